@@ -3,20 +3,39 @@ package configs
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	Redis    RedisConfig    `yaml:"redis,omitempty"`
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Redis     RedisConfig     `yaml:"redis,omitempty"`
+	Checker   CheckerConfig   `yaml:"checker"`
+	Blocklist BlocklistConfig `yaml:"blocklist"`
+	Resolver  ResolverConfig  `yaml:"resolver"`
+	Reserved  ReservedConfig  `yaml:"reserved"`
+	Analytics AnalyticsConfig `yaml:"analytics"`
+	Webhook   WebhookConfig   `yaml:"webhook"`
+	Privacy   PrivacyConfig   `yaml:"privacy"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	QrCode    QrCodeConfig    `yaml:"qrcode"`
+	BlobStore BlobStoreConfig `yaml:"blobstore"`
 }
 
 type ServerConfig struct {
-	Host    string `yaml:"host"`
-	Port    string `yaml:"port"`
-	BaseURL string `yaml:"base_url"`
+	Host         string   `yaml:"host"`
+	Port         string   `yaml:"port"`
+	BaseURL      string   `yaml:"base_url"`
+	AliasDomains []string `yaml:"alias_domains"`
+	AdminToken   string   `yaml:"admin_token"`
+
+	// TrustedProxies are the CIDRs whose X-Forwarded-For is believed; without any, the peer address is the client
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 type DatabaseConfig struct {
@@ -35,6 +54,134 @@ type RedisConfig struct {
 	DB       string `yaml:"db,omitempty"`
 }
 
+// CheckerConfig controls the background link-rot checker
+type CheckerConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	Interval        time.Duration `yaml:"interval"`
+	RecheckAfter    time.Duration `yaml:"recheck_after"`
+	Timeout         time.Duration `yaml:"timeout"`
+	Concurrency     int           `yaml:"concurrency"`
+	PerHostDelay    time.Duration `yaml:"per_host_delay"`
+	BatchSize       int           `yaml:"batch_size"`
+	BrokenThreshold int           `yaml:"broken_threshold"`
+	MaxRedirects    int           `yaml:"max_redirects"`
+}
+
+// BlocklistConfig points at an optional rule file loaded next to the database rules
+type BlocklistConfig struct {
+	FilePath string `yaml:"file_path"`
+}
+
+// ResolverConfig controls how links to third-party shorteners are unwrapped
+type ResolverConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	ShortenerDomains []string      `yaml:"shortener_domains"`
+	MaxHops          int           `yaml:"max_hops"`
+	Timeout          time.Duration `yaml:"timeout"`
+}
+
+// ReservedConfig lists words that may never appear inside a short code, on top of route names
+type ReservedConfig struct {
+	Words    []string `yaml:"words"`
+	FilePath string   `yaml:"file_path"`
+}
+
+// AnalyticsConfig controls how click events are captured and stored
+type AnalyticsConfig struct {
+	IPHashSalt           string        `yaml:"ip_hash_salt"`
+	CountryHeader        string        `yaml:"country_header"`
+	PartitionMonthsAhead int           `yaml:"partition_months_ahead"`
+	RollupInterval       time.Duration `yaml:"rollup_interval"`
+	RawSeriesMaxRange    time.Duration `yaml:"raw_series_max_range"`
+	MaxSeriesBuckets     int           `yaml:"max_series_buckets"`
+	BotIPRangesFile      string        `yaml:"bot_ip_ranges_file"`
+	QueueSize            int           `yaml:"queue_size"`
+	QueuePolicy          string        `yaml:"queue_policy"`
+	EnqueueTimeout       time.Duration `yaml:"enqueue_timeout"`
+	Workers              int           `yaml:"workers"`
+	BatchSize            int           `yaml:"batch_size"`
+	FlushInterval        time.Duration `yaml:"flush_interval"`
+	LeaderboardRefresh   time.Duration `yaml:"leaderboard_refresh"`
+	TrendingMinClicks    int           `yaml:"trending_min_clicks"`
+	LiveBufferSize       int           `yaml:"live_buffer_size"`
+	LiveCounterInterval  time.Duration `yaml:"live_counter_interval"`
+}
+
+// WebhookConfig controls how outgoing webhook deliveries are sent and retried
+type WebhookConfig struct {
+	PollInterval    time.Duration `yaml:"poll_interval"`
+	Timeout         time.Duration `yaml:"timeout"`
+	Concurrency     int           `yaml:"concurrency"`
+	BatchSize       int           `yaml:"batch_size"`
+	MaxAttempts     int           `yaml:"max_attempts"`
+	RetryBaseDelay  time.Duration `yaml:"retry_base_delay"`
+	RetryMaxDelay   time.Duration `yaml:"retry_max_delay"`
+	ClickSampleRate float64       `yaml:"click_sample_rate"`
+	ClickThresholds []int         `yaml:"click_thresholds"`
+}
+
+// PrivacyConfig controls how much is kept about the people who click links, and for how long
+type PrivacyConfig struct {
+	IPTruncation      string        `yaml:"ip_truncation"`
+	IPStorage         string        `yaml:"ip_storage"`
+	DailySalt         bool          `yaml:"daily_salt"`
+	HonorDoNotTrack   bool          `yaml:"honor_do_not_track"`
+	RetentionDays     int           `yaml:"retention_days"`
+	RetentionMode     string        `yaml:"retention_mode"`
+	RetentionInterval time.Duration `yaml:"retention_interval"`
+}
+
+// MetricsConfig exposes Prometheus metrics at /metrics, optionally behind a bearer token
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Token   string `yaml:"token"`
+}
+
+// TracingConfig exports OpenTelemetry spans over OTLP/HTTP or to stdout
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// QrCodeConfig limits workspace logos and how much of a QR code they may cover, how rendered images
+// are cached in memory and by clients, how many codes one printable sheet may hold and how large an
+// uploaded proof may be
+type QrCodeConfig struct {
+	LogoMaxBytes     int           `yaml:"logo_max_bytes"`
+	LogoMaxDimension int           `yaml:"logo_max_dimension"`
+	LogoMaxArea      int           `yaml:"logo_max_area"`
+	CacheEntries     int           `yaml:"cache_entries"`
+	CacheMaxBytes    int           `yaml:"cache_max_bytes"`
+	MaxAge           time.Duration `yaml:"max_age"`
+	SheetMaxCodes    int           `yaml:"sheet_max_codes"`
+	DecodeMaxBytes   int           `yaml:"decode_max_bytes"`
+	DecodeMaxPixels  int           `yaml:"decode_max_pixels"`
+}
+
+// BlobStoreConfig picks where logos, QR images and exports are kept: fs, memory or s3. SigningKey signs the
+// download URLs the application serves for fs and memory; S3 presigns its own.
+type BlobStoreConfig struct {
+	Backend     string        `yaml:"backend"`
+	Dir         string        `yaml:"dir"`
+	SigningKey  string        `yaml:"signing_key"`
+	URLExpiry   time.Duration `yaml:"url_expiry"`
+	S3Endpoint  string        `yaml:"s3_endpoint"`
+	S3Region    string        `yaml:"s3_region"`
+	S3Bucket    string        `yaml:"s3_bucket"`
+	S3AccessKey string        `yaml:"s3_access_key"`
+	S3SecretKey string        `yaml:"s3_secret_key"`
+	S3UseSSL    bool          `yaml:"s3_use_ssl"`
+}
+
+var defaultShortenerDomains = []string{
+	"bit.ly", "bitly.com", "t.co", "tinyurl.com", "goo.gl", "ow.ly", "is.gd",
+	"buff.ly", "rebrand.ly", "cutt.ly", "tiny.cc", "shorturl.at", "rb.gy", "lnkd.in",
+}
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig(envPath string) (*Config, error) {
 
@@ -45,9 +192,13 @@ func LoadConfig(envPath string) (*Config, error) {
 
 	return &Config{
 		Server: ServerConfig{
-			Host:    os.Getenv("SERVER_HOST"),
-			Port:    os.Getenv("SERVER_PORT"),
-			BaseURL: os.Getenv("API_BASE_URL"),
+			Host:         os.Getenv("SERVER_HOST"),
+			Port:         os.Getenv("SERVER_PORT"),
+			BaseURL:      os.Getenv("API_BASE_URL"),
+			AliasDomains: getEnvList("API_ALIAS_DOMAINS", nil),
+			AdminToken:   os.Getenv("ADMIN_TOKEN"),
+
+			TrustedProxies: getEnvList("SERVER_TRUSTED_PROXIES", nil),
 		},
 		Database: DatabaseConfig{
 			Host:     os.Getenv("DB_HOST"),
@@ -63,12 +214,174 @@ func LoadConfig(envPath string) (*Config, error) {
 			Password: os.Getenv("REDIS_PASSWORD"),
 			DB:       os.Getenv("REDIS_DB"),
 		},
+		Checker: CheckerConfig{
+			Enabled:         getEnvBool("CHECKER_ENABLED", true),
+			Interval:        getEnvDuration("CHECKER_INTERVAL", time.Minute*10),
+			RecheckAfter:    getEnvDuration("CHECKER_RECHECK_AFTER", time.Hour*6),
+			Timeout:         getEnvDuration("CHECKER_TIMEOUT", time.Second*10),
+			Concurrency:     getEnvInt("CHECKER_CONCURRENCY", 8),
+			PerHostDelay:    getEnvDuration("CHECKER_PER_HOST_DELAY", time.Second*2),
+			BatchSize:       getEnvInt("CHECKER_BATCH_SIZE", 200),
+			BrokenThreshold: getEnvInt("CHECKER_BROKEN_THRESHOLD", 3),
+			MaxRedirects:    getEnvInt("CHECKER_MAX_REDIRECTS", 10),
+		},
+		Blocklist: BlocklistConfig{
+			FilePath: os.Getenv("BLOCKLIST_FILE"),
+		},
+		Resolver: ResolverConfig{
+			Enabled:          getEnvBool("SHORTENER_RESOLVE_ENABLED", true),
+			ShortenerDomains: getEnvList("SHORTENER_DOMAINS", defaultShortenerDomains),
+			MaxHops:          getEnvInt("SHORTENER_MAX_HOPS", 5),
+			Timeout:          getEnvDuration("SHORTENER_TIMEOUT", time.Second*5),
+		},
+		Reserved: ReservedConfig{
+			Words:    getEnvList("RESERVED_WORDS", nil),
+			FilePath: os.Getenv("RESERVED_WORDS_FILE"),
+		},
+		Analytics: AnalyticsConfig{
+			IPHashSalt:           os.Getenv("ANALYTICS_IP_HASH_SALT"),
+			CountryHeader:        getEnv("ANALYTICS_COUNTRY_HEADER", "CF-IPCountry"),
+			PartitionMonthsAhead: getEnvInt("ANALYTICS_PARTITION_MONTHS_AHEAD", 3),
+			RollupInterval:       getEnvDuration("ANALYTICS_ROLLUP_INTERVAL", time.Minute*5),
+			RawSeriesMaxRange:    getEnvDuration("ANALYTICS_RAW_SERIES_MAX_RANGE", time.Hour*48),
+			MaxSeriesBuckets:     getEnvInt("ANALYTICS_MAX_SERIES_BUCKETS", 5000),
+			BotIPRangesFile:      os.Getenv("ANALYTICS_BOT_IP_RANGES_FILE"),
+			QueueSize:            getEnvInt("ANALYTICS_QUEUE_SIZE", 10000),
+			QueuePolicy:          getEnv("ANALYTICS_QUEUE_POLICY", "drop"),
+			EnqueueTimeout:       getEnvDuration("ANALYTICS_ENQUEUE_TIMEOUT", time.Millisecond*20),
+			Workers:              getEnvInt("ANALYTICS_WORKERS", 2),
+			BatchSize:            getEnvInt("ANALYTICS_BATCH_SIZE", 500),
+			FlushInterval:        getEnvDuration("ANALYTICS_FLUSH_INTERVAL", time.Second),
+			LeaderboardRefresh:   getEnvDuration("ANALYTICS_LEADERBOARD_REFRESH", time.Minute),
+			TrendingMinClicks:    getEnvInt("ANALYTICS_TRENDING_MIN_CLICKS", 10),
+			LiveBufferSize:       getEnvInt("ANALYTICS_LIVE_BUFFER_SIZE", 64),
+			LiveCounterInterval:  getEnvDuration("ANALYTICS_LIVE_COUNTER_INTERVAL", time.Second*5),
+		},
+		Webhook: WebhookConfig{
+			PollInterval:    getEnvDuration("WEBHOOK_POLL_INTERVAL", time.Second*5),
+			Timeout:         getEnvDuration("WEBHOOK_TIMEOUT", time.Second*10),
+			Concurrency:     getEnvInt("WEBHOOK_CONCURRENCY", 4),
+			BatchSize:       getEnvInt("WEBHOOK_BATCH_SIZE", 50),
+			MaxAttempts:     getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+			RetryBaseDelay:  getEnvDuration("WEBHOOK_RETRY_BASE_DELAY", time.Second*30),
+			RetryMaxDelay:   getEnvDuration("WEBHOOK_RETRY_MAX_DELAY", time.Hour*6),
+			ClickSampleRate: getEnvFloat("WEBHOOK_CLICK_SAMPLE_RATE", 0.1),
+			ClickThresholds: getEnvIntList("WEBHOOK_CLICK_THRESHOLDS", []int{100, 1000, 10000, 100000}),
+		},
+		Privacy: PrivacyConfig{
+			IPTruncation:      getEnv("PRIVACY_IP_TRUNCATION", "partial"),
+			IPStorage:         getEnv("PRIVACY_IP_STORAGE", "hashed"),
+			DailySalt:         getEnvBool("PRIVACY_DAILY_SALT", true),
+			HonorDoNotTrack:   getEnvBool("PRIVACY_HONOR_DNT", true),
+			RetentionDays:     getEnvInt("PRIVACY_RETENTION_DAYS", 90),
+			RetentionMode:     getEnv("PRIVACY_RETENTION_MODE", "aggregate"),
+			RetentionInterval: getEnvDuration("PRIVACY_RETENTION_INTERVAL", time.Hour*6),
+		},
+		Metrics: MetricsConfig{
+			Enabled: getEnvBool("METRICS_ENABLED", true),
+			Token:   os.Getenv("METRICS_TOKEN"),
+		},
+		Tracing: TracingConfig{
+			Enabled:     getEnvBool("TRACING_ENABLED", false),
+			Exporter:    getEnv("TRACING_EXPORTER", "otlp"),
+			Endpoint:    os.Getenv("TRACING_ENDPOINT"),
+			Insecure:    getEnvBool("TRACING_INSECURE", false),
+			ServiceName: getEnv("TRACING_SERVICE_NAME", "shorten-url"),
+			SampleRatio: getEnvFloat("TRACING_SAMPLE_RATIO", 1),
+		},
+		QrCode: QrCodeConfig{
+			LogoMaxBytes:     getEnvInt("QRCODE_LOGO_MAX_BYTES", 1<<20),
+			LogoMaxDimension: getEnvInt("QRCODE_LOGO_MAX_DIMENSION", 1024),
+			LogoMaxArea:      getEnvInt("QRCODE_LOGO_MAX_AREA", 15),
+			CacheEntries:     getEnvInt("QRCODE_CACHE_ENTRIES", 512),
+			CacheMaxBytes:    getEnvInt("QRCODE_CACHE_MAX_BYTES", 64<<20),
+			MaxAge:           getEnvDuration("QRCODE_MAX_AGE", time.Hour*24),
+			SheetMaxCodes:    getEnvInt("QRCODE_SHEET_MAX_CODES", 1000),
+			DecodeMaxBytes:   getEnvInt("QRCODE_DECODE_MAX_BYTES", 10<<20),
+			DecodeMaxPixels:  getEnvInt("QRCODE_DECODE_MAX_PIXELS", 40_000_000),
+		},
+		BlobStore: BlobStoreConfig{
+			Backend:     getEnv("BLOBSTORE_BACKEND", "fs"),
+			Dir:         getEnv("BLOBSTORE_DIR", "data/blobs"),
+			SigningKey:  os.Getenv("BLOBSTORE_SIGNING_KEY"),
+			URLExpiry:   getEnvDuration("BLOBSTORE_URL_EXPIRY", time.Minute*15),
+			S3Endpoint:  getEnv("BLOBSTORE_S3_ENDPOINT", "localhost:9000"),
+			S3Region:    getEnv("BLOBSTORE_S3_REGION", "us-east-1"),
+			S3Bucket:    getEnv("BLOBSTORE_S3_BUCKET", "shorten-url"),
+			S3AccessKey: os.Getenv("BLOBSTORE_S3_ACCESS_KEY"),
+			S3SecretKey: os.Getenv("BLOBSTORE_S3_SECRET_KEY"),
+			S3UseSSL:    getEnvBool("BLOBSTORE_S3_USE_SSL", false),
+		},
 	}, nil
 }
 
-// func getEnv(key, defaultValue string) string {
-// 	if value := os.Getenv(key); value != "" {
-// 		return value
-// 	}
-// 	return defaultValue
-// }
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvList(key string, defaultValue []string) []string {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue
+	}
+
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnvIntList(key string, defaultValue []int) []int {
+	items := getEnvList(key, nil)
+	if items == nil {
+		return defaultValue
+	}
+
+	values := make([]int, 0, len(items))
+	for _, item := range items {
+		value, err := strconv.Atoi(item)
+		if err != nil {
+			return defaultValue
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -30,5 +30,236 @@ IF NOT EXISTS qrcode
     click_count  INTEGER DEFAULT 0,
     created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-)
+);
+
+CREATE TABLE
+IF NOT EXISTS url_health
+(
+    url_id               INTEGER PRIMARY KEY REFERENCES urls(id) ON DELETE CASCADE,
+    status_code          INTEGER,
+    latency_ms           INTEGER,
+    final_url            TEXT,
+    last_error           TEXT,
+    consecutive_failures INTEGER DEFAULT 0,
+    is_broken            BOOLEAN DEFAULT FALSE,
+    last_checked_at      TIMESTAMP
+);
+
+CREATE INDEX
+IF NOT EXISTS idx_url_health_is_broken ON url_health
+(is_broken);
+
+CREATE TABLE
+IF NOT EXISTS blocklist_rules
+(
+    id         SERIAL PRIMARY KEY,
+    kind       VARCHAR(16) NOT NULL,
+    pattern    TEXT NOT NULL,
+    reason     TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (kind, pattern)
+);
+
+-- Raw click events, range partitioned by month. Monthly partitions are created
+-- ahead of time by the application; the default partition only catches strays.
+CREATE TABLE
+IF NOT EXISTS click_events
+(
+    id         BIGSERIAL,
+    url_id     INTEGER NOT NULL,
+    clicked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    referrer   TEXT,
+    user_agent TEXT,
+    ip_hash    VARCHAR(64),
+    country    VARCHAR(2),
+    device     VARCHAR(16),
+    source     VARCHAR(16) NOT NULL DEFAULT 'direct',
+    PRIMARY KEY (id, clicked_at)
+) PARTITION BY RANGE (clicked_at);
+
+CREATE TABLE
+IF NOT EXISTS click_events_default PARTITION OF click_events DEFAULT;
+
+CREATE INDEX
+IF NOT EXISTS idx_click_events_url_id_clicked_at ON click_events
+(url_id, clicked_at);
+
+ALTER TABLE urls ALTER COLUMN click_count SET DEFAULT 0;
+
+-- Hourly click totals (UTC hours) used for long time-series ranges
+CREATE TABLE
+IF NOT EXISTS click_rollups_hourly
+(
+    url_id INTEGER NOT NULL,
+    bucket TIMESTAMP NOT NULL,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, bucket)
+);
+
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS referrer_host VARCHAR(255);
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS browser VARCHAR(64);
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS os VARCHAR(64);
+
+-- Daily HyperLogLog sketches of salted visitor hashes; merged for unique visitor counts over any range
+CREATE TABLE
+IF NOT EXISTS click_visitor_sketches
+(
+    url_id INTEGER NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    day    DATE NOT NULL,
+    sketch BYTEA NOT NULL,
+    PRIMARY KEY (url_id, day)
+);
+
+-- Crawlers, unfurlers and prefetches are kept for auditing but excluded from stats by default
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE click_rollups_hourly ADD COLUMN IF NOT EXISTS bot_clicks BIGINT NOT NULL DEFAULT 0;
+
+-- Outgoing webhooks. Every event is written to the delivery log before it is sent,
+-- so deliveries survive restarts and can be retried or replayed from the log.
+CREATE TABLE
+IF NOT EXISTS webhook_endpoints
+(
+    id         SERIAL PRIMARY KEY,
+    url        TEXT NOT NULL,
+    secret     VARCHAR(128) NOT NULL,
+    events     TEXT[] NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE
+IF NOT EXISTS webhook_deliveries
+(
+    id               BIGSERIAL PRIMARY KEY,
+    endpoint_id      INTEGER NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id         VARCHAR(64) NOT NULL,
+    event_type       VARCHAR(64) NOT NULL,
+    payload          JSONB NOT NULL,
+    status           VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMP NOT NULL,
+    last_attempt_at  TIMESTAMP,
+    last_status_code INTEGER,
+    last_error       TEXT,
+    replay_of        BIGINT,
+    created_at       TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX
+IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries
+(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX
+IF NOT EXISTS idx_webhook_deliveries_endpoint_id ON webhook_deliveries
+(endpoint_id, id);
+
+-- Privacy. Addresses are stored only when configured to; otherwise clicks keep a salted hash or nothing.
+-- Visitor salts rotate daily and are shared by every instance, then deleted so old hashes cannot be linked.
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS ip VARCHAR(45);
+
+CREATE INDEX
+IF NOT EXISTS idx_click_events_clicked_at ON click_events
+(clicked_at);
+
+CREATE TABLE
+IF NOT EXISTS click_daily_salts
+(
+    day  DATE PRIMARY KEY,
+    salt BYTEA NOT NULL
+);
+
+-- Totals of purged days come from the hourly rollups, which are settled before raw events are deleted
+DROP TABLE IF EXISTS click_purged_totals;
+
+-- Raw events past the retention period are folded into these before they are deleted,
+-- so breakdowns still cover the purged days
+CREATE TABLE
+IF NOT EXISTS click_dimension_daily
+(
+    url_id     INTEGER NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    day        DATE NOT NULL,
+    dimension  VARCHAR(16) NOT NULL,
+    value      VARCHAR(255) NOT NULL,
+    clicks     BIGINT NOT NULL DEFAULT 0,
+    bot_clicks BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, day, dimension, value)
+);
+
+-- QR codes belong to a short link: one canonical code per link, removed with it.
+-- Rows from before the link existed are attached by short code where possible. The rest keep a NULL url_id rather
+-- than being deleted: no lookup reaches them, and the unique index still admits any number of NULLs.
+ALTER TABLE qrcode ADD COLUMN IF NOT EXISTS url_id INTEGER REFERENCES urls(id) ON DELETE CASCADE;
+
+UPDATE qrcode SET url_id = latest.url_id
+FROM (
+    SELECT DISTINCT ON (u.id) q.id, u.id AS url_id
+    FROM qrcode q
+    JOIN urls u ON u.short_code = q.original_url
+    WHERE q.url_id IS NULL AND NOT EXISTS (SELECT 1 FROM qrcode bound WHERE bound.url_id = u.id)
+    ORDER BY u.id, q.updated_at DESC
+) latest
+WHERE qrcode.id = latest.id;
+
+CREATE UNIQUE INDEX
+IF NOT EXISTS idx_qrcode_url_id ON qrcode
+(url_id);
+
+-- Brand logos composited into the QR codes of a workspace
+CREATE TABLE
+IF NOT EXISTS workspace_logos
+(
+    workspace  VARCHAR(64) PRIMARY KEY,
+    image      BYTEA NOT NULL,
+    width      INTEGER NOT NULL,
+    height     INTEGER NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Logo bytes now live in the blob store; rows written before keep theirs in image until the logo is uploaded again
+ALTER TABLE workspace_logos ADD COLUMN IF NOT EXISTS image_key VARCHAR(255);
+ALTER TABLE workspace_logos ALTER COLUMN image DROP NOT NULL;
+
+-- QR codes encode /q/<scan_code> rather than the short link, so a printed code can be moved to another link.
+-- The code is random rather than the row id, which would let anyone walk every link that has a QR code. It is not a
+-- secret, since it is printed in every copy of the code, which is why moving a code is an admin action.
+ALTER TABLE qrcode ADD COLUMN IF NOT EXISTS scan_code VARCHAR(16);
+UPDATE qrcode SET scan_code = substr(md5(random()::text || id::text), 1, 10) WHERE scan_code IS NULL;
+ALTER TABLE qrcode ALTER COLUMN scan_code SET NOT NULL;
+ALTER TABLE qrcode ALTER COLUMN click_count SET DEFAULT 0;
+
+CREATE UNIQUE INDEX
+IF NOT EXISTS idx_qrcode_scan_code ON qrcode
+(scan_code);
+
+-- A link may belong to one campaign, e.g. the event its codes are printed for, so they can be selected together
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS campaign VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX
+IF NOT EXISTS idx_urls_campaign ON urls
+(campaign, created_at) WHERE campaign <> '';
+
+-- Every hourly rollup before rolled_up_to is complete. The rollup worker resumes from here after an outage and
+-- retention never purges raw events past it. It starts at the oldest raw event, so hours missed before it existed
+-- are rolled up on the first run.
+CREATE TABLE
+IF NOT EXISTS click_rollup_progress
+(
+    id           BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    rolled_up_to TIMESTAMP NOT NULL
+);
+
+INSERT INTO click_rollup_progress (rolled_up_to)
+SELECT COALESCE(date_trunc('hour', MIN(clicked_at)), date_trunc('hour', now() AT TIME ZONE 'UTC'))
+FROM click_events
+ON CONFLICT (id) DO NOTHING;
 
+-- Rollups go with their link. Raw events are deleted with the link explicitly, since a foreign key on the
+-- partitioned events table would be checked on every click; rollups are only built for links that still exist.
+-- Whatever links deleted before this left behind is cleared once, as the key is added.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'click_rollups_hourly_url_id_fkey') THEN
+        DELETE FROM click_rollups_hourly r WHERE NOT EXISTS (SELECT 1 FROM urls WHERE urls.id = r.url_id);
+        DELETE FROM click_events e WHERE NOT EXISTS (SELECT 1 FROM urls WHERE urls.id = e.url_id);
+        ALTER TABLE click_rollups_hourly
+            ADD CONSTRAINT click_rollups_hourly_url_id_fkey FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE;
+    END IF;
+END $$;
@@ -0,0 +1,18 @@
+package entities
+
+import "time"
+
+type CreateBlocklistRuleReq struct {
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern"`
+	Reason  string `json:"reason"`
+}
+
+type BlocklistRuleRes struct {
+	Id        uint      `json:"id"`
+	Kind      string    `json:"kind"`
+	Pattern   string    `json:"pattern"`
+	Reason    string    `json:"reason"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
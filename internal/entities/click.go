@@ -0,0 +1,50 @@
+package entities
+
+import "time"
+
+// ClickInfo is the request metadata captured when a short link is followed
+type ClickInfo struct {
+	Referrer  string
+	UserAgent string
+	IP        string
+	Country   string
+	Source    string
+	Method    string
+	// Purpose is the prefetch hint sent by browsers and link previewers, e.g. Sec-Purpose: prefetch
+	Purpose string
+	// DoNotTrack is set when the browser sent DNT: 1 or Sec-GPC: 1
+	DoNotTrack bool
+}
+
+type ClickPipelineStatsRes struct {
+	Queued   int    `json:"queued"`
+	Capacity int    `json:"capacity"`
+	Policy   string `json:"policy"`
+	Accepted uint64 `json:"accepted"`
+	Dropped  uint64 `json:"dropped"`
+	Written  uint64 `json:"written"`
+	Failed   uint64 `json:"failed"`
+}
+
+type LiveClickRes struct {
+	ShortCode string    `json:"short_code"`
+	ClickedAt time.Time `json:"clicked_at"`
+	Country   string    `json:"country"`
+	Device    string    `json:"device"`
+	Referrer  string    `json:"referrer"`
+	Source    string    `json:"source"`
+}
+
+type LiveCountersRes struct {
+	At              time.Time `json:"at"`
+	LastMinute      int       `json:"last_minute"`
+	LastFiveMinutes int       `json:"last_five_minutes"`
+	Subscribers     int       `json:"subscribers"`
+}
+
+// StoredExportRes points at an export kept in the blob store; URL stops working at ExpiresAt, the export itself stays
+type StoredExportRes struct {
+	Key       string    `json:"key"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -25,30 +25,236 @@ type CreateShortenUrlRes struct {
 	Id          string    `json:"id"`
 	ShortUrl    string    `json:"short_url"`
 	OriginalURL string    `json:"original_url"`
+	Campaign    string    `json:"campaign,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+// CreateShortenUrlReq creates a link; Campaign groups it with others, e.g. to print their codes on one sheet
 type CreateShortenUrlReq struct {
 	OriginalUrl string `json:"original_url"`
+	CustomAlias string `json:"custom_alias"`
+	Campaign    string `json:"campaign"`
+}
+
+// QrCodeReq holds the rendering options; anything left out takes its default
+type QrCodeReq struct {
+	Size       int    `query:"size"`
+	Level      string `query:"level"`
+	Margin     *int   `query:"margin"`
+	Foreground string `query:"fg"`
+	Background string `query:"bg"`
+	Format     string `query:"format"`
+	Workspace  string `query:"workspace"`
+	LogoSize   int    `query:"logo_size"`
+	Frame      string `query:"frame"`
+	Caption    string `query:"caption"`
 }
 
-type CreateQrCodeRes struct {
+type WorkspaceLogoRes struct {
+	Workspace string    `json:"workspace"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// QrCodeRes describes a link's QR code. The code encodes ScanURL, which redirects to the link and counts
+// the scan, so it keeps working when the code is moved to another link.
+type QrCodeRes struct {
 	Id          string    `json:"id"`
+	ShortCode   string    `json:"short_code"`
+	ShortUrl    string    `json:"short_url"`
 	OriginalURL string    `json:"original_url"`
 	QrCodeURL   string    `json:"qrcode_url"`
+	ScanCode    string    `json:"scan_code"`
+	ScanURL     string    `json:"scan_url"`
+	Scans       int       `json:"scans"`
+	Format      string    `json:"format"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
-type CreateQrcodeReq struct {
-	OriginalUrl string `json:"original_url"`
+// RetargetQrCodeReq moves a printed QR code to another link
+type RetargetQrCodeReq struct {
+	ShortCode string `json:"short_code"`
+}
+
+// QrCodeSheetReq lays out a printable PDF of many codes; anything left out takes its default.
+// The codes are either ShortCodes, in that order, or every link of Campaign, oldest first.
+// LabelSize is the side of each code in millimetres, Caption is full, short_url or none.
+type QrCodeSheetReq struct {
+	ShortCodes []string `json:"short_codes"`
+	Campaign   string   `json:"campaign"`
+	PageSize   string   `json:"page_size"`
+	Columns    int      `json:"columns"`
+	Rows       int      `json:"rows"`
+	LabelSize  float64  `json:"label_size"`
+	Caption    string   `json:"caption"`
+	Level      string   `json:"level"`
 }
 
+// QrCodeDecodeRes lists the QR codes read from an uploaded image
+type QrCodeDecodeRes struct {
+	Codes []DecodedQrCodeRes `json:"codes"`
+}
+
+// DecodedQrCodeRes is one code read from an image. Ours is set when Text is one of our short URLs or scan
+// URLs; Status is then active, disabled, broken or not_found, and the rest says where the code leads today.
+type DecodedQrCodeRes struct {
+	Text        string `json:"text"`
+	Ours        bool   `json:"ours"`
+	ShortCode   string `json:"short_code,omitempty"`
+	ScanCode    string `json:"scan_code,omitempty"`
+	ShortUrl    string `json:"short_url,omitempty"`
+	OriginalURL string `json:"original_url,omitempty"`
+	Status      string `json:"status,omitempty"`
+}
+
+// QrCodeImageRes is a rendered QR image; Data is left empty when the client's copy is still current
+type QrCodeImageRes struct {
+	ContentType string
+	FileName    string
+	ETag        string
+	NotModified bool
+	Data        []byte
+}
+
+// UrlStaticRes is a link's stats. UniqueVisitors covers the series range, or the last 30 days without one,
+// starting at UniqueVisitorsSince. With daily salts (privacy.daily_salt) visitors cannot be matched across
+// days, so over more than one day it counts visitor-days: someone who came on three days counts three times.
 type UrlStaticRes struct {
-	Id          string    `json:"id"`
-	Url         string    `json:"url"`
-	ShortCode   string    `json:"shortCode"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
-	AccessCount int       `json:"accessCount"`
+	Id                  string          `json:"id"`
+	Url                 string          `json:"url"`
+	ShortCode           string          `json:"shortCode"`
+	CreatedAt           time.Time       `json:"createdAt"`
+	UpdatedAt           time.Time       `json:"updatedAt"`
+	AccessCount         int             `json:"accessCount"`
+	UniqueVisitors      int             `json:"uniqueVisitors"`
+	UniqueVisitorsSince time.Time       `json:"uniqueVisitorsSince"`
+	IncludesBots        bool            `json:"includesBots"`
+	Health              *LinkHealthRes  `json:"health,omitempty"`
+	Series              *ClickSeriesRes `json:"series,omitempty"`
+}
+
+type UrlStaticReq struct {
+	From        string `query:"from"`
+	To          string `query:"to"`
+	Interval    string `query:"interval"`
+	TZ          string `query:"tz"`
+	IncludeBots bool   `query:"include_bots"`
+}
+
+type ClickSeriesRes struct {
+	From           time.Time               `json:"from"`
+	To             time.Time               `json:"to"`
+	Interval       string                  `json:"interval"`
+	Timezone       string                  `json:"timezone"`
+	Source         string                  `json:"source"`
+	Total          int                     `json:"total"`
+	UniqueVisitors int                     `json:"uniqueVisitors"`
+	Buckets        []*ClickSeriesBucketRes `json:"buckets"`
+}
+
+type ClickSeriesBucketRes struct {
+	Start  time.Time `json:"start"`
+	Clicks int       `json:"clicks"`
+	// Unique visitors are only known per UTC day, so finer intervals leave it out
+	UniqueVisitors *int `json:"uniqueVisitors,omitempty"`
+}
+
+type LinkHealthRes struct {
+	StatusCode          int       `json:"statusCode"`
+	LatencyMs           int64     `json:"latencyMs"`
+	FinalURL            string    `json:"finalUrl"`
+	LastError           string    `json:"lastError,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	IsBroken            bool      `json:"isBroken"`
+	LastCheckedAt       time.Time `json:"lastCheckedAt"`
+}
+
+type BrokenLinkRes struct {
+	Id          string         `json:"id"`
+	ShortCode   string         `json:"short_code"`
+	OriginalURL string         `json:"original_url"`
+	Health      *LinkHealthRes `json:"health"`
+}
+
+type ReservedConflictRes struct {
+	Id          string `json:"id"`
+	ShortCode   string `json:"short_code"`
+	OriginalURL string `json:"original_url"`
+	Reserved    string `json:"reserved"`
+}
+
+type ClickBreakdownReq struct {
+	From        string `query:"from"`
+	To          string `query:"to"`
+	TZ          string `query:"tz"`
+	Limit       int    `query:"limit"`
+	IncludeBots bool   `query:"include_bots"`
+}
+
+type ClickBreakdownRes struct {
+	Dimension string                   `json:"dimension"`
+	From      time.Time                `json:"from"`
+	To        time.Time                `json:"to"`
+	Total     int                      `json:"total"`
+	Items     []*ClickBreakdownItemRes `json:"items"`
+}
+
+type ClickBreakdownItemRes struct {
+	Name   string  `json:"name"`
+	Clicks int     `json:"clicks"`
+	Share  float64 `json:"share"`
+}
+
+type ClickExportReq struct {
+	Format      string `query:"format"`
+	From        string `query:"from"`
+	To          string `query:"to"`
+	TZ          string `query:"tz"`
+	Interval    string `query:"interval"`
+	IncludeBots bool   `query:"include_bots"`
+}
+
+type ClickExportEventRes struct {
+	ShortCode    string    `json:"short_code"`
+	ClickedAt    time.Time `json:"clicked_at"`
+	Source       string    `json:"source"`
+	Referrer     string    `json:"referrer"`
+	ReferrerHost string    `json:"referrer_host"`
+	Browser      string    `json:"browser"`
+	OS           string    `json:"os"`
+	Device       string    `json:"device"`
+	Country      string    `json:"country"`
+	IsBot        bool      `json:"is_bot"`
+}
+
+type ClickExportBucketRes struct {
+	ShortCode string    `json:"short_code"`
+	Start     time.Time `json:"start"`
+	Clicks    int       `json:"clicks"`
+}
+
+type TopLinksReq struct {
+	Window string `query:"window"`
+	Limit  int    `query:"limit"`
+}
+
+type TopLinksRes struct {
+	Window      string        `json:"window"`
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	GeneratedAt time.Time     `json:"generated_at"`
+	Top         []*TopLinkRes `json:"top"`
+	Trending    []*TopLinkRes `json:"trending"`
+}
+
+type TopLinkRes struct {
+	Id             string  `json:"id"`
+	ShortCode      string  `json:"short_code"`
+	OriginalURL    string  `json:"original_url"`
+	Clicks         int     `json:"clicks"`
+	PreviousClicks int     `json:"previous_clicks"`
+	Growth         float64 `json:"growth"`
 }
@@ -0,0 +1,74 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type CreateWebhookEndpointReq struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// WebhookEndpointRes carries the signing secret only in the response that created the endpoint
+type WebhookEndpointRes struct {
+	Id        uint      `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDeliveriesReq struct {
+	Status string `query:"status"`
+	Limit  int    `query:"limit"`
+}
+
+type WebhookDeliveryRes struct {
+	Id             int64           `json:"id"`
+	EndpointId     uint            `json:"endpoint_id"`
+	EventId        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	ReplayOf       *int64          `json:"replay_of,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// WebhookEventRes is the body posted to webhook endpoints
+type WebhookEventRes struct {
+	Id        string               `json:"id"`
+	Type      string               `json:"type"`
+	CreatedAt time.Time            `json:"created_at"`
+	Data      *WebhookEventDataRes `json:"data"`
+}
+
+type WebhookEventDataRes struct {
+	Link      *WebhookLinkRes  `json:"link"`
+	Click     *WebhookClickRes `json:"click,omitempty"`
+	Threshold int              `json:"threshold,omitempty"`
+}
+
+type WebhookLinkRes struct {
+	Id          string    `json:"id"`
+	ShortCode   string    `json:"short_code"`
+	ShortUrl    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	ClickCount  int       `json:"click_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookClickRes describes a click without anything that identifies the visitor
+type WebhookClickRes struct {
+	ClickedAt time.Time `json:"clicked_at"`
+	Referrer  string    `json:"referrer"`
+	Country   string    `json:"country"`
+	Device    string    `json:"device"`
+	Source    string    `json:"source"`
+}
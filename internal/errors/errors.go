@@ -8,6 +8,7 @@ var (
 	ErrInvalidInput = errors.New("invalid input")
 	ErrInternal     = errors.New("internal server error")
 	ErrConflict     = errors.New("resource already exists")
+	ErrForbidden    = errors.New("forbidden")
 )
 
 // Error types for checking
@@ -18,6 +19,7 @@ const (
 	InvalidInput ErrorType = "INVALID_INPUT"
 	Internal     ErrorType = "INTERNAL"
 	Conflict     ErrorType = "CONFLICT"
+	Forbidden    ErrorType = "FORBIDDEN"
 )
 
 // AppError represents application error with type
@@ -63,3 +65,10 @@ func NewConflictError(message string) *AppError {
 		Message: message,
 	}
 }
+
+func NewForbiddenError(message string) *AppError {
+	return &AppError{
+		Type:    Forbidden,
+		Message: message,
+	}
+}
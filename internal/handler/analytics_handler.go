@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"shorten-url/internal/entities"
+	"shorten-url/internal/service"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	AnalyticsHandler interface {
+		GetUrlStatic(c echo.Context) error
+		GetBreakdown(c echo.Context) error
+		GetClickPipelineStats(c echo.Context) error
+		ExportClicks(c echo.Context) error
+		ExportAllClicks(c echo.Context) error
+		StoreAllClicksExport(c echo.Context) error
+		GetTopLinks(c echo.Context) error
+	}
+
+	analyticsHandler struct {
+		analyticsService service.AnalyticsService
+		clickRecorder    service.ClickRecorder
+		leaderboard      service.Leaderboard
+	}
+)
+
+func NewAnalyticsHandler(analyticsService service.AnalyticsService, clickRecorder service.ClickRecorder, leaderboard service.Leaderboard) AnalyticsHandler {
+	return &analyticsHandler{
+		analyticsService: analyticsService,
+		clickRecorder:    clickRecorder,
+		leaderboard:      leaderboard,
+	}
+}
+
+func (h *analyticsHandler) GetUrlStatic(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	shortCode := c.Param("short_code")
+
+	req := new(entities.UrlStaticReq)
+
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid query parameters",
+		})
+	}
+
+	urlStat, err := h.analyticsService.GetUrlStatic(ctx, shortCode, req)
+	if err != nil {
+		log.Printf("Error: failed to get url stat %s", err.Error())
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, urlStat)
+
+}
+
+func (h *analyticsHandler) GetBreakdown(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	shortCode := c.Param("short_code")
+	dimension := c.Param("dimension")
+
+	req := new(entities.ClickBreakdownReq)
+
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid query parameters",
+		})
+	}
+
+	breakdown, err := h.analyticsService.GetBreakdown(ctx, shortCode, dimension, req)
+	if err != nil {
+		log.Printf("Error: failed to get url %s breakdown %s", dimension, err.Error())
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, breakdown)
+
+}
+
+func (h *analyticsHandler) GetTopLinks(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	req := new(entities.TopLinksReq)
+
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid query parameters",
+		})
+	}
+
+	topLinks, err := h.leaderboard.GetTopLinks(ctx, req)
+	if err != nil {
+		log.Printf("Error: failed to get top links %s", err.Error())
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, topLinks)
+
+}
+
+func (h *analyticsHandler) GetClickPipelineStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.clickRecorder.Stats())
+}
+
+func (h *analyticsHandler) ExportClicks(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	shortCode := c.Param("short_code")
+
+	req := new(entities.ClickExportReq)
+
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid query parameters",
+		})
+	}
+
+	out := newStreamWriter(c, exportContentType(req.Format), fmt.Sprintf("%s-clicks.%s", shortCode, exportExtension(req.Format)))
+
+	if err := h.analyticsService.ExportClicks(ctx, shortCode, req, out); err != nil {
+		log.Printf("Error: failed to export clicks of %s %s", shortCode, err.Error())
+		if out.started {
+			return nil
+		}
+		return handleError(c, err)
+	}
+
+	return out.finish()
+}
+
+func (h *analyticsHandler) ExportAllClicks(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	req := new(entities.ClickExportReq)
+
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid query parameters",
+		})
+	}
+
+	out := newStreamWriter(c, "application/zip", fmt.Sprintf("clicks-%s.zip", time.Now().UTC().Format("20060102")))
+
+	if err := h.analyticsService.ExportAllClicks(ctx, req, out); err != nil {
+		log.Printf("Error: failed to export all clicks %s", err.Error())
+		if out.started {
+			return nil
+		}
+		return handleError(c, err)
+	}
+
+	return out.finish()
+}
+
+func (h *analyticsHandler) StoreAllClicksExport(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	req := new(entities.ClickExportReq)
+
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid query parameters",
+		})
+	}
+
+	stored, err := h.analyticsService.StoreAllClicksExport(ctx, req)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, stored)
+}
+
+func exportExtension(format string) string {
+
+	if strings.ToLower(format) == service.ExportFormatNDJSON {
+		return service.ExportFormatNDJSON
+	}
+	return service.ExportFormatCSV
+}
+
+func exportContentType(format string) string {
+
+	if exportExtension(format) == service.ExportFormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// streamWriter commits the download headers on the first write, so errors raised before any output can still be sent as JSON
+type streamWriter struct {
+	c           echo.Context
+	contentType string
+	filename    string
+	started     bool
+}
+
+func newStreamWriter(c echo.Context, contentType string, filename string) *streamWriter {
+	return &streamWriter{
+		c:           c,
+		contentType: contentType,
+		filename:    filename,
+	}
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+
+	if !w.started {
+		w.commit()
+	}
+	return w.c.Response().Write(p)
+}
+
+// finish sends the headers of an export that produced no output at all
+func (w *streamWriter) finish() error {
+
+	if !w.started {
+		w.commit()
+	}
+	w.c.Response().Flush()
+	return nil
+}
+
+func (w *streamWriter) commit() {
+
+	header := w.c.Response().Header()
+	header.Set(echo.HeaderContentType, w.contentType)
+	header.Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", w.filename))
+	w.c.Response().WriteHeader(http.StatusOK)
+	w.started = true
+}
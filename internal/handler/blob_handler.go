@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"shorten-url/pkg/blobstore"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	BlobHandler interface {
+		Download(c echo.Context) error
+	}
+
+	blobHandler struct {
+		store  blobstore.BlobStore
+		signer *blobstore.URLSigner
+	}
+)
+
+// NewBlobHandler serves the signed download URLs of the fs and memory stores
+func NewBlobHandler(store blobstore.BlobStore, signer *blobstore.URLSigner) BlobHandler {
+	return &blobHandler{
+		store:  store,
+		signer: signer,
+	}
+}
+
+func (h *blobHandler) Download(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	key := c.Param("*")
+
+	if !h.signer.Verify(key, c.QueryParam("expires"), c.QueryParam("signature")) {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "download link is invalid or has expired",
+		})
+	}
+
+	object, err := h.store.Get(ctx, key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "file was not found",
+		})
+	}
+	if err != nil {
+		log.Printf("Error: failed to read blob %s %s", key, err.Error())
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to read file",
+		})
+	}
+	defer object.Close()
+
+	c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(object.Size, 10))
+	return c.Stream(http.StatusOK, object.ContentType, object)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"shorten-url/internal/entities"
+	"shorten-url/internal/service"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	BlocklistHandler interface {
+		ListRules(c echo.Context) error
+		CreateRule(c echo.Context) error
+		DeleteRule(c echo.Context) error
+		Reload(c echo.Context) error
+	}
+
+	blocklistHandler struct {
+		blocklistService service.BlocklistService
+	}
+)
+
+func NewBlocklistHandler(blocklistService service.BlocklistService) BlocklistHandler {
+	return &blocklistHandler{
+		blocklistService: blocklistService,
+	}
+}
+
+func (h *blocklistHandler) ListRules(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	rules, err := h.blocklistService.ListRules(ctx)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, rules)
+}
+
+func (h *blocklistHandler) CreateRule(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	req := new(entities.CreateBlocklistRuleReq)
+
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	rule, err := h.blocklistService.CreateRule(ctx, req)
+	if err != nil {
+		log.Printf("Error: failed to create blocklist rule %s", err.Error())
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, rule)
+}
+
+func (h *blocklistHandler) DeleteRule(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid rule id",
+		})
+	}
+
+	if err := h.blocklistService.DeleteRule(ctx, uint(id)); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *blocklistHandler) Reload(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	if err := h.blocklistService.Reload(ctx); err != nil {
+		log.Printf("Error: failed to reload blocklist %s", err.Error())
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to reload blocklist",
+		})
+	}
+
+	return h.ListRules(c)
+}
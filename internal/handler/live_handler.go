@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"shorten-url/configs"
+	"shorten-url/internal/service"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	LiveHandler interface {
+		StreamClicks(c echo.Context) error
+		StreamAllClicks(c echo.Context) error
+	}
+
+	liveHandler struct {
+		liveService service.LiveService
+		cfg         *configs.Config
+	}
+)
+
+func NewLiveHandler(liveService service.LiveService, cfg *configs.Config) LiveHandler {
+	return &liveHandler{
+		liveService: liveService,
+		cfg:         cfg,
+	}
+}
+
+func (h *liveHandler) StreamClicks(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	shortCode := c.Param("short_code")
+
+	sub, err := h.liveService.Subscribe(ctx, shortCode)
+	if err != nil {
+		log.Printf("Error: failed to subscribe to live clicks %s", err.Error())
+		return handleError(c, err)
+	}
+
+	return h.stream(c, sub)
+}
+
+func (h *liveHandler) StreamAllClicks(c echo.Context) error {
+	return h.stream(c, h.liveService.SubscribeAll())
+}
+
+// stream writes clicks and rolling counters as Server-Sent Events until the client leaves or is evicted
+func (h *liveHandler) stream(c echo.Context, sub *service.ClickSubscription) error {
+
+	defer h.liveService.Unsubscribe(sub)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	interval := h.cfg.Analytics.LiveCounterInterval
+	if interval <= 0 {
+		interval = time.Second * 5
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	if err := writeEvent(res, "counters", h.liveService.Counters(sub)); err != nil {
+		return nil
+	}
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case click, ok := <-sub.C:
+			if !ok {
+				if sub.Evicted() {
+					writeEvent(res, "evicted", map[string]string{
+						"error": "client was too slow to keep up with the stream",
+					})
+				}
+				return nil
+			}
+			if err := writeEvent(res, "click", click); err != nil {
+				return nil
+			}
+		case <-ticker.C:
+			if err := writeEvent(res, "counters", h.liveService.Counters(sub)); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func writeEvent(res *echo.Response, event string, data any) error {
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	res.Flush()
+
+	return nil
+}
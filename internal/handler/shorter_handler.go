@@ -1,12 +1,15 @@
 package handler
 
 import (
-	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"shorten-url/configs"
 	"shorten-url/internal/entities"
 	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
 	"shorten-url/internal/service"
 
 	"github.com/labstack/echo/v4"
@@ -15,27 +18,76 @@ import (
 type (
 	ShortenHandler interface {
 		CreateShortenURL(c echo.Context) error
-		CreateQrCode(c echo.Context) error
+		GetQrCode(c echo.Context) error
+		GetQrCodeImage(c echo.Context) error
 		GetShortenURL(c echo.Context) error
+		ScanQrCode(c echo.Context) error
+		RetargetQrCode(c echo.Context) error
+		ExportQrCodeSheet(c echo.Context) error
+		DecodeQrCodes(c echo.Context) error
 		RetrieveOriginalURL(c echo.Context) error
 		UpdateShortenURL(c echo.Context) error
 		DeleteUrl(c echo.Context) error
-		GetUrlStatic(c echo.Context) error
+		GetBrokenLinks(c echo.Context) error
+		GetReservedConflicts(c echo.Context) error
+		UploadWorkspaceLogo(c echo.Context) error
+		DeleteWorkspaceLogo(c echo.Context) error
 	}
 
 	shortenHandler struct {
 		shortenService service.URLService
+		cfg            *configs.Config
 	}
 )
 
-func NewHandler(shortenService service.URLService) ShortenHandler {
+// uploadFormOverhead is what the multipart boundaries and part headers may add around an uploaded image
+const uploadFormOverhead = 64 << 10
+
+func NewHandler(shortenService service.URLService, cfg *configs.Config) ShortenHandler {
 	return &shortenHandler{
 		shortenService: shortenService,
+		cfg:            cfg,
+	}
+}
+
+// readUpload reads the file in the given form field, refusing a body larger than maxBytes plus the form around
+// it. The whole form is parsed before the file can be measured, so the body is capped first; a declared length
+// over the cap is refused without reading anything
+func readUpload(c echo.Context, field string, maxBytes int) ([]byte, int, error) {
+
+	limit := int64(maxBytes) + uploadFormOverhead
+	tooLarge := fmt.Errorf("%s must be at most %d bytes", field, maxBytes)
+	if c.Request().ContentLength > limit {
+		return nil, http.StatusRequestEntityTooLarge, tooLarge
+	}
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, limit)
+
+	file, err := c.FormFile(field)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, http.StatusRequestEntityTooLarge, tooLarge
+		}
+		return nil, http.StatusBadRequest, fmt.Errorf("%s file is required", field)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid %s file", field)
+	}
+	defer src.Close()
+
+	// One byte past the limit is read so the service can tell an oversized upload apart
+	upload, err := io.ReadAll(io.LimitReader(src, int64(maxBytes)+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid %s file", field)
 	}
+
+	return upload, http.StatusOK, nil
 }
 
 // Helper function to handle errors and return appropriate HTTP status
-func (h *shortenHandler) handleError(c echo.Context, err error) error {
+func handleError(c echo.Context, err error) error {
 	var appErr *appErrors.AppError
 	if errors.As(err, &appErr) {
 		switch appErr.Type {
@@ -51,6 +103,10 @@ func (h *shortenHandler) handleError(c echo.Context, err error) error {
 			return c.JSON(http.StatusConflict, map[string]string{
 				"error": appErr.Message,
 			})
+		case appErrors.Forbidden:
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": appErr.Message,
+			})
 		default:
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": appErr.Message,
@@ -66,22 +122,68 @@ func (h *shortenHandler) handleError(c echo.Context, err error) error {
 
 func (h *shortenHandler) GetShortenURL(c echo.Context) error {
 
-	ctx := context.Background()
+	ctx := c.Request().Context()
 
 	shortCode := c.Param("short_code")
 
-	originalUrl, err := h.shortenService.GetOriginalURL(ctx, shortCode)
+	originalUrl, err := h.shortenService.GetOriginalURL(ctx, shortCode, h.clickInfo(c, model.ClickSourceDirect))
 	if err != nil {
 		log.Printf("Error: failed to get original url %s", err.Error())
-		return h.handleError(c, err)
+		return handleError(c, err)
 	}
 
-	return c.Redirect(http.StatusMovedPermanently, originalUrl)
+	// Temporary, so browsers come back on every click instead of replaying a cached redirect the stats never see
+	return c.Redirect(http.StatusFound, originalUrl)
+}
+
+// ScanQrCode redirects a scanned code. The redirect is temporary like any other, as the code may also be
+// moved to another link and browsers would otherwise keep going to the old one.
+func (h *shortenHandler) ScanQrCode(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	scanCode := c.Param("scan_code")
+
+	originalUrl, err := h.shortenService.ResolveQrCode(ctx, scanCode, h.clickInfo(c, model.ClickSourceQR))
+	if err != nil {
+		log.Printf("Error: failed to resolve qr code %s", err.Error())
+		return handleError(c, err)
+	}
+
+	return c.Redirect(http.StatusFound, originalUrl)
+}
+
+// clickInfo captures the request metadata stored with a click event
+func (h *shortenHandler) clickInfo(c echo.Context, source string) *entities.ClickInfo {
+
+	req := c.Request()
+
+	return &entities.ClickInfo{
+		Referrer:   req.Referer(),
+		UserAgent:  req.UserAgent(),
+		IP:         c.RealIP(),
+		Country:    req.Header.Get(h.cfg.Analytics.CountryHeader),
+		Source:     source,
+		Method:     req.Method,
+		Purpose:    prefetchPurpose(req.Header),
+		DoNotTrack: req.Header.Get("DNT") == "1" || req.Header.Get("Sec-GPC") == "1",
+	}
+}
+
+// prefetchPurpose returns the first prefetch or preview hint a browser or unfurler sent
+func prefetchPurpose(header http.Header) string {
+
+	for _, name := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		if value := header.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
 }
 
 func (h *shortenHandler) UpdateShortenURL(c echo.Context) error {
 
-	ctx := context.Background()
+	ctx := c.Request().Context()
 
 	shortCode := c.Param("short_code")
 
@@ -96,7 +198,7 @@ func (h *shortenHandler) UpdateShortenURL(c echo.Context) error {
 	res, err := h.shortenService.UpdateShortUrl(ctx, shortCode, updateUrlReq.Url)
 	if err != nil {
 		log.Printf("Error: failed to update short url %s", err.Error())
-		return h.handleError(c, err)
+		return handleError(c, err)
 	}
 
 	return c.JSON(http.StatusOK, res)
@@ -104,26 +206,26 @@ func (h *shortenHandler) UpdateShortenURL(c echo.Context) error {
 
 func (h *shortenHandler) DeleteUrl(c echo.Context) error {
 
-	ctx := context.Background()
+	ctx := c.Request().Context()
 
 	shortCode := c.Param("short_code")
 
 	if err := h.shortenService.DeleteShortUrl(ctx, shortCode); err != nil {
-		return h.handleError(c, err)
+		return handleError(c, err)
 	}
 
 	return c.JSON(http.StatusNoContent, nil)
 }
 
 func (h *shortenHandler) RetrieveOriginalURL(c echo.Context) error {
-	ctx := context.Background()
+	ctx := c.Request().Context()
 
 	shortCode := c.Param("short_code")
 
 	retriveUrlRes, err := h.shortenService.RetrieveOriginalURL(ctx, shortCode)
 	if err != nil {
 		log.Printf("Error: failed to retrieve original url %s", err.Error())
-		return h.handleError(c, err)
+		return handleError(c, err)
 	}
 
 	return c.JSON(http.StatusOK, retriveUrlRes)
@@ -131,7 +233,7 @@ func (h *shortenHandler) RetrieveOriginalURL(c echo.Context) error {
 
 func (h *shortenHandler) CreateShortenURL(c echo.Context) error {
 
-	ctx := context.Background()
+	ctx := c.Request().Context()
 
 	req := new(entities.CreateShortenUrlReq)
 
@@ -141,20 +243,40 @@ func (h *shortenHandler) CreateShortenURL(c echo.Context) error {
 		})
 	}
 
-	shorten, err := h.shortenService.ShortenURL(ctx, req.OriginalUrl)
+	shorten, err := h.shortenService.ShortenURL(ctx, req.OriginalUrl, req.CustomAlias, req.Campaign)
 	if err != nil {
-		return h.handleError(c, err)
+		return handleError(c, err)
 	}
 
 	return c.JSON(http.StatusCreated, shorten)
 
 }
 
-func (h *shortenHandler) CreateQrCode(c echo.Context) error {
+func (h *shortenHandler) GetQrCode(c echo.Context) error {
 
-	ctx := context.Background()
+	ctx := c.Request().Context()
 
-	req := new(entities.CreateQrcodeReq)
+	req := new(entities.QrCodeReq)
+
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid query parameters",
+		})
+	}
+
+	res, err := h.shortenService.GetQrCode(ctx, c.Param("short_code"), req)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *shortenHandler) RetargetQrCode(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	req := new(entities.RetargetQrCodeReq)
 
 	if err := c.Bind(req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{
@@ -162,26 +284,142 @@ func (h *shortenHandler) CreateQrCode(c echo.Context) error {
 		})
 	}
 
-	res, err := h.shortenService.CreateQrCode(ctx, req.OriginalUrl)
+	res, err := h.shortenService.RetargetQrCode(ctx, c.Param("scan_code"), req)
 	if err != nil {
-		return h.handleError(c, err)
+		return handleError(c, err)
 	}
 
-	return c.JSON(http.StatusCreated, res)
+	return c.JSON(http.StatusOK, res)
 }
 
-func (h *shortenHandler) GetUrlStatic(c echo.Context) error {
+// ExportQrCodeSheet streams a printable PDF of many codes; errors found before the first page keep their status
+func (h *shortenHandler) ExportQrCodeSheet(c echo.Context) error {
 
-	ctx := context.Background()
+	ctx := c.Request().Context()
 
-	shortCode := c.Param("short_code")
+	req := new(entities.QrCodeSheetReq)
+
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	out := newStreamWriter(c, "application/pdf", "qrcodes.pdf")
 
-	urlStat, err := h.shortenService.GetUrlStatic(ctx, shortCode)
+	if err := h.shortenService.WriteQrCodeSheet(ctx, req, out); err != nil {
+		log.Printf("Error: failed to export qrcode sheet %s", err.Error())
+		if out.started {
+			return nil
+		}
+		return handleError(c, err)
+	}
+
+	return out.finish()
+}
+
+// DecodeQrCodes checks an uploaded proof: every QR code in the image with the link it leads to
+func (h *shortenHandler) DecodeQrCodes(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	upload, status, err := readUpload(c, "image", h.cfg.QrCode.DecodeMaxBytes)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	decoded, err := h.shortenService.DecodeQrCodes(ctx, upload)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, decoded)
+}
+
+// GetQrCodeImage serves the image itself. It is rendered on request, so the response carries a strong
+// ETag and clients revalidate with If-None-Match once max-age has passed.
+func (h *shortenHandler) GetQrCodeImage(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	req := new(entities.QrCodeReq)
+
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid query parameters",
+		})
+	}
+
+	res, err := h.shortenService.GetQrCodeImage(ctx, c.Param("short_code"), req, c.Request().Header.Get("If-None-Match"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	header := c.Response().Header()
+	header.Set("ETag", res.ETag)
+	header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.cfg.QrCode.MaxAge.Seconds())))
+
+	if res.NotModified {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	header.Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", res.FileName))
+	return c.Blob(http.StatusOK, res.ContentType, res.Data)
+}
+
+func (h *shortenHandler) GetBrokenLinks(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	brokenLinks, err := h.shortenService.GetBrokenLinks(ctx)
 	if err != nil {
-		log.Printf("Error: failed to get url stat %s", err.Error())
-		return h.handleError(c, err)
+		log.Printf("Error: failed to get broken links %s", err.Error())
+		return handleError(c, err)
 	}
 
-	return c.JSON(http.StatusOK, urlStat)
+	return c.JSON(http.StatusOK, brokenLinks)
+}
+
+func (h *shortenHandler) GetReservedConflicts(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	conflicts, err := h.shortenService.GetReservedConflicts(ctx)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, conflicts)
+}
+
+func (h *shortenHandler) UploadWorkspaceLogo(c echo.Context) error {
+
+	ctx := c.Request().Context()
 
+	upload, status, err := readUpload(c, "logo", h.cfg.QrCode.LogoMaxBytes)
+	if err != nil {
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	logo, err := h.shortenService.SaveWorkspaceLogo(ctx, c.Param("workspace"), upload)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, logo)
+}
+
+func (h *shortenHandler) DeleteWorkspaceLogo(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	if err := h.shortenService.DeleteWorkspaceLogo(ctx, c.Param("workspace")); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
 }
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shorten-url/configs"
+	"shorten-url/internal/entities"
+	"shorten-url/internal/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// uploadOnlyService fails the test through a nil interface for anything but the two uploads
+type uploadOnlyService struct {
+	service.URLService
+	uploads [][]byte
+}
+
+func (s *uploadOnlyService) DecodeQrCodes(pctx context.Context, upload []byte) (*entities.QrCodeDecodeRes, error) {
+	s.uploads = append(s.uploads, upload)
+	return &entities.QrCodeDecodeRes{}, nil
+}
+
+func (s *uploadOnlyService) SaveWorkspaceLogo(pctx context.Context, workspace string, upload []byte) (*entities.WorkspaceLogoRes, error) {
+	s.uploads = append(s.uploads, upload)
+	return &entities.WorkspaceLogoRes{}, nil
+}
+
+// countingReader records how much of a request body the handler pulled
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func uploadForm(t *testing.T, field string, image []byte) (*bytes.Buffer, string) {
+
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile(field, "upload.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(image)
+	form.Close()
+
+	return body, form.FormDataContentType()
+}
+
+func TestUploads_BodyLimit(t *testing.T) {
+
+	cfg := &configs.Config{QrCode: configs.QrCodeConfig{DecodeMaxBytes: 1 << 10, LogoMaxBytes: 2 << 10}}
+
+	uploads := []struct {
+		name     string
+		field    string
+		maxBytes int
+		handle   func(ShortenHandler, echo.Context) error
+	}{
+		{name: "decode", field: "image", maxBytes: cfg.QrCode.DecodeMaxBytes, handle: ShortenHandler.DecodeQrCodes},
+		{name: "logo", field: "logo", maxBytes: cfg.QrCode.LogoMaxBytes, handle: ShortenHandler.UploadWorkspaceLogo},
+	}
+
+	cases := []struct {
+		name            string
+		oversized       bool
+		chunked         bool
+		wantStatus      int
+		wantSaved       bool
+		wantNothingRead bool
+	}{
+		{name: "within limit", wantStatus: http.StatusOK, wantSaved: true},
+		{name: "declared length over limit", oversized: true, wantStatus: http.StatusRequestEntityTooLarge, wantNothingRead: true},
+		{name: "chunked body over limit", oversized: true, chunked: true, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, upload := range uploads {
+		for _, tc := range cases {
+			t.Run(upload.name+"/"+tc.name, func(t *testing.T) {
+
+				image := []byte("png")
+				if tc.oversized {
+					image = make([]byte, upload.maxBytes+uploadFormOverhead)
+				}
+				form, contentType := uploadForm(t, upload.field, image)
+				size := form.Len()
+				body := &countingReader{r: form}
+
+				req := httptest.NewRequest(http.MethodPost, "/", body)
+				req.Header.Set(echo.HeaderContentType, contentType)
+				req.ContentLength = int64(size)
+				if tc.chunked {
+					req.ContentLength = -1
+				}
+				rec := httptest.NewRecorder()
+
+				svc := new(uploadOnlyService)
+				err := upload.handle(NewHandler(svc, cfg), echo.New().NewContext(req, rec))
+
+				assert.NoError(t, err)
+				assert.Equal(t, tc.wantStatus, rec.Code)
+				assert.Equal(t, tc.wantSaved, len(svc.uploads) == 1)
+				assert.LessOrEqual(t, body.read, upload.maxBytes+uploadFormOverhead+1)
+				if tc.wantNothingRead {
+					assert.Equal(t, 0, body.read)
+				}
+			})
+		}
+	}
+}
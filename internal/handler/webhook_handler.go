@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"shorten-url/internal/entities"
+	"shorten-url/internal/service"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	WebhookHandler interface {
+		ListEndpoints(c echo.Context) error
+		CreateEndpoint(c echo.Context) error
+		DeleteEndpoint(c echo.Context) error
+		ListDeliveries(c echo.Context) error
+		ReplayDelivery(c echo.Context) error
+	}
+
+	webhookHandler struct {
+		webhookService service.WebhookService
+	}
+)
+
+func NewWebhookHandler(webhookService service.WebhookService) WebhookHandler {
+	return &webhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+func (h *webhookHandler) ListEndpoints(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	endpoints, err := h.webhookService.ListEndpoints(ctx)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, endpoints)
+}
+
+func (h *webhookHandler) CreateEndpoint(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	req := new(entities.CreateWebhookEndpointReq)
+
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	endpoint, err := h.webhookService.CreateEndpoint(ctx, req)
+	if err != nil {
+		log.Printf("Error: failed to create webhook endpoint %s", err.Error())
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, endpoint)
+}
+
+func (h *webhookHandler) DeleteEndpoint(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid webhook endpoint id",
+		})
+	}
+
+	if err := h.webhookService.DeleteEndpoint(ctx, uint(id)); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *webhookHandler) ListDeliveries(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid webhook endpoint id",
+		})
+	}
+
+	req := new(entities.WebhookDeliveriesReq)
+
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid query parameters",
+		})
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(ctx, uint(id), req)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+func (h *webhookHandler) ReplayDelivery(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid webhook delivery id",
+		})
+	}
+
+	delivery, err := h.webhookService.ReplayDelivery(ctx, id)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusAccepted, delivery)
+}
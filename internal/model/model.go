@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
 
 type URL struct {
 	ID          uint      `db:"id" json:"id"`
@@ -8,6 +12,7 @@ type URL struct {
 	OriginalURL string    `db:"original_url" json:"original_url"`
 	QrCodeUrl   string    `db:"qrcode_url" json:"qrcode_url"`
 	ClickCount  int       `db:"click_count" json:"click_count"`
+	Campaign    string    `db:"campaign" json:"campaign"`
 	CreatedAt   time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
 }
@@ -18,8 +23,12 @@ type URLInterpeter struct {
 	UpdatedAt time.Time
 }
 
+// Qrcode is the canonical QR code of a short link. It encodes its own scan URL, /q/<ScanCode>, held in
+// OriginalURL, so a printed code can be moved to another link; ClickCount counts its scans.
 type Qrcode struct {
 	ID          uint      `db:"id" json:"id"`
+	URLID       uint      `db:"url_id" json:"url_id"`
+	ScanCode    string    `db:"scan_code" json:"scan_code"`
 	OriginalURL string    `db:"original_url" json:"original_url"`
 	QrCodeUrl   string    `db:"qrcode_url" json:"qrcode_url"`
 	ClickCount  int       `db:"click_count" json:"click_count"`
@@ -27,8 +36,135 @@ type Qrcode struct {
 	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
 }
 
-type QrcodeInterpeter struct {
-	ID        uint
-	CreatedAt time.Time
-	UpdatedAt time.Time
+// WorkspaceLogo is the brand logo composited into a workspace's QR codes, stored re-encoded as PNG in the
+// blob store under ImageKey; logos uploaded before the blob store carry their bytes in Image instead
+type WorkspaceLogo struct {
+	Workspace string    `db:"workspace" json:"workspace"`
+	Image     []byte    `db:"image" json:"-"`
+	ImageKey  string    `db:"image_key" json:"-"`
+	Width     int       `db:"width" json:"width"`
+	Height    int       `db:"height" json:"height"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type URLHealth struct {
+	URLID               uint      `db:"url_id" json:"url_id"`
+	StatusCode          int       `db:"status_code" json:"status_code"`
+	LatencyMs           int64     `db:"latency_ms" json:"latency_ms"`
+	FinalURL            string    `db:"final_url" json:"final_url"`
+	LastError           string    `db:"last_error" json:"last_error"`
+	ConsecutiveFailures int       `db:"consecutive_failures" json:"consecutive_failures"`
+	IsBroken            bool      `db:"is_broken" json:"is_broken"`
+	LastCheckedAt       time.Time `db:"last_checked_at" json:"last_checked_at"`
+}
+
+type BrokenURL struct {
+	URL
+	Health URLHealth `db:"health"`
+}
+
+type BlocklistRule struct {
+	ID        uint      `db:"id" json:"id"`
+	Kind      string    `db:"kind" json:"kind"`
+	Pattern   string    `db:"pattern" json:"pattern"`
+	Reason    string    `db:"reason" json:"reason"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+const (
+	ClickSourceDirect = "direct"
+	ClickSourceQR     = "qr"
+
+	ClickDimensionReferrer = "referrers"
+	ClickDimensionBrowser  = "browsers"
+	ClickDimensionOS       = "os"
+	ClickDimensionDevice   = "devices"
+	ClickDimensionSource   = "sources"
+)
+
+type ClickEvent struct {
+	ID           int64     `db:"id" json:"id"`
+	URLID        uint      `db:"url_id" json:"url_id"`
+	ClickedAt    time.Time `db:"clicked_at" json:"clicked_at"`
+	Referrer     string    `db:"referrer" json:"referrer"`
+	ReferrerHost string    `db:"referrer_host" json:"referrer_host"`
+	UserAgent    string    `db:"user_agent" json:"user_agent"`
+	Browser      string    `db:"browser" json:"browser"`
+	OS           string    `db:"os" json:"os"`
+	IP           string    `db:"ip" json:"ip"`
+	IPHash       string    `db:"ip_hash" json:"ip_hash"`
+	Country      string    `db:"country" json:"country"`
+	Device       string    `db:"device" json:"device"`
+	Source       string    `db:"source" json:"source"`
+	IsBot        bool      `db:"is_bot" json:"is_bot"`
+}
+
+type ClickBucket struct {
+	Bucket time.Time `db:"bucket" json:"bucket"`
+	Clicks int       `db:"clicks" json:"clicks"`
+}
+
+// VisitorSketch is the encoded HyperLogLog sketch of one link's visitors on one UTC day
+type VisitorSketch struct {
+	URLID  uint      `db:"url_id" json:"url_id"`
+	Day    time.Time `db:"day" json:"day"`
+	Sketch []byte    `db:"sketch" json:"-"`
+}
+
+type ClickDimensionCount struct {
+	Value  string `db:"value" json:"value"`
+	Clicks int    `db:"clicks" json:"clicks"`
+}
+
+// URLClickWindow is a link's human clicks in a window and in the window before it
+type URLClickWindow struct {
+	URLID          uint   `db:"url_id" json:"url_id"`
+	ShortCode      string `db:"short_code" json:"short_code"`
+	OriginalURL    string `db:"original_url" json:"original_url"`
+	Clicks         int    `db:"clicks" json:"clicks"`
+	PreviousClicks int    `db:"previous_clicks" json:"previous_clicks"`
+}
+
+const (
+	WebhookEventLinkCreated          = "link.created"
+	WebhookEventLinkUpdated          = "link.updated"
+	WebhookEventLinkDeleted          = "link.deleted"
+	WebhookEventLinkClicked          = "link.clicked"
+	WebhookEventLinkThresholdReached = "link.threshold_reached"
+
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+type WebhookEndpoint struct {
+	ID        uint           `db:"id" json:"id"`
+	URL       string         `db:"url" json:"url"`
+	Secret    string         `db:"secret" json:"-"`
+	Events    pq.StringArray `db:"events" json:"events"`
+	CreatedAt time.Time      `db:"created_at" json:"created_at"`
+}
+
+// WebhookDelivery is one event addressed to one endpoint, together with the outcome of its last attempt
+type WebhookDelivery struct {
+	ID             int64      `db:"id" json:"id"`
+	EndpointID     uint       `db:"endpoint_id" json:"endpoint_id"`
+	EventID        string     `db:"event_id" json:"event_id"`
+	EventType      string     `db:"event_type" json:"event_type"`
+	Payload        []byte     `db:"payload" json:"-"`
+	Status         string     `db:"status" json:"status"`
+	Attempts       int        `db:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time  `db:"next_attempt_at" json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `db:"last_attempt_at" json:"last_attempt_at"`
+	LastStatusCode int        `db:"last_status_code" json:"last_status_code"`
+	LastError      string     `db:"last_error" json:"last_error"`
+	ReplayOf       *int64     `db:"replay_of" json:"replay_of"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+}
+
+// WebhookDeliveryTarget is a claimed delivery with the endpoint it is sent to
+type WebhookDeliveryTarget struct {
+	WebhookDelivery
+	URL    string `db:"url"`
+	Secret string `db:"secret"`
 }
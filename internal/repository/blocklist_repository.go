@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"shorten-url/internal/model"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type BlocklistRepository interface {
+	CreateRule(pctx context.Context, rule *model.BlocklistRule) (*model.BlocklistRule, error)
+	ListRules(pctx context.Context) ([]*model.BlocklistRule, error)
+	DeleteRule(pctx context.Context, id uint) error
+}
+
+type blocklistRepository struct {
+	db *sqlx.DB
+}
+
+// NewBlocklistRepository creates a new blocklist rule repository
+func NewBlocklistRepository(db *sqlx.DB) BlocklistRepository {
+	return &blocklistRepository{
+		db: db,
+	}
+}
+
+func (r *blocklistRepository) CreateRule(pctx context.Context, rule *model.BlocklistRule) (*model.BlocklistRule, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `INSERT INTO blocklist_rules (kind, pattern, reason) VALUES ($1, $2, $3) RETURNING id, created_at`
+
+	if err := r.db.QueryRowContext(ctx, query, rule.Kind, rule.Pattern, rule.Reason).Scan(&rule.ID, &rule.CreatedAt); err != nil {
+		log.Printf("Error creating blocklist rule: %v", err)
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+func (r *blocklistRepository) ListRules(pctx context.Context) ([]*model.BlocklistRule, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT id, kind, pattern, COALESCE(reason, '') AS reason, created_at FROM blocklist_rules ORDER BY id`
+
+	rules := make([]*model.BlocklistRule, 0)
+	if err := r.db.SelectContext(ctx, &rules, query); err != nil {
+		log.Printf("Error listing blocklist rules: %v", err)
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (r *blocklistRepository) DeleteRule(pctx context.Context, id uint) error {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM blocklist_rules WHERE id = $1`, id)
+	if err != nil {
+		log.Printf("Error deleting blocklist rule %d: %v", id, err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,571 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"shorten-url/internal/model"
+	"shorten-url/pkg/hll"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type ClickRepository interface {
+	InsertClickEvents(pctx context.Context, events []*model.ClickEvent) error
+	AddClickCounts(pctx context.Context, deltas map[uint]int) ([]*model.URL, error)
+	AddQrCodeScans(pctx context.Context, deltas map[uint]int) error
+	CountClicks(pctx context.Context, urlID uint, rolledUpBefore time.Time, includeBots bool) (int, error)
+	EnsureClickPartitions(pctx context.Context, from time.Time, months int) error
+	CountClicksByMinute(pctx context.Context, urlID uint, from time.Time, to time.Time, includeBots bool) ([]*model.ClickBucket, error)
+	CountClicksByHour(pctx context.Context, urlID uint, from time.Time, to time.Time, includeBots bool) ([]*model.ClickBucket, error)
+	RefreshClickRollups(pctx context.Context, from time.Time, to time.Time) error
+	GetClickRollupMark(pctx context.Context) (time.Time, error)
+	SetClickRollupMark(pctx context.Context, rolledUpTo time.Time) error
+	CountClicksByDimension(pctx context.Context, urlID uint, dimension string, from time.Time, to time.Time, includeBots bool) ([]*model.ClickDimensionCount, error)
+	MergeVisitorSketch(pctx context.Context, urlID uint, day time.Time, sketch *hll.Sketch) error
+	ListVisitorSketches(pctx context.Context, urlID uint, from time.Time, to time.Time) ([]*model.VisitorSketch, error)
+	StreamClickEvents(pctx context.Context, urlID uint, from time.Time, to time.Time, includeBots bool, fn func(event *model.ClickEvent) error) error
+	ListClickedURLs(pctx context.Context, from time.Time, to time.Time) ([]*model.URL, error)
+	SumClicksByWindow(pctx context.Context, previousFrom time.Time, from time.Time, to time.Time) ([]*model.URLClickWindow, error)
+	EnsureDailySalt(pctx context.Context, day time.Time, candidate []byte) ([]byte, error)
+	DeleteDailySaltsBefore(pctx context.Context, day time.Time) error
+	OldestClickEventTime(pctx context.Context) (time.Time, error)
+	PurgeClickEvents(pctx context.Context, from time.Time, to time.Time, aggregate bool) (int64, error)
+}
+
+// clickDimensionColumns whitelists the columns breakdowns may group by
+var clickDimensionColumns = map[string]string{
+	model.ClickDimensionReferrer: "referrer_host",
+	model.ClickDimensionBrowser:  "browser",
+	model.ClickDimensionOS:       "os",
+	model.ClickDimensionDevice:   "device",
+	model.ClickDimensionSource:   "source",
+}
+
+type clickRepository struct {
+	db *sqlx.DB
+}
+
+// NewClickRepository creates a new click event repository
+func NewClickRepository(db *sqlx.DB) ClickRepository {
+	return &clickRepository{
+		db: db,
+	}
+}
+
+// InsertClickEvents writes a batch of events in a single statement
+func (r *clickRepository) InsertClickEvents(pctx context.Context, events []*model.ClickEvent) error {
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	query := `INSERT INTO click_events (url_id, clicked_at, referrer, referrer_host, user_agent, browser, os, ip, ip_hash, country, device, source, is_bot)
+              VALUES (:url_id, :clicked_at, :referrer, :referrer_host, :user_agent, :browser, :os, :ip, :ip_hash, :country, :device, :source, :is_bot)`
+
+	if _, err := r.db.NamedExecContext(ctx, query, events); err != nil {
+		log.Printf("Error inserting %d click events: %v", len(events), err)
+		return err
+	}
+
+	return nil
+}
+
+// AddClickCounts applies aggregated click count deltas to many urls in one update and returns their new totals
+func (r *clickRepository) AddClickCounts(pctx context.Context, deltas map[uint]int) ([]*model.URL, error) {
+
+	if len(deltas) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	ids := make([]int64, 0, len(deltas))
+	counts := make([]int64, 0, len(deltas))
+	for id, delta := range deltas {
+		ids = append(ids, int64(id))
+		counts = append(counts, int64(delta))
+	}
+
+	query := `UPDATE urls
+              SET click_count = click_count + d.delta, updated_at = CURRENT_TIMESTAMP
+              FROM (SELECT unnest($1::bigint[]) AS id, unnest($2::bigint[]) AS delta) d
+              WHERE urls.id = d.id
+              RETURNING urls.id, urls.short_code, urls.original_url, urls.click_count, urls.created_at, urls.updated_at`
+
+	urls := make([]*model.URL, 0, len(deltas))
+	if err := r.db.SelectContext(ctx, &urls, query, pq.Array(ids), pq.Array(counts)); err != nil {
+		log.Printf("Error adding click counts for %d urls: %v", len(deltas), err)
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// AddQrCodeScans applies aggregated scan count deltas to the QR codes of many urls in one update
+func (r *clickRepository) AddQrCodeScans(pctx context.Context, deltas map[uint]int) error {
+
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	ids := make([]int64, 0, len(deltas))
+	counts := make([]int64, 0, len(deltas))
+	for id, delta := range deltas {
+		ids = append(ids, int64(id))
+		counts = append(counts, int64(delta))
+	}
+
+	query := `UPDATE qrcode
+              SET click_count = COALESCE(click_count, 0) + d.delta
+              FROM (SELECT unnest($1::bigint[]) AS id, unnest($2::bigint[]) AS delta) d
+              WHERE qrcode.url_id = d.id`
+
+	if _, err := r.db.ExecContext(ctx, query, pq.Array(ids), pq.Array(counts)); err != nil {
+		log.Printf("Error adding qr code scans for %d urls: %v", len(deltas), err)
+		return err
+	}
+
+	return nil
+}
+
+// CountClicks counts a link's clicks from its hourly rollups before rolledUpBefore and its raw events after,
+// so only the hours the rollup worker may not have reached yet are read from click_events
+func (r *clickRepository) CountClicks(pctx context.Context, urlID uint, rolledUpBefore time.Time, includeBots bool) (int, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	query := `SELECT COALESCE((SELECT SUM(clicks + CASE WHEN $3 THEN bot_clicks ELSE 0 END) FROM click_rollups_hourly WHERE url_id = $1 AND bucket < $2), 0)
+                   + (SELECT COUNT(1) FROM click_events WHERE url_id = $1 AND clicked_at >= $2 AND ($3 OR NOT is_bot))`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, urlID, rolledUpBefore.UTC(), includeBots).Scan(&count); err != nil {
+		log.Printf("Error counting clicks for url %d: %v", urlID, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// EnsureClickPartitions creates the monthly partitions covering [from, from + months)
+func (r *clickRepository) EnsureClickPartitions(pctx context.Context, from time.Time, months int) error {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*30)
+	defer cancel()
+
+	start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < months; i++ {
+		lower := start.AddDate(0, i, 0)
+		upper := lower.AddDate(0, 1, 0)
+
+		query := fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS click_events_y%04dm%02d PARTITION OF click_events FOR VALUES FROM ('%s') TO ('%s')`,
+			lower.Year(), lower.Month(), lower.Format("2006-01-02"), upper.Format("2006-01-02"),
+		)
+
+		if _, err := r.db.ExecContext(ctx, query); err != nil {
+			log.Printf("Error creating click partition for %s: %v", lower.Format("2006-01"), err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CountClicksByMinute aggregates raw events into UTC minutes within [from, to)
+func (r *clickRepository) CountClicksByMinute(pctx context.Context, urlID uint, from time.Time, to time.Time, includeBots bool) ([]*model.ClickBucket, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	query := `SELECT date_trunc('minute', clicked_at) AS bucket, COUNT(1) AS clicks
+              FROM click_events
+              WHERE url_id = $1 AND clicked_at >= $2 AND clicked_at < $3 AND ($4 OR NOT is_bot)
+              GROUP BY 1
+              ORDER BY 1`
+
+	buckets := make([]*model.ClickBucket, 0)
+	if err := r.db.SelectContext(ctx, &buckets, query, urlID, from.UTC(), to.UTC(), includeBots); err != nil {
+		log.Printf("Error counting clicks by minute for url %d: %v", urlID, err)
+		return nil, err
+	}
+
+	return buckets, nil
+}
+
+// CountClicksByHour reads pre-aggregated UTC hours within [from, to)
+func (r *clickRepository) CountClicksByHour(pctx context.Context, urlID uint, from time.Time, to time.Time, includeBots bool) ([]*model.ClickBucket, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	query := `SELECT bucket, clicks + CASE WHEN $4 THEN bot_clicks ELSE 0 END AS clicks
+              FROM click_rollups_hourly
+              WHERE url_id = $1 AND bucket >= $2 AND bucket < $3
+              ORDER BY bucket`
+
+	buckets := make([]*model.ClickBucket, 0)
+	if err := r.db.SelectContext(ctx, &buckets, query, urlID, from.UTC(), to.UTC(), includeBots); err != nil {
+		log.Printf("Error counting clicks by hour for url %d: %v", urlID, err)
+		return nil, err
+	}
+
+	return buckets, nil
+}
+
+// RefreshClickRollups recomputes the hourly human and bot totals of every hour within [from, to)
+func (r *clickRepository) RefreshClickRollups(pctx context.Context, from time.Time, to time.Time) error {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Minute)
+	defer cancel()
+
+	query := `INSERT INTO click_rollups_hourly (url_id, bucket, clicks, bot_clicks)
+              SELECT url_id, date_trunc('hour', clicked_at), COUNT(1) FILTER (WHERE NOT is_bot), COUNT(1) FILTER (WHERE is_bot)
+              FROM click_events
+              WHERE clicked_at >= $1 AND clicked_at < $2 AND EXISTS (SELECT 1 FROM urls WHERE urls.id = click_events.url_id)
+              GROUP BY 1, 2
+              ON CONFLICT (url_id, bucket) DO UPDATE SET clicks = EXCLUDED.clicks, bot_clicks = EXCLUDED.bot_clicks`
+
+	if _, err := r.db.ExecContext(ctx, query, from.UTC(), to.UTC()); err != nil {
+		log.Printf("Error refreshing click rollups: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetClickRollupMark returns the hour before which every hourly rollup is complete
+func (r *clickRepository) GetClickRollupMark(pctx context.Context) (time.Time, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	var mark time.Time
+	if err := r.db.GetContext(ctx, &mark, `SELECT rolled_up_to FROM click_rollup_progress`); err != nil {
+		log.Printf("Error reading the click rollup mark: %v", err)
+		return time.Time{}, err
+	}
+
+	return mark.UTC(), nil
+}
+
+// SetClickRollupMark moves the rollup mark forward to rolledUpTo; it never moves back, so instances may race
+func (r *clickRepository) SetClickRollupMark(pctx context.Context, rolledUpTo time.Time) error {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `UPDATE click_rollup_progress SET rolled_up_to = GREATEST(rolled_up_to, $1)`
+
+	if _, err := r.db.ExecContext(ctx, query, rolledUpTo.UTC()); err != nil {
+		log.Printf("Error moving the click rollup mark: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// CountClicksByDimension groups the clicks within [from, to) by one event attribute, largest first;
+// purged days are read from their daily aggregates
+func (r *clickRepository) CountClicksByDimension(pctx context.Context, urlID uint, dimension string, from time.Time, to time.Time, includeBots bool) ([]*model.ClickDimensionCount, error) {
+
+	column, ok := clickDimensionColumns[dimension]
+	if !ok {
+		return nil, errors.New("unknown click dimension")
+	}
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	query := fmt.Sprintf(`SELECT value, SUM(clicks)::bigint AS clicks
+              FROM (
+                  SELECT COALESCE(%s, '') AS value, COUNT(1) AS clicks
+                  FROM click_events
+                  WHERE url_id = $1 AND clicked_at >= $2 AND clicked_at < $3 AND ($4 OR NOT is_bot)
+                  GROUP BY 1
+                  UNION ALL
+                  SELECT value, clicks + CASE WHEN $4 THEN bot_clicks ELSE 0 END
+                  FROM click_dimension_daily
+                  WHERE url_id = $1 AND dimension = $5 AND day >= date_trunc('day', $2::timestamp) AND day < $3
+              ) c
+              GROUP BY 1
+              ORDER BY 2 DESC`, column)
+
+	counts := make([]*model.ClickDimensionCount, 0)
+	if err := r.db.SelectContext(ctx, &counts, query, urlID, from.UTC(), to.UTC(), includeBots, dimension); err != nil {
+		log.Printf("Error counting clicks by %s for url %d: %v", dimension, urlID, err)
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// MergeVisitorSketch folds a sketch into the stored one for the day, locking the row so concurrent merges are not lost
+func (r *clickRepository) MergeVisitorSketch(pctx context.Context, urlID uint, day time.Time, sketch *hll.Sketch) error {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting visitor sketch merge for url %d: %v", urlID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	day = day.UTC().Truncate(time.Hour * 24)
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO click_visitor_sketches (url_id, day, sketch)
+              VALUES ($1, $2, $3)
+              ON CONFLICT (url_id, day) DO NOTHING`, urlID, day, hll.New().Bytes()); err != nil {
+		log.Printf("Error seeding visitor sketch for url %d: %v", urlID, err)
+		return err
+	}
+
+	var stored []byte
+	if err := tx.GetContext(ctx, &stored, `SELECT sketch FROM click_visitor_sketches
+              WHERE url_id = $1 AND day = $2
+              FOR UPDATE`, urlID, day); err != nil {
+		log.Printf("Error locking visitor sketch for url %d: %v", urlID, err)
+		return err
+	}
+
+	merged, err := hll.FromBytes(stored)
+	if err != nil {
+		log.Printf("Error decoding visitor sketch for url %d: %v", urlID, err)
+		return err
+	}
+	merged.Merge(sketch)
+
+	if _, err := tx.ExecContext(ctx, `UPDATE click_visitor_sketches SET sketch = $3
+              WHERE url_id = $1 AND day = $2`, urlID, day, merged.Bytes()); err != nil {
+		log.Printf("Error saving visitor sketch for url %d: %v", urlID, err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListVisitorSketches returns the daily sketches of the UTC days touching [from, to]
+func (r *clickRepository) ListVisitorSketches(pctx context.Context, urlID uint, from time.Time, to time.Time) ([]*model.VisitorSketch, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	query := `SELECT url_id, day, sketch FROM click_visitor_sketches
+              WHERE url_id = $1 AND day >= $2 AND day <= $3
+              ORDER BY day`
+
+	sketches := make([]*model.VisitorSketch, 0)
+	if err := r.db.SelectContext(ctx, &sketches, query, urlID, from.UTC().Truncate(time.Hour*24), to.UTC()); err != nil {
+		log.Printf("Error listing visitor sketches for url %d: %v", urlID, err)
+		return nil, err
+	}
+
+	return sketches, nil
+}
+
+// StreamClickEvents hands the events within [from, to) to fn one row at a time, oldest first, so exports never hold them all
+func (r *clickRepository) StreamClickEvents(pctx context.Context, urlID uint, from time.Time, to time.Time, includeBots bool, fn func(event *model.ClickEvent) error) error {
+
+	query := `SELECT id, url_id, clicked_at, COALESCE(referrer, '') AS referrer, COALESCE(referrer_host, '') AS referrer_host,
+                     COALESCE(user_agent, '') AS user_agent, COALESCE(browser, '') AS browser, COALESCE(os, '') AS os,
+                     COALESCE(ip_hash, '') AS ip_hash, COALESCE(country, '') AS country, COALESCE(device, '') AS device,
+                     source, is_bot
+              FROM click_events
+              WHERE url_id = $1 AND clicked_at >= $2 AND clicked_at < $3 AND ($4 OR NOT is_bot)
+              ORDER BY clicked_at`
+
+	rows, err := r.db.QueryxContext(pctx, query, urlID, from.UTC(), to.UTC(), includeBots)
+	if err != nil {
+		log.Printf("Error streaming click events for url %d: %v", urlID, err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event := new(model.ClickEvent)
+		if err := rows.StructScan(event); err != nil {
+			log.Printf("Error scanning click event for url %d: %v", urlID, err)
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ListClickedURLs returns the links with at least one click within [from, to), by short code
+func (r *clickRepository) ListClickedURLs(pctx context.Context, from time.Time, to time.Time) ([]*model.URL, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*30)
+	defer cancel()
+
+	query := `SELECT id, short_code, original_url, click_count, created_at, updated_at
+              FROM urls
+              WHERE EXISTS (
+                  SELECT 1 FROM click_events
+                  WHERE click_events.url_id = urls.id AND clicked_at >= $1 AND clicked_at < $2
+              )
+              ORDER BY short_code`
+
+	urls := make([]*model.URL, 0)
+	if err := r.db.SelectContext(ctx, &urls, query, from.UTC(), to.UTC()); err != nil {
+		log.Printf("Error listing clicked urls: %v", err)
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// SumClicksByWindow totals the hourly rollups of every link over [from, to) and the preceding [previousFrom, from)
+func (r *clickRepository) SumClicksByWindow(pctx context.Context, previousFrom time.Time, from time.Time, to time.Time) ([]*model.URLClickWindow, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*30)
+	defer cancel()
+
+	query := `SELECT r.url_id, u.short_code, u.original_url,
+                     COALESCE(SUM(r.clicks) FILTER (WHERE r.bucket >= $2), 0) AS clicks,
+                     COALESCE(SUM(r.clicks) FILTER (WHERE r.bucket < $2), 0) AS previous_clicks
+              FROM click_rollups_hourly r
+              JOIN urls u ON u.id = r.url_id
+              WHERE r.bucket >= $1 AND r.bucket < $3
+              GROUP BY r.url_id, u.short_code, u.original_url`
+
+	windows := make([]*model.URLClickWindow, 0)
+	if err := r.db.SelectContext(ctx, &windows, query, previousFrom.UTC(), from.UTC(), to.UTC()); err != nil {
+		log.Printf("Error summing clicks by window: %v", err)
+		return nil, err
+	}
+
+	return windows, nil
+}
+
+// EnsureDailySalt stores candidate as the visitor salt of a UTC day unless another instance got there first, and returns the stored one
+func (r *clickRepository) EnsureDailySalt(pctx context.Context, day time.Time, candidate []byte) ([]byte, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	day = day.UTC().Truncate(time.Hour * 24)
+
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO click_daily_salts (day, salt) VALUES ($1, $2)
+              ON CONFLICT (day) DO NOTHING`, day, candidate); err != nil {
+		log.Printf("Error storing visitor salt for %s: %v", day.Format("2006-01-02"), err)
+		return nil, err
+	}
+
+	var salt []byte
+	if err := r.db.GetContext(ctx, &salt, `SELECT salt FROM click_daily_salts WHERE day = $1`, day); err != nil {
+		log.Printf("Error reading visitor salt for %s: %v", day.Format("2006-01-02"), err)
+		return nil, err
+	}
+
+	return salt, nil
+}
+
+// DeleteDailySaltsBefore forgets the salts of every day before day, after which their hashes cannot be recomputed
+func (r *clickRepository) DeleteDailySaltsBefore(pctx context.Context, day time.Time) error {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM click_daily_salts WHERE day < $1`, day.UTC()); err != nil {
+		log.Printf("Error deleting visitor salts: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// OldestClickEventTime returns when the oldest raw event was recorded, or the zero time when there are none
+func (r *clickRepository) OldestClickEventTime(pctx context.Context) (time.Time, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	var oldest sql.NullTime
+	if err := r.db.GetContext(ctx, &oldest, `SELECT MIN(clicked_at) FROM click_events`); err != nil {
+		log.Printf("Error finding the oldest click event: %v", err)
+		return time.Time{}, err
+	}
+
+	return oldest.Time, nil
+}
+
+// PurgeClickEvents deletes the raw events within [from, to) in one transaction, first settling their hourly rollups,
+// which totals keep reading, and their daily breakdowns when aggregate is set
+func (r *clickRepository) PurgeClickEvents(pctx context.Context, from time.Time, to time.Time, aggregate bool) (int64, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Minute*5)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting click event purge: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	from, to = from.UTC(), to.UTC()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO click_rollups_hourly (url_id, bucket, clicks, bot_clicks)
+              SELECT url_id, date_trunc('hour', clicked_at), COUNT(1) FILTER (WHERE NOT is_bot), COUNT(1) FILTER (WHERE is_bot)
+              FROM click_events
+              WHERE clicked_at >= $1 AND clicked_at < $2 AND EXISTS (SELECT 1 FROM urls WHERE urls.id = click_events.url_id)
+              GROUP BY 1, 2
+              ON CONFLICT (url_id, bucket) DO UPDATE SET clicks = EXCLUDED.clicks, bot_clicks = EXCLUDED.bot_clicks`, from, to); err != nil {
+		log.Printf("Error settling click rollups before purge: %v", err)
+		return 0, err
+	}
+
+	if aggregate {
+		for dimension, column := range clickDimensionColumns {
+			query := fmt.Sprintf(`INSERT INTO click_dimension_daily (url_id, day, dimension, value, clicks, bot_clicks)
+              SELECT url_id, date_trunc('day', clicked_at)::date, $3, LEFT(COALESCE(%s, ''), 255),
+                     COUNT(1) FILTER (WHERE NOT is_bot), COUNT(1) FILTER (WHERE is_bot)
+              FROM click_events
+              WHERE clicked_at >= $1 AND clicked_at < $2 AND EXISTS (SELECT 1 FROM urls WHERE urls.id = click_events.url_id)
+              GROUP BY 1, 2, 4
+              ON CONFLICT (url_id, day, dimension, value) DO UPDATE SET clicks = click_dimension_daily.clicks + EXCLUDED.clicks,
+                                                                        bot_clicks = click_dimension_daily.bot_clicks + EXCLUDED.bot_clicks`, column)
+
+			if _, err := tx.ExecContext(ctx, query, from, to, dimension); err != nil {
+				log.Printf("Error aggregating clicks by %s before purge: %v", dimension, err)
+				return 0, err
+			}
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM click_events WHERE clicked_at >= $1 AND clicked_at < $2`, from, to)
+	if err != nil {
+		log.Printf("Error purging click events: %v", err)
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing click event purge: %v", err)
+		return 0, err
+	}
+
+	return purged, nil
+}
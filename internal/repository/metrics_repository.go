@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"shorten-url/internal/model"
+	"shorten-url/pkg/metrics"
+	"time"
+)
+
+var queryDuration = metrics.Default.NewHistogramVec(
+	"shorten_repository_query_duration_seconds",
+	"Time spent in URL repository calls, by method.",
+	[]float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	"method",
+)
+
+func observeQuery(method string, start time.Time) {
+	queryDuration.Observe(time.Since(start).Seconds(), method)
+}
+
+// instrumentedURLRepository times every call of the repository it wraps
+type instrumentedURLRepository struct {
+	inner URLRepository
+}
+
+// NewInstrumentedURLRepository records the latency of each URLRepository method of inner
+func NewInstrumentedURLRepository(inner URLRepository) URLRepository {
+	return &instrumentedURLRepository{
+		inner: inner,
+	}
+}
+
+func (r *instrumentedURLRepository) Create(ctx context.Context, url *model.URL) (*model.URLInterpeter, error) {
+	defer observeQuery("Create", time.Now())
+	return r.inner.Create(ctx, url)
+}
+
+func (r *instrumentedURLRepository) GetQrCode(pctx context.Context, urlID uint) (*model.Qrcode, error) {
+	defer observeQuery("GetQrCode", time.Now())
+	return r.inner.GetQrCode(pctx, urlID)
+}
+
+func (r *instrumentedURLRepository) SaveQrCode(pctx context.Context, qrcode *model.Qrcode) (*model.Qrcode, error) {
+	defer observeQuery("SaveQrCode", time.Now())
+	return r.inner.SaveQrCode(pctx, qrcode)
+}
+
+func (r *instrumentedURLRepository) RetargetQrCode(pctx context.Context, qrcode *model.Qrcode) (*model.Qrcode, error) {
+	defer observeQuery("RetargetQrCode", time.Now())
+	return r.inner.RetargetQrCode(pctx, qrcode)
+}
+
+func (r *instrumentedURLRepository) GetURLByScanCode(pctx context.Context, scanCode string) (*model.URL, error) {
+	defer observeQuery("GetURLByScanCode", time.Now())
+	return r.inner.GetURLByScanCode(pctx, scanCode)
+}
+
+func (r *instrumentedURLRepository) GetWorkspaceLogo(pctx context.Context, workspace string) (*model.WorkspaceLogo, error) {
+	defer observeQuery("GetWorkspaceLogo", time.Now())
+	return r.inner.GetWorkspaceLogo(pctx, workspace)
+}
+
+func (r *instrumentedURLRepository) SaveWorkspaceLogo(pctx context.Context, logo *model.WorkspaceLogo) (*model.WorkspaceLogo, error) {
+	defer observeQuery("SaveWorkspaceLogo", time.Now())
+	return r.inner.SaveWorkspaceLogo(pctx, logo)
+}
+
+func (r *instrumentedURLRepository) DeleteWorkspaceLogo(pctx context.Context, workspace string) (bool, error) {
+	defer observeQuery("DeleteWorkspaceLogo", time.Now())
+	return r.inner.DeleteWorkspaceLogo(pctx, workspace)
+}
+
+func (r *instrumentedURLRepository) GetByShortCode(ctx context.Context, shortCode string) (*model.URL, error) {
+	defer observeQuery("GetByShortCode", time.Now())
+	return r.inner.GetByShortCode(ctx, shortCode)
+}
+
+func (r *instrumentedURLRepository) ListByShortCodes(pctx context.Context, shortCodes []string) ([]*model.URL, error) {
+	defer observeQuery("ListByShortCodes", time.Now())
+	return r.inner.ListByShortCodes(pctx, shortCodes)
+}
+
+func (r *instrumentedURLRepository) ListByCampaign(pctx context.Context, campaign string, limit int) ([]*model.URL, error) {
+	defer observeQuery("ListByCampaign", time.Now())
+	return r.inner.ListByCampaign(pctx, campaign, limit)
+}
+
+func (r *instrumentedURLRepository) UpdateShortUrl(pctx context.Context, shortCode string, updatedUrl string) (*model.URL, error) {
+	defer observeQuery("UpdateShortUrl", time.Now())
+	return r.inner.UpdateShortUrl(pctx, shortCode, updatedUrl)
+}
+
+func (r *instrumentedURLRepository) DeleteByShortCode(ctx context.Context, shortCode string) error {
+	defer observeQuery("DeleteByShortCode", time.Now())
+	return r.inner.DeleteByShortCode(ctx, shortCode)
+}
+
+func (r *instrumentedURLRepository) IsShortCodeExists(pctx context.Context, shortCode string) bool {
+	defer observeQuery("IsShortCodeExists", time.Now())
+	return r.inner.IsShortCodeExists(pctx, shortCode)
+}
+
+func (r *instrumentedURLRepository) ListURLsDueForCheck(pctx context.Context, checkedBefore time.Time, limit int) ([]*model.URL, error) {
+	defer observeQuery("ListURLsDueForCheck", time.Now())
+	return r.inner.ListURLsDueForCheck(pctx, checkedBefore, limit)
+}
+
+func (r *instrumentedURLRepository) SaveURLHealth(pctx context.Context, health *model.URLHealth, brokenThreshold int) (*model.URLHealth, error) {
+	defer observeQuery("SaveURLHealth", time.Now())
+	return r.inner.SaveURLHealth(pctx, health, brokenThreshold)
+}
+
+func (r *instrumentedURLRepository) GetURLHealth(pctx context.Context, urlID uint) (*model.URLHealth, error) {
+	defer observeQuery("GetURLHealth", time.Now())
+	return r.inner.GetURLHealth(pctx, urlID)
+}
+
+func (r *instrumentedURLRepository) ListBrokenURLs(pctx context.Context) ([]*model.BrokenURL, error) {
+	defer observeQuery("ListBrokenURLs", time.Now())
+	return r.inner.ListBrokenURLs(pctx)
+}
+
+func (r *instrumentedURLRepository) FindShortCodeConflicts(pctx context.Context, exact []string, terms []string) ([]*model.URL, error) {
+	defer observeQuery("FindShortCodeConflicts", time.Now())
+	return r.inner.FindShortCodeConflicts(pctx, exact, terms)
+}
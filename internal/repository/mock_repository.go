@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 	"shorten-url/internal/model"
+	"shorten-url/pkg/hll"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -22,14 +24,57 @@ func (mr *MockURLRepository) Create(ctx context.Context, url *model.URL) (*model
 
 	return args.Get(0).(*model.URLInterpeter), args.Error(1)
 }
-func (mr *MockURLRepository) CreateQrCode(ctx context.Context, url *model.Qrcode) (*model.QrcodeInterpeter, error) {
-	args := mr.Called(ctx, url)
+func (mr *MockURLRepository) GetQrCode(pctx context.Context, urlID uint) (*model.Qrcode, error) {
+	args := mr.Called(pctx, urlID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.Qrcode), args.Error(1)
+}
+func (mr *MockURLRepository) SaveQrCode(pctx context.Context, qrcode *model.Qrcode) (*model.Qrcode, error) {
+	args := mr.Called(pctx, qrcode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.Qrcode), args.Error(1)
+}
+func (mr *MockURLRepository) RetargetQrCode(pctx context.Context, qrcode *model.Qrcode) (*model.Qrcode, error) {
+	args := mr.Called(pctx, qrcode)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 
-	return args.Get(0).(*model.QrcodeInterpeter), args.Error(1)
+	return args.Get(0).(*model.Qrcode), args.Error(1)
+}
+func (mr *MockURLRepository) GetURLByScanCode(pctx context.Context, scanCode string) (*model.URL, error) {
+	args := mr.Called(pctx, scanCode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
 
+	return args.Get(0).(*model.URL), args.Error(1)
+}
+func (mr *MockURLRepository) GetWorkspaceLogo(pctx context.Context, workspace string) (*model.WorkspaceLogo, error) {
+	args := mr.Called(pctx, workspace)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.WorkspaceLogo), args.Error(1)
+}
+func (mr *MockURLRepository) SaveWorkspaceLogo(pctx context.Context, logo *model.WorkspaceLogo) (*model.WorkspaceLogo, error) {
+	args := mr.Called(pctx, logo)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.WorkspaceLogo), args.Error(1)
+}
+func (mr *MockURLRepository) DeleteWorkspaceLogo(pctx context.Context, workspace string) (bool, error) {
+	args := mr.Called(pctx, workspace)
+	return args.Bool(0), args.Error(1)
 }
 func (mr *MockURLRepository) GetByShortCode(ctx context.Context, shortCode string) (*model.URL, error) {
 
@@ -40,6 +85,24 @@ func (mr *MockURLRepository) GetByShortCode(ctx context.Context, shortCode strin
 
 	return args.Get(0).(*model.URL), args.Error(1)
 }
+func (mr *MockURLRepository) ListByShortCodes(pctx context.Context, shortCodes []string) ([]*model.URL, error) {
+
+	args := mr.Called(pctx, shortCodes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.URL), args.Error(1)
+}
+func (mr *MockURLRepository) ListByCampaign(pctx context.Context, campaign string, limit int) ([]*model.URL, error) {
+
+	args := mr.Called(pctx, campaign, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.URL), args.Error(1)
+}
 func (mr *MockURLRepository) UpdateShortUrl(pctx context.Context, shortCode string, updatedUrl string) (*model.URL, error) {
 
 	args := mr.Called(pctx, shortCode, updatedUrl)
@@ -55,15 +118,322 @@ func (mr *MockURLRepository) DeleteByShortCode(pctx context.Context, shortCode s
 
 	return args.Error(0)
 }
-func (mr *MockURLRepository) UpdateShortUrlCount(pctx context.Context, shortCode string) error {
+func (mr *MockURLRepository) IsShortCodeExists(pctx context.Context, shortCode string) bool {
 
 	args := mr.Called(pctx, shortCode)
 
+	return args.Bool(0)
+}
+func (mr *MockURLRepository) ListURLsDueForCheck(pctx context.Context, checkedBefore time.Time, limit int) ([]*model.URL, error) {
+
+	args := mr.Called(pctx, checkedBefore, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.URL), args.Error(1)
+}
+func (mr *MockURLRepository) SaveURLHealth(pctx context.Context, health *model.URLHealth, brokenThreshold int) (*model.URLHealth, error) {
+
+	args := mr.Called(pctx, health, brokenThreshold)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.URLHealth), args.Error(1)
+}
+func (mr *MockURLRepository) GetURLHealth(pctx context.Context, urlID uint) (*model.URLHealth, error) {
+
+	args := mr.Called(pctx, urlID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.URLHealth), args.Error(1)
+}
+func (mr *MockURLRepository) ListBrokenURLs(pctx context.Context) ([]*model.BrokenURL, error) {
+
+	args := mr.Called(pctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.BrokenURL), args.Error(1)
+}
+func (mr *MockURLRepository) FindShortCodeConflicts(pctx context.Context, exact []string, terms []string) ([]*model.URL, error) {
+
+	args := mr.Called(pctx, exact, terms)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.URL), args.Error(1)
+}
+
+type MockBlocklistRepository struct {
+	mock.Mock
+}
+
+func (mr *MockBlocklistRepository) CreateRule(pctx context.Context, rule *model.BlocklistRule) (*model.BlocklistRule, error) {
+
+	args := mr.Called(pctx, rule)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.BlocklistRule), args.Error(1)
+}
+func (mr *MockBlocklistRepository) ListRules(pctx context.Context) ([]*model.BlocklistRule, error) {
+
+	args := mr.Called(pctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.BlocklistRule), args.Error(1)
+}
+func (mr *MockBlocklistRepository) DeleteRule(pctx context.Context, id uint) error {
+
+	args := mr.Called(pctx, id)
+
 	return args.Error(0)
 }
-func (mr *MockURLRepository) IsShortCodeExists(pctx context.Context, shortCode string) bool {
 
-	args := mr.Called(pctx, shortCode)
+type MockClickRepository struct {
+	mock.Mock
+}
 
-	return args.Bool(0)
+func (mr *MockClickRepository) InsertClickEvents(pctx context.Context, events []*model.ClickEvent) error {
+
+	args := mr.Called(pctx, events)
+
+	return args.Error(0)
+}
+
+func (mr *MockClickRepository) AddClickCounts(pctx context.Context, deltas map[uint]int) ([]*model.URL, error) {
+
+	args := mr.Called(pctx, deltas)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.URL), args.Error(1)
+}
+
+func (mr *MockClickRepository) AddQrCodeScans(pctx context.Context, deltas map[uint]int) error {
+
+	args := mr.Called(pctx, deltas)
+	return args.Error(0)
+}
+
+func (mr *MockClickRepository) CountClicks(pctx context.Context, urlID uint, rolledUpBefore time.Time, includeBots bool) (int, error) {
+
+	args := mr.Called(pctx, urlID, rolledUpBefore, includeBots)
+
+	return args.Int(0), args.Error(1)
+}
+func (mr *MockClickRepository) EnsureClickPartitions(pctx context.Context, from time.Time, months int) error {
+
+	args := mr.Called(pctx, from, months)
+
+	return args.Error(0)
+}
+func (mr *MockClickRepository) CountClicksByMinute(pctx context.Context, urlID uint, from time.Time, to time.Time, includeBots bool) ([]*model.ClickBucket, error) {
+
+	args := mr.Called(pctx, urlID, from, to, includeBots)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.ClickBucket), args.Error(1)
+}
+func (mr *MockClickRepository) CountClicksByHour(pctx context.Context, urlID uint, from time.Time, to time.Time, includeBots bool) ([]*model.ClickBucket, error) {
+
+	args := mr.Called(pctx, urlID, from, to, includeBots)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.ClickBucket), args.Error(1)
+}
+func (mr *MockClickRepository) RefreshClickRollups(pctx context.Context, from time.Time, to time.Time) error {
+
+	args := mr.Called(pctx, from, to)
+
+	return args.Error(0)
+}
+
+func (mr *MockClickRepository) GetClickRollupMark(pctx context.Context) (time.Time, error) {
+
+	args := mr.Called(pctx)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (mr *MockClickRepository) SetClickRollupMark(pctx context.Context, rolledUpTo time.Time) error {
+
+	args := mr.Called(pctx, rolledUpTo)
+	return args.Error(0)
+}
+func (mr *MockClickRepository) CountClicksByDimension(pctx context.Context, urlID uint, dimension string, from time.Time, to time.Time, includeBots bool) ([]*model.ClickDimensionCount, error) {
+
+	args := mr.Called(pctx, urlID, dimension, from, to, includeBots)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.ClickDimensionCount), args.Error(1)
+}
+
+func (mr *MockClickRepository) MergeVisitorSketch(pctx context.Context, urlID uint, day time.Time, sketch *hll.Sketch) error {
+
+	args := mr.Called(pctx, urlID, day, sketch)
+	return args.Error(0)
+}
+
+func (mr *MockClickRepository) ListVisitorSketches(pctx context.Context, urlID uint, from time.Time, to time.Time) ([]*model.VisitorSketch, error) {
+
+	args := mr.Called(pctx, urlID, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.VisitorSketch), args.Error(1)
+}
+
+// StreamClickEvents feeds the events given to Return to fn, stopping at the first error fn returns
+func (mr *MockClickRepository) StreamClickEvents(pctx context.Context, urlID uint, from time.Time, to time.Time, includeBots bool, fn func(event *model.ClickEvent) error) error {
+
+	args := mr.Called(pctx, urlID, from, to, includeBots)
+	if events, ok := args.Get(0).([]*model.ClickEvent); ok {
+		for _, event := range events {
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+	}
+
+	return args.Error(1)
+}
+
+func (mr *MockClickRepository) ListClickedURLs(pctx context.Context, from time.Time, to time.Time) ([]*model.URL, error) {
+
+	args := mr.Called(pctx, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.URL), args.Error(1)
+}
+
+func (mr *MockClickRepository) SumClicksByWindow(pctx context.Context, previousFrom time.Time, from time.Time, to time.Time) ([]*model.URLClickWindow, error) {
+
+	args := mr.Called(pctx, previousFrom, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.URLClickWindow), args.Error(1)
+}
+
+func (mr *MockClickRepository) EnsureDailySalt(pctx context.Context, day time.Time, candidate []byte) ([]byte, error) {
+
+	args := mr.Called(pctx, day, candidate)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (mr *MockClickRepository) DeleteDailySaltsBefore(pctx context.Context, day time.Time) error {
+
+	args := mr.Called(pctx, day)
+	return args.Error(0)
+}
+
+func (mr *MockClickRepository) OldestClickEventTime(pctx context.Context) (time.Time, error) {
+
+	args := mr.Called(pctx)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (mr *MockClickRepository) PurgeClickEvents(pctx context.Context, from time.Time, to time.Time, aggregate bool) (int64, error) {
+
+	args := mr.Called(pctx, from, to, aggregate)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+func (mr *MockWebhookRepository) CreateEndpoint(pctx context.Context, endpoint *model.WebhookEndpoint) (*model.WebhookEndpoint, error) {
+
+	args := mr.Called(pctx, endpoint)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.WebhookEndpoint), args.Error(1)
+}
+
+func (mr *MockWebhookRepository) ListEndpoints(pctx context.Context) ([]*model.WebhookEndpoint, error) {
+
+	args := mr.Called(pctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.WebhookEndpoint), args.Error(1)
+}
+
+func (mr *MockWebhookRepository) DeleteEndpoint(pctx context.Context, id uint) error {
+
+	args := mr.Called(pctx, id)
+
+	return args.Error(0)
+}
+
+func (mr *MockWebhookRepository) EnqueueDeliveries(pctx context.Context, eventID string, eventType string, payload []byte, at time.Time) (int64, error) {
+
+	args := mr.Called(pctx, eventID, eventType, payload, at)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (mr *MockWebhookRepository) ClaimDueDeliveries(pctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]*model.WebhookDeliveryTarget, error) {
+
+	args := mr.Called(pctx, now, leaseUntil, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.WebhookDeliveryTarget), args.Error(1)
+}
+
+func (mr *MockWebhookRepository) SaveDeliveryAttempt(pctx context.Context, delivery *model.WebhookDelivery) error {
+
+	args := mr.Called(pctx, delivery)
+
+	return args.Error(0)
+}
+
+func (mr *MockWebhookRepository) ListDeliveries(pctx context.Context, endpointID uint, status string, limit int) ([]*model.WebhookDelivery, error) {
+
+	args := mr.Called(pctx, endpointID, status, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.WebhookDelivery), args.Error(1)
+}
+
+func (mr *MockWebhookRepository) ReplayDelivery(pctx context.Context, id int64, at time.Time) (*model.WebhookDelivery, error) {
+
+	args := mr.Called(pctx, id, at)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.WebhookDelivery), args.Error(1)
 }
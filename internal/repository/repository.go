@@ -5,20 +5,34 @@ import (
 	"errors"
 	"log"
 	"shorten-url/internal/model"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // Example repository interface - modify as needed
 type URLRepository interface {
 	Create(ctx context.Context, url *model.URL) (*model.URLInterpeter, error)
-	CreateQrCode(ctx context.Context, url *model.Qrcode) (*model.QrcodeInterpeter, error)
+	GetQrCode(pctx context.Context, urlID uint) (*model.Qrcode, error)
+	SaveQrCode(pctx context.Context, qrcode *model.Qrcode) (*model.Qrcode, error)
+	RetargetQrCode(pctx context.Context, qrcode *model.Qrcode) (*model.Qrcode, error)
+	GetURLByScanCode(pctx context.Context, scanCode string) (*model.URL, error)
+	GetWorkspaceLogo(pctx context.Context, workspace string) (*model.WorkspaceLogo, error)
+	SaveWorkspaceLogo(pctx context.Context, logo *model.WorkspaceLogo) (*model.WorkspaceLogo, error)
+	DeleteWorkspaceLogo(pctx context.Context, workspace string) (bool, error)
 	GetByShortCode(ctx context.Context, shortCode string) (*model.URL, error)
+	ListByShortCodes(pctx context.Context, shortCodes []string) ([]*model.URL, error)
+	ListByCampaign(pctx context.Context, campaign string, limit int) ([]*model.URL, error)
 	UpdateShortUrl(pctx context.Context, shortCode string, updatedUrl string) (*model.URL, error)
 	DeleteByShortCode(ctx context.Context, shortCode string) error
-	UpdateShortUrlCount(pctx context.Context, shortCode string) error
 	IsShortCodeExists(pctx context.Context, shortCode string) bool
+	ListURLsDueForCheck(pctx context.Context, checkedBefore time.Time, limit int) ([]*model.URL, error)
+	SaveURLHealth(pctx context.Context, health *model.URLHealth, brokenThreshold int) (*model.URLHealth, error)
+	GetURLHealth(pctx context.Context, urlID uint) (*model.URLHealth, error)
+	ListBrokenURLs(pctx context.Context) ([]*model.BrokenURL, error)
+	FindShortCodeConflicts(pctx context.Context, exact []string, terms []string) ([]*model.URL, error)
 }
 
 // Example repository struct - modify as needed
@@ -55,12 +69,12 @@ func (r *urlRepository) Create(ctx context.Context, url *model.URL) (*model.URLI
 	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 
-	url.ClickCount = 1
+	url.ClickCount = 0
 	url.QrCodeUrl = ""
 
-	query := `INSERT INTO urls (short_code, original_url,qrcode_url, click_count) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at`
+	query := `INSERT INTO urls (short_code, original_url,qrcode_url, click_count, campaign) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at`
 
-	err := r.db.QueryRowContext(ctx, query, url.ShortCode, url.OriginalURL, url.QrCodeUrl, url.ClickCount).Scan(&url.ID, &url.CreatedAt, &url.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, url.ShortCode, url.OriginalURL, url.QrCodeUrl, url.ClickCount, url.Campaign).Scan(&url.ID, &url.CreatedAt, &url.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -72,54 +86,138 @@ func (r *urlRepository) Create(ctx context.Context, url *model.URL) (*model.URLI
 	}, nil
 }
 
-func (r *urlRepository) CreateQrCode(pctx context.Context, url *model.Qrcode) (*model.QrcodeInterpeter, error) {
+// GetQrCode returns the QR code of a link, or sql.ErrNoRows when none was generated yet
+func (r *urlRepository) GetQrCode(pctx context.Context, urlID uint) (*model.Qrcode, error) {
 
 	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
 	defer cancel()
 
-	url.ClickCount = 1
+	query := `SELECT id, url_id, scan_code, original_url, COALESCE(qrcode_url, '') AS qrcode_url, COALESCE(click_count, 0) AS click_count, created_at, updated_at
+              FROM qrcode
+              WHERE url_id = $1`
 
-	query := `INSERT INTO qrcode (original_url, qrcode_url, click_count) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at`
+	qrcode := new(model.Qrcode)
+	if err := r.db.GetContext(ctx, qrcode, query, urlID); err != nil {
+		return nil, err
+	}
 
-	err := r.db.QueryRowContext(ctx, query, url.OriginalURL, url.QrCodeUrl, url.ClickCount).Scan(&url.ID, &url.CreatedAt, &url.UpdatedAt)
-	if err != nil {
+	return qrcode, nil
+}
+
+// SaveQrCode stores the QR code of a link, replacing the one it already has. A code keeps the scan code it
+// was first saved with, so the returned ScanCode is the one in effect.
+func (r *urlRepository) SaveQrCode(pctx context.Context, qrcode *model.Qrcode) (*model.Qrcode, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `INSERT INTO qrcode (url_id, scan_code, original_url, qrcode_url)
+              VALUES ($1, $2, $3, $4)
+              ON CONFLICT (url_id) DO UPDATE SET original_url = EXCLUDED.original_url, qrcode_url = EXCLUDED.qrcode_url, updated_at = CURRENT_TIMESTAMP
+              RETURNING id, scan_code, COALESCE(click_count, 0), created_at, updated_at`
+
+	if err := r.db.QueryRowContext(ctx, query, qrcode.URLID, qrcode.ScanCode, qrcode.OriginalURL, qrcode.QrCodeUrl).Scan(&qrcode.ID, &qrcode.ScanCode, &qrcode.ClickCount, &qrcode.CreatedAt, &qrcode.UpdatedAt); err != nil {
+		log.Printf("Error saving qr code for url %d: %v", qrcode.URLID, err)
 		return nil, err
 	}
 
-	return &model.QrcodeInterpeter{
-		ID:        url.ID,
-		CreatedAt: url.CreatedAt,
-		UpdatedAt: url.UpdatedAt,
-	}, nil
+	return qrcode, nil
 }
 
-func (r *urlRepository) UpdateShortUrlCount(pctx context.Context, shortCode string) error {
-	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+// RetargetQrCode moves the QR code with qrcode.ScanCode to the link qrcode.URLID, or returns sql.ErrNoRows
+// when there is no such code
+func (r *urlRepository) RetargetQrCode(pctx context.Context, qrcode *model.Qrcode) (*model.Qrcode, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
 	defer cancel()
 
-	query := `UPDATE urls 
-              SET click_count = click_count + 1, updated_at = CURRENT_TIMESTAMP 
-              WHERE short_code = $1`
+	query := `UPDATE qrcode
+              SET url_id = $2, qrcode_url = $3, updated_at = CURRENT_TIMESTAMP
+              WHERE scan_code = $1
+              RETURNING id, original_url, COALESCE(click_count, 0), created_at, updated_at`
 
-	result, err := r.db.ExecContext(ctx, query, shortCode)
-	if err != nil {
-		log.Printf("Error updating click count for short code %s: %v", shortCode, err)
-		return err
+	if err := r.db.QueryRowContext(ctx, query, qrcode.ScanCode, qrcode.URLID, qrcode.QrCodeUrl).Scan(&qrcode.ID, &qrcode.OriginalURL, &qrcode.ClickCount, &qrcode.CreatedAt, &qrcode.UpdatedAt); err != nil {
+		log.Printf("Error retargeting qr code %s to url %d: %v", qrcode.ScanCode, qrcode.URLID, err)
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		log.Printf("Error checking rows affected for short code %s: %v", shortCode, err)
-		return err
+	return qrcode, nil
+}
+
+// GetURLByScanCode returns the link a QR code currently points to
+func (r *urlRepository) GetURLByScanCode(pctx context.Context, scanCode string) (*model.URL, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT u.id, u.short_code, u.original_url, u.qrcode_url, u.click_count, u.created_at, u.updated_at
+              FROM qrcode q
+              JOIN urls u ON u.id = q.url_id
+              WHERE q.scan_code = $1`
+
+	url := new(model.URL)
+	if err := r.db.GetContext(ctx, url, query, scanCode); err != nil {
+		log.Printf("Error getting URL by scan code: %v", err)
+		return nil, err
 	}
 
-	if rowsAffected == 0 {
-		log.Printf("No URL found with short code: %s", shortCode)
-		return errors.New("no URL found with the given short code")
+	return url, nil
+}
+
+// GetWorkspaceLogo returns the logo of a workspace, or sql.ErrNoRows when it has none
+func (r *urlRepository) GetWorkspaceLogo(pctx context.Context, workspace string) (*model.WorkspaceLogo, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT workspace, image, COALESCE(image_key, '') AS image_key, width, height, updated_at FROM workspace_logos WHERE workspace = $1`
+
+	logo := new(model.WorkspaceLogo)
+	if err := r.db.GetContext(ctx, logo, query, workspace); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return logo, nil
+}
+
+// SaveWorkspaceLogo records where the logo of a workspace is stored, replacing the one it already has;
+// bytes kept in the row by older versions are dropped
+func (r *urlRepository) SaveWorkspaceLogo(pctx context.Context, logo *model.WorkspaceLogo) (*model.WorkspaceLogo, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `INSERT INTO workspace_logos (workspace, image_key, width, height)
+              VALUES ($1, $2, $3, $4)
+              ON CONFLICT (workspace) DO UPDATE SET image = NULL, image_key = EXCLUDED.image_key, width = EXCLUDED.width, height = EXCLUDED.height, updated_at = CURRENT_TIMESTAMP
+              RETURNING updated_at`
+
+	if err := r.db.QueryRowContext(ctx, query, logo.Workspace, logo.ImageKey, logo.Width, logo.Height).Scan(&logo.UpdatedAt); err != nil {
+		log.Printf("Error saving logo of workspace %s: %v", logo.Workspace, err)
+		return nil, err
+	}
+
+	return logo, nil
+}
+
+// DeleteWorkspaceLogo removes the logo of a workspace and reports whether it had one
+func (r *urlRepository) DeleteWorkspaceLogo(pctx context.Context, workspace string) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM workspace_logos WHERE workspace = $1`, workspace)
+	if err != nil {
+		log.Printf("Error deleting logo of workspace %s: %v", workspace, err)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
 
+	return rowsAffected > 0, nil
 }
 
 func (r *urlRepository) GetByShortCode(ctx context.Context, shortCode string) (*model.URL, error) {
@@ -139,6 +237,44 @@ func (r *urlRepository) GetByShortCode(ctx context.Context, shortCode string) (*
 	return url, nil
 }
 
+// ListByShortCodes returns the links with any of the short codes, in no particular order; unknown codes are left out
+func (r *urlRepository) ListByShortCodes(pctx context.Context, shortCodes []string) ([]*model.URL, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	query := `SELECT id, short_code, original_url, qrcode_url, click_count, created_at, updated_at FROM urls WHERE short_code = ANY($1)`
+
+	urls := make([]*model.URL, 0, len(shortCodes))
+	if err := r.db.SelectContext(ctx, &urls, query, pq.Array(shortCodes)); err != nil {
+		log.Printf("Error listing %d URLs by short code: %v", len(shortCodes), err)
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// ListByCampaign returns at most limit links of a campaign, oldest first
+func (r *urlRepository) ListByCampaign(pctx context.Context, campaign string, limit int) ([]*model.URL, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	query := `SELECT id, short_code, original_url, qrcode_url, click_count, campaign, created_at, updated_at
+              FROM urls
+              WHERE campaign = $1
+              ORDER BY created_at, id
+              LIMIT $2`
+
+	urls := make([]*model.URL, 0)
+	if err := r.db.SelectContext(ctx, &urls, query, campaign, limit); err != nil {
+		log.Printf("Error listing URLs of campaign %s: %v", campaign, err)
+		return nil, err
+	}
+
+	return urls, nil
+}
+
 func (r *urlRepository) UpdateShortUrl(pctx context.Context, shortCode string, updatedUrl string) (*model.URL, error) {
 
 	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
@@ -166,14 +302,28 @@ func (r *urlRepository) UpdateShortUrl(pctx context.Context, shortCode string, u
 	return urlData, nil
 }
 
+// DeleteByShortCode deletes a link with its raw click events in one transaction. The events table is partitioned
+// and has no foreign key to urls; every other table keyed by the link cascades from it.
 func (r *urlRepository) DeleteByShortCode(ctx context.Context, shortCode string) error {
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting delete by short code %s: %v", shortCode, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM click_events WHERE url_id = (SELECT id FROM urls WHERE short_code = $1)`, shortCode); err != nil {
+		log.Printf("Error deleting click events by short code %s: %v", shortCode, err)
+		return err
+	}
+
 	query := `DELETE FROM urls WHERE short_code = $1 `
 
-	result, err := r.db.ExecContext(ctx, query, shortCode)
+	result, err := tx.ExecContext(ctx, query, shortCode)
 	if err != nil {
 		log.Printf("Error deleting URL by short code: %v", err)
 		return err
@@ -190,6 +340,139 @@ func (r *urlRepository) DeleteByShortCode(ctx context.Context, shortCode string)
 		return errors.New("no URL found with the given short code")
 	}
 
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing delete by short code %s: %v", shortCode, err)
+		return err
+	}
+
 	log.Printf("Successfully deleted URL with short code: %s", shortCode)
 	return nil
 }
+
+func (r *urlRepository) ListURLsDueForCheck(pctx context.Context, checkedBefore time.Time, limit int) ([]*model.URL, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	query := `SELECT u.id, u.short_code, u.original_url, u.qrcode_url, u.click_count, u.created_at, u.updated_at
+              FROM urls u
+              LEFT JOIN url_health h ON h.url_id = u.id
+              WHERE h.last_checked_at IS NULL OR h.last_checked_at < $1
+              ORDER BY h.last_checked_at NULLS FIRST
+              LIMIT $2`
+
+	urls := make([]*model.URL, 0)
+	if err := r.db.SelectContext(ctx, &urls, query, checkedBefore, limit); err != nil {
+		log.Printf("Error listing urls due for health check: %v", err)
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+func (r *urlRepository) SaveURLHealth(pctx context.Context, health *model.URLHealth, brokenThreshold int) (*model.URLHealth, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `INSERT INTO url_health (url_id, status_code, latency_ms, final_url, last_error, consecutive_failures, is_broken, last_checked_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+              ON CONFLICT (url_id) DO UPDATE SET
+                status_code = EXCLUDED.status_code,
+                latency_ms = EXCLUDED.latency_ms,
+                final_url = EXCLUDED.final_url,
+                last_error = EXCLUDED.last_error,
+                last_checked_at = EXCLUDED.last_checked_at,
+                consecutive_failures = CASE WHEN EXCLUDED.consecutive_failures = 0 THEN 0 ELSE url_health.consecutive_failures + 1 END,
+                is_broken = CASE WHEN EXCLUDED.consecutive_failures = 0 THEN FALSE ELSE url_health.consecutive_failures + 1 >= $9 END
+              RETURNING consecutive_failures, is_broken`
+
+	if err := r.db.QueryRowContext(ctx, query,
+		health.URLID,
+		health.StatusCode,
+		health.LatencyMs,
+		health.FinalURL,
+		health.LastError,
+		health.ConsecutiveFailures,
+		health.IsBroken,
+		health.LastCheckedAt,
+		brokenThreshold,
+	).Scan(&health.ConsecutiveFailures, &health.IsBroken); err != nil {
+		log.Printf("Error saving url health for url %d: %v", health.URLID, err)
+		return nil, err
+	}
+
+	return health, nil
+}
+
+func (r *urlRepository) GetURLHealth(pctx context.Context, urlID uint) (*model.URLHealth, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT url_id, COALESCE(status_code, 0) AS status_code, COALESCE(latency_ms, 0) AS latency_ms,
+                COALESCE(final_url, '') AS final_url, COALESCE(last_error, '') AS last_error,
+                consecutive_failures, is_broken, last_checked_at
+              FROM url_health WHERE url_id = $1`
+
+	health := new(model.URLHealth)
+	if err := r.db.GetContext(ctx, health, query, urlID); err != nil {
+		return nil, err
+	}
+
+	return health, nil
+}
+
+func (r *urlRepository) ListBrokenURLs(pctx context.Context) ([]*model.BrokenURL, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	query := `SELECT u.id, u.short_code, u.original_url, u.qrcode_url, u.click_count, u.created_at, u.updated_at,
+                h.url_id AS "health.url_id",
+                COALESCE(h.status_code, 0) AS "health.status_code",
+                COALESCE(h.latency_ms, 0) AS "health.latency_ms",
+                COALESCE(h.final_url, '') AS "health.final_url",
+                COALESCE(h.last_error, '') AS "health.last_error",
+                h.consecutive_failures AS "health.consecutive_failures",
+                h.is_broken AS "health.is_broken",
+                h.last_checked_at AS "health.last_checked_at"
+              FROM urls u
+              JOIN url_health h ON h.url_id = u.id
+              WHERE h.is_broken = TRUE
+              ORDER BY h.consecutive_failures DESC, u.id`
+
+	urls := make([]*model.BrokenURL, 0)
+	if err := r.db.SelectContext(ctx, &urls, query); err != nil {
+		log.Printf("Error listing broken urls: %v", err)
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// FindShortCodeConflicts lists links whose code equals an exact word or contains one of the terms
+func (r *urlRepository) FindShortCodeConflicts(pctx context.Context, exact []string, terms []string) ([]*model.URL, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*30)
+	defer cancel()
+
+	likeEscaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	patterns := make([]string, 0, len(terms))
+	for _, term := range terms {
+		patterns = append(patterns, "%"+likeEscaper.Replace(term)+"%")
+	}
+
+	query := `SELECT id, short_code, original_url, qrcode_url, click_count, created_at, updated_at
+              FROM urls
+              WHERE lower(short_code) = ANY($1) OR lower(short_code) LIKE ANY($2)
+              ORDER BY id`
+
+	urls := make([]*model.URL, 0)
+	if err := r.db.SelectContext(ctx, &urls, query, pq.Array(exact), pq.Array(patterns)); err != nil {
+		log.Printf("Error finding short code conflicts: %v", err)
+		return nil, err
+	}
+
+	return urls, nil
+}
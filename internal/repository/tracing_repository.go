@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"shorten-url/internal/model"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("shorten-url/internal/repository")
+
+func startSpan(pctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+
+	attrs = append(attrs, semconv.DBSystemNamePostgreSQL, semconv.DBOperationName(method))
+	return tracer.Start(pctx, "URLRepository."+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// finishSpan ends a span; a lookup that finds no row is an answer, not a failure
+func finishSpan(span trace.Span, err error) {
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// tracedURLRepository records a client span around every call of the repository it wraps
+type tracedURLRepository struct {
+	inner URLRepository
+}
+
+// NewTracedURLRepository traces each URLRepository method of inner
+func NewTracedURLRepository(inner URLRepository) URLRepository {
+	return &tracedURLRepository{
+		inner: inner,
+	}
+}
+
+func (r *tracedURLRepository) Create(ctx context.Context, url *model.URL) (*model.URLInterpeter, error) {
+	ctx, span := startSpan(ctx, "Create")
+	result, err := r.inner.Create(ctx, url)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) GetQrCode(pctx context.Context, urlID uint) (*model.Qrcode, error) {
+	ctx, span := startSpan(pctx, "GetQrCode")
+	result, err := r.inner.GetQrCode(ctx, urlID)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) SaveQrCode(pctx context.Context, qrcode *model.Qrcode) (*model.Qrcode, error) {
+	ctx, span := startSpan(pctx, "SaveQrCode")
+	result, err := r.inner.SaveQrCode(ctx, qrcode)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) RetargetQrCode(pctx context.Context, qrcode *model.Qrcode) (*model.Qrcode, error) {
+	ctx, span := startSpan(pctx, "RetargetQrCode", attribute.String("scan_code", qrcode.ScanCode))
+	result, err := r.inner.RetargetQrCode(ctx, qrcode)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) GetURLByScanCode(pctx context.Context, scanCode string) (*model.URL, error) {
+	ctx, span := startSpan(pctx, "GetURLByScanCode", attribute.String("scan_code", scanCode))
+	result, err := r.inner.GetURLByScanCode(ctx, scanCode)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) GetWorkspaceLogo(pctx context.Context, workspace string) (*model.WorkspaceLogo, error) {
+	ctx, span := startSpan(pctx, "GetWorkspaceLogo")
+	result, err := r.inner.GetWorkspaceLogo(ctx, workspace)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) SaveWorkspaceLogo(pctx context.Context, logo *model.WorkspaceLogo) (*model.WorkspaceLogo, error) {
+	ctx, span := startSpan(pctx, "SaveWorkspaceLogo")
+	result, err := r.inner.SaveWorkspaceLogo(ctx, logo)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) DeleteWorkspaceLogo(pctx context.Context, workspace string) (bool, error) {
+	ctx, span := startSpan(pctx, "DeleteWorkspaceLogo")
+	result, err := r.inner.DeleteWorkspaceLogo(ctx, workspace)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) GetByShortCode(ctx context.Context, shortCode string) (*model.URL, error) {
+	ctx, span := startSpan(ctx, "GetByShortCode", attribute.String("short_code", shortCode))
+	result, err := r.inner.GetByShortCode(ctx, shortCode)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) ListByShortCodes(pctx context.Context, shortCodes []string) ([]*model.URL, error) {
+	ctx, span := startSpan(pctx, "ListByShortCodes", attribute.Int("short_codes", len(shortCodes)))
+	result, err := r.inner.ListByShortCodes(ctx, shortCodes)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) ListByCampaign(pctx context.Context, campaign string, limit int) ([]*model.URL, error) {
+	ctx, span := startSpan(pctx, "ListByCampaign", attribute.String("campaign", campaign))
+	result, err := r.inner.ListByCampaign(ctx, campaign, limit)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) UpdateShortUrl(pctx context.Context, shortCode string, updatedUrl string) (*model.URL, error) {
+	ctx, span := startSpan(pctx, "UpdateShortUrl", attribute.String("short_code", shortCode))
+	result, err := r.inner.UpdateShortUrl(ctx, shortCode, updatedUrl)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) DeleteByShortCode(ctx context.Context, shortCode string) error {
+	ctx, span := startSpan(ctx, "DeleteByShortCode", attribute.String("short_code", shortCode))
+	err := r.inner.DeleteByShortCode(ctx, shortCode)
+	finishSpan(span, err)
+	return err
+}
+
+func (r *tracedURLRepository) IsShortCodeExists(pctx context.Context, shortCode string) bool {
+	ctx, span := startSpan(pctx, "IsShortCodeExists", attribute.String("short_code", shortCode))
+	exists := r.inner.IsShortCodeExists(ctx, shortCode)
+	span.End()
+	return exists
+}
+
+func (r *tracedURLRepository) ListURLsDueForCheck(pctx context.Context, checkedBefore time.Time, limit int) ([]*model.URL, error) {
+	ctx, span := startSpan(pctx, "ListURLsDueForCheck")
+	result, err := r.inner.ListURLsDueForCheck(ctx, checkedBefore, limit)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) SaveURLHealth(pctx context.Context, health *model.URLHealth, brokenThreshold int) (*model.URLHealth, error) {
+	ctx, span := startSpan(pctx, "SaveURLHealth")
+	result, err := r.inner.SaveURLHealth(ctx, health, brokenThreshold)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) GetURLHealth(pctx context.Context, urlID uint) (*model.URLHealth, error) {
+	ctx, span := startSpan(pctx, "GetURLHealth")
+	result, err := r.inner.GetURLHealth(ctx, urlID)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) ListBrokenURLs(pctx context.Context) ([]*model.BrokenURL, error) {
+	ctx, span := startSpan(pctx, "ListBrokenURLs")
+	result, err := r.inner.ListBrokenURLs(ctx)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (r *tracedURLRepository) FindShortCodeConflicts(pctx context.Context, exact []string, terms []string) ([]*model.URL, error) {
+	ctx, span := startSpan(pctx, "FindShortCodeConflicts")
+	result, err := r.inner.FindShortCodeConflicts(ctx, exact, terms)
+	finishSpan(span, err)
+	return result, err
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"shorten-url/internal/model"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type WebhookRepository interface {
+	CreateEndpoint(pctx context.Context, endpoint *model.WebhookEndpoint) (*model.WebhookEndpoint, error)
+	ListEndpoints(pctx context.Context) ([]*model.WebhookEndpoint, error)
+	DeleteEndpoint(pctx context.Context, id uint) error
+	EnqueueDeliveries(pctx context.Context, eventID string, eventType string, payload []byte, at time.Time) (int64, error)
+	ClaimDueDeliveries(pctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]*model.WebhookDeliveryTarget, error)
+	SaveDeliveryAttempt(pctx context.Context, delivery *model.WebhookDelivery) error
+	ListDeliveries(pctx context.Context, endpointID uint, status string, limit int) ([]*model.WebhookDelivery, error)
+	ReplayDelivery(pctx context.Context, id int64, at time.Time) (*model.WebhookDelivery, error)
+}
+
+const webhookDeliveryColumns = `d.id, d.endpoint_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+              d.last_attempt_at, COALESCE(d.last_status_code, 0) AS last_status_code, COALESCE(d.last_error, '') AS last_error,
+              d.replay_of, d.created_at`
+
+type webhookRepository struct {
+	db *sqlx.DB
+}
+
+// NewWebhookRepository creates a new webhook endpoint and delivery log repository
+func NewWebhookRepository(db *sqlx.DB) WebhookRepository {
+	return &webhookRepository{
+		db: db,
+	}
+}
+
+func (r *webhookRepository) CreateEndpoint(pctx context.Context, endpoint *model.WebhookEndpoint) (*model.WebhookEndpoint, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `INSERT INTO webhook_endpoints (url, secret, events) VALUES ($1, $2, $3) RETURNING id, created_at`
+
+	if err := r.db.QueryRowContext(ctx, query, endpoint.URL, endpoint.Secret, endpoint.Events).Scan(&endpoint.ID, &endpoint.CreatedAt); err != nil {
+		log.Printf("Error creating webhook endpoint: %v", err)
+		return nil, err
+	}
+
+	return endpoint, nil
+}
+
+func (r *webhookRepository) ListEndpoints(pctx context.Context) ([]*model.WebhookEndpoint, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	endpoints := make([]*model.WebhookEndpoint, 0)
+	if err := r.db.SelectContext(ctx, &endpoints, `SELECT id, url, secret, events, created_at FROM webhook_endpoints ORDER BY id`); err != nil {
+		log.Printf("Error listing webhook endpoints: %v", err)
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+func (r *webhookRepository) DeleteEndpoint(pctx context.Context, id uint) error {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE id = $1`, id)
+	if err != nil {
+		log.Printf("Error deleting webhook endpoint %d: %v", id, err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("no webhook endpoint found with the given id")
+	}
+
+	return nil
+}
+
+// EnqueueDeliveries logs one pending delivery of an event for every endpoint subscribed to its type
+func (r *webhookRepository) EnqueueDeliveries(pctx context.Context, eventID string, eventType string, payload []byte, at time.Time) (int64, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload, next_attempt_at)
+              SELECT id, $1, $2, $3, $4 FROM webhook_endpoints WHERE $2 = ANY(events)`
+
+	result, err := r.db.ExecContext(ctx, query, eventID, eventType, payload, at)
+	if err != nil {
+		log.Printf("Error enqueueing %s webhook deliveries: %v", eventType, err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// ClaimDueDeliveries leases due deliveries by pushing their next attempt out, so other instances skip them while they are sent
+func (r *webhookRepository) ClaimDueDeliveries(pctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]*model.WebhookDeliveryTarget, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	defer cancel()
+
+	query := `UPDATE webhook_deliveries d
+              SET next_attempt_at = $2
+              FROM webhook_endpoints e
+              WHERE e.id = d.endpoint_id
+                AND d.id IN (
+                  SELECT id FROM webhook_deliveries
+                  WHERE status = 'pending' AND next_attempt_at <= $1
+                  ORDER BY next_attempt_at
+                  LIMIT $3
+                  FOR UPDATE SKIP LOCKED
+                )
+              RETURNING ` + webhookDeliveryColumns + `, e.url, e.secret`
+
+	deliveries := make([]*model.WebhookDeliveryTarget, 0)
+	if err := r.db.SelectContext(ctx, &deliveries, query, now, leaseUntil, limit); err != nil {
+		log.Printf("Error claiming due webhook deliveries: %v", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *webhookRepository) SaveDeliveryAttempt(pctx context.Context, delivery *model.WebhookDelivery) error {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `UPDATE webhook_deliveries
+              SET status = :status, attempts = :attempts, next_attempt_at = :next_attempt_at, last_attempt_at = :last_attempt_at,
+                  last_status_code = NULLIF(:last_status_code, 0), last_error = NULLIF(:last_error, '')
+              WHERE id = :id`
+
+	if _, err := r.db.NamedExecContext(ctx, query, delivery); err != nil {
+		log.Printf("Error saving webhook delivery %d: %v", delivery.ID, err)
+		return err
+	}
+
+	return nil
+}
+
+// ListDeliveries returns an endpoint's most recent deliveries first, optionally only those in one status
+func (r *webhookRepository) ListDeliveries(pctx context.Context, endpointID uint, status string, limit int) ([]*model.WebhookDelivery, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `SELECT ` + webhookDeliveryColumns + `
+              FROM webhook_deliveries d
+              WHERE d.endpoint_id = $1 AND ($2 = '' OR d.status = $2)
+              ORDER BY d.id DESC
+              LIMIT $3`
+
+	deliveries := make([]*model.WebhookDelivery, 0)
+	if err := r.db.SelectContext(ctx, &deliveries, query, endpointID, status, limit); err != nil {
+		log.Printf("Error listing webhook deliveries for endpoint %d: %v", endpointID, err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// ReplayDelivery logs a fresh pending copy of a delivery; the event id is kept so receivers can deduplicate
+func (r *webhookRepository) ReplayDelivery(pctx context.Context, id int64, at time.Time) (*model.WebhookDelivery, error) {
+
+	ctx, cancel := context.WithTimeout(pctx, time.Second*5)
+	defer cancel()
+
+	query := `INSERT INTO webhook_deliveries AS d (endpoint_id, event_id, event_type, payload, next_attempt_at, replay_of)
+              SELECT endpoint_id, event_id, event_type, payload, $2, id FROM webhook_deliveries WHERE id = $1
+              RETURNING ` + webhookDeliveryColumns
+
+	delivery := new(model.WebhookDelivery)
+	if err := r.db.GetContext(ctx, delivery, query, id, at); err != nil {
+		log.Printf("Error replaying webhook delivery %d: %v", id, err)
+		return nil, err
+	}
+
+	return delivery, nil
+}
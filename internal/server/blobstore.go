@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"strings"
+
+	"shorten-url/configs"
+	"shorten-url/pkg/blobstore"
+)
+
+const (
+	BlobStoreFS     = "fs"
+	BlobStoreMemory = "memory"
+	BlobStoreS3     = "s3"
+)
+
+// newBlobStore opens the configured backend. The signer is returned for the fs and memory stores, whose
+// downloads the application serves under /blobs, and is nil for S3, which presigns its own URLs.
+func newBlobStore(pctx context.Context, cfg *configs.Config) (blobstore.BlobStore, *blobstore.URLSigner, error) {
+
+	var signer *blobstore.URLSigner
+	if cfg.BlobStore.Backend != BlobStoreS3 {
+		secret := []byte(cfg.BlobStore.SigningKey)
+		if len(secret) == 0 {
+			log.Printf("BLOBSTORE_SIGNING_KEY is not set, blob download URLs only work on this instance until it restarts")
+			secret = make([]byte, 32)
+			rand.Read(secret)
+		}
+		signer = blobstore.NewURLSigner(strings.TrimSuffix(cfg.Server.BaseURL, "/")+"/blobs", secret)
+	}
+
+	switch cfg.BlobStore.Backend {
+	case BlobStoreFS, "":
+		return blobstore.NewFileStore(cfg.BlobStore.Dir, signer), signer, nil
+	case BlobStoreMemory:
+		return blobstore.NewMemoryStore(signer), signer, nil
+	case BlobStoreS3:
+		store, err := blobstore.NewS3Store(pctx, blobstore.S3Options{
+			Endpoint:  cfg.BlobStore.S3Endpoint,
+			Region:    cfg.BlobStore.S3Region,
+			Bucket:    cfg.BlobStore.S3Bucket,
+			AccessKey: cfg.BlobStore.S3AccessKey,
+			SecretKey: cfg.BlobStore.S3SecretKey,
+			UseSSL:    cfg.BlobStore.S3UseSSL,
+		})
+		return store, nil, err
+	default:
+		return nil, nil, fmt.Errorf("unknown blob store backend %q, expected %s, %s or %s", cfg.BlobStore.Backend, BlobStoreFS, BlobStoreMemory, BlobStoreS3)
+	}
+}
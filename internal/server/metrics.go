@@ -0,0 +1,87 @@
+package server
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"time"
+
+	"shorten-url/pkg/metrics"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+var requestDuration = metrics.Default.NewHistogramVec(
+	"shorten_http_request_duration_seconds",
+	"Time to serve HTTP requests, by method, route template and status.",
+	metrics.DefBuckets,
+	"method", "route", "status",
+)
+
+// requestMetrics times every request under its route template, e.g. /:short_code, so raw paths never become labels
+func requestMetrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			start := time.Now()
+
+			// The error is rendered here so the recorded status is the one the client gets
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			requestDuration.Observe(
+				time.Since(start).Seconds(),
+				c.Request().Method,
+				route,
+				strconv.Itoa(c.Response().Status),
+			)
+			return nil
+		}
+	}
+}
+
+// registerPoolMetrics exports the connection pool statistics of db, read on every scrape
+func registerPoolMetrics(db *sqlx.DB) {
+
+	metrics.Default.NewGaugeFunc("shorten_db_max_open_connections", "Maximum number of open connections to the database.",
+		func() float64 { return float64(db.Stats().MaxOpenConnections) })
+	metrics.Default.NewGaugeFunc("shorten_db_open_connections", "Established connections, both in use and idle.",
+		func() float64 { return float64(db.Stats().OpenConnections) })
+	metrics.Default.NewGaugeFunc("shorten_db_in_use_connections", "Connections currently in use.",
+		func() float64 { return float64(db.Stats().InUse) })
+	metrics.Default.NewGaugeFunc("shorten_db_idle_connections", "Idle connections.",
+		func() float64 { return float64(db.Stats().Idle) })
+	metrics.Default.NewCounterFunc("shorten_db_wait_count_total", "Connections waited for because the pool was exhausted.",
+		func() float64 { return float64(db.Stats().WaitCount) })
+	metrics.Default.NewCounterFunc("shorten_db_wait_duration_seconds_total", "Time spent waiting for a free connection.",
+		func() float64 { return db.Stats().WaitDuration.Seconds() })
+	metrics.Default.NewCounterFunc("shorten_db_max_idle_closed_total", "Connections closed because the idle pool was full.",
+		func() float64 { return float64(db.Stats().MaxIdleClosed) })
+	metrics.Default.NewCounterFunc("shorten_db_max_idle_time_closed_total", "Connections closed because they were idle too long.",
+		func() float64 { return float64(db.Stats().MaxIdleTimeClosed) })
+	metrics.Default.NewCounterFunc("shorten_db_max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.",
+		func() float64 { return float64(db.Stats().MaxLifetimeClosed) })
+}
+
+// metricsAuth lets scrapers in with the configured bearer token, or without one when none is set
+func (s *server) metricsAuth() echo.MiddlewareFunc {
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		Skipper: func(c echo.Context) bool {
+			return s.cfg.Metrics.Token == ""
+		},
+		Validator: func(key string, c echo.Context) (bool, error) {
+			return subtle.ConstantTimeCompare([]byte(key), []byte(s.cfg.Metrics.Token)) == 1, nil
+		},
+	})
+}
+
+func metricsHandler() echo.HandlerFunc {
+	return echo.WrapHandler(metrics.Default.Handler())
+}
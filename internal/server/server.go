@@ -2,8 +2,11 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,6 +14,7 @@ import (
 	"shorten-url/internal/handler"
 	"shorten-url/internal/repository"
 	"shorten-url/internal/service"
+	"strings"
 	"syscall"
 	"time"
 
@@ -25,9 +29,12 @@ type (
 	}
 
 	server struct {
-		app *echo.Echo
-		cfg *configs.Config
-		db  *sqlx.DB
+		app    *echo.Echo
+		cfg    *configs.Config
+		db     *sqlx.DB
+		clicks service.ClickRecorder
+
+		shutdownTracing func(context.Context) error
 	}
 )
 
@@ -41,10 +48,29 @@ func NewEchoServer(cfg *configs.Config, db *sqlx.DB) Server {
 
 func (s *server) Start() {
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if s.cfg.Metrics.Enabled {
+		s.app.Use(requestMetrics())
+		registerPoolMetrics(s.db)
+	}
+
+	shutdownTracing, err := setupTracing(ctx, s.cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	s.shutdownTracing = shutdownTracing
+	s.app.Use(requestTracing())
+
+	ipExtractor, err := clientIPExtractor(s.cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+	s.app.IPExtractor = ipExtractor
 
 	s.app.Use(middleware.TimeoutWithConfig(middleware.TimeoutConfig{
-		Skipper:      middleware.DefaultSkipper,
+		Skipper:      isStreamingRoute,
 		ErrorMessage: "Error: Request Timeout",
 		Timeout:      time.Second * 10,
 	}))
@@ -56,58 +82,238 @@ func (s *server) Start() {
 
 	s.app.Use(middleware.Logger())
 
-	close := make(chan os.Signal, 1)
-	signal.Notify(close, syscall.SIGINT, syscall.SIGTERM)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 
-	go s.gracefulShutdown(ctx, close)
+	s.ShortenModules(ctx)
 
-	s.ShortenModules()
+	done := make(chan struct{})
+	go s.gracefulShutdown(signals, done)
 
-	if err := s.app.Start(fmt.Sprintf(":%s", s.cfg.Server.Port)); err != nil {
+	if err := s.app.Start(fmt.Sprintf(":%s", s.cfg.Server.Port)); !errors.Is(err, http.ErrServerClosed) {
 		log.Printf("Server stopped: %v", err)
+		return
 	}
 
+	// Start returns as soon as Shutdown begins; the background workers keep running until queued clicks and
+	// spans are flushed, and only then does the deferred cancel stop them and main exit
+	<-done
 }
 
-func (s *server) ShortenModules() {
+func (s *server) ShortenModules(pctx context.Context) {
+
+	blocklistRepo := repository.NewBlocklistRepository(s.db)
+	blocklistService := service.NewBlocklistService(blocklistRepo, s.cfg)
+	blocklistHandler := handler.NewBlocklistHandler(blocklistService)
+
+	if err := blocklistService.Reload(pctx); err != nil {
+		log.Fatalf("Failed to load blocklist: %v", err)
+	}
+
+	reservedWords := service.NewReservedWords(s.cfg)
+
+	botClassifier := service.NewBotClassifier(s.cfg)
 
-	shortenRepo := repository.NewURLRepository(s.db)
-	shortenService := service.NewURLService(shortenRepo, s.cfg)
-	shortenHandler := handler.NewHandler(shortenService)
+	webhookService := service.NewWebhookService(repository.NewWebhookRepository(s.db), s.cfg)
+	webhookHandler := handler.NewWebhookHandler(webhookService)
+
+	if err := webhookService.Reload(pctx); err != nil {
+		log.Fatalf("Failed to load webhook endpoints: %v", err)
+	}
+
+	clickRepo := repository.NewClickRepository(s.db)
+	clickHub := service.NewClickHub(s.cfg)
+
+	// Without the shared salt every instance would hash the same visitor differently until the next rotation
+	visitorSalts := service.NewVisitorSalts(clickRepo, s.cfg)
+	if err := visitorSalts.Load(pctx); err != nil {
+		log.Printf("Error: failed to load visitor salts %s", err.Error())
+	}
+
+	clickRecorder := service.NewClickRecorder(clickRepo, botClassifier, clickHub, webhookService, visitorSalts, s.cfg)
+	s.clicks = clickRecorder
+
+	blobStore, blobSigner, err := newBlobStore(pctx, s.cfg)
+	if err != nil {
+		log.Fatalf("Failed to open blob store: %v", err)
+	}
+
+	shortenRepo := repository.NewTracedURLRepository(repository.NewInstrumentedURLRepository(repository.NewURLRepository(s.db)))
+	shortenService := service.NewTracedURLService(service.NewURLService(
+		shortenRepo,
+		blocklistService,
+		service.NewShortenerResolver(s.cfg),
+		reservedWords,
+		clickRecorder,
+		webhookService,
+		blobStore,
+		s.cfg,
+	))
+	shortenHandler := handler.NewHandler(shortenService, s.cfg)
+
+	analyticsService := service.NewAnalyticsService(shortenRepo, clickRepo, blobStore, s.cfg)
+	liveHandler := handler.NewLiveHandler(service.NewLiveService(shortenRepo, clickHub), s.cfg)
+
+	leaderboard := service.NewLeaderboard(clickRepo, s.cfg)
+	analyticsHandler := handler.NewAnalyticsHandler(analyticsService, clickRecorder, leaderboard)
+
+	go service.NewLinkChecker(shortenRepo, s.cfg).Start(pctx)
+	go service.NewClickPartitioner(clickRepo, s.cfg).Start(pctx)
+	go service.NewClickRollupWorker(clickRepo, s.cfg).Start(pctx)
+	go service.NewClickRetention(clickRepo, s.cfg).Start(pctx)
+	go visitorSalts.Start(pctx)
+	go clickRecorder.Start(pctx)
+	go leaderboard.Start(pctx)
+	go clickHub.Start(pctx)
+	go webhookService.Start(pctx)
 
-	s.app.Static("/temp", "temp")
 	s.app.GET("/:short_code", shortenHandler.GetShortenURL)
+	// Link unfurlers probe with HEAD; those hits are recorded as bot clicks
+	s.app.HEAD("/:short_code", shortenHandler.GetShortenURL)
+	s.app.GET("/q/:scan_code", shortenHandler.ScanQrCode)
+	s.app.HEAD("/q/:scan_code", shortenHandler.ScanQrCode)
+
+	// S3 presigns its own download URLs; the other stores are served from here
+	if blobSigner != nil {
+		s.app.GET("/blobs/*", handler.NewBlobHandler(blobStore, blobSigner).Download)
+	}
 
 	s.app.GET("/health", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, "✅ status ok")
 	})
 
+	if s.cfg.Metrics.Enabled {
+		s.app.GET("/metrics", metricsHandler(), s.metricsAuth())
+	}
+
 	route := s.app.Group("/shorten")
 
-	route.GET("/:short_code", shortenHandler.RetrieveOriginalURL)
-	route.GET("/:short_code/stat", shortenHandler.GetUrlStatic)
+	route.GET("/broken", shortenHandler.GetBrokenLinks)
+	route.GET("/top", analyticsHandler.GetTopLinks)
 
-	route.POST("/qrcode", shortenHandler.CreateQrCode)
+	route.GET("/:short_code", shortenHandler.RetrieveOriginalURL)
+	route.GET("/:short_code/live", liveHandler.StreamClicks)
+	route.GET("/:short_code/qrcode", shortenHandler.GetQrCode)
+	route.GET("/:short_code/qrcode/image", shortenHandler.GetQrCodeImage)
+	route.GET("/:short_code/stat", analyticsHandler.GetUrlStatic)
+	route.GET("/:short_code/stat/export", analyticsHandler.ExportClicks)
+	route.GET("/:short_code/stat/:dimension", analyticsHandler.GetBreakdown)
 
 	route.PUT("/:short_code", shortenHandler.UpdateShortenURL)
 
+	route.POST("/qrcode/sheet", shortenHandler.ExportQrCodeSheet)
+	route.POST("/qrcode/decode", shortenHandler.DecodeQrCodes)
+
 	route.DELETE("/:short_code", shortenHandler.DeleteUrl)
 
 	route.POST("/", shortenHandler.CreateShortenURL)
 
+	admin := s.app.Group("/admin", s.adminAuth())
+
+	admin.GET("/blocklist", blocklistHandler.ListRules)
+	admin.POST("/blocklist", blocklistHandler.CreateRule)
+	admin.POST("/blocklist/reload", blocklistHandler.Reload)
+	admin.DELETE("/blocklist/:id", blocklistHandler.DeleteRule)
+
+	admin.GET("/reserved/conflicts", shortenHandler.GetReservedConflicts)
+
+	// Anyone holding a printed code can read its scan code, so only an admin may move it to another link
+	admin.PUT("/qrcode/:scan_code", shortenHandler.RetargetQrCode)
+
+	admin.PUT("/workspaces/:workspace/logo", shortenHandler.UploadWorkspaceLogo)
+	admin.DELETE("/workspaces/:workspace/logo", shortenHandler.DeleteWorkspaceLogo)
+
+	// Every link's clicks as they happen, which is no one else's business
+	admin.GET("/live", liveHandler.StreamAllClicks)
+
+	admin.GET("/clicks/pipeline", analyticsHandler.GetClickPipelineStats)
+	admin.GET("/clicks/export", analyticsHandler.ExportAllClicks)
+	admin.POST("/clicks/export", analyticsHandler.StoreAllClicksExport)
+
+	admin.GET("/webhooks", webhookHandler.ListEndpoints)
+	admin.POST("/webhooks", webhookHandler.CreateEndpoint)
+	admin.DELETE("/webhooks/:id", webhookHandler.DeleteEndpoint)
+	admin.GET("/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+	admin.POST("/webhooks/deliveries/:id/replay", webhookHandler.ReplayDelivery)
+
+	// Every static route segment is reserved so generated or custom codes cannot shadow it
+	paths := make([]string, 0)
+	for _, r := range s.app.Routes() {
+		paths = append(paths, r.Path)
+	}
+	reservedWords.AddPaths(paths)
+
+}
+
+// isStreamingRoute skips the request timeout for long downloads and live streams, which it would otherwise buffer and cut off
+func isStreamingRoute(c echo.Context) bool {
+	return strings.HasSuffix(c.Path(), "/export") || strings.HasSuffix(c.Path(), "/:short_code/live") || c.Path() == "/admin/live" ||
+		strings.HasSuffix(c.Path(), "/qrcode/sheet") || strings.HasPrefix(c.Path(), "/blobs/")
+}
+
+// adminAuth guards admin routes with the configured token, rejecting everything when none is set
+func (s *server) adminAuth() echo.MiddlewareFunc {
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		KeyLookup: "header:X-Admin-Token",
+		Validator: func(key string, c echo.Context) (bool, error) {
+			if s.cfg.Server.AdminToken == "" {
+				return false, nil
+			}
+			return subtle.ConstantTimeCompare([]byte(key), []byte(s.cfg.Server.AdminToken)) == 1, nil
+		},
+	})
 }
 
-func (s *server) gracefulShutdown(pctx context.Context, close <-chan os.Signal) {
+func (s *server) gracefulShutdown(signals <-chan os.Signal, done chan<- struct{}) {
 
-	<-close
+	defer close(done)
 
-	ctx, cancel := context.WithTimeout(pctx, time.Second*10)
+	<-signals
+
+	// Not derived from the server context, which is cancelled once Start returns
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
+	// Requests still running past the timeout are cut off, but the clicks they queued are flushed all the same
 	if err := s.app.Shutdown(ctx); err != nil {
-		s.app.Logger.Fatal(err)
+		log.Printf("Error: failed to shut down server %s", err.Error())
+	}
+
+	// No more redirects can arrive, so whatever is still queued is the last batch
+	if err := s.clicks.Close(ctx); err != nil {
+		log.Printf("Error: %s", err.Error())
+	}
+
+	// Spans of the last requests are still batched in memory
+	if err := s.shutdownTracing(ctx); err != nil {
+		log.Printf("Error: failed to flush traces %s", err.Error())
 	}
 
 	log.Println("Shuttung Down Server....")
 
 }
+
+// clientIPExtractor decides where c.RealIP comes from. Echo would otherwise believe X-Forwarded-For and
+// X-Real-IP from anyone, letting visitors pick the IP that clicks, bot ranges and unique visitors rest on.
+func clientIPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	// Only the configured proxies are trusted, not the loopback and private ranges echo trusts by default
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, proxy := range trustedProxies {
+		_, ipRange, err := net.ParseCIDR(strings.TrimSpace(proxy))
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
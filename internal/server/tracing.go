@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"shorten-url/configs"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+var tracer = otel.Tracer("shorten-url/internal/server")
+
+// setupTracing installs the global tracer provider and W3C propagators; the returned function flushes pending spans
+func setupTracing(pctx context.Context, cfg *configs.Config) (func(context.Context) error, error) {
+
+	// Trace context is passed on even when nothing is exported here, so callers' traces stay connected
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if !cfg.Tracing.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newSpanExporter(pctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(cfg.Tracing.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Tracing.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+func newSpanExporter(pctx context.Context, cfg *configs.Config) (sdktrace.SpanExporter, error) {
+
+	switch cfg.Tracing.Exporter {
+	case TracingExporterStdout:
+		return stdouttrace.New()
+	case TracingExporterOTLP, "":
+		options := make([]otlptracehttp.Option, 0)
+		switch endpoint := cfg.Tracing.Endpoint; {
+		case strings.Contains(endpoint, "://"):
+			options = append(options, otlptracehttp.WithEndpointURL(endpoint))
+		case endpoint != "":
+			options = append(options, otlptracehttp.WithEndpoint(endpoint))
+		}
+		if cfg.Tracing.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(pctx, options...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q, expected %s or %s", cfg.Tracing.Exporter, TracingExporterOTLP, TracingExporterStdout)
+	}
+}
+
+// requestTracing continues the caller's W3C trace, or starts one, and hands its context to the handler.
+// Client addresses and user agents are left out of spans; the privacy settings decide what is kept of those.
+func requestTracing() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			ctx, span := tracer.Start(ctx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.HTTPRoute(route),
+				),
+			)
+			defer span.End()
+
+			c.SetRequest(req.WithContext(ctx))
+
+			// The error is rendered here so the span carries the status the client gets
+			err := next(c)
+			if err != nil {
+				span.RecordError(err)
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+
+			return nil
+		}
+	}
+}
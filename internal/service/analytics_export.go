@@ -0,0 +1,292 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/utils"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+)
+
+var (
+	exportEventColumns  = []string{"short_code", "clicked_at", "source", "referrer", "referrer_host", "browser", "os", "device", "country", "is_bot"}
+	exportBucketColumns = []string{"short_code", "start", "clicks"}
+)
+
+// exportQuery is a validated export request; a nil series means raw events
+type exportQuery struct {
+	format      string
+	from        time.Time
+	to          time.Time
+	series      *seriesQuery
+	includeBots bool
+}
+
+// ExportClicks streams one link's raw click events, or its buckets when an interval is given, as CSV or NDJSON
+func (s *analyticsService) ExportClicks(pctx context.Context, shortCode string, req *entities.ClickExportReq, w io.Writer) error {
+
+	query, err := s.parseExportQuery(req)
+	if err != nil {
+		return err
+	}
+
+	url, err := s.repo.GetByShortCode(pctx, shortCode)
+	if err != nil {
+		return appErrors.NewNotFoundError("short url was not found")
+	}
+
+	out := newExportWriter(query.format, w)
+	if err := s.writeLinkExport(pctx, out, url, query); err != nil {
+		return appErrors.NewInternalError("failed to export clicks", err)
+	}
+
+	return nil
+}
+
+// ExportAllClicks streams a zip holding one export file per link clicked within the range
+func (s *analyticsService) ExportAllClicks(pctx context.Context, req *entities.ClickExportReq, w io.Writer) error {
+
+	query, err := s.parseExportQuery(req)
+	if err != nil {
+		return err
+	}
+
+	urls, err := s.clickRepo.ListClickedURLs(pctx, query.from, query.to)
+	if err != nil {
+		return appErrors.NewInternalError("failed to list clicked links", err)
+	}
+
+	archive := zip.NewWriter(w)
+	for _, url := range urls {
+		file, err := archive.Create(fmt.Sprintf("%s.%s", url.ShortCode, query.format))
+		if err != nil {
+			return appErrors.NewInternalError("failed to export clicks", err)
+		}
+
+		if err := s.writeLinkExport(pctx, newExportWriter(query.format, file), url, query); err != nil {
+			log.Printf("Error: failed to export clicks of %s %s", url.ShortCode, err.Error())
+			return appErrors.NewInternalError("failed to export clicks", err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return appErrors.NewInternalError("failed to export clicks", err)
+	}
+
+	return nil
+}
+
+// StoreAllClicksExport writes the zip of ExportAllClicks to the blob store and returns a signed link to it,
+// so a large export can be fetched later, or by someone without the admin token, instead of in one request
+func (s *analyticsService) StoreAllClicksExport(pctx context.Context, req *entities.ClickExportReq) (*entities.StoredExportRes, error) {
+
+	// Bad input is reported before anything is written
+	if _, err := s.parseExportQuery(req); err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	key := fmt.Sprintf("exports/clicks-%s-%s.zip", now.Format("20060102-150405"), utils.RandString(8))
+
+	reader, writer := io.Pipe()
+	exported := make(chan error, 1)
+	go func() {
+		err := s.ExportAllClicks(pctx, req, writer)
+		writer.CloseWithError(err)
+		exported <- err
+	}()
+
+	putErr := s.blobs.Put(pctx, key, reader, "application/zip")
+	// Unblocks the export when the store stopped reading early
+	reader.CloseWithError(putErr)
+
+	if err := <-exported; err != nil {
+		log.Printf("Error: failed to export all clicks %s", err.Error())
+		return nil, err
+	}
+	if putErr != nil {
+		log.Printf("Error: failed to store click export %s %s", key, putErr.Error())
+		return nil, appErrors.NewInternalError("failed to store export", putErr)
+	}
+
+	signedURL, err := s.blobs.SignedURL(pctx, key, s.cfg.BlobStore.URLExpiry)
+	if err != nil {
+		log.Printf("Error: failed to sign click export %s %s", key, err.Error())
+		return nil, appErrors.NewInternalError("failed to sign export url", err)
+	}
+
+	return &entities.StoredExportRes{
+		Key:       key,
+		URL:       signedURL,
+		ExpiresAt: now.Add(s.cfg.BlobStore.URLExpiry),
+	}, nil
+}
+
+func (s *analyticsService) parseExportQuery(req *entities.ClickExportReq) (*exportQuery, error) {
+
+	if req == nil {
+		req = new(entities.ClickExportReq)
+	}
+
+	format := strings.ToLower(req.Format)
+	switch format {
+	case "":
+		format = ExportFormatCSV
+	case ExportFormatCSV, ExportFormatNDJSON:
+	default:
+		return nil, appErrors.NewInvalidInputError("format must be csv or ndjson")
+	}
+
+	query := &exportQuery{format: format, includeBots: req.IncludeBots}
+
+	if req.Interval != "" {
+		series, err := s.parseSeriesQuery(&entities.UrlStaticReq{
+			From:        req.From,
+			To:          req.To,
+			Interval:    req.Interval,
+			TZ:          req.TZ,
+			IncludeBots: req.IncludeBots,
+		})
+		if err != nil {
+			return nil, err
+		}
+		query.series = series
+		query.from, query.to = series.from, series.to
+		return query, nil
+	}
+
+	from, to, err := s.parseTimeRange(req.From, req.To, req.TZ)
+	if err != nil {
+		return nil, err
+	}
+	query.from, query.to = from, to
+
+	return query, nil
+}
+
+func (s *analyticsService) writeLinkExport(pctx context.Context, out *exportWriter, url *model.URL, query *exportQuery) error {
+
+	if query.series != nil {
+		series, err := s.clickSeries(pctx, url.ID, query.series)
+		if err != nil {
+			return err
+		}
+
+		if err := out.header(exportBucketColumns); err != nil {
+			return err
+		}
+		for _, bucket := range series.Buckets {
+			row := &entities.ClickExportBucketRes{ShortCode: url.ShortCode, Start: bucket.Start, Clicks: bucket.Clicks}
+			record := []string{row.ShortCode, row.Start.Format(time.RFC3339), strconv.Itoa(row.Clicks)}
+			if err := out.row(record, row); err != nil {
+				return err
+			}
+		}
+		return out.flush()
+	}
+
+	if err := out.header(exportEventColumns); err != nil {
+		return err
+	}
+
+	loc := query.from.Location()
+	err := s.clickRepo.StreamClickEvents(pctx, url.ID, query.from, query.to, query.includeBots, func(event *model.ClickEvent) error {
+		row := &entities.ClickExportEventRes{
+			ShortCode:    url.ShortCode,
+			ClickedAt:    event.ClickedAt.In(loc),
+			Source:       event.Source,
+			Referrer:     event.Referrer,
+			ReferrerHost: event.ReferrerHost,
+			Browser:      event.Browser,
+			OS:           event.OS,
+			Device:       event.Device,
+			Country:      event.Country,
+			IsBot:        event.IsBot,
+		}
+		record := []string{
+			row.ShortCode,
+			row.ClickedAt.Format(time.RFC3339),
+			row.Source,
+			row.Referrer,
+			row.ReferrerHost,
+			row.Browser,
+			row.OS,
+			row.Device,
+			row.Country,
+			strconv.FormatBool(row.IsBot),
+		}
+		return out.row(record, row)
+	})
+	if err != nil {
+		return err
+	}
+
+	return out.flush()
+}
+
+// exportWriter writes rows as CSV records or as one JSON object per line
+type exportWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newExportWriter(format string, w io.Writer) *exportWriter {
+
+	if format == ExportFormatNDJSON {
+		return &exportWriter{json: json.NewEncoder(w)}
+	}
+	return &exportWriter{csv: csv.NewWriter(w)}
+}
+
+func (e *exportWriter) header(columns []string) error {
+
+	if e.csv == nil {
+		return nil
+	}
+	return e.csv.Write(columns)
+}
+
+func (e *exportWriter) row(record []string, value any) error {
+
+	if e.csv == nil {
+		return e.json.Encode(value)
+	}
+	for i, cell := range record {
+		record[i] = escapeFormula(cell)
+	}
+	return e.csv.Write(record)
+}
+
+// escapeFormula quotes a cell a spreadsheet would otherwise run as a formula; referrers come straight from
+// visitors, so a header like =HYPERLINK(...) must land in the sheet as text
+func escapeFormula(cell string) string {
+
+	if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+func (e *exportWriter) flush() error {
+
+	if e.csv == nil {
+		return nil
+	}
+	e.csv.Flush()
+	return e.csv.Error()
+}
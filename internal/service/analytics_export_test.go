@@ -0,0 +1,224 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExportClicks_EventsAsCSV(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("StreamClickEvents", ctx, uint(1), utcTime("2026-10-01T00:00:00Z"), utcTime("2026-10-02T00:00:00Z"), false).
+		Return([]*model.ClickEvent{
+			{URLID: 1, ClickedAt: utcTime("2026-10-01T08:30:00Z"), Source: "direct", Referrer: "https://www.google.com/", ReferrerHost: "google.com", Browser: "Chrome", OS: "Windows", Device: "desktop", Country: "TH"},
+			{URLID: 1, ClickedAt: utcTime("2026-10-01T09:00:00Z"), Source: "qr", Browser: "Safari", OS: "iOS", Device: "mobile"},
+		}, nil)
+
+	var out bytes.Buffer
+	err := service.ExportClicks(ctx, "abc123", &entities.ClickExportReq{From: "2026-10-01", To: "2026-10-02"}, &out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Join([]string{
+		"short_code,clicked_at,source,referrer,referrer_host,browser,os,device,country,is_bot",
+		"abc123,2026-10-01T08:30:00Z,direct,https://www.google.com/,google.com,Chrome,Windows,desktop,TH,false",
+		"abc123,2026-10-01T09:00:00Z,qr,,,Safari,iOS,mobile,,false",
+		"",
+	}, "\n"), out.String())
+}
+
+func TestExportClicks_CSVEscapesFormulas(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("StreamClickEvents", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickEvent{
+			{URLID: 1, ClickedAt: utcTime("2026-10-01T08:30:00Z"), Source: "direct", Referrer: "=HYPERLINK(\"https://evil.example\")", ReferrerHost: "+evil", Browser: "-1", OS: "@SUM(A1)"},
+		}, nil)
+
+	var out bytes.Buffer
+	err := service.ExportClicks(ctx, "abc123", &entities.ClickExportReq{From: "2026-10-01", To: "2026-10-02"}, &out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Join([]string{
+		"short_code,clicked_at,source,referrer,referrer_host,browser,os,device,country,is_bot",
+		"abc123,2026-10-01T08:30:00Z,direct,\"'=HYPERLINK(\"\"https://evil.example\"\")\",'+evil,'-1,'@SUM(A1),,,false",
+		"",
+	}, "\n"), out.String())
+}
+
+func TestExportClicks_NDJSONKeepsValues(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("StreamClickEvents", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickEvent{{URLID: 1, ClickedAt: utcTime("2026-10-01T08:30:00Z"), Referrer: "=1+1"}}, nil)
+
+	var out bytes.Buffer
+	err := service.ExportClicks(ctx, "abc123", &entities.ClickExportReq{Format: "ndjson", From: "2026-10-01", To: "2026-10-02"}, &out)
+
+	assert.NoError(t, err)
+
+	var event entities.ClickExportEventRes
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &event))
+	assert.Equal(t, "=1+1", event.Referrer)
+}
+
+func TestExportClicks_BucketsAsNDJSON(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("CountClicksByMinute", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), true).
+		Return([]*model.ClickBucket{
+			{Bucket: utcTime("2026-10-17T05:00:00Z"), Clicks: 4},
+		}, nil)
+
+	var out bytes.Buffer
+	err := service.ExportClicks(ctx, "abc123", &entities.ClickExportReq{Format: "ndjson", From: "2026-10-16", To: "2026-10-18", Interval: "day", IncludeBots: true}, &out)
+
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var bucket entities.ClickExportBucketRes
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &bucket))
+	assert.Equal(t, "abc123", bucket.ShortCode)
+	assert.True(t, bucket.Start.Equal(utcTime("2026-10-17T00:00:00Z")))
+	assert.Equal(t, 4, bucket.Clicks)
+}
+
+func TestExportClicks_InvalidRequest(t *testing.T) {
+
+	mockRepo := new(repository.MockURLRepository)
+	service := NewAnalyticsService(mockRepo, new(repository.MockClickRepository), newTestBlobs(), testCfg())
+	ctx := context.Background()
+
+	err := service.ExportClicks(ctx, "abc123", &entities.ClickExportReq{Format: "xlsx"}, io.Discard)
+	assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+
+	err = service.ExportClicks(ctx, "abc123", &entities.ClickExportReq{Interval: "fortnight"}, io.Discard)
+	assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+
+	mockRepo.On("GetByShortCode", ctx, "missing").
+		Return(nil, errors.New("not found"))
+
+	err = service.ExportClicks(ctx, "missing", nil, io.Discard)
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+}
+
+func TestExportClicks_StreamError(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("StreamClickEvents", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return(nil, errors.New("database error"))
+
+	err := service.ExportClicks(ctx, "abc123", nil, io.Discard)
+
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+}
+
+func TestExportAllClicks_ZipsOneFilePerLink(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("ListClickedURLs", ctx, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).
+		Return([]*model.URL{{ID: 1, ShortCode: "abc123"}, {ID: 2, ShortCode: "def456"}}, nil)
+	mockClickRepo.On("StreamClickEvents", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickEvent{{URLID: 1, ClickedAt: utcTime("2026-10-17T08:00:00Z"), Source: "direct"}}, nil)
+	mockClickRepo.On("StreamClickEvents", ctx, uint(2), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickEvent{}, nil)
+
+	var out bytes.Buffer
+	err := service.ExportAllClicks(ctx, &entities.ClickExportReq{Format: "ndjson"}, &out)
+
+	assert.NoError(t, err)
+
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	assert.NoError(t, err)
+	assert.Len(t, archive.File, 2)
+	assert.Equal(t, "abc123.ndjson", archive.File[0].Name)
+	assert.Equal(t, "def456.ndjson", archive.File[1].Name)
+
+	file, err := archive.File[0].Open()
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(file)
+	assert.Contains(t, string(content), `"short_code":"abc123"`)
+}
+
+func TestExportAllClicks_ListError(t *testing.T) {
+
+	mockClickRepo := new(repository.MockClickRepository)
+	service := NewAnalyticsService(new(repository.MockURLRepository), mockClickRepo, newTestBlobs(), testCfg())
+	ctx := context.Background()
+
+	mockClickRepo.On("ListClickedURLs", ctx, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).
+		Return(nil, errors.New("database error"))
+
+	err := service.ExportAllClicks(ctx, nil, io.Discard)
+
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+}
+
+func TestStoreAllClicksExport(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("ListClickedURLs", ctx, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).
+		Return([]*model.URL{{ID: 1, ShortCode: "abc123"}}, nil)
+	mockClickRepo.On("StreamClickEvents", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickEvent{{URLID: 1, ClickedAt: utcTime("2026-10-17T08:00:00Z"), Source: "direct"}}, nil)
+
+	res, err := service.StoreAllClicksExport(ctx, nil)
+
+	assert.NoError(t, err)
+	assert.Regexp(t, `^exports/clicks-20261018-100000-[A-Za-z0-9]{8}\.zip$`, res.Key)
+	assert.True(t, strings.HasPrefix(res.URL, "http://localhost:8080/blobs/"+res.Key+"?"))
+	assert.Equal(t, utcTime("2026-10-18T10:15:00Z"), res.ExpiresAt)
+
+	object, err := service.blobs.Get(ctx, res.Key)
+	assert.NoError(t, err)
+	stored, _ := io.ReadAll(object)
+	archive, err := zip.NewReader(bytes.NewReader(stored), int64(len(stored)))
+	assert.NoError(t, err)
+	assert.Len(t, archive.File, 1)
+	assert.Equal(t, "abc123.csv", archive.File[0].Name)
+}
+
+func TestStoreAllClicksExport_Errors(t *testing.T) {
+
+	mockClickRepo := new(repository.MockClickRepository)
+	service := NewAnalyticsService(new(repository.MockURLRepository), mockClickRepo, newTestBlobs(), testCfg())
+	ctx := context.Background()
+
+	_, err := service.StoreAllClicksExport(ctx, &entities.ClickExportReq{Format: "xlsx"})
+	assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+
+	mockClickRepo.On("ListClickedURLs", ctx, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).
+		Return(nil, errors.New("database error"))
+
+	_, err = service.StoreAllClicksExport(ctx, nil)
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+}
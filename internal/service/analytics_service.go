@@ -0,0 +1,630 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"shorten-url/configs"
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+	"shorten-url/pkg/blobstore"
+	"shorten-url/pkg/hll"
+	"shorten-url/pkg/referrer"
+	"shorten-url/pkg/useragent"
+)
+
+const (
+	IntervalMinute = "minute"
+	IntervalHour   = "hour"
+	IntervalDay    = "day"
+	IntervalWeek   = "week"
+
+	seriesSourceRaw    = "raw"
+	seriesSourceRollup = "rollup"
+
+	defaultBreakdownLimit = 10
+	maxBreakdownLimit     = 100
+	defaultTimeRange      = time.Hour * 24 * 30
+	breakdownOther        = "Other"
+)
+
+type AnalyticsService interface {
+	GetUrlStatic(pctx context.Context, shortCode string, req *entities.UrlStaticReq) (*entities.UrlStaticRes, error)
+	GetBreakdown(pctx context.Context, shortCode string, dimension string, req *entities.ClickBreakdownReq) (*entities.ClickBreakdownRes, error)
+	ExportClicks(pctx context.Context, shortCode string, req *entities.ClickExportReq, w io.Writer) error
+	ExportAllClicks(pctx context.Context, req *entities.ClickExportReq, w io.Writer) error
+	StoreAllClicksExport(pctx context.Context, req *entities.ClickExportReq) (*entities.StoredExportRes, error)
+}
+
+type analyticsService struct {
+	repo      repository.URLRepository
+	clickRepo repository.ClickRepository
+	blobs     blobstore.BlobStore
+	cfg       *configs.Config
+	now       func() time.Time
+}
+
+func NewAnalyticsService(repo repository.URLRepository, clickRepo repository.ClickRepository, blobs blobstore.BlobStore, cfg *configs.Config) AnalyticsService {
+	return &analyticsService{
+		repo:      repo,
+		clickRepo: clickRepo,
+		blobs:     blobs,
+		cfg:       cfg,
+		now:       time.Now,
+	}
+}
+
+// seriesQuery is a validated time-series request
+type seriesQuery struct {
+	from        time.Time
+	to          time.Time
+	interval    string
+	loc         *time.Location
+	includeBots bool
+}
+
+func (s *analyticsService) GetUrlStatic(pctx context.Context, shortCode string, req *entities.UrlStaticReq) (*entities.UrlStaticRes, error) {
+
+	var query *seriesQuery
+	if req != nil && (req.From != "" || req.To != "" || req.Interval != "" || req.TZ != "") {
+		parsed, err := s.parseSeriesQuery(req)
+		if err != nil {
+			return nil, err
+		}
+		query = parsed
+	}
+
+	url, err := s.repo.GetByShortCode(pctx, shortCode)
+	if err != nil {
+		return nil, appErrors.NewNotFoundError("short url was not found")
+	}
+
+	includeBots := req != nil && req.IncludeBots
+
+	// The total comes from the same events as the series and breakdowns; urls.click_count predates them and
+	// still holds the seeded and bot hits of older links
+	rolledUpBefore, err := s.rolledUpBefore(pctx)
+	if err != nil {
+		return nil, appErrors.NewInternalError("failed to count clicks", err)
+	}
+
+	accessCount, err := s.clickRepo.CountClicks(pctx, url.ID, rolledUpBefore, includeBots)
+	if err != nil {
+		return nil, appErrors.NewInternalError("failed to count clicks", err)
+	}
+
+	stat := &entities.UrlStaticRes{
+		Id:           strconv.Itoa(int(url.ID)),
+		Url:          url.OriginalURL,
+		ShortCode:    url.ShortCode,
+		CreatedAt:    url.CreatedAt,
+		UpdatedAt:    url.UpdatedAt,
+		AccessCount:  accessCount,
+		IncludesBots: includeBots,
+	}
+
+	// Links that have not been checked yet simply have no health section
+	if health, err := s.repo.GetURLHealth(pctx, url.ID); err == nil {
+		stat.Health = toLinkHealthRes(health)
+	}
+
+	// Visitors are counted over the series range, or the default range without one, rather than the link's
+	// whole life, which would merge a sketch for every day since it was created
+	if query != nil {
+		series, err := s.clickSeries(pctx, url.ID, query)
+		if err != nil {
+			log.Printf("Error: failed to build click series for %s %s", shortCode, err.Error())
+			return nil, appErrors.NewInternalError("failed to build click series", err)
+		}
+		stat.Series = series
+		stat.UniqueVisitors = series.UniqueVisitors
+		stat.UniqueVisitorsSince = series.From
+	} else {
+		to := s.now()
+		from := to.Add(-defaultTimeRange)
+		if url.CreatedAt.After(from) {
+			from = url.CreatedAt
+		}
+
+		sketches, err := s.clickRepo.ListVisitorSketches(pctx, url.ID, from, to)
+		if err != nil {
+			return nil, appErrors.NewInternalError("failed to count unique visitors", err)
+		}
+		stat.UniqueVisitors = countVisitors(sketches)
+		stat.UniqueVisitorsSince = from
+	}
+
+	return stat, nil
+}
+
+// GetBreakdown groups a link's clicks by referrer channel, browser, OS, device or source (direct or qr), keeping the top N
+func (s *analyticsService) GetBreakdown(pctx context.Context, shortCode string, dimension string, req *entities.ClickBreakdownReq) (*entities.ClickBreakdownRes, error) {
+
+	if req == nil {
+		req = new(entities.ClickBreakdownReq)
+	}
+
+	switch dimension {
+	case model.ClickDimensionReferrer, model.ClickDimensionBrowser, model.ClickDimensionOS, model.ClickDimensionDevice, model.ClickDimensionSource:
+	default:
+		return nil, appErrors.NewInvalidInputError("dimension must be one of referrers, browsers, os, devices or sources")
+	}
+
+	limit := req.Limit
+	switch {
+	case limit == 0:
+		limit = defaultBreakdownLimit
+	case limit < 0 || limit > maxBreakdownLimit:
+		return nil, appErrors.NewInvalidInputError(fmt.Sprintf("limit must be between 1 and %d", maxBreakdownLimit))
+	}
+
+	from, to, err := s.parseTimeRange(req.From, req.To, req.TZ)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := s.repo.GetByShortCode(pctx, shortCode)
+	if err != nil {
+		return nil, appErrors.NewNotFoundError("short url was not found")
+	}
+
+	counts, err := s.clickRepo.CountClicksByDimension(pctx, url.ID, dimension, from, to, req.IncludeBots)
+	if err != nil {
+		return nil, appErrors.NewInternalError("failed to count clicks", err)
+	}
+
+	// Several stored values can collapse into one label, e.g. google.com and google.co.th
+	merged := make(map[string]int)
+	total := 0
+	for _, count := range counts {
+		merged[breakdownLabel(dimension, count.Value)] += count.Clicks
+		total += count.Clicks
+	}
+
+	items := make([]*entities.ClickBreakdownItemRes, 0, len(merged))
+	for name, clicks := range merged {
+		items = append(items, &entities.ClickBreakdownItemRes{Name: name, Clicks: clicks})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Clicks != items[j].Clicks {
+			return items[i].Clicks > items[j].Clicks
+		}
+		return items[i].Name < items[j].Name
+	})
+
+	if len(items) > limit {
+		other := &entities.ClickBreakdownItemRes{Name: breakdownOther}
+		for _, item := range items[limit:] {
+			other.Clicks += item.Clicks
+		}
+		items = append(items[:limit], other)
+	}
+
+	for _, item := range items {
+		if total > 0 {
+			item.Share = float64(item.Clicks) / float64(total)
+		}
+	}
+
+	return &entities.ClickBreakdownRes{
+		Dimension: dimension,
+		From:      from,
+		To:        to,
+		Total:     total,
+		Items:     items,
+	}, nil
+}
+
+// parseTimeRange reads an optional from/to pair in the given time zone, defaulting to the last 30 days
+func (s *analyticsService) parseTimeRange(fromValue string, toValue string, tz string) (time.Time, time.Time, error) {
+
+	loc := time.UTC
+	if tz != "" {
+		parsed, err := time.LoadLocation(tz)
+		if err != nil {
+			return time.Time{}, time.Time{}, appErrors.NewInvalidInputError(fmt.Sprintf("unknown time zone %q", tz))
+		}
+		loc = parsed
+	}
+
+	to := s.now()
+	if toValue != "" {
+		parsed, err := parseSeriesTime(toValue, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, appErrors.NewInvalidInputError("to must be RFC3339 or YYYY-MM-DD")
+		}
+		to = parsed
+	}
+
+	from := to.Add(-defaultTimeRange)
+	if fromValue != "" {
+		parsed, err := parseSeriesTime(fromValue, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, appErrors.NewInvalidInputError("from must be RFC3339 or YYYY-MM-DD")
+		}
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, appErrors.NewInvalidInputError("from must be before to")
+	}
+
+	return from.In(loc), to.In(loc), nil
+}
+
+// breakdownLabel turns a stored value into the name shown to users
+func breakdownLabel(dimension string, value string) string {
+
+	if dimension == model.ClickDimensionReferrer {
+		return referrer.Channel(value)
+	}
+	if value == "" {
+		return useragent.Unknown
+	}
+	return value
+}
+
+// parseSeriesQuery applies defaults (last 30 days by day in UTC) and validates the range
+func (s *analyticsService) parseSeriesQuery(req *entities.UrlStaticReq) (*seriesQuery, error) {
+
+	loc := time.UTC
+	if req.TZ != "" {
+		parsed, err := time.LoadLocation(req.TZ)
+		if err != nil {
+			return nil, appErrors.NewInvalidInputError(fmt.Sprintf("unknown time zone %q", req.TZ))
+		}
+		loc = parsed
+	}
+
+	interval := strings.ToLower(req.Interval)
+	switch interval {
+	case "":
+		interval = IntervalDay
+	case IntervalMinute, IntervalHour, IntervalDay, IntervalWeek:
+	default:
+		return nil, appErrors.NewInvalidInputError("interval must be one of minute, hour, day or week")
+	}
+
+	to := s.now()
+	if req.To != "" {
+		parsed, err := parseSeriesTime(req.To, loc)
+		if err != nil {
+			return nil, appErrors.NewInvalidInputError("to must be RFC3339 or YYYY-MM-DD")
+		}
+		to = parsed
+	}
+
+	from := to.Add(-defaultSeriesRange(interval))
+	if req.From != "" {
+		parsed, err := parseSeriesTime(req.From, loc)
+		if err != nil {
+			return nil, appErrors.NewInvalidInputError("from must be RFC3339 or YYYY-MM-DD")
+		}
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		return nil, appErrors.NewInvalidInputError("from must be before to")
+	}
+
+	query := &seriesQuery{from: from, to: to, interval: interval, loc: loc, includeBots: req.IncludeBots}
+	if query.bucketCount(s.cfg.Analytics.MaxSeriesBuckets) > s.cfg.Analytics.MaxSeriesBuckets {
+		return nil, appErrors.NewInvalidInputError(fmt.Sprintf("range produces more than %d buckets", s.cfg.Analytics.MaxSeriesBuckets))
+	}
+
+	// Hourly rollups are cut on UTC hours; in a zone like Asia/Kolkata a local day or hour would take in part
+	// of an hour that belongs to the next bucket
+	if s.fromRollups(query) && !query.onUTCHours() {
+		return nil, appErrors.NewInvalidInputError(fmt.Sprintf("time zone %s is not a whole number of hours from UTC, which hourly totals cannot split; use a range of at most %s of retained clicks", loc, s.cfg.Analytics.RawSeriesMaxRange))
+	}
+
+	return query, nil
+}
+
+// fromRollups tells whether a series is read from hourly rollups: long ranges, and ranges reaching back before
+// the retention cutoff, whose raw events are gone while their rollups are kept
+func (s *analyticsService) fromRollups(query *seriesQuery) bool {
+
+	purged := query.from.Before(retentionCutoff(s.cfg, s.now()))
+	return query.interval != IntervalMinute && (query.to.Sub(query.from) > s.cfg.Analytics.RawSeriesMaxRange || purged)
+}
+
+// rolledUpBefore is where hourly rollups stop being trusted: the last full hour and the current one may still
+// change, and after an outage the rollup worker may not have caught up yet, so everything past its mark is read
+// from raw events
+func (s *analyticsService) rolledUpBefore(pctx context.Context) (time.Time, error) {
+
+	mark, err := s.clickRepo.GetClickRollupMark(pctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	settled := s.now().UTC().Truncate(time.Hour).Add(-time.Hour)
+	if mark.Before(settled) {
+		return mark, nil
+	}
+	return settled, nil
+}
+
+// clickSeries reads rollups for long or purged ranges, raw events for short ones and for the most recent hours
+func (s *analyticsService) clickSeries(pctx context.Context, urlID uint, query *seriesQuery) (*entities.ClickSeriesRes, error) {
+
+	source := seriesSourceRaw
+	points := make([]*model.ClickBucket, 0)
+
+	if s.fromRollups(query) {
+		source = seriesSourceRollup
+
+		rawFrom, err := s.rolledUpBefore(pctx)
+		if err != nil {
+			return nil, err
+		}
+		if rawFrom.After(query.to) {
+			rawFrom = query.to
+		}
+
+		if query.from.Before(rawFrom) {
+			hourly, err := s.clickRepo.CountClicksByHour(pctx, urlID, query.from.UTC().Truncate(time.Hour), rawFrom, query.includeBots)
+			if err != nil {
+				return nil, err
+			}
+			points = append(points, hourly...)
+		} else {
+			rawFrom = query.from
+		}
+
+		if rawFrom.Before(query.to) {
+			recent, err := s.clickRepo.CountClicksByMinute(pctx, urlID, rawFrom, query.to, query.includeBots)
+			if err != nil {
+				return nil, err
+			}
+			points = append(points, recent...)
+		}
+	} else {
+		raw, err := s.clickRepo.CountClicksByMinute(pctx, urlID, query.from, query.to, query.includeBots)
+		if err != nil {
+			return nil, err
+		}
+		points = raw
+	}
+
+	starts := query.bucketStarts()
+	index := make(map[int64]*entities.ClickSeriesBucketRes, len(starts))
+	buckets := make([]*entities.ClickSeriesBucketRes, 0, len(starts))
+	for _, start := range starts {
+		bucket := &entities.ClickSeriesBucketRes{Start: start}
+		index[start.Unix()] = bucket
+		buckets = append(buckets, bucket)
+	}
+
+	total := 0
+	for _, point := range points {
+		if bucket, ok := index[query.bucketStart(point.Bucket).Unix()]; ok {
+			bucket.Clicks += point.Clicks
+			total += point.Clicks
+		}
+	}
+
+	sketches, err := s.clickRepo.ListVisitorSketches(pctx, urlID, query.from, query.to)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.interval == IntervalDay || query.interval == IntervalWeek {
+		// Sketches cover UTC days, so in other time zones a day is attributed to the bucket its UTC midnight falls in
+		perBucket := make(map[int64][]*model.VisitorSketch)
+		for _, sketch := range sketches {
+			key := query.bucketStart(sketch.Day).Unix()
+			perBucket[key] = append(perBucket[key], sketch)
+		}
+		for _, bucket := range buckets {
+			visitors := countVisitors(perBucket[bucket.Start.Unix()])
+			bucket.UniqueVisitors = &visitors
+		}
+	}
+
+	return &entities.ClickSeriesRes{
+		From:           query.from.In(query.loc),
+		To:             query.to.In(query.loc),
+		Interval:       query.interval,
+		Timezone:       query.loc.String(),
+		Source:         source,
+		Total:          total,
+		UniqueVisitors: countVisitors(sketches),
+		Buckets:        buckets,
+	}, nil
+}
+
+// countVisitors merges daily sketches into the estimate for their union; unreadable sketches are skipped
+func countVisitors(sketches []*model.VisitorSketch) int {
+
+	merged := hll.New()
+	for _, sketch := range sketches {
+		decoded, err := hll.FromBytes(sketch.Sketch)
+		if err != nil {
+			log.Printf("Error: skipping visitor sketch of url %d on %s %s", sketch.URLID, sketch.Day.Format("2006-01-02"), err.Error())
+			continue
+		}
+		merged.Merge(decoded)
+	}
+
+	return int(merged.Count())
+}
+
+// bucketStart truncates t to the start of its bucket in the query time zone; weeks start on Monday
+func (q *seriesQuery) bucketStart(t time.Time) time.Time {
+
+	local := t.In(q.loc)
+	year, month, day := local.Date()
+
+	switch q.interval {
+	case IntervalMinute:
+		return time.Date(year, month, day, local.Hour(), local.Minute(), 0, 0, q.loc)
+	case IntervalHour:
+		return time.Date(year, month, day, local.Hour(), 0, 0, 0, q.loc)
+	case IntervalWeek:
+		offset := (int(local.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, q.loc)
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, q.loc)
+	}
+}
+
+func (q *seriesQuery) bucketStarts() []time.Time {
+
+	starts := make([]time.Time, 0)
+	for start := q.bucketStart(q.from); start.Before(q.to); start = q.nextBucket(start) {
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// onUTCHours tells whether every bucket starts on a UTC hour, so whole hourly rollups fall into each
+func (q *seriesQuery) onUTCHours() bool {
+
+	for start := q.bucketStart(q.from); start.Before(q.to); start = q.nextBucket(start) {
+		if start.UTC().Minute() != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bucketCount counts the buckets of the range but stops past limit, so an absurd range costs no more than a valid one
+func (q *seriesQuery) bucketCount(limit int) int {
+
+	count := 0
+	for start := q.bucketStart(q.from); start.Before(q.to) && count <= limit; start = q.nextBucket(start) {
+		count++
+	}
+	return count
+}
+
+func (q *seriesQuery) nextBucket(start time.Time) time.Time {
+
+	switch q.interval {
+	case IntervalMinute:
+		return start.Add(time.Minute)
+	case IntervalHour:
+		return q.bucketStart(start.Add(time.Hour))
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+func defaultSeriesRange(interval string) time.Duration {
+
+	switch interval {
+	case IntervalMinute:
+		return time.Hour
+	case IntervalHour:
+		return time.Hour * 24
+	case IntervalWeek:
+		return time.Hour * 24 * 7 * 12
+	default:
+		return time.Hour * 24 * 30
+	}
+}
+
+// parseSeriesTime accepts RFC3339 timestamps or plain dates, which are read in the query time zone
+func parseSeriesTime(value string, loc *time.Location) (time.Time, error) {
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
+
+type ClickRollupWorker interface {
+	Start(pctx context.Context)
+	RunOnce(pctx context.Context) error
+}
+
+type clickRollupWorker struct {
+	repo repository.ClickRepository
+	cfg  *configs.Config
+	now  func() time.Time
+}
+
+func NewClickRollupWorker(repo repository.ClickRepository, cfg *configs.Config) ClickRollupWorker {
+	return &clickRollupWorker{
+		repo: repo,
+		cfg:  cfg,
+		now:  time.Now,
+	}
+}
+
+// Start refreshes the hourly rollups on every interval
+func (w *clickRollupWorker) Start(pctx context.Context) {
+
+	ticker := time.NewTicker(w.cfg.Analytics.RollupInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.RunOnce(pctx); err != nil {
+			log.Printf("Error: failed to refresh click rollups %s", err.Error())
+		}
+
+		select {
+		case <-pctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce rolls up every hour from the oldest one not known to be complete up to the current one, a day per query,
+// moving the mark past each day it finishes. The last two hours are always redone, since late clicks may still land
+// in them, so the mark never passes the last full hour.
+func (w *clickRollupWorker) RunOnce(pctx context.Context) error {
+
+	mark, err := w.repo.GetClickRollupMark(pctx)
+	if err != nil {
+		return err
+	}
+
+	hour := w.now().UTC().Truncate(time.Hour)
+	settled := hour.Add(-time.Hour)
+	end := hour.Add(time.Hour)
+
+	from := settled.Add(-time.Hour)
+	if mark.Before(from) {
+		from = mark
+	}
+
+	for from.Before(end) {
+		to := from.Add(time.Hour * 24)
+		if to.After(end) {
+			to = end
+		}
+
+		if err := w.repo.RefreshClickRollups(pctx, from, to); err != nil {
+			return err
+		}
+
+		rolledUpTo := to
+		if rolledUpTo.After(settled) {
+			rolledUpTo = settled
+		}
+		if rolledUpTo.After(mark) {
+			if err := w.repo.SetClickRollupMark(pctx, rolledUpTo); err != nil {
+				return err
+			}
+			mark = rolledUpTo
+		}
+
+		from = to
+	}
+
+	return nil
+}
@@ -0,0 +1,628 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+	"shorten-url/pkg/hll"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetUrlStatic_Success(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	mockClickRepo := new(repository.MockClickRepository)
+	service := NewAnalyticsService(mockRepo, mockClickRepo, newTestBlobs(), testCfg())
+	ctx := context.Background()
+
+	shortCode := "abc123"
+	now := time.Now()
+	expectedURL := &model.URL{
+		ID:          1,
+		ShortCode:   shortCode,
+		OriginalURL: "http://example.com",
+		ClickCount:  15,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	mockRepo.On("GetByShortCode", ctx, shortCode).
+		Return(expectedURL, nil)
+	// The stored click_count is not what the stat reports, it predates the click events
+	mockClickRepo.On("GetClickRollupMark", ctx).Return(time.Now(), nil)
+	mockClickRepo.On("CountClicks", ctx, expectedURL.ID, mock.AnythingOfType("time.Time"), false).
+		Return(12, nil)
+	mockClickRepo.On("ListVisitorSketches", ctx, expectedURL.ID, expectedURL.CreatedAt, mock.AnythingOfType("time.Time")).
+		Return([]*model.VisitorSketch{
+			{URLID: 1, Day: utcTime("2026-10-17T00:00:00Z"), Sketch: visitorSketch("a", "b")},
+			{URLID: 1, Day: utcTime("2026-10-18T00:00:00Z"), Sketch: visitorSketch("b", "c")},
+		}, nil)
+	mockRepo.On("GetURLHealth", ctx, expectedURL.ID).
+		Return(nil, sql.ErrNoRows)
+
+	result, err := service.GetUrlStatic(ctx, shortCode, nil)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, "1", result.Id)
+	assert.Equal(t, expectedURL.OriginalURL, result.Url)
+	assert.Equal(t, expectedURL.ShortCode, result.ShortCode)
+	assert.Equal(t, 12, result.AccessCount)
+	assert.Equal(t, 3, result.UniqueVisitors)
+	assert.Equal(t, expectedURL.CreatedAt, result.CreatedAt)
+	assert.Equal(t, expectedURL.UpdatedAt, result.UpdatedAt)
+	assert.Nil(t, result.Health)
+
+	mockRepo.AssertExpectations(t)
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestGetUrlStatic_CountError(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	mockClickRepo := new(repository.MockClickRepository)
+	service := NewAnalyticsService(mockRepo, mockClickRepo, newTestBlobs(), testCfg())
+	ctx := context.Background()
+
+	mockRepo.On("GetByShortCode", ctx, "abc123").
+		Return(&model.URL{ID: 1, ShortCode: "abc123"}, nil)
+	mockClickRepo.On("GetClickRollupMark", ctx).Return(time.Now(), nil)
+	mockClickRepo.On("CountClicks", ctx, uint(1), mock.AnythingOfType("time.Time"), false).
+		Return(0, errors.New("database error"))
+
+	result, err := service.GetUrlStatic(ctx, "abc123", nil)
+
+	assert.Nil(t, result)
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+
+	mockRepo.AssertExpectations(t)
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestGetUrlStatic_WithHealth(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	mockClickRepo := new(repository.MockClickRepository)
+	service := NewAnalyticsService(mockRepo, mockClickRepo, newTestBlobs(), testCfg())
+	ctx := context.Background()
+
+	shortCode := "abc123"
+	now := time.Now()
+
+	mockRepo.On("GetByShortCode", ctx, shortCode).
+		Return(&model.URL{ID: 1, ShortCode: shortCode, OriginalURL: "http://example.com"}, nil)
+	mockClickRepo.On("GetClickRollupMark", ctx).Return(time.Now(), nil)
+	mockClickRepo.On("CountClicks", ctx, uint(1), mock.AnythingOfType("time.Time"), false).
+		Return(0, nil)
+	mockClickRepo.On("ListVisitorSketches", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).
+		Return([]*model.VisitorSketch{}, nil)
+	mockRepo.On("GetURLHealth", ctx, uint(1)).
+		Return(&model.URLHealth{
+			URLID:               1,
+			StatusCode:          404,
+			LastError:           "404 Not Found",
+			ConsecutiveFailures: 3,
+			IsBroken:            true,
+			LastCheckedAt:       now,
+		}, nil)
+
+	result, err := service.GetUrlStatic(ctx, shortCode, nil)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, result.Health)
+	assert.Equal(t, 404, result.Health.StatusCode)
+	assert.True(t, result.Health.IsBroken)
+	assert.Equal(t, now, result.Health.LastCheckedAt)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetUrlStatic_NotFound(t *testing.T) {
+
+	mockRepo := new(repository.MockURLRepository)
+	service := NewAnalyticsService(mockRepo, new(repository.MockClickRepository), newTestBlobs(), testCfg())
+	ctx := context.Background()
+
+	shortCode := "notfound"
+
+	mockRepo.On("GetByShortCode", ctx, shortCode).
+		Return(nil, errors.New("not found"))
+
+	result, err := service.GetUrlStatic(ctx, shortCode, nil)
+
+	assert.Error(t, err)
+	assert.Nil(t, result)
+	assert.IsType(t, &appErrors.AppError{}, err)
+
+	appErr := err.(*appErrors.AppError)
+	assert.Equal(t, appErrors.NotFound, appErr.Type)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func newSeriesTestService(now time.Time, sketches ...*model.VisitorSketch) (*analyticsService, *repository.MockURLRepository, *repository.MockClickRepository) {
+
+	cfg := testCfg()
+	cfg.Analytics.RawSeriesMaxRange = time.Hour * 48
+	cfg.Analytics.MaxSeriesBuckets = 5000
+
+	mockRepo := new(repository.MockURLRepository)
+	mockClickRepo := new(repository.MockClickRepository)
+	service := NewAnalyticsService(mockRepo, mockClickRepo, newTestBlobs(), cfg).(*analyticsService)
+	service.now = func() time.Time { return now }
+
+	mockRepo.On("GetByShortCode", mock.Anything, "abc123").
+		Return(&model.URL{ID: 1, ShortCode: "abc123", OriginalURL: "http://example.com"}, nil)
+	mockClickRepo.On("CountClicks", mock.Anything, uint(1), mock.AnythingOfType("time.Time"), false).
+		Return(42, nil)
+	mockClickRepo.On("GetClickRollupMark", mock.Anything).Return(now, nil)
+	mockClickRepo.On("ListVisitorSketches", mock.Anything, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).
+		Return(sketches, nil)
+	mockRepo.On("GetURLHealth", mock.Anything, uint(1)).Return(nil, sql.ErrNoRows)
+
+	return service, mockRepo, mockClickRepo
+}
+
+// visitorSketch encodes a sketch holding the given visitor ips
+func visitorSketch(ips ...string) []byte {
+
+	sketch := hll.New()
+	for _, ip := range ips {
+		sketch.AddHash(visitorHash("salt", ip, "agent"))
+	}
+	return sketch.Bytes()
+}
+
+func utcTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339, value)
+	return t.UTC()
+}
+
+func TestGetUrlStatic_SeriesFromRawEventsInTimeZone(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("CountClicksByMinute", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickBucket{
+			{Bucket: utcTime("2026-09-30T17:05:00Z"), Clicks: 2},
+			{Bucket: utcTime("2026-09-30T17:59:00Z"), Clicks: 1},
+			{Bucket: utcTime("2026-09-30T19:30:00Z"), Clicks: 4},
+		}, nil)
+
+	result, err := service.GetUrlStatic(ctx, "abc123", &entities.UrlStaticReq{
+		From:     "2026-10-01",
+		To:       "2026-10-01T03:00:00+07:00",
+		Interval: "hour",
+		TZ:       "Asia/Bangkok",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 42, result.AccessCount)
+	assert.Equal(t, "raw", result.Series.Source)
+	assert.Equal(t, "Asia/Bangkok", result.Series.Timezone)
+	assert.Equal(t, 7, result.Series.Total)
+	assert.Len(t, result.Series.Buckets, 3)
+	assert.Equal(t, "2026-10-01T00:00:00+07:00", result.Series.Buckets[0].Start.Format(time.RFC3339))
+	assert.Equal(t, []int{3, 0, 4}, []int{
+		result.Series.Buckets[0].Clicks,
+		result.Series.Buckets[1].Clicks,
+		result.Series.Buckets[2].Clicks,
+	})
+
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestGetUrlStatic_SeriesFromRollups(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:30:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("CountClicksByHour", ctx, uint(1), utcTime("2026-10-12T00:00:00Z"), utcTime("2026-10-18T09:00:00Z"), false).
+		Return([]*model.ClickBucket{
+			{Bucket: utcTime("2026-10-12T03:00:00Z"), Clicks: 10},
+			{Bucket: utcTime("2026-10-17T23:00:00Z"), Clicks: 5},
+		}, nil)
+	mockClickRepo.On("CountClicksByMinute", ctx, uint(1), utcTime("2026-10-18T09:00:00Z"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickBucket{
+			{Bucket: utcTime("2026-10-18T09:45:00Z"), Clicks: 1},
+		}, nil)
+
+	result, err := service.GetUrlStatic(ctx, "abc123", &entities.UrlStaticReq{
+		From:     "2026-10-12T00:00:00Z",
+		Interval: "week",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "rollup", result.Series.Source)
+	assert.Equal(t, 16, result.Series.Total)
+	assert.Len(t, result.Series.Buckets, 1)
+	assert.Equal(t, time.Monday, result.Series.Buckets[0].Start.Weekday())
+
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestGetUrlStatic_SeriesFromRollupsNeedsWholeHourZone(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:30:00Z"))
+	ctx := context.Background()
+
+	// Local midnight in Kolkata is half past a UTC hour, which hourly rollups cannot split
+	for _, tz := range []string{"Asia/Kolkata", "Australia/Adelaide"} {
+		_, err := service.GetUrlStatic(ctx, "abc123", &entities.UrlStaticReq{From: "2026-09-01", Interval: "day", TZ: tz})
+		var appErr *appErrors.AppError
+		if assert.True(t, errors.As(err, &appErr), tz) {
+			assert.Equal(t, appErrors.InvalidInput, appErr.Type, tz)
+			assert.Contains(t, appErr.Message, tz)
+		}
+	}
+	mockClickRepo.AssertNotCalled(t, "CountClicksByHour", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// Short ranges are counted from raw events, which split anywhere
+	mockClickRepo.On("CountClicksByMinute", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickBucket{
+			{Bucket: utcTime("2026-10-17T18:29:00Z"), Clicks: 1},
+			{Bucket: utcTime("2026-10-17T18:30:00Z"), Clicks: 2},
+		}, nil)
+
+	result, err := service.GetUrlStatic(ctx, "abc123", &entities.UrlStaticReq{From: "2026-10-17", Interval: "day", TZ: "Asia/Kolkata"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "raw", result.Series.Source)
+	if assert.Len(t, result.Series.Buckets, 2) {
+		assert.Equal(t, 1, result.Series.Buckets[0].Clicks)
+		assert.Equal(t, 2, result.Series.Buckets[1].Clicks)
+	}
+}
+
+func TestGetUrlStatic_SeriesOfPurgedDaysFromRollups(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:30:00Z"))
+	service.cfg.Privacy.RetentionDays = 30
+	ctx := context.Background()
+
+	mockClickRepo.On("CountClicksByHour", ctx, uint(1), utcTime("2026-09-01T00:00:00Z"), utcTime("2026-09-01T12:00:00Z"), false).
+		Return([]*model.ClickBucket{
+			{Bucket: utcTime("2026-09-01T08:00:00Z"), Clicks: 6},
+		}, nil)
+
+	result, err := service.GetUrlStatic(ctx, "abc123", &entities.UrlStaticReq{
+		From:     "2026-09-01T00:00:00Z",
+		To:       "2026-09-01T12:00:00Z",
+		Interval: "hour",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "rollup", result.Series.Source)
+	assert.Equal(t, 6, result.Series.Total)
+	mockClickRepo.AssertNotCalled(t, "CountClicksByMinute", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetUrlStatic_SeriesDefaultsToDaily(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:30:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("CountClicksByHour", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickBucket{}, nil)
+	mockClickRepo.On("CountClicksByMinute", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickBucket{}, nil)
+
+	result, err := service.GetUrlStatic(ctx, "abc123", &entities.UrlStaticReq{TZ: "UTC"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "day", result.Series.Interval)
+	assert.Len(t, result.Series.Buckets, 31)
+	assert.Equal(t, 0, result.Series.Total)
+}
+
+func TestGetUrlStatic_SeriesValidation(t *testing.T) {
+
+	service, _, _ := newSeriesTestService(utcTime("2026-10-18T10:30:00Z"))
+	ctx := context.Background()
+
+	for name, req := range map[string]*entities.UrlStaticReq{
+		"unknown tz":       {TZ: "Mars/Olympus"},
+		"unknown interval": {Interval: "month"},
+		"bad from":         {From: "yesterday"},
+		"bad to":           {To: "18/10/2026"},
+		"inverted range":   {From: "2026-10-10", To: "2026-10-01"},
+		"too many buckets": {From: "2026-01-01", Interval: "minute"},
+		"absurd range":     {From: "0001-01-01", To: "9999-12-31", Interval: "minute"},
+	} {
+		_, err := service.GetUrlStatic(ctx, "abc123", req)
+		var appErr *appErrors.AppError
+		assert.True(t, errors.As(err, &appErr), name)
+		assert.Equal(t, appErrors.InvalidInput, appErr.Type, name)
+	}
+}
+
+func TestGetUrlStatic_SeriesRepoError(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:30:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("CountClicksByMinute", ctx, uint(1), mock.Anything, mock.Anything, false).
+		Return(nil, errors.New("database error"))
+
+	_, err := service.GetUrlStatic(ctx, "abc123", &entities.UrlStaticReq{Interval: "minute"})
+
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+}
+
+func TestGetBreakdown_ReferrersGroupedByChannelWithOther(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("CountClicksByDimension", ctx, uint(1), model.ClickDimensionReferrer, utcTime("2026-09-18T10:00:00Z"), utcTime("2026-10-18T10:00:00Z"), false).
+		Return([]*model.ClickDimensionCount{
+			{Value: "google.com", Clicks: 5},
+			{Value: "", Clicks: 4},
+			{Value: "google.co.th", Clicks: 3},
+			{Value: "t.co", Clicks: 2},
+			{Value: "blog.example", Clicks: 1},
+		}, nil)
+
+	result, err := service.GetBreakdown(ctx, "abc123", model.ClickDimensionReferrer, &entities.ClickBreakdownReq{Limit: 2})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 15, result.Total)
+	assert.Len(t, result.Items, 3)
+	assert.Equal(t, "Google", result.Items[0].Name)
+	assert.Equal(t, 8, result.Items[0].Clicks)
+	assert.Equal(t, "Direct", result.Items[1].Name)
+	assert.Equal(t, 4, result.Items[1].Clicks)
+	assert.Equal(t, breakdownOther, result.Items[2].Name)
+	assert.Equal(t, 3, result.Items[2].Clicks)
+	assert.InDelta(t, 0.2, result.Items[2].Share, 0.0001)
+}
+
+func TestGetBreakdown_EmptyValuesAreUnknown(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("CountClicksByDimension", ctx, uint(1), model.ClickDimensionBrowser, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickDimensionCount{
+			{Value: "Chrome", Clicks: 3},
+			{Value: "", Clicks: 1},
+		}, nil)
+
+	result, err := service.GetBreakdown(ctx, "abc123", model.ClickDimensionBrowser, nil)
+
+	assert.NoError(t, err)
+	assert.Len(t, result.Items, 2)
+	assert.Equal(t, "Chrome", result.Items[0].Name)
+	assert.Equal(t, "Unknown", result.Items[1].Name)
+	assert.InDelta(t, 0.75, result.Items[0].Share, 0.0001)
+}
+
+func TestGetBreakdown_SourcesSeparateQrScans(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("CountClicksByDimension", ctx, uint(1), model.ClickDimensionSource, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickDimensionCount{
+			{Value: model.ClickSourceDirect, Clicks: 6},
+			{Value: model.ClickSourceQR, Clicks: 2},
+		}, nil)
+
+	result, err := service.GetBreakdown(ctx, "abc123", model.ClickDimensionSource, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 8, result.Total)
+	assert.Equal(t, model.ClickSourceDirect, result.Items[0].Name)
+	assert.Equal(t, model.ClickSourceQR, result.Items[1].Name)
+	assert.Equal(t, 2, result.Items[1].Clicks)
+}
+
+func TestGetBreakdown_InvalidRequest(t *testing.T) {
+
+	service := NewAnalyticsService(new(repository.MockURLRepository), new(repository.MockClickRepository), newTestBlobs(), testCfg())
+	ctx := context.Background()
+
+	cases := []struct {
+		dimension string
+		req       *entities.ClickBreakdownReq
+	}{
+		{dimension: "countries", req: nil},
+		{dimension: model.ClickDimensionOS, req: &entities.ClickBreakdownReq{Limit: maxBreakdownLimit + 1}},
+		{dimension: model.ClickDimensionOS, req: &entities.ClickBreakdownReq{TZ: "Mars/Olympus"}},
+		{dimension: model.ClickDimensionOS, req: &entities.ClickBreakdownReq{From: "2026-10-02", To: "2026-10-01"}},
+	}
+
+	for _, tc := range cases {
+		result, err := service.GetBreakdown(ctx, "abc123", tc.dimension, tc.req)
+
+		assert.Nil(t, result)
+		assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+	}
+}
+
+func TestGetBreakdown_NotFound(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := NewAnalyticsService(mockRepo, new(repository.MockClickRepository), newTestBlobs(), testCfg())
+	ctx := context.Background()
+
+	mockRepo.On("GetByShortCode", ctx, "missing").
+		Return(nil, sql.ErrNoRows)
+
+	result, err := service.GetBreakdown(ctx, "missing", model.ClickDimensionDevice, nil)
+
+	assert.Nil(t, result)
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+}
+
+func TestGetUrlStatic_SeriesUniqueVisitorsPerDay(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"),
+		&model.VisitorSketch{URLID: 1, Day: utcTime("2026-10-16T00:00:00Z"), Sketch: visitorSketch("a", "b")},
+		&model.VisitorSketch{URLID: 1, Day: utcTime("2026-10-17T00:00:00Z"), Sketch: visitorSketch("b", "c", "d")},
+		&model.VisitorSketch{URLID: 1, Day: utcTime("2026-10-17T00:00:00Z"), Sketch: []byte("corrupt")},
+	)
+	ctx := context.Background()
+
+	mockClickRepo.On("CountClicksByMinute", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickBucket{}, nil)
+
+	result, err := service.GetUrlStatic(ctx, "abc123", &entities.UrlStaticReq{From: "2026-10-16", To: "2026-10-18", Interval: "day"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.Series.UniqueVisitors)
+	assert.Len(t, result.Series.Buckets, 2)
+	assert.Equal(t, 2, *result.Series.Buckets[0].UniqueVisitors)
+	assert.Equal(t, 3, *result.Series.Buckets[1].UniqueVisitors)
+	assert.Equal(t, 4, result.UniqueVisitors)
+	assert.Equal(t, utcTime("2026-10-16T00:00:00Z"), result.UniqueVisitorsSince.UTC())
+	// The series already merged the range's sketches
+	mockClickRepo.AssertNumberOfCalls(t, "ListVisitorSketches", 1)
+}
+
+func TestGetUrlStatic_SeriesHourlyHasNoBucketVisitors(t *testing.T) {
+
+	service, _, mockClickRepo := newSeriesTestService(utcTime("2026-10-18T10:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("CountClicksByMinute", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), false).
+		Return([]*model.ClickBucket{}, nil)
+
+	result, err := service.GetUrlStatic(ctx, "abc123", &entities.UrlStaticReq{Interval: "hour"})
+
+	assert.NoError(t, err)
+	assert.Nil(t, result.Series.Buckets[0].UniqueVisitors)
+}
+
+func TestGetUrlStatic_IncludeBots(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	mockClickRepo := new(repository.MockClickRepository)
+	service := NewAnalyticsService(mockRepo, mockClickRepo, newTestBlobs(), testCfg())
+	service.(*analyticsService).now = func() time.Time { return utcTime("2026-10-18T12:30:00Z") }
+	ctx := context.Background()
+
+	mockRepo.On("GetByShortCode", ctx, "abc123").
+		Return(&model.URL{ID: 1, ShortCode: "abc123", ClickCount: 15}, nil)
+	// Rollups up to the previous full hour, raw events after
+	mockClickRepo.On("GetClickRollupMark", ctx).Return(time.Now(), nil)
+	mockClickRepo.On("CountClicks", ctx, uint(1), utcTime("2026-10-18T11:00:00Z"), true).
+		Return(20, nil)
+	mockClickRepo.On("ListVisitorSketches", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).
+		Return([]*model.VisitorSketch{}, nil)
+	mockRepo.On("GetURLHealth", ctx, uint(1)).
+		Return(nil, sql.ErrNoRows)
+
+	result, err := service.GetUrlStatic(ctx, "abc123", &entities.UrlStaticReq{IncludeBots: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 20, result.AccessCount)
+	assert.True(t, result.IncludesBots)
+	assert.Nil(t, result.Series)
+
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestGetUrlStatic_RollupsTrustedOnlyUpToMark(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	mockClickRepo := new(repository.MockClickRepository)
+	service := NewAnalyticsService(mockRepo, mockClickRepo, newTestBlobs(), testCfg())
+	service.(*analyticsService).now = func() time.Time { return utcTime("2026-10-18T12:30:00Z") }
+	ctx := context.Background()
+
+	mockRepo.On("GetByShortCode", ctx, "abc123").
+		Return(&model.URL{ID: 1, ShortCode: "abc123"}, nil)
+	// The rollup worker has not caught up since an outage, so the hours after its mark come from raw events
+	mockClickRepo.On("GetClickRollupMark", ctx).Return(utcTime("2026-10-17T05:00:00Z"), nil)
+	mockClickRepo.On("CountClicks", ctx, uint(1), utcTime("2026-10-17T05:00:00Z"), false).
+		Return(7, nil)
+	mockClickRepo.On("ListVisitorSketches", ctx, uint(1), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).
+		Return([]*model.VisitorSketch{}, nil)
+	mockRepo.On("GetURLHealth", ctx, uint(1)).
+		Return(nil, sql.ErrNoRows)
+
+	result, err := service.GetUrlStatic(ctx, "abc123", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 7, result.AccessCount)
+	mockClickRepo.AssertExpectations(t)
+}
+
+func newTestRollupWorker(now time.Time, mark time.Time) (*clickRollupWorker, *repository.MockClickRepository) {
+
+	mockClickRepo := new(repository.MockClickRepository)
+	worker := NewClickRollupWorker(mockClickRepo, testCfg()).(*clickRollupWorker)
+	worker.now = func() time.Time { return now }
+	mockClickRepo.On("GetClickRollupMark", mock.Anything).Return(mark, nil)
+
+	return worker, mockClickRepo
+}
+
+func TestClickRollupWorker_RedoesRecentHours(t *testing.T) {
+
+	worker, mockClickRepo := newTestRollupWorker(utcTime("2026-10-18T10:30:00Z"), utcTime("2026-10-18T09:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("RefreshClickRollups", ctx, utcTime("2026-10-18T08:00:00Z"), utcTime("2026-10-18T11:00:00Z")).Return(nil).Once()
+
+	assert.NoError(t, worker.RunOnce(ctx))
+	mockClickRepo.AssertExpectations(t)
+	mockClickRepo.AssertNotCalled(t, "SetClickRollupMark", mock.Anything, mock.Anything)
+}
+
+func TestClickRollupWorker_CatchesUpAfterOutage(t *testing.T) {
+
+	worker, mockClickRepo := newTestRollupWorker(utcTime("2026-10-18T10:30:00Z"), utcTime("2026-10-16T20:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("RefreshClickRollups", ctx, utcTime("2026-10-16T20:00:00Z"), utcTime("2026-10-17T20:00:00Z")).Return(nil).Once()
+	mockClickRepo.On("SetClickRollupMark", ctx, utcTime("2026-10-17T20:00:00Z")).Return(nil).Once()
+	mockClickRepo.On("RefreshClickRollups", ctx, utcTime("2026-10-17T20:00:00Z"), utcTime("2026-10-18T11:00:00Z")).Return(nil).Once()
+	// The last full hour may still get late clicks, so the mark stops before it
+	mockClickRepo.On("SetClickRollupMark", ctx, utcTime("2026-10-18T09:00:00Z")).Return(nil).Once()
+
+	assert.NoError(t, worker.RunOnce(ctx))
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestClickRollupWorker_FailedRefreshKeepsMark(t *testing.T) {
+
+	worker, mockClickRepo := newTestRollupWorker(utcTime("2026-10-18T10:30:00Z"), utcTime("2026-10-16T20:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("RefreshClickRollups", ctx, mock.Anything, mock.Anything).Return(errors.New("database error")).Once()
+
+	assert.Error(t, worker.RunOnce(ctx))
+	mockClickRepo.AssertNotCalled(t, "SetClickRollupMark", mock.Anything, mock.Anything)
+}
+
+func TestGetUrlStatic_VisitorsOverDefaultRange(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	mockClickRepo := new(repository.MockClickRepository)
+	service := NewAnalyticsService(mockRepo, mockClickRepo, newTestBlobs(), testCfg())
+	now := utcTime("2026-10-18T12:30:00Z")
+	service.(*analyticsService).now = func() time.Time { return now }
+	ctx := context.Background()
+
+	mockRepo.On("GetByShortCode", ctx, "abc123").
+		Return(&model.URL{ID: 1, ShortCode: "abc123", CreatedAt: utcTime("2024-01-01T00:00:00Z")}, nil)
+	mockClickRepo.On("GetClickRollupMark", ctx).Return(now, nil)
+	mockClickRepo.On("CountClicks", ctx, uint(1), mock.AnythingOfType("time.Time"), false).
+		Return(0, nil)
+	// A link from years ago still only merges the sketches of the last 30 days
+	mockClickRepo.On("ListVisitorSketches", ctx, uint(1), utcTime("2026-09-18T12:30:00Z"), now).
+		Return([]*model.VisitorSketch{}, nil)
+	mockRepo.On("GetURLHealth", ctx, uint(1)).
+		Return(nil, sql.ErrNoRows)
+
+	result, err := service.GetUrlStatic(ctx, "abc123", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, utcTime("2026-09-18T12:30:00Z"), result.UniqueVisitorsSince)
+	mockClickRepo.AssertExpectations(t)
+}
@@ -0,0 +1,342 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"shorten-url/configs"
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+)
+
+const (
+	BlocklistKindDomain   = "domain"
+	BlocklistKindWildcard = "wildcard"
+	BlocklistKindRegex    = "regex"
+
+	blocklistSourceDatabase = "database"
+	blocklistSourceFile     = "file"
+)
+
+var hostnamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+type BlocklistService interface {
+	Check(rawURL string) error
+	Blocked(rawURL string) *model.BlocklistRule
+	Reload(pctx context.Context) error
+	CreateRule(pctx context.Context, req *entities.CreateBlocklistRuleReq) (*entities.BlocklistRuleRes, error)
+	ListRules(pctx context.Context) ([]*entities.BlocklistRuleRes, error)
+	DeleteRule(pctx context.Context, id uint) error
+}
+
+type blocklistService struct {
+	repo repository.BlocklistRepository
+	cfg  *configs.Config
+
+	mu        sync.RWMutex
+	dbRules   []*model.BlocklistRule
+	fileRules []*model.BlocklistRule
+	snapshot  *blocklistSnapshot
+}
+
+// blocklistSnapshot is the compiled, read-only form of every active rule
+type blocklistSnapshot struct {
+	domains   map[string]*model.BlocklistRule
+	wildcards []*model.BlocklistRule
+	regexes   []compiledRegexRule
+}
+
+type compiledRegexRule struct {
+	re   *regexp.Regexp
+	rule *model.BlocklistRule
+}
+
+func NewBlocklistService(repo repository.BlocklistRepository, cfg *configs.Config) BlocklistService {
+
+	return &blocklistService{
+		repo:     repo,
+		cfg:      cfg,
+		snapshot: compileBlocklist(nil),
+	}
+}
+
+// Check rejects destinations that cannot be parsed or that match a blocklist rule
+func (s *blocklistService) Check(rawURL string) error {
+
+	target, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || target.Hostname() == "" {
+		return appErrors.NewInvalidInputError("invalid url")
+	}
+
+	if rule := s.match(target); rule != nil {
+		log.Printf("Blocked destination %s by %s rule %q", target.Hostname(), rule.Kind, rule.Pattern)
+		return appErrors.NewForbiddenError(fmt.Sprintf("destination %s is blocked", target.Hostname()))
+	}
+
+	return nil
+}
+
+// Blocked returns the rule matching the url, or nil when it is allowed
+func (s *blocklistService) Blocked(rawURL string) *model.BlocklistRule {
+
+	target, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || target.Hostname() == "" {
+		return nil
+	}
+
+	return s.match(target)
+}
+
+func (s *blocklistService) match(target *url.URL) *model.BlocklistRule {
+
+	s.mu.RLock()
+	snapshot := s.snapshot
+	s.mu.RUnlock()
+
+	host := strings.TrimSuffix(strings.ToLower(target.Hostname()), ".")
+
+	if rule, ok := snapshot.domains[host]; ok {
+		return rule
+	}
+
+	for _, rule := range snapshot.wildcards {
+		if strings.HasSuffix(host, strings.TrimPrefix(rule.Pattern, "*")) {
+			return rule
+		}
+	}
+
+	full := target.String()
+	for _, compiled := range snapshot.regexes {
+		if compiled.re.MatchString(full) {
+			return compiled.rule
+		}
+	}
+
+	return nil
+}
+
+// Reload replaces the active rules with the database rules plus the configured rule file
+func (s *blocklistService) Reload(pctx context.Context) error {
+
+	dbRules, err := s.repo.ListRules(pctx)
+	if err != nil {
+		return err
+	}
+
+	fileRules, err := loadBlocklistFile(s.cfg.Blocklist.FilePath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.dbRules = dbRules
+	s.fileRules = fileRules
+	s.rebuildLocked()
+	s.mu.Unlock()
+
+	log.Printf("Loaded %d blocklist rules (%d from file)", len(dbRules)+len(fileRules), len(fileRules))
+
+	return nil
+}
+
+func (s *blocklistService) CreateRule(pctx context.Context, req *entities.CreateBlocklistRuleReq) (*entities.BlocklistRuleRes, error) {
+
+	rule, err := normalizeBlocklistRule(req.Kind, req.Pattern)
+	if err != nil {
+		return nil, appErrors.NewInvalidInputError(err.Error())
+	}
+	rule.Reason = strings.TrimSpace(req.Reason)
+
+	s.mu.RLock()
+	for _, existing := range s.dbRules {
+		if existing.Kind == rule.Kind && existing.Pattern == rule.Pattern {
+			s.mu.RUnlock()
+			return nil, appErrors.NewConflictError("blocklist rule already exists")
+		}
+	}
+	s.mu.RUnlock()
+
+	created, err := s.repo.CreateRule(pctx, rule)
+	if err != nil {
+		log.Printf("Error: failed to create blocklist rule %s", err.Error())
+		return nil, appErrors.NewInternalError("failed to create blocklist rule", err)
+	}
+
+	s.mu.Lock()
+	s.dbRules = append(s.dbRules, created)
+	s.rebuildLocked()
+	s.mu.Unlock()
+
+	return toBlocklistRuleRes(created, blocklistSourceDatabase), nil
+}
+
+func (s *blocklistService) ListRules(pctx context.Context) ([]*entities.BlocklistRuleRes, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make([]*entities.BlocklistRuleRes, 0, len(s.dbRules)+len(s.fileRules))
+	for _, rule := range s.dbRules {
+		res = append(res, toBlocklistRuleRes(rule, blocklistSourceDatabase))
+	}
+	for _, rule := range s.fileRules {
+		res = append(res, toBlocklistRuleRes(rule, blocklistSourceFile))
+	}
+
+	return res, nil
+}
+
+func (s *blocklistService) DeleteRule(pctx context.Context, id uint) error {
+
+	if err := s.repo.DeleteRule(pctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return appErrors.NewNotFoundError("blocklist rule was not found")
+		}
+		log.Printf("Error: failed to delete blocklist rule %d %s", id, err.Error())
+		return appErrors.NewInternalError("failed to delete blocklist rule", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules := make([]*model.BlocklistRule, 0, len(s.dbRules))
+	for _, rule := range s.dbRules {
+		if rule.ID != id {
+			rules = append(rules, rule)
+		}
+	}
+	s.dbRules = rules
+	s.rebuildLocked()
+
+	return nil
+}
+
+func (s *blocklistService) rebuildLocked() {
+
+	rules := make([]*model.BlocklistRule, 0, len(s.dbRules)+len(s.fileRules))
+	rules = append(rules, s.dbRules...)
+	rules = append(rules, s.fileRules...)
+
+	s.snapshot = compileBlocklist(rules)
+}
+
+func compileBlocklist(rules []*model.BlocklistRule) *blocklistSnapshot {
+
+	snapshot := &blocklistSnapshot{
+		domains: make(map[string]*model.BlocklistRule),
+	}
+
+	for _, rule := range rules {
+		switch rule.Kind {
+		case BlocklistKindDomain:
+			snapshot.domains[rule.Pattern] = rule
+		case BlocklistKindWildcard:
+			snapshot.wildcards = append(snapshot.wildcards, rule)
+		case BlocklistKindRegex:
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				log.Printf("Error: skipping invalid blocklist regex %q %s", rule.Pattern, err.Error())
+				continue
+			}
+			snapshot.regexes = append(snapshot.regexes, compiledRegexRule{re: re, rule: rule})
+		}
+	}
+
+	return snapshot
+}
+
+// normalizeBlocklistRule validates a rule and lower-cases domain patterns
+func normalizeBlocklistRule(kind string, pattern string) (*model.BlocklistRule, error) {
+
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	pattern = strings.TrimSpace(pattern)
+
+	switch kind {
+	case BlocklistKindDomain:
+		pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+		if !hostnamePattern.MatchString(pattern) {
+			return nil, fmt.Errorf("invalid domain %q", pattern)
+		}
+	case BlocklistKindWildcard:
+		pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+		if !strings.HasPrefix(pattern, "*.") || !hostnamePattern.MatchString(pattern[2:]) {
+			return nil, fmt.Errorf("invalid wildcard %q, expected *.example.com", pattern)
+		}
+	case BlocklistKindRegex:
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid regex %q", pattern)
+		}
+	default:
+		return nil, fmt.Errorf("unknown rule kind %q", kind)
+	}
+
+	return &model.BlocklistRule{
+		Kind:    kind,
+		Pattern: pattern,
+	}, nil
+}
+
+// loadBlocklistFile reads one rule per line: example.com, *.example.com or regex:<expr>
+func loadBlocklistFile(path string) ([]*model.BlocklistRule, error) {
+
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("Blocklist file %s does not exist, skipping", path)
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := make([]*model.BlocklistRule, 0)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kind := BlocklistKindDomain
+		switch {
+		case strings.HasPrefix(line, "regex:"):
+			kind, line = BlocklistKindRegex, strings.TrimPrefix(line, "regex:")
+		case strings.HasPrefix(line, "*."):
+			kind = BlocklistKindWildcard
+		}
+
+		rule, err := normalizeBlocklistRule(kind, line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+func toBlocklistRuleRes(rule *model.BlocklistRule, source string) *entities.BlocklistRuleRes {
+	return &entities.BlocklistRuleRes{
+		Id:        rule.ID,
+		Kind:      rule.Kind,
+		Pattern:   rule.Pattern,
+		Reason:    rule.Reason,
+		Source:    source,
+		CreatedAt: rule.CreatedAt,
+	}
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newLoadedBlocklist(t *testing.T, rules []*model.BlocklistRule, fileContent string) (BlocklistService, *repository.MockBlocklistRepository) {
+
+	cfg := testCfg()
+	if fileContent != "" {
+		cfg.Blocklist.FilePath = filepath.Join(t.TempDir(), "blocklist.txt")
+		assert.NoError(t, os.WriteFile(cfg.Blocklist.FilePath, []byte(fileContent), 0o644))
+	}
+
+	mockRepo := new(repository.MockBlocklistRepository)
+	mockRepo.On("ListRules", mock.Anything).Return(rules, nil).Once()
+
+	blocklist := NewBlocklistService(mockRepo, cfg)
+	assert.NoError(t, blocklist.Reload(context.Background()))
+
+	return blocklist, mockRepo
+}
+
+func TestBlocklist_Check(t *testing.T) {
+
+	blocklist, _ := newLoadedBlocklist(t, []*model.BlocklistRule{
+		{ID: 1, Kind: BlocklistKindDomain, Pattern: "phish.example"},
+		{ID: 2, Kind: BlocklistKindWildcard, Pattern: "*.evil.test"},
+	}, "# comment\nregex:^https?://[^/]+/login\\.php\n*.bad.test\n")
+
+	tests := []struct {
+		name     string
+		url      string
+		wantType appErrors.ErrorType
+	}{
+		{name: "allowed", url: "https://example.com/page"},
+		{name: "exact domain", url: "http://PHISH.example/x", wantType: appErrors.Forbidden},
+		{name: "exact domain does not cover subdomain", url: "http://www.phish.example/x"},
+		{name: "wildcard subdomain", url: "https://a.b.evil.test/", wantType: appErrors.Forbidden},
+		{name: "wildcard does not cover apex", url: "https://evil.test/"},
+		{name: "file wildcard", url: "https://x.bad.test", wantType: appErrors.Forbidden},
+		{name: "file regex", url: "https://anything.example/login.php", wantType: appErrors.Forbidden},
+		{name: "invalid url", url: "not a url", wantType: appErrors.InvalidInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := blocklist.Check(tt.url)
+			if tt.wantType == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var appErr *appErrors.AppError
+			assert.True(t, errors.As(err, &appErr))
+			assert.Equal(t, tt.wantType, appErr.Type)
+		})
+	}
+}
+
+func TestBlocklist_ReloadInvalidFile(t *testing.T) {
+
+	cfg := testCfg()
+	cfg.Blocklist.FilePath = filepath.Join(t.TempDir(), "blocklist.txt")
+	assert.NoError(t, os.WriteFile(cfg.Blocklist.FilePath, []byte("regex:([\n"), 0o644))
+
+	mockRepo := new(repository.MockBlocklistRepository)
+	mockRepo.On("ListRules", mock.Anything).Return([]*model.BlocklistRule{}, nil)
+
+	err := NewBlocklistService(mockRepo, cfg).Reload(context.Background())
+
+	assert.Error(t, err)
+}
+
+func TestBlocklist_CreateRule(t *testing.T) {
+
+	blocklist, mockRepo := newLoadedBlocklist(t, []*model.BlocklistRule{
+		{ID: 1, Kind: BlocklistKindDomain, Pattern: "phish.example"},
+	}, "")
+	ctx := context.Background()
+	now := time.Now()
+
+	mockRepo.On("CreateRule", ctx, mock.MatchedBy(func(rule *model.BlocklistRule) bool {
+		return rule.Kind == BlocklistKindWildcard && rule.Pattern == "*.scam.test"
+	})).Return(&model.BlocklistRule{ID: 2, Kind: BlocklistKindWildcard, Pattern: "*.scam.test", Reason: "reported", CreatedAt: now}, nil)
+
+	res, err := blocklist.CreateRule(ctx, &entities.CreateBlocklistRuleReq{Kind: "Wildcard", Pattern: "*.SCAM.test", Reason: "reported"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), res.Id)
+	assert.Equal(t, "database", res.Source)
+	assert.Error(t, blocklist.Check("https://login.scam.test"))
+
+	_, err = blocklist.CreateRule(ctx, &entities.CreateBlocklistRuleReq{Kind: "domain", Pattern: "phish.example"})
+	assert.Equal(t, appErrors.Conflict, err.(*appErrors.AppError).Type)
+
+	for _, req := range []*entities.CreateBlocklistRuleReq{
+		{Kind: "domain", Pattern: "https://x.test/path"},
+		{Kind: "wildcard", Pattern: "scam.test"},
+		{Kind: "regex", Pattern: "(["},
+		{Kind: "unknown", Pattern: "x.test"},
+	} {
+		_, err := blocklist.CreateRule(ctx, req)
+		assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type, req.Pattern)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestBlocklist_DeleteRule(t *testing.T) {
+
+	blocklist, mockRepo := newLoadedBlocklist(t, []*model.BlocklistRule{
+		{ID: 1, Kind: BlocklistKindDomain, Pattern: "phish.example"},
+	}, "")
+	ctx := context.Background()
+
+	mockRepo.On("DeleteRule", ctx, uint(1)).Return(nil)
+	mockRepo.On("DeleteRule", ctx, uint(9)).Return(sql.ErrNoRows)
+	mockRepo.On("DeleteRule", ctx, uint(10)).Return(errors.New("connection refused"))
+
+	assert.Error(t, blocklist.Check("http://phish.example"))
+	assert.NoError(t, blocklist.DeleteRule(ctx, 1))
+	assert.NoError(t, blocklist.Check("http://phish.example"))
+
+	err := blocklist.DeleteRule(ctx, 9)
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+
+	// A failing database is not reported as a missing rule
+	err = blocklist.DeleteRule(ctx, 10)
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+
+	rules, err := blocklist.ListRules(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestURLService_BlockedDestinations(t *testing.T) {
+
+	blocklist, _ := newLoadedBlocklist(t, []*model.BlocklistRule{
+		{ID: 1, Kind: BlocklistKindDomain, Pattern: "phish.example"},
+	}, "")
+	mockRepo := new(repository.MockURLRepository)
+	cfg := testCfg()
+	service := newTestServiceWith(cfg, mockRepo, blocklist, NewShortenerResolver(cfg), NewReservedWords(cfg))
+	ctx := context.Background()
+
+	_, err := service.ShortenURL(ctx, "http://phish.example/login", "", "")
+	assert.Equal(t, appErrors.Forbidden, err.(*appErrors.AppError).Type)
+
+	_, err = service.UpdateShortUrl(ctx, "abc123", "http://phish.example/login")
+	assert.Equal(t, appErrors.Forbidden, err.(*appErrors.AppError).Type)
+
+	mockRepo.On("GetByShortCode", ctx, "abc123").
+		Return(&model.URL{ID: 1, ShortCode: "abc123", OriginalURL: "http://phish.example/login"}, nil)
+
+	_, err = service.GetOriginalURL(ctx, "abc123", nil)
+	assert.Equal(t, appErrors.Forbidden, err.(*appErrors.AppError).Type)
+
+	mockRepo.AssertExpectations(t)
+}
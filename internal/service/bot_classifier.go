@@ -0,0 +1,112 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"shorten-url/configs"
+	"shorten-url/internal/entities"
+	"shorten-url/pkg/useragent"
+)
+
+type BotClassifier interface {
+	IsBot(click *entities.ClickInfo) bool
+}
+
+type botClassifier struct {
+	ranges []*net.IPNet
+}
+
+func NewBotClassifier(cfg *configs.Config) BotClassifier {
+
+	ranges, err := loadBotIPRanges(cfg.Analytics.BotIPRangesFile)
+	if err != nil {
+		log.Printf("Error: failed to load bot ip ranges from %s %s", cfg.Analytics.BotIPRangesFile, err.Error())
+	}
+
+	return &botClassifier{
+		ranges: ranges,
+	}
+}
+
+// IsBot reports whether a click came from software rather than a person; clicks without metadata count as human
+func (b *botClassifier) IsBot(click *entities.ClickInfo) bool {
+
+	if click == nil {
+		return false
+	}
+
+	// Unfurlers probe with HEAD and browsers prefetch links the user never opened
+	if click.Method == http.MethodHead || isPrefetch(click.Purpose) {
+		return true
+	}
+
+	// Every browser sends a user agent, scripts and scanners often do not
+	if strings.TrimSpace(click.UserAgent) == "" || useragent.Parse(click.UserAgent).IsBot {
+		return true
+	}
+
+	if ip := net.ParseIP(click.IP); ip != nil {
+		for _, r := range b.ranges {
+			if r.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isPrefetch(purpose string) bool {
+
+	purpose = strings.ToLower(purpose)
+	return strings.Contains(purpose, "prefetch") || strings.Contains(purpose, "preview")
+}
+
+func loadBotIPRanges(path string) ([]*net.IPNet, error) {
+
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("Bot ip ranges file %s does not exist, skipping", path)
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	ranges := make([]*net.IPNet, 0)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// A bare address is a range of one
+		if !strings.Contains(line, "/") {
+			if ip := net.ParseIP(line); ip != nil && ip.To4() != nil {
+				line += "/32"
+			} else {
+				line += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		ranges = append(ranges, ipNet)
+	}
+
+	return ranges, scanner.Err()
+}
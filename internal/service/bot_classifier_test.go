@@ -0,0 +1,71 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"shorten-url/internal/entities"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testBrowserUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+
+func newTestBotClassifier(t *testing.T) BotClassifier {
+
+	path := filepath.Join(t.TempDir(), "bot_ip_ranges.txt")
+	content := "# scanners\n192.0.2.0/24\n\n2001:db8::1\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testCfg()
+	cfg.Analytics.BotIPRangesFile = path
+	return NewBotClassifier(cfg)
+}
+
+func TestBotClassifier_IsBot(t *testing.T) {
+
+	classifier := newTestBotClassifier(t)
+
+	cases := []struct {
+		name  string
+		click *entities.ClickInfo
+		bot   bool
+	}{
+		{name: "no metadata", click: nil, bot: false},
+		{name: "browser", click: &entities.ClickInfo{UserAgent: testBrowserUserAgent, IP: "203.0.113.7", Method: "GET"}, bot: false},
+		{name: "crawler user agent", click: &entities.ClickInfo{UserAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", Method: "GET"}, bot: true},
+		{name: "empty user agent", click: &entities.ClickInfo{IP: "203.0.113.7", Method: "GET"}, bot: true},
+		{name: "head request", click: &entities.ClickInfo{UserAgent: testBrowserUserAgent, Method: "HEAD"}, bot: true},
+		{name: "prefetch", click: &entities.ClickInfo{UserAgent: testBrowserUserAgent, Method: "GET", Purpose: "prefetch;prerender"}, bot: true},
+		{name: "scanner range", click: &entities.ClickInfo{UserAgent: testBrowserUserAgent, IP: "192.0.2.77", Method: "GET"}, bot: true},
+		{name: "scanner address", click: &entities.ClickInfo{UserAgent: testBrowserUserAgent, IP: "2001:db8::1", Method: "GET"}, bot: true},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.bot, classifier.IsBot(tc.click), tc.name)
+	}
+}
+
+func TestLoadBotIPRanges_InvalidLine(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "bot_ip_ranges.txt")
+	if err := os.WriteFile(path, []byte("192.0.2.0/24\nnot-a-range\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ranges, err := loadBotIPRanges(path)
+
+	assert.Nil(t, ranges)
+	assert.ErrorContains(t, err, ":2:")
+}
+
+func TestLoadBotIPRanges_MissingFile(t *testing.T) {
+
+	ranges, err := loadBotIPRanges(filepath.Join(t.TempDir(), "missing.txt"))
+
+	assert.NoError(t, err)
+	assert.Empty(t, ranges)
+}
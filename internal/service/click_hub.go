@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"shorten-url/configs"
+	"shorten-url/internal/entities"
+)
+
+// FirehoseID subscribes to the clicks of every link
+const FirehoseID uint = 0
+
+const liveCounterSeconds = 300
+
+// ClickHub fans clicks out to live subscribers in process and keeps rolling per-second counters
+type ClickHub interface {
+	Start(pctx context.Context)
+	Publish(urlID uint, click *entities.LiveClickRes)
+	Subscribe(urlID uint) *ClickSubscription
+	Unsubscribe(sub *ClickSubscription)
+	Counters(urlID uint) *entities.LiveCountersRes
+}
+
+// ClickSubscription receives clicks on C; C is closed when the subscriber is evicted for falling behind or unsubscribes
+type ClickSubscription struct {
+	C       <-chan *entities.LiveClickRes
+	URLID   uint
+	ch      chan *entities.LiveClickRes
+	evicted bool
+}
+
+// Evicted reports whether the hub dropped the subscription because its buffer was full
+func (s *ClickSubscription) Evicted() bool {
+	return s.evicted
+}
+
+type clickHub struct {
+	cfg *configs.Config
+	now func() time.Time
+
+	mu          sync.Mutex
+	subscribers map[uint]map[*ClickSubscription]struct{}
+	counters    map[uint]*rollingCounter
+}
+
+func NewClickHub(cfg *configs.Config) ClickHub {
+	return &clickHub{
+		cfg:         cfg,
+		now:         time.Now,
+		subscribers: make(map[uint]map[*ClickSubscription]struct{}),
+		counters:    make(map[uint]*rollingCounter),
+	}
+}
+
+// Start forgets the counters of links without clicks in the counted window until the context is cancelled
+func (h *clickHub) Start(pctx context.Context) {
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pctx.Done():
+			return
+		case <-ticker.C:
+			h.prune()
+		}
+	}
+}
+
+// Publish never blocks: a subscriber whose buffer is full is evicted instead of slowing the redirect down
+func (h *clickHub) Publish(urlID uint, click *entities.LiveClickRes) {
+
+	now := h.now().Unix()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, id := range []uint{urlID, FirehoseID} {
+		counter := h.counters[id]
+		if counter == nil {
+			counter = new(rollingCounter)
+			h.counters[id] = counter
+		}
+		counter.add(now)
+
+		for sub := range h.subscribers[id] {
+			select {
+			case sub.ch <- click:
+			default:
+				log.Printf("Evicting slow live subscriber of url %d", id)
+				sub.evicted = true
+				h.remove(sub)
+			}
+		}
+	}
+}
+
+func (h *clickHub) Subscribe(urlID uint) *ClickSubscription {
+
+	size := h.cfg.Analytics.LiveBufferSize
+	if size <= 0 {
+		size = 1
+	}
+
+	ch := make(chan *entities.LiveClickRes, size)
+	sub := &ClickSubscription{C: ch, URLID: urlID, ch: ch}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers[urlID] == nil {
+		h.subscribers[urlID] = make(map[*ClickSubscription]struct{})
+	}
+	h.subscribers[urlID][sub] = struct{}{}
+
+	return sub
+}
+
+func (h *clickHub) Unsubscribe(sub *ClickSubscription) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(sub)
+}
+
+func (h *clickHub) Counters(urlID uint) *entities.LiveCountersRes {
+
+	now := h.now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counters := &entities.LiveCountersRes{
+		At:          now.UTC(),
+		Subscribers: len(h.subscribers[urlID]),
+	}
+	if counter := h.counters[urlID]; counter != nil {
+		counters.LastMinute = counter.sum(now.Unix(), 60)
+		counters.LastFiveMinutes = counter.sum(now.Unix(), liveCounterSeconds)
+	}
+
+	return counters
+}
+
+// remove must be called with the lock held; closing C is safe because sends also happen under the lock
+func (h *clickHub) remove(sub *ClickSubscription) {
+
+	subs, ok := h.subscribers[sub.URLID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.URLID)
+	}
+	close(sub.ch)
+}
+
+func (h *clickHub) prune() {
+
+	now := h.now().Unix()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, counter := range h.counters {
+		if now-counter.lastClick >= liveCounterSeconds {
+			delete(h.counters, id)
+		}
+	}
+}
+
+// rollingCounter counts clicks per second over the last liveCounterSeconds seconds in a ring
+type rollingCounter struct {
+	seconds [liveCounterSeconds]int
+	last    int64
+	// lastClick is kept apart from last, which reading the counters also advances
+	lastClick int64
+}
+
+func (r *rollingCounter) advance(now int64) {
+
+	if now <= r.last {
+		return
+	}
+
+	if now-r.last >= liveCounterSeconds {
+		r.seconds = [liveCounterSeconds]int{}
+	} else {
+		for second := r.last + 1; second <= now; second++ {
+			r.seconds[second%liveCounterSeconds] = 0
+		}
+	}
+	r.last = now
+}
+
+func (r *rollingCounter) add(now int64) {
+
+	r.advance(now)
+	r.seconds[now%liveCounterSeconds]++
+	r.lastClick = now
+}
+
+// sum totals the window seconds ending at now
+func (r *rollingCounter) sum(now int64, window int64) int {
+
+	r.advance(now)
+
+	total := 0
+	for second := now - window + 1; second <= now; second++ {
+		total += r.seconds[second%liveCounterSeconds]
+	}
+	return total
+}
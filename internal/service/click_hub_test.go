@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClickHub(bufferSize int, now *time.Time) *clickHub {
+
+	cfg := testCfg()
+	cfg.Analytics.LiveBufferSize = bufferSize
+
+	hub := NewClickHub(cfg).(*clickHub)
+	hub.now = func() time.Time { return *now }
+	return hub
+}
+
+func TestClickHub_DeliversToLinkAndFirehose(t *testing.T) {
+
+	now := utcTime("2026-10-18T10:00:00Z")
+	hub := newTestClickHub(4, &now)
+
+	link := hub.Subscribe(1)
+	other := hub.Subscribe(2)
+	firehose := hub.Subscribe(FirehoseID)
+
+	hub.Publish(1, &entities.LiveClickRes{ShortCode: "abc123"})
+
+	assert.Equal(t, "abc123", (<-link.C).ShortCode)
+	assert.Equal(t, "abc123", (<-firehose.C).ShortCode)
+	assert.Len(t, other.C, 0)
+
+	hub.Unsubscribe(link)
+	hub.Unsubscribe(link)
+
+	_, open := <-link.C
+	assert.False(t, open)
+	assert.False(t, link.Evicted())
+}
+
+func TestClickHub_EvictsSlowSubscriber(t *testing.T) {
+
+	now := utcTime("2026-10-18T10:00:00Z")
+	hub := newTestClickHub(1, &now)
+
+	slow := hub.Subscribe(1)
+
+	hub.Publish(1, &entities.LiveClickRes{ShortCode: "first"})
+	hub.Publish(1, &entities.LiveClickRes{ShortCode: "second"})
+
+	assert.Equal(t, "first", (<-slow.C).ShortCode)
+	_, open := <-slow.C
+	assert.False(t, open)
+	assert.True(t, slow.Evicted())
+	assert.Equal(t, 0, hub.Counters(1).Subscribers)
+
+	// Publishing after the eviction must not touch the closed channel
+	hub.Publish(1, &entities.LiveClickRes{ShortCode: "third"})
+}
+
+func TestClickHub_RollingCounters(t *testing.T) {
+
+	now := utcTime("2026-10-18T10:00:00Z")
+	hub := newTestClickHub(16, &now)
+
+	hub.Publish(1, &entities.LiveClickRes{})
+	now = now.Add(time.Second * 30)
+	hub.Publish(1, &entities.LiveClickRes{})
+	hub.Publish(2, &entities.LiveClickRes{})
+	now = now.Add(time.Second * 45)
+
+	counters := hub.Counters(1)
+	assert.Equal(t, 1, counters.LastMinute)
+	assert.Equal(t, 2, counters.LastFiveMinutes)
+	assert.Equal(t, 3, hub.Counters(FirehoseID).LastFiveMinutes)
+
+	now = now.Add(time.Minute * 5)
+	assert.Equal(t, 0, hub.Counters(1).LastFiveMinutes)
+
+	hub.prune()
+	assert.Empty(t, hub.counters)
+}
+
+func TestClickRecorder_PublishesHumanClicks(t *testing.T) {
+
+	cfg := testCfg()
+	cfg.Analytics.QueueSize = 10
+	cfg.Analytics.LiveBufferSize = 10
+	hub := NewClickHub(cfg)
+	recorder := NewClickRecorder(new(repository.MockClickRepository), NewBotClassifier(cfg), hub, newTestWebhooks(cfg), newTestSalts(cfg), cfg)
+	ctx := context.Background()
+
+	sub := hub.Subscribe(1)
+
+	recorder.Record(ctx, &model.URL{ID: 1, ShortCode: "abc123"}, &entities.ClickInfo{UserAgent: testBrowserUserAgent, Referrer: "https://t.co/x", Country: "th"})
+	recorder.Record(ctx, &model.URL{ID: 1, ShortCode: "abc123"}, &entities.ClickInfo{UserAgent: "curl/8.0"})
+
+	assert.Len(t, sub.C, 1)
+
+	click := <-sub.C
+	assert.Equal(t, "abc123", click.ShortCode)
+	assert.Equal(t, "TH", click.Country)
+	assert.Equal(t, "t.co", click.Referrer)
+	assert.Equal(t, "desktop", click.Device)
+}
+
+func TestLiveService_Subscribe(t *testing.T) {
+
+	mockRepo := new(repository.MockURLRepository)
+	hub := NewClickHub(testCfg())
+	service := NewLiveService(mockRepo, hub)
+	ctx := context.Background()
+
+	mockRepo.On("GetByShortCode", ctx, "abc123").
+		Return(&model.URL{ID: 7, ShortCode: "abc123"}, nil)
+	mockRepo.On("GetByShortCode", ctx, "missing").
+		Return(nil, errors.New("not found"))
+
+	sub, err := service.Subscribe(ctx, "abc123")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), sub.URLID)
+	assert.Equal(t, 1, service.Counters(sub).Subscribers)
+
+	service.Unsubscribe(sub)
+	assert.Equal(t, 0, service.Counters(sub).Subscribers)
+
+	assert.Equal(t, FirehoseID, service.SubscribeAll().URLID)
+
+	_, err = service.Subscribe(ctx, "missing")
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+}
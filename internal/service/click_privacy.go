@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/netip"
+	"sync"
+	"time"
+
+	"shorten-url/configs"
+	"shorten-url/internal/entities"
+	"shorten-url/internal/repository"
+)
+
+const (
+	IPTruncationNone    = "none"
+	IPTruncationPartial = "partial"
+	IPTruncationStrict  = "strict"
+
+	IPStorageFull   = "full"
+	IPStorageHashed = "hashed"
+	IPStorageNone   = "none"
+
+	RetentionModeDrop      = "drop"
+	RetentionModeAggregate = "aggregate"
+
+	visitorSaltSize = 32
+)
+
+// truncateIP zeroes the host part of an address: /24 and /48 when partial, /16 and /32 when strict.
+// Anything that does not parse is discarded rather than stored as given.
+func truncateIP(ip string, mode string) string {
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap().WithZone("")
+
+	v4, v6 := 24, 48
+	switch mode {
+	case IPTruncationNone:
+		return addr.String()
+	case IPTruncationStrict:
+		v4, v6 = 16, 32
+	}
+
+	bits := v6
+	if addr.Is4() {
+		bits = v4
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.Addr().String()
+}
+
+// doNotTrack reports whether a click asked, through DNT or Sec-GPC, not to be tracked and the config honors that
+func doNotTrack(cfg *configs.Config, click *entities.ClickInfo) bool {
+	return cfg.Privacy.HonorDoNotTrack && click != nil && click.DoNotTrack
+}
+
+// VisitorSalts hands out the salt that ip hashes and visitor hashes of a given day are made with
+type VisitorSalts interface {
+	Load(pctx context.Context) error
+	Start(pctx context.Context)
+	Salt(at time.Time) string
+}
+
+type visitorSalts struct {
+	repo repository.ClickRepository
+	cfg  *configs.Config
+	now  func() time.Time
+
+	mu    sync.RWMutex
+	salts map[time.Time]string
+}
+
+func NewVisitorSalts(repo repository.ClickRepository, cfg *configs.Config) VisitorSalts {
+	return &visitorSalts{
+		repo:  repo,
+		cfg:   cfg,
+		now:   time.Now,
+		salts: make(map[time.Time]string),
+	}
+}
+
+// Load fetches the salts of today and tomorrow, so the redirect path never waits for one at midnight
+func (s *visitorSalts) Load(pctx context.Context) error {
+
+	if !s.cfg.Privacy.DailySalt {
+		return nil
+	}
+
+	today := s.now().UTC().Truncate(time.Hour * 24)
+
+	for _, day := range []time.Time{today, today.AddDate(0, 0, 1)} {
+		if _, ok := s.cached(day); ok {
+			continue
+		}
+
+		candidate := make([]byte, visitorSaltSize)
+		rand.Read(candidate)
+
+		salt, err := s.repo.EnsureDailySalt(pctx, day, candidate)
+		if err != nil {
+			return err
+		}
+		s.store(day, hex.EncodeToString(salt))
+	}
+
+	// Yesterday's salt is kept one more day for instances whose clock is slightly behind
+	expired := today.AddDate(0, 0, -1)
+
+	s.mu.Lock()
+	for day := range s.salts {
+		if day.Before(expired) {
+			delete(s.salts, day)
+		}
+	}
+	s.mu.Unlock()
+
+	return s.repo.DeleteDailySaltsBefore(pctx, expired)
+}
+
+// Start reloads the salts every hour, rotating in the next day's and destroying the expired ones
+func (s *visitorSalts) Start(pctx context.Context) {
+
+	if !s.cfg.Privacy.DailySalt {
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.Load(pctx); err != nil {
+			log.Printf("Error: failed to rotate visitor salts %s", err.Error())
+		}
+	}
+}
+
+// Salt returns the day's shared salt, or the static one when daily salts are off
+func (s *visitorSalts) Salt(at time.Time) string {
+
+	if !s.cfg.Privacy.DailySalt {
+		return s.cfg.Analytics.IPHashSalt
+	}
+
+	day := at.UTC().Truncate(time.Hour * 24)
+	if salt, ok := s.cached(day); ok {
+		return salt
+	}
+
+	// The shared salt could not be loaded; a local one still hashes, it just does not match other instances
+	log.Printf("Error: no shared visitor salt for %s, using a local one", day.Format("2006-01-02"))
+
+	candidate := make([]byte, visitorSaltSize)
+	rand.Read(candidate)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if salt, ok := s.salts[day]; ok {
+		return salt
+	}
+	s.salts[day] = hex.EncodeToString(candidate)
+	return s.salts[day]
+}
+
+func (s *visitorSalts) cached(day time.Time) (string, bool) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	salt, ok := s.salts[day]
+	return salt, ok
+}
+
+func (s *visitorSalts) store(day time.Time, salt string) {
+
+	s.mu.Lock()
+	s.salts[day] = salt
+	s.mu.Unlock()
+}
+
+// retentionCutoff is the UTC midnight before which raw click events are purged, or the zero time when they are kept forever
+func retentionCutoff(cfg *configs.Config, now time.Time) time.Time {
+
+	if cfg.Privacy.RetentionDays <= 0 {
+		return time.Time{}
+	}
+	return now.UTC().Truncate(time.Hour*24).AddDate(0, 0, -cfg.Privacy.RetentionDays)
+}
+
+// ClickRetention purges raw click events past the retention period, keeping what stats need in aggregate form
+type ClickRetention interface {
+	Start(pctx context.Context)
+	RunOnce(pctx context.Context) error
+}
+
+type clickRetention struct {
+	repo repository.ClickRepository
+	cfg  *configs.Config
+	now  func() time.Time
+}
+
+func NewClickRetention(repo repository.ClickRepository, cfg *configs.Config) ClickRetention {
+	return &clickRetention{
+		repo: repo,
+		cfg:  cfg,
+		now:  time.Now,
+	}
+}
+
+// Start purges on every interval; a retention of zero days keeps raw events forever
+func (w *clickRetention) Start(pctx context.Context) {
+
+	if w.cfg.Privacy.RetentionDays <= 0 {
+		return
+	}
+
+	interval := w.cfg.Privacy.RetentionInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.RunOnce(pctx); err != nil {
+			log.Printf("Error: failed to purge expired click events %s", err.Error())
+		}
+
+		select {
+		case <-pctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce purges one UTC day at a time so each transaction stays small and a failure only repeats one day
+func (w *clickRetention) RunOnce(pctx context.Context) error {
+
+	cutoff := retentionCutoff(w.cfg, w.now())
+	if cutoff.IsZero() {
+		return nil
+	}
+
+	// Raw events are the only copy of hours the rollup worker has not reached yet, so those are kept
+	mark, err := w.repo.GetClickRollupMark(pctx)
+	if err != nil {
+		return err
+	}
+	if rolledUp := mark.UTC().Truncate(time.Hour * 24); rolledUp.Before(cutoff) {
+		cutoff = rolledUp
+	}
+
+	oldest, err := w.repo.OldestClickEventTime(pctx)
+	if err != nil {
+		return err
+	}
+	if oldest.IsZero() || !oldest.Before(cutoff) {
+		return nil
+	}
+
+	aggregate := w.cfg.Privacy.RetentionMode != RetentionModeDrop
+
+	var purged int64
+	for day := oldest.UTC().Truncate(time.Hour * 24); day.Before(cutoff); day = day.AddDate(0, 0, 1) {
+		if pctx.Err() != nil {
+			return pctx.Err()
+		}
+
+		count, err := w.repo.PurgeClickEvents(pctx, day, day.AddDate(0, 0, 1), aggregate)
+		if err != nil {
+			return err
+		}
+		purged += count
+	}
+
+	log.Printf("Purged %d click events recorded before %s", purged, cutoff.Format("2006-01-02"))
+	return nil
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"shorten-url/configs"
+	"shorten-url/internal/entities"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+	"shorten-url/pkg/hll"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newTestSalts hands out the static salt unless a test turns daily salts on
+func newTestSalts(cfg *configs.Config) VisitorSalts {
+	return NewVisitorSalts(new(repository.MockClickRepository), cfg)
+}
+
+func TestTruncateIP(t *testing.T) {
+
+	tests := []struct {
+		ip   string
+		mode string
+		want string
+	}{
+		{"203.0.113.77", IPTruncationPartial, "203.0.113.0"},
+		{"203.0.113.77", IPTruncationStrict, "203.0.0.0"},
+		{"203.0.113.77", IPTruncationNone, "203.0.113.77"},
+		{"203.0.113.77", "", "203.0.113.0"},
+		{"::ffff:203.0.113.77", IPTruncationPartial, "203.0.113.0"},
+		{"2001:db8:abcd:12:1:2:3:4", IPTruncationPartial, "2001:db8:abcd::"},
+		{"2001:db8:abcd:12:1:2:3:4", IPTruncationStrict, "2001:db8::"},
+		{"fe80::1%eth0", IPTruncationNone, "fe80::1"},
+		{"not-an-ip", IPTruncationNone, ""},
+		{"", IPTruncationPartial, ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, truncateIP(tt.ip, tt.mode), "%s %s", tt.ip, tt.mode)
+	}
+}
+
+// recordOne records a single click and returns the event that reached the repository
+func recordOne(t *testing.T, cfg *configs.Config, click *entities.ClickInfo) (*model.ClickEvent, bool) {
+
+	cfg.Analytics.QueueSize = 10
+	cfg.Analytics.Workers = 1
+	cfg.Analytics.BatchSize = 10
+	cfg.Analytics.FlushInterval = time.Hour
+
+	mockClickRepo := new(repository.MockClickRepository)
+	recorder := NewClickRecorder(mockClickRepo, NewBotClassifier(cfg), NewClickHub(cfg), newTestWebhooks(cfg), newTestSalts(cfg), cfg)
+	ctx := context.Background()
+
+	var stored *model.ClickEvent
+	mockClickRepo.On("InsertClickEvents", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { stored = args.Get(1).([]*model.ClickEvent)[0] }).
+		Return(nil)
+	mockClickRepo.On("AddClickCounts", mock.Anything, mock.Anything).Return([]*model.URL{}, nil)
+	mockClickRepo.On("AddQrCodeScans", mock.Anything, mock.Anything).Return(nil)
+
+	sketched := false
+	mockClickRepo.On("MergeVisitorSketch", mock.Anything, uint(1), mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { sketched = args.Get(3).(*hll.Sketch).Count() > 0 }).
+		Return(nil)
+
+	recorder.Record(ctx, &model.URL{ID: 1, ShortCode: "abc123"}, click)
+	assert.NoError(t, recorder.Close(ctx))
+
+	return stored, sketched
+}
+
+func TestClickRecorder_IPStorageModes(t *testing.T) {
+
+	click := &entities.ClickInfo{UserAgent: testBrowserUserAgent, IP: "203.0.113.77", Method: "GET"}
+
+	cfg := testCfg()
+	cfg.Analytics.IPHashSalt = "salt"
+	cfg.Privacy.IPStorage = IPStorageHashed
+	event, sketched := recordOne(t, cfg, click)
+	assert.Empty(t, event.IP)
+	assert.Equal(t, hashIP("salt", "203.0.113.0"), event.IPHash)
+	assert.True(t, sketched)
+
+	cfg = testCfg()
+	cfg.Privacy.IPStorage = IPStorageFull
+	cfg.Privacy.IPTruncation = IPTruncationStrict
+	event, _ = recordOne(t, cfg, click)
+	assert.Equal(t, "203.0.0.0", event.IP)
+	assert.Empty(t, event.IPHash)
+
+	cfg = testCfg()
+	cfg.Privacy.IPStorage = IPStorageNone
+	event, sketched = recordOne(t, cfg, click)
+	assert.Empty(t, event.IP)
+	assert.Empty(t, event.IPHash)
+	assert.True(t, sketched, "visitors are still counted from the hash, which is never stored")
+}
+
+func TestClickRecorder_HonorsDoNotTrack(t *testing.T) {
+
+	click := &entities.ClickInfo{
+		UserAgent:  testBrowserUserAgent,
+		IP:         "203.0.113.77",
+		Referrer:   "https://news.example.com/article",
+		Country:    "TH",
+		Source:     model.ClickSourceQR,
+		Method:     "GET",
+		DoNotTrack: true,
+	}
+
+	cfg := testCfg()
+	cfg.Privacy.HonorDoNotTrack = true
+	event, sketched := recordOne(t, cfg, click)
+
+	assert.Equal(t, uint(1), event.URLID)
+	assert.Equal(t, model.ClickSourceQR, event.Source)
+	assert.False(t, event.ClickedAt.IsZero())
+	assert.Empty(t, event.Referrer)
+	assert.Empty(t, event.UserAgent)
+	assert.Empty(t, event.Browser)
+	assert.Empty(t, event.Country)
+	assert.Empty(t, event.IPHash)
+	assert.False(t, sketched)
+
+	cfg = testCfg()
+	event, sketched = recordOne(t, cfg, click)
+	assert.Equal(t, "TH", event.Country)
+	assert.NotEmpty(t, event.IPHash)
+	assert.True(t, sketched)
+}
+
+func TestVisitorSalts_LoadSharesStoredSaltsAndForgetsOldOnes(t *testing.T) {
+
+	cfg := testCfg()
+	cfg.Privacy.DailySalt = true
+
+	mockClickRepo := new(repository.MockClickRepository)
+	salts := NewVisitorSalts(mockClickRepo, cfg).(*visitorSalts)
+	salts.now = func() time.Time { return utcTime("2026-10-18T23:30:00Z") }
+	ctx := context.Background()
+
+	mockClickRepo.On("EnsureDailySalt", ctx, utcTime("2026-10-18T00:00:00Z"), mock.Anything).Return([]byte{0x01}, nil).Once()
+	mockClickRepo.On("EnsureDailySalt", ctx, utcTime("2026-10-19T00:00:00Z"), mock.Anything).Return([]byte{0x02}, nil).Once()
+	mockClickRepo.On("DeleteDailySaltsBefore", ctx, utcTime("2026-10-17T00:00:00Z")).Return(nil)
+
+	assert.NoError(t, salts.Load(ctx))
+	assert.Equal(t, "01", salts.Salt(utcTime("2026-10-18T23:59:59Z")))
+	assert.Equal(t, "02", salts.Salt(utcTime("2026-10-19T00:00:01Z")))
+
+	// Cached days are not fetched again
+	assert.NoError(t, salts.Load(ctx))
+
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestVisitorSalts_FallsBackToLocalSalt(t *testing.T) {
+
+	cfg := testCfg()
+	cfg.Privacy.DailySalt = true
+
+	mockClickRepo := new(repository.MockClickRepository)
+	salts := NewVisitorSalts(mockClickRepo, cfg)
+
+	mockClickRepo.On("EnsureDailySalt", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("database error"))
+
+	assert.Error(t, salts.Load(context.Background()))
+
+	salt := salts.Salt(time.Now())
+	assert.Len(t, salt, visitorSaltSize*2)
+	assert.Equal(t, salt, salts.Salt(time.Now()), "the local salt is kept for the rest of the day")
+}
+
+func TestVisitorSalts_StaticSaltWhenDailyIsOff(t *testing.T) {
+
+	cfg := testCfg()
+	cfg.Analytics.IPHashSalt = "static"
+
+	mockClickRepo := new(repository.MockClickRepository)
+	salts := NewVisitorSalts(mockClickRepo, cfg)
+
+	assert.NoError(t, salts.Load(context.Background()))
+	assert.Equal(t, "static", salts.Salt(time.Now()))
+	mockClickRepo.AssertNotCalled(t, "EnsureDailySalt", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// newTestRetention has every hour up to now rolled up, unless rolledUpTo says otherwise
+func newTestRetention(now time.Time, days int, mode string, rolledUpTo ...time.Time) (*clickRetention, *repository.MockClickRepository) {
+
+	cfg := testCfg()
+	cfg.Privacy.RetentionDays = days
+	cfg.Privacy.RetentionMode = mode
+
+	mockClickRepo := new(repository.MockClickRepository)
+	retention := NewClickRetention(mockClickRepo, cfg).(*clickRetention)
+	retention.now = func() time.Time { return now }
+
+	mark := now
+	if len(rolledUpTo) > 0 {
+		mark = rolledUpTo[0]
+	}
+	mockClickRepo.On("GetClickRollupMark", mock.Anything).Return(mark, nil)
+
+	return retention, mockClickRepo
+}
+
+func TestClickRetention_PurgesWholeDaysBeforeCutoff(t *testing.T) {
+
+	retention, mockClickRepo := newTestRetention(utcTime("2026-10-18T10:00:00Z"), 30, RetentionModeAggregate)
+	ctx := context.Background()
+
+	mockClickRepo.On("OldestClickEventTime", ctx).Return(utcTime("2026-09-16T13:45:00Z"), nil)
+	mockClickRepo.On("PurgeClickEvents", ctx, utcTime("2026-09-16T00:00:00Z"), utcTime("2026-09-17T00:00:00Z"), true).Return(int64(5), nil).Once()
+	mockClickRepo.On("PurgeClickEvents", ctx, utcTime("2026-09-17T00:00:00Z"), utcTime("2026-09-18T00:00:00Z"), true).Return(int64(3), nil).Once()
+
+	assert.NoError(t, retention.RunOnce(ctx))
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestClickRetention_KeepsHoursNotRolledUp(t *testing.T) {
+
+	// The rollup worker is stuck since 05:00 on the 17th, so the raw events of that day are all there is
+	retention, mockClickRepo := newTestRetention(utcTime("2026-10-18T10:00:00Z"), 30, RetentionModeAggregate, utcTime("2026-09-17T05:00:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("OldestClickEventTime", ctx).Return(utcTime("2026-09-16T13:45:00Z"), nil)
+	mockClickRepo.On("PurgeClickEvents", ctx, utcTime("2026-09-16T00:00:00Z"), utcTime("2026-09-17T00:00:00Z"), true).Return(int64(5), nil).Once()
+
+	assert.NoError(t, retention.RunOnce(ctx))
+	mockClickRepo.AssertExpectations(t)
+	mockClickRepo.AssertNumberOfCalls(t, "PurgeClickEvents", 1)
+}
+
+func TestClickRetention_DropModeSkipsAggregates(t *testing.T) {
+
+	retention, mockClickRepo := newTestRetention(utcTime("2026-10-18T10:00:00Z"), 1, RetentionModeDrop)
+	ctx := context.Background()
+
+	mockClickRepo.On("OldestClickEventTime", ctx).Return(utcTime("2026-10-16T08:00:00Z"), nil)
+	mockClickRepo.On("PurgeClickEvents", ctx, utcTime("2026-10-16T00:00:00Z"), utcTime("2026-10-17T00:00:00Z"), false).Return(int64(1), nil).Once()
+
+	assert.NoError(t, retention.RunOnce(ctx))
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestClickRetention_NothingToPurge(t *testing.T) {
+
+	retention, mockClickRepo := newTestRetention(utcTime("2026-10-18T10:00:00Z"), 30, RetentionModeAggregate)
+	ctx := context.Background()
+
+	mockClickRepo.On("OldestClickEventTime", ctx).Return(utcTime("2026-10-01T00:00:00Z"), nil).Once()
+	assert.NoError(t, retention.RunOnce(ctx))
+
+	mockClickRepo.On("OldestClickEventTime", ctx).Return(time.Time{}, nil).Once()
+	assert.NoError(t, retention.RunOnce(ctx))
+
+	mockClickRepo.AssertNotCalled(t, "PurgeClickEvents", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestClickRetention_StopsAtFirstError(t *testing.T) {
+
+	retention, mockClickRepo := newTestRetention(utcTime("2026-10-18T10:00:00Z"), 30, RetentionModeAggregate)
+	ctx := context.Background()
+
+	mockClickRepo.On("OldestClickEventTime", ctx).Return(utcTime("2026-09-10T00:00:00Z"), nil)
+	mockClickRepo.On("PurgeClickEvents", ctx, mock.Anything, mock.Anything, true).Return(int64(0), errors.New("database error")).Once()
+
+	assert.Error(t, retention.RunOnce(ctx))
+	mockClickRepo.AssertNumberOfCalls(t, "PurgeClickEvents", 1)
+}
+
+func TestClickRetention_DisabledKeepsEverything(t *testing.T) {
+
+	retention, mockClickRepo := newTestRetention(utcTime("2026-10-18T10:00:00Z"), 0, RetentionModeAggregate)
+
+	assert.NoError(t, retention.RunOnce(context.Background()))
+	mockClickRepo.AssertNotCalled(t, "OldestClickEventTime", mock.Anything)
+}
@@ -0,0 +1,471 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"shorten-url/configs"
+	"shorten-url/internal/entities"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+	"shorten-url/pkg/hll"
+	"shorten-url/pkg/referrer"
+	"shorten-url/pkg/useragent"
+)
+
+const (
+	maxStoredUserAgentLength = 512
+
+	ClickQueuePolicyDrop  = "drop"
+	ClickQueuePolicyBlock = "block"
+)
+
+// ClickRecorder queues clicks in memory and writes them in batches off the redirect path
+type ClickRecorder interface {
+	Start(pctx context.Context)
+	Record(pctx context.Context, url *model.URL, click *entities.ClickInfo)
+	Close(pctx context.Context) error
+	Stats() *entities.ClickPipelineStatsRes
+}
+
+// pendingClick is a queued event; the raw ip never enters the queue, only what the privacy settings keep of it
+type pendingClick struct {
+	url        *model.URL
+	event      *model.ClickEvent
+	visitor    uint64
+	hasVisitor bool
+}
+
+type clickRecorder struct {
+	repo     repository.ClickRepository
+	bots     BotClassifier
+	hub      ClickHub
+	webhooks WebhookService
+	salts    VisitorSalts
+	cfg      *configs.Config
+
+	queue   chan *pendingClick
+	mu      sync.RWMutex
+	closed  bool
+	started sync.Once
+	stopped sync.Once
+	done    chan struct{}
+
+	accepted atomic.Uint64
+	dropped  atomic.Uint64
+	written  atomic.Uint64
+	failed   atomic.Uint64
+}
+
+func NewClickRecorder(repo repository.ClickRepository, bots BotClassifier, hub ClickHub, webhooks WebhookService, salts VisitorSalts, cfg *configs.Config) ClickRecorder {
+
+	queueSize := cfg.Analytics.QueueSize
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	return &clickRecorder{
+		repo:     repo,
+		bots:     bots,
+		hub:      hub,
+		webhooks: webhooks,
+		salts:    salts,
+		cfg:      cfg,
+		queue:    make(chan *pendingClick, queueSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the batch writers until the recorder is closed; cancelling the context closes it and drains the queue
+func (r *clickRecorder) Start(pctx context.Context) {
+
+	r.started.Do(func() {
+		workers := r.cfg.Analytics.Workers
+		if workers <= 0 {
+			workers = 1
+		}
+
+		// Draining must outlive the server context, otherwise the last batches are lost on shutdown
+		ctx := context.WithoutCancel(pctx)
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.work(ctx)
+			}()
+		}
+
+		go func() {
+			select {
+			case <-pctx.Done():
+				r.stopIntake()
+			case <-r.done:
+			}
+		}()
+
+		wg.Wait()
+		close(r.done)
+	})
+}
+
+// Record classifies and enqueues a click, applying the back-pressure policy when the queue is full
+func (r *clickRecorder) Record(pctx context.Context, url *model.URL, click *entities.ClickInfo) {
+
+	pending := &pendingClick{url: url, event: newClickEvent(r.cfg, url, click, time.Now().UTC())}
+	pending.event.IsBot = r.bots.IsBot(click)
+	r.anonymize(pending, click)
+
+	// Live viewers see every human click, even one the queue has to drop
+	if !pending.event.IsBot {
+		r.hub.Publish(url.ID, &entities.LiveClickRes{
+			ShortCode: url.ShortCode,
+			ClickedAt: pending.event.ClickedAt,
+			Country:   pending.event.Country,
+			Device:    pending.event.Device,
+			Referrer:  pending.event.ReferrerHost,
+			Source:    pending.event.Source,
+		})
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		r.drop(url)
+		return
+	}
+
+	select {
+	case r.queue <- pending:
+		r.accepted.Add(1)
+		return
+	default:
+	}
+
+	if r.cfg.Analytics.QueuePolicy != ClickQueuePolicyBlock || r.cfg.Analytics.EnqueueTimeout <= 0 {
+		r.drop(url)
+		return
+	}
+
+	timer := time.NewTimer(r.cfg.Analytics.EnqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case r.queue <- pending:
+		r.accepted.Add(1)
+	case <-timer.C:
+		r.drop(url)
+	case <-pctx.Done():
+		r.drop(url)
+	}
+}
+
+// Close stops accepting clicks and waits until the queued ones are written or the context expires
+func (r *clickRecorder) Close(pctx context.Context) error {
+
+	r.stopIntake()
+
+	// A recorder that was never started still owes its queued clicks a write
+	go r.Start(pctx)
+
+	select {
+	case <-r.done:
+		log.Printf("Click recorder drained, %d written, %d dropped, %d failed", r.written.Load(), r.dropped.Load(), r.failed.Load())
+		return nil
+	case <-pctx.Done():
+		return fmt.Errorf("click recorder did not drain, %d clicks still queued: %w", len(r.queue), pctx.Err())
+	}
+}
+
+func (r *clickRecorder) Stats() *entities.ClickPipelineStatsRes {
+	return &entities.ClickPipelineStatsRes{
+		Queued:   len(r.queue),
+		Capacity: cap(r.queue),
+		Policy:   r.policy(),
+		Accepted: r.accepted.Load(),
+		Dropped:  r.dropped.Load(),
+		Written:  r.written.Load(),
+		Failed:   r.failed.Load(),
+	}
+}
+
+// anonymize keeps only the truncated address, stored or hashed as configured, and nothing at all for clicks that opted out
+func (r *clickRecorder) anonymize(pending *pendingClick, click *entities.ClickInfo) {
+
+	if click == nil || doNotTrack(r.cfg, click) {
+		return
+	}
+
+	ip := truncateIP(click.IP, r.cfg.Privacy.IPTruncation)
+	if ip == "" {
+		return
+	}
+
+	salt := r.salts.Salt(pending.event.ClickedAt)
+
+	switch r.cfg.Privacy.IPStorage {
+	case IPStorageFull:
+		pending.event.IP = ip
+	case IPStorageNone:
+	default:
+		pending.event.IPHash = hashIP(salt, ip)
+	}
+
+	if !pending.event.IsBot {
+		pending.visitor = visitorHash(salt, ip, click.UserAgent)
+		pending.hasVisitor = true
+	}
+}
+
+func (r *clickRecorder) policy() string {
+
+	if r.cfg.Analytics.QueuePolicy == ClickQueuePolicyBlock {
+		return ClickQueuePolicyBlock
+	}
+	return ClickQueuePolicyDrop
+}
+
+func (r *clickRecorder) drop(url *model.URL) {
+
+	// Log the first drop and then every thousandth so a saturated queue does not flood the log
+	if dropped := r.dropped.Add(1); dropped%1000 == 1 {
+		log.Printf("Error: click queue is full, dropped click for %s (%d dropped so far)", url.ShortCode, dropped)
+	}
+}
+
+func (r *clickRecorder) stopIntake() {
+
+	r.stopped.Do(func() {
+		r.mu.Lock()
+		r.closed = true
+		close(r.queue)
+		r.mu.Unlock()
+	})
+}
+
+// work collects queued clicks into batches, flushing when a batch is full, on every interval and once the queue is closed
+func (r *clickRecorder) work(ctx context.Context) {
+
+	batchSize := r.cfg.Analytics.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	interval := r.cfg.Analytics.FlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]*pendingClick, 0, batchSize)
+	for {
+		select {
+		case pending, ok := <-r.queue:
+			if !ok {
+				r.flush(ctx, batch)
+				return
+			}
+			batch = append(batch, pending)
+			if len(batch) >= batchSize {
+				r.flush(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.flush(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush writes the events, then the aggregated human click counts, visitor sketches and click webhooks of one batch
+func (r *clickRecorder) flush(ctx context.Context, batch []*pendingClick) {
+
+	if len(batch) == 0 {
+		return
+	}
+
+	events := make([]*model.ClickEvent, 0, len(batch))
+	deltas := make(map[uint]int)
+	scans := make(map[uint]int)
+	sketches := make(map[visitorDay]*hll.Sketch)
+
+	for _, pending := range batch {
+		events = append(events, pending.event)
+		if pending.event.IsBot {
+			continue
+		}
+
+		deltas[pending.event.URLID]++
+		if pending.event.Source == model.ClickSourceQR {
+			scans[pending.event.URLID]++
+		}
+
+		if pending.hasVisitor {
+			key := visitorDay{urlID: pending.event.URLID, day: pending.event.ClickedAt.Truncate(time.Hour * 24)}
+			if sketches[key] == nil {
+				sketches[key] = hll.New()
+			}
+			sketches[key].AddHash(pending.visitor)
+		}
+	}
+
+	if err := r.repo.InsertClickEvents(ctx, events); err != nil {
+		r.failed.Add(uint64(len(events)))
+		log.Printf("Error: failed to write %d click events %s", len(events), err.Error())
+		return
+	}
+	r.written.Add(uint64(len(events)))
+
+	if len(deltas) > 0 {
+		urls, err := r.repo.AddClickCounts(ctx, deltas)
+		if err != nil {
+			log.Printf("Error: failed to add click counts for %d urls %s", len(deltas), err.Error())
+		}
+		r.emitThresholds(ctx, urls, deltas)
+	}
+
+	if len(scans) > 0 {
+		if err := r.repo.AddQrCodeScans(ctx, scans); err != nil {
+			log.Printf("Error: failed to add qr code scans for %d urls %s", len(scans), err.Error())
+		}
+	}
+
+	// Unique visitors are an estimate anyway, so a failed sketch merge is only logged
+	for key, sketch := range sketches {
+		if err := r.repo.MergeVisitorSketch(ctx, key.urlID, key.day, sketch); err != nil {
+			log.Printf("Error: failed to update visitor sketch for url %d %s", key.urlID, err.Error())
+		}
+	}
+
+	for _, pending := range batch {
+		r.webhooks.LinkClicked(ctx, pending.url, pending.event)
+	}
+}
+
+// emitThresholds fires once per threshold a link's new total crossed; the totals come from the update itself, so no crossing is seen twice
+func (r *clickRecorder) emitThresholds(ctx context.Context, urls []*model.URL, deltas map[uint]int) {
+
+	for _, url := range urls {
+		previous := url.ClickCount - deltas[url.ID]
+		for _, threshold := range r.cfg.Webhook.ClickThresholds {
+			if previous < threshold && url.ClickCount >= threshold {
+				r.webhooks.Emit(ctx, model.WebhookEventLinkThresholdReached, url, &entities.WebhookEventDataRes{Threshold: threshold})
+			}
+		}
+	}
+}
+
+type visitorDay struct {
+	urlID uint
+	day   time.Time
+}
+
+// newClickEvent turns request metadata into a storable event without any ip; a click that asked not to be tracked
+// keeps only when and through which channel it happened
+func newClickEvent(cfg *configs.Config, url *model.URL, click *entities.ClickInfo, clickedAt time.Time) *model.ClickEvent {
+
+	if click == nil {
+		click = &entities.ClickInfo{}
+	}
+
+	source := click.Source
+	if source == "" {
+		source = model.ClickSourceDirect
+	}
+
+	if doNotTrack(cfg, click) {
+		return &model.ClickEvent{URLID: url.ID, ClickedAt: clickedAt, Source: source}
+	}
+
+	userAgent := click.UserAgent
+	if len(userAgent) > maxStoredUserAgentLength {
+		userAgent = userAgent[:maxStoredUserAgentLength]
+	}
+
+	agent := useragent.Parse(click.UserAgent)
+
+	return &model.ClickEvent{
+		URLID:        url.ID,
+		ClickedAt:    clickedAt,
+		Referrer:     click.Referrer,
+		ReferrerHost: referrer.Host(click.Referrer),
+		UserAgent:    userAgent,
+		Browser:      agent.Browser,
+		OS:           agent.OS,
+		Country:      normalizeCountry(click.Country),
+		Device:       agent.Device,
+		Source:       source,
+	}
+}
+
+func hashIP(salt string, ip string) string {
+
+	if ip == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(salt + "|" + ip))
+	return hex.EncodeToString(sum[:])
+}
+
+// visitorHash identifies a visitor by salted, truncated ip and user agent; only its bits reach the sketch
+func visitorHash(salt string, ip string, userAgent string) uint64 {
+
+	sum := sha256.Sum256([]byte(salt + "|" + ip + "|" + userAgent))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func normalizeCountry(country string) string {
+
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if len(country) != 2 || country == "XX" {
+		return ""
+	}
+	return country
+}
+
+type ClickPartitioner interface {
+	Start(pctx context.Context)
+}
+
+type clickPartitioner struct {
+	repo repository.ClickRepository
+	cfg  *configs.Config
+}
+
+func NewClickPartitioner(repo repository.ClickRepository, cfg *configs.Config) ClickPartitioner {
+	return &clickPartitioner{
+		repo: repo,
+		cfg:  cfg,
+	}
+}
+
+// Start keeps monthly click partitions created ahead of time so the default partition stays empty
+func (p *clickPartitioner) Start(pctx context.Context) {
+
+	ticker := time.NewTicker(time.Hour * 24)
+	defer ticker.Stop()
+
+	for {
+		if err := p.repo.EnsureClickPartitions(pctx, time.Now().UTC(), p.cfg.Analytics.PartitionMonthsAhead+1); err != nil {
+			log.Printf("Error: failed to ensure click partitions %s", err.Error())
+		}
+
+		select {
+		case <-pctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"shorten-url/internal/entities"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+	"shorten-url/pkg/hll"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newTestClickRecorder buffers clicks until Close, since the flush interval never fires during a test
+func newTestClickRecorder(repo *repository.MockClickRepository) ClickRecorder {
+
+	cfg := testCfg()
+	cfg.Analytics.QueueSize = 10
+	cfg.Analytics.Workers = 1
+	cfg.Analytics.BatchSize = 10
+	cfg.Analytics.FlushInterval = time.Hour
+	return NewClickRecorder(repo, NewBotClassifier(cfg), NewClickHub(cfg), newTestWebhooks(cfg), newTestSalts(cfg), cfg)
+}
+
+func TestClickRecorder_FlushAggregatesCountsAndVisitors(t *testing.T) {
+
+	mockClickRepo := new(repository.MockClickRepository)
+	recorder := newTestClickRecorder(mockClickRepo)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go recorder.Start(ctx)
+
+	human := &entities.ClickInfo{UserAgent: testBrowserUserAgent, IP: "203.0.113.7", Method: "GET"}
+	bot := &entities.ClickInfo{UserAgent: "curl/8.0", IP: "203.0.113.8", Method: "GET"}
+
+	recorder.Record(ctx, &model.URL{ID: 1, ShortCode: "abc123"}, human)
+	recorder.Record(ctx, &model.URL{ID: 1, ShortCode: "abc123"}, human)
+	recorder.Record(ctx, &model.URL{ID: 2, ShortCode: "def456"}, bot)
+
+	mockClickRepo.On("InsertClickEvents", mock.Anything, mock.MatchedBy(func(events []*model.ClickEvent) bool {
+		return len(events) == 3
+	})).Return(nil)
+	mockClickRepo.On("AddClickCounts", mock.Anything, map[uint]int{1: 2}).
+		Return([]*model.URL{}, nil)
+	mockClickRepo.On("MergeVisitorSketch", mock.Anything, uint(1), mock.MatchedBy(func(day time.Time) bool {
+		return day.Equal(day.Truncate(time.Hour * 24))
+	}), mock.MatchedBy(func(sketch *hll.Sketch) bool {
+		return sketch.Count() == 1
+	})).Return(nil)
+
+	assert.NoError(t, recorder.Close(ctx))
+
+	stats := recorder.Stats()
+	assert.Equal(t, uint64(3), stats.Accepted)
+	assert.Equal(t, uint64(3), stats.Written)
+	assert.Equal(t, uint64(0), stats.Dropped)
+	assert.Equal(t, ClickQueuePolicyDrop, stats.Policy)
+
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestClickRecorder_FlushesFullBatchWhileRunning(t *testing.T) {
+
+	mockClickRepo := new(repository.MockClickRepository)
+	recorder := newTestClickRecorder(mockClickRepo)
+	recorder.(*clickRecorder).cfg.Analytics.BatchSize = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	flushed := make(chan struct{})
+	mockClickRepo.On("InsertClickEvents", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { close(flushed) }).
+		Return(nil).Once()
+	mockClickRepo.On("AddClickCounts", mock.Anything, map[uint]int{1: 2}).
+		Return([]*model.URL{}, nil)
+
+	go recorder.Start(ctx)
+
+	recorder.Record(ctx, &model.URL{ID: 1}, nil)
+	recorder.Record(ctx, &model.URL{ID: 1}, nil)
+
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("batch was not flushed")
+	}
+
+	assert.NoError(t, recorder.Close(ctx))
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestClickRecorder_CloseDrainsAfterServerContextIsCancelled(t *testing.T) {
+
+	mockClickRepo := new(repository.MockClickRepository)
+	recorder := newTestClickRecorder(mockClickRepo)
+	serverCtx, cancel := context.WithCancel(context.Background())
+
+	var writeErr error
+	mockClickRepo.On("InsertClickEvents", mock.Anything, mock.MatchedBy(func(events []*model.ClickEvent) bool {
+		return len(events) == 3
+	})).Run(func(args mock.Arguments) {
+		writeErr = args.Get(0).(context.Context).Err()
+	}).Return(nil)
+	mockClickRepo.On("AddClickCounts", mock.Anything, map[uint]int{1: 3}).
+		Return([]*model.URL{}, nil)
+
+	go recorder.Start(serverCtx)
+
+	for i := 0; i < 3; i++ {
+		recorder.Record(serverCtx, &model.URL{ID: 1}, nil)
+	}
+	assert.Equal(t, uint64(0), recorder.Stats().Written)
+
+	// Shutdown cancels the server context first; the queued clicks must still be written
+	cancel()
+
+	ctx, cancelClose := context.WithTimeout(context.Background(), time.Second)
+	defer cancelClose()
+
+	assert.NoError(t, recorder.Close(ctx))
+	assert.NoError(t, writeErr)
+	assert.Equal(t, uint64(3), recorder.Stats().Written)
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestClickRecorder_WriteFailureIsCounted(t *testing.T) {
+
+	mockClickRepo := new(repository.MockClickRepository)
+	recorder := newTestClickRecorder(mockClickRepo)
+	ctx := context.Background()
+
+	mockClickRepo.On("InsertClickEvents", mock.Anything, mock.Anything).
+		Return(errors.New("database error"))
+
+	recorder.Record(ctx, &model.URL{ID: 1}, nil)
+
+	assert.NoError(t, recorder.Close(ctx))
+	assert.Equal(t, uint64(1), recorder.Stats().Failed)
+	mockClickRepo.AssertNotCalled(t, "AddClickCounts", mock.Anything, mock.Anything)
+}
+
+func TestClickRecorder_BlockPolicyWaitsThenDrops(t *testing.T) {
+
+	cfg := testCfg()
+	cfg.Analytics.QueueSize = 1
+	cfg.Analytics.QueuePolicy = ClickQueuePolicyBlock
+	cfg.Analytics.EnqueueTimeout = time.Millisecond * 20
+	recorder := NewClickRecorder(new(repository.MockClickRepository), NewBotClassifier(cfg), NewClickHub(cfg), newTestWebhooks(cfg), newTestSalts(cfg), cfg)
+	ctx := context.Background()
+
+	recorder.Record(ctx, &model.URL{ID: 1}, nil)
+
+	start := time.Now()
+	recorder.Record(ctx, &model.URL{ID: 1}, nil)
+
+	assert.GreaterOrEqual(t, time.Since(start), cfg.Analytics.EnqueueTimeout)
+
+	stats := recorder.Stats()
+	assert.Equal(t, uint64(1), stats.Accepted)
+	assert.Equal(t, uint64(1), stats.Dropped)
+	assert.Equal(t, 1, stats.Queued)
+	assert.Equal(t, ClickQueuePolicyBlock, stats.Policy)
+}
+
+func TestClickRecorder_DropsAfterClose(t *testing.T) {
+
+	mockClickRepo := new(repository.MockClickRepository)
+	recorder := newTestClickRecorder(mockClickRepo)
+	ctx := context.Background()
+
+	assert.NoError(t, recorder.Close(ctx))
+
+	recorder.Record(ctx, &model.URL{ID: 1}, nil)
+
+	assert.Equal(t, uint64(1), recorder.Stats().Dropped)
+	mockClickRepo.AssertNotCalled(t, "InsertClickEvents", mock.Anything, mock.Anything)
+}
+
+func TestClickRecorder_CloseTimesOut(t *testing.T) {
+
+	mockClickRepo := new(repository.MockClickRepository)
+	recorder := newTestClickRecorder(mockClickRepo)
+
+	release := make(chan struct{})
+	defer close(release)
+	mockClickRepo.On("InsertClickEvents", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { <-release }).
+		Return(nil)
+	mockClickRepo.On("AddClickCounts", mock.Anything, mock.Anything).
+		Return([]*model.URL{}, nil)
+
+	recorder.Record(context.Background(), &model.URL{ID: 1}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	assert.ErrorIs(t, recorder.Close(ctx), context.DeadlineExceeded)
+}
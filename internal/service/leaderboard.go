@@ -0,0 +1,246 @@
+package service
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"shorten-url/configs"
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+)
+
+const (
+	defaultLeaderboardWindow = "24h"
+	defaultLeaderboardLimit  = 50
+	maxLeaderboardLimit      = 100
+)
+
+// Windows are whole hours because the leaderboard is built from the hourly rollups
+var leaderboardWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"6h":  time.Hour * 6,
+	"24h": time.Hour * 24,
+	"7d":  time.Hour * 24 * 7,
+	"30d": time.Hour * 24 * 30,
+}
+
+type Leaderboard interface {
+	Start(pctx context.Context)
+	Refresh(pctx context.Context, window string) error
+	GetTopLinks(pctx context.Context, req *entities.TopLinksReq) (*entities.TopLinksRes, error)
+}
+
+// leaderboard keeps the top and trending links of every window in memory, rebuilt on an interval
+type leaderboard struct {
+	repo repository.ClickRepository
+	cfg  *configs.Config
+	now  func() time.Time
+
+	mu     sync.RWMutex
+	boards map[string]*entities.TopLinksRes
+}
+
+func NewLeaderboard(repo repository.ClickRepository, cfg *configs.Config) Leaderboard {
+	return &leaderboard{
+		repo:   repo,
+		cfg:    cfg,
+		now:    time.Now,
+		boards: make(map[string]*entities.TopLinksRes),
+	}
+}
+
+// Start rebuilds every window on each refresh interval until the context is cancelled
+func (l *leaderboard) Start(pctx context.Context) {
+
+	ticker := time.NewTicker(l.cfg.Analytics.LeaderboardRefresh)
+	defer ticker.Stop()
+
+	for {
+		for window := range leaderboardWindows {
+			if err := l.Refresh(pctx, window); err != nil {
+				log.Printf("Error: failed to refresh %s leaderboard %s", window, err.Error())
+			}
+		}
+
+		select {
+		case <-pctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh ranks the links of one window; the current window includes the hour in progress
+func (l *leaderboard) Refresh(pctx context.Context, window string) error {
+
+	length, ok := leaderboardWindows[window]
+	if !ok {
+		return fmt.Errorf("unknown leaderboard window %q", window)
+	}
+
+	now := l.now().UTC()
+	to := now.Truncate(time.Hour).Add(time.Hour)
+	from := to.Add(-length)
+
+	windows, err := l.repo.SumClicksByWindow(pctx, from.Add(-length), from, to)
+	if err != nil {
+		return err
+	}
+
+	top := newLinkHeap(func(a, b *entities.TopLinkRes) bool {
+		if a.Clicks != b.Clicks {
+			return a.Clicks < b.Clicks
+		}
+		return a.ShortCode > b.ShortCode
+	})
+	trending := newLinkHeap(func(a, b *entities.TopLinkRes) bool {
+		if a.Growth != b.Growth {
+			return a.Growth < b.Growth
+		}
+		if a.Clicks != b.Clicks {
+			return a.Clicks < b.Clicks
+		}
+		return a.ShortCode > b.ShortCode
+	})
+
+	for _, w := range windows {
+		if w.Clicks == 0 {
+			continue
+		}
+
+		link := toTopLinkRes(w)
+		top.pushBounded(link, maxLeaderboardLimit)
+
+		// A handful of clicks on a dormant link would otherwise outrank steady traffic
+		if w.Clicks >= l.cfg.Analytics.TrendingMinClicks && w.Clicks > w.PreviousClicks {
+			trending.pushBounded(link, maxLeaderboardLimit)
+		}
+	}
+
+	board := &entities.TopLinksRes{
+		Window:      window,
+		From:        from,
+		To:          to,
+		GeneratedAt: now,
+		Top:         top.sorted(),
+		Trending:    trending.sorted(),
+	}
+
+	l.mu.Lock()
+	l.boards[window] = board
+	l.mu.Unlock()
+
+	return nil
+}
+
+func (l *leaderboard) GetTopLinks(pctx context.Context, req *entities.TopLinksReq) (*entities.TopLinksRes, error) {
+
+	if req == nil {
+		req = new(entities.TopLinksReq)
+	}
+
+	window := req.Window
+	if window == "" {
+		window = defaultLeaderboardWindow
+	}
+	if _, ok := leaderboardWindows[window]; !ok {
+		return nil, appErrors.NewInvalidInputError("window must be one of 1h, 6h, 24h, 7d or 30d")
+	}
+
+	limit := req.Limit
+	switch {
+	case limit == 0:
+		limit = defaultLeaderboardLimit
+	case limit < 0 || limit > maxLeaderboardLimit:
+		return nil, appErrors.NewInvalidInputError(fmt.Sprintf("limit must be between 1 and %d", maxLeaderboardLimit))
+	}
+
+	board := l.board(window)
+	if board == nil {
+		// Only until the first background refresh has run
+		if err := l.Refresh(pctx, window); err != nil {
+			return nil, appErrors.NewInternalError("failed to build leaderboard", err)
+		}
+		board = l.board(window)
+	}
+
+	return &entities.TopLinksRes{
+		Window:      board.Window,
+		From:        board.From,
+		To:          board.To,
+		GeneratedAt: board.GeneratedAt,
+		Top:         board.Top[:min(limit, len(board.Top))],
+		Trending:    board.Trending[:min(limit, len(board.Trending))],
+	}, nil
+}
+
+func (l *leaderboard) board(window string) *entities.TopLinksRes {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.boards[window]
+}
+
+// toTopLinkRes computes growth against the previous window, treating an empty one as a single click
+func toTopLinkRes(w *model.URLClickWindow) *entities.TopLinkRes {
+	return &entities.TopLinkRes{
+		Id:             strconv.Itoa(int(w.URLID)),
+		ShortCode:      w.ShortCode,
+		OriginalURL:    w.OriginalURL,
+		Clicks:         w.Clicks,
+		PreviousClicks: w.PreviousClicks,
+		Growth:         float64(w.Clicks-w.PreviousClicks) / float64(max(w.PreviousClicks, 1)),
+	}
+}
+
+// linkHeap is a min-heap under less, used to keep the k largest links without sorting them all
+type linkHeap struct {
+	items []*entities.TopLinkRes
+	less  func(a, b *entities.TopLinkRes) bool
+}
+
+func newLinkHeap(less func(a, b *entities.TopLinkRes) bool) *linkHeap {
+	return &linkHeap{less: less}
+}
+
+func (h *linkHeap) Len() int           { return len(h.items) }
+func (h *linkHeap) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+func (h *linkHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *linkHeap) Push(x any)         { h.items = append(h.items, x.(*entities.TopLinkRes)) }
+
+func (h *linkHeap) Pop() any {
+
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+func (h *linkHeap) pushBounded(link *entities.TopLinkRes, k int) {
+
+	if h.Len() < k {
+		heap.Push(h, link)
+		return
+	}
+	if h.less(h.items[0], link) {
+		h.items[0] = link
+		heap.Fix(h, 0)
+	}
+}
+
+// sorted drains the heap, largest first
+func (h *linkHeap) sorted() []*entities.TopLinkRes {
+
+	links := make([]*entities.TopLinkRes, h.Len())
+	for i := len(links) - 1; i >= 0; i-- {
+		links[i] = heap.Pop(h).(*entities.TopLinkRes)
+	}
+	return links
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestLeaderboard(now time.Time) (*leaderboard, *repository.MockClickRepository) {
+
+	cfg := testCfg()
+	cfg.Analytics.TrendingMinClicks = 10
+
+	mockClickRepo := new(repository.MockClickRepository)
+	board := NewLeaderboard(mockClickRepo, cfg).(*leaderboard)
+	board.now = func() time.Time { return now }
+
+	return board, mockClickRepo
+}
+
+func TestLeaderboard_RanksTopAndTrending(t *testing.T) {
+
+	board, mockClickRepo := newTestLeaderboard(utcTime("2026-10-18T10:20:00Z"))
+	ctx := context.Background()
+
+	mockClickRepo.On("SumClicksByWindow", ctx, utcTime("2026-10-16T11:00:00Z"), utcTime("2026-10-17T11:00:00Z"), utcTime("2026-10-18T11:00:00Z")).
+		Return([]*model.URLClickWindow{
+			{URLID: 1, ShortCode: "steady", Clicks: 500, PreviousClicks: 480},
+			{URLID: 2, ShortCode: "rising", Clicks: 120, PreviousClicks: 20},
+			{URLID: 3, ShortCode: "newbie", Clicks: 40, PreviousClicks: 0},
+			{URLID: 4, ShortCode: "blip", Clicks: 5, PreviousClicks: 0},
+			{URLID: 5, ShortCode: "fading", Clicks: 60, PreviousClicks: 300},
+			{URLID: 6, ShortCode: "gone", Clicks: 0, PreviousClicks: 90},
+		}, nil).Once()
+
+	result, err := board.GetTopLinks(ctx, &entities.TopLinksReq{Window: "24h", Limit: 3})
+
+	assert.NoError(t, err)
+	assert.Equal(t, utcTime("2026-10-17T11:00:00Z"), result.From)
+	assert.Equal(t, utcTime("2026-10-18T11:00:00Z"), result.To)
+
+	assert.Len(t, result.Top, 3)
+	assert.Equal(t, "steady", result.Top[0].ShortCode)
+	assert.Equal(t, "rising", result.Top[1].ShortCode)
+	assert.Equal(t, "fading", result.Top[2].ShortCode)
+
+	// growth: newbie 39x, rising 5x, steady ~0.04x; blip has too few clicks and fading is shrinking
+	assert.Len(t, result.Trending, 3)
+	assert.Equal(t, "newbie", result.Trending[0].ShortCode)
+	assert.Equal(t, "rising", result.Trending[1].ShortCode)
+	assert.InDelta(t, 5.0, result.Trending[1].Growth, 0.0001)
+	assert.Equal(t, "steady", result.Trending[2].ShortCode)
+
+	// Served from memory until the next refresh
+	_, err = board.GetTopLinks(ctx, nil)
+	assert.NoError(t, err)
+
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestLeaderboard_KeepsOnlyTheLargest(t *testing.T) {
+
+	board, mockClickRepo := newTestLeaderboard(utcTime("2026-10-18T10:20:00Z"))
+	ctx := context.Background()
+
+	windows := make([]*model.URLClickWindow, 0)
+	for i := 1; i <= maxLeaderboardLimit+50; i++ {
+		windows = append(windows, &model.URLClickWindow{URLID: uint(i), ShortCode: fmt.Sprintf("link%03d", i), Clicks: i})
+	}
+	mockClickRepo.On("SumClicksByWindow", ctx, mock.Anything, mock.Anything, mock.Anything).
+		Return(windows, nil)
+
+	assert.NoError(t, board.Refresh(ctx, "1h"))
+
+	result, err := board.GetTopLinks(ctx, &entities.TopLinksReq{Window: "1h", Limit: maxLeaderboardLimit})
+
+	assert.NoError(t, err)
+	assert.Len(t, result.Top, maxLeaderboardLimit)
+	assert.Equal(t, maxLeaderboardLimit+50, result.Top[0].Clicks)
+	assert.Equal(t, 51, result.Top[maxLeaderboardLimit-1].Clicks)
+}
+
+func TestLeaderboard_InvalidRequest(t *testing.T) {
+
+	board, _ := newTestLeaderboard(time.Now())
+	ctx := context.Background()
+
+	for _, req := range []*entities.TopLinksReq{{Window: "2h"}, {Limit: -1}, {Limit: maxLeaderboardLimit + 1}} {
+		result, err := board.GetTopLinks(ctx, req)
+
+		assert.Nil(t, result)
+		assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+	}
+
+	assert.Error(t, board.Refresh(ctx, "2h"))
+}
+
+func TestLeaderboard_RefreshError(t *testing.T) {
+
+	board, mockClickRepo := newTestLeaderboard(time.Now())
+	ctx := context.Background()
+
+	mockClickRepo.On("SumClicksByWindow", ctx, mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, errors.New("database error"))
+
+	result, err := board.GetTopLinks(ctx, nil)
+
+	assert.Nil(t, result)
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"shorten-url/configs"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+	"shorten-url/pkg/safehttp"
+)
+
+const linkCheckerUserAgent = "shorten-url-link-checker/1.0"
+
+type LinkChecker interface {
+	Start(pctx context.Context)
+	RunOnce(pctx context.Context) error
+}
+
+type linkChecker struct {
+	repo   repository.URLRepository
+	cfg    *configs.Config
+	client *http.Client
+
+	mu       sync.Mutex
+	hostNext map[string]time.Time
+}
+
+// NewLinkChecker probes destinations through a client that only dials public addresses. Destinations are
+// user supplied and their health is shown back, so internal hosts must stay out of reach, on every redirect too.
+func NewLinkChecker(repo repository.URLRepository, cfg *configs.Config) LinkChecker {
+	return newLinkChecker(repo, cfg, safehttp.NewClient(cfg.Checker.Timeout))
+}
+
+func newLinkChecker(repo repository.URLRepository, cfg *configs.Config, client *http.Client) *linkChecker {
+
+	maxRedirects := cfg.Checker.MaxRedirects
+
+	// Each hop is a new request through the same dialer, so a redirect is held to the same address check
+	checked := *client
+	checked.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+
+	return &linkChecker{
+		repo:     repo,
+		cfg:      cfg,
+		client:   &checked,
+		hostNext: make(map[string]time.Time),
+	}
+}
+
+// Start runs the checker on every interval until the context is cancelled
+func (c *linkChecker) Start(pctx context.Context) {
+
+	if !c.cfg.Checker.Enabled {
+		log.Println("Link checker is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(c.cfg.Checker.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.RunOnce(pctx); err != nil {
+			log.Printf("Error: link checker run failed %s", err.Error())
+		}
+
+		select {
+		case <-pctx.Done():
+			log.Println("Link checker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce checks one batch of links that are due and stores their health
+func (c *linkChecker) RunOnce(pctx context.Context) error {
+
+	checkedBefore := time.Now().Add(-c.cfg.Checker.RecheckAfter)
+
+	urls, err := c.repo.ListURLsDueForCheck(pctx, checkedBefore, c.cfg.Checker.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	c.pruneHosts()
+
+	concurrency := c.cfg.Checker.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		wg.Add(1)
+		go func(u *model.URL) {
+			defer wg.Done()
+
+			health := c.check(pctx, u, slots)
+			if health == nil {
+				return
+			}
+
+			if _, err := c.repo.SaveURLHealth(pctx, health, c.cfg.Checker.BrokenThreshold); err != nil {
+				log.Printf("Error: failed to save health for %s %s", u.ShortCode, err.Error())
+			}
+		}(u)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// check probes a single destination, returning nil when the context was cancelled
+func (c *linkChecker) check(pctx context.Context, u *model.URL, slots chan struct{}) *model.URLHealth {
+
+	health := &model.URLHealth{
+		URLID:         u.ID,
+		LastCheckedAt: time.Now(),
+	}
+
+	target, err := url.Parse(u.OriginalURL)
+	if err != nil || target.Host == "" {
+		health.LastError = "invalid destination url"
+		return c.finish(health)
+	}
+
+	if err := c.waitForHost(pctx, target.Hostname()); err != nil {
+		return nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-pctx.Done():
+		return nil
+	}
+
+	start := time.Now()
+
+	resp, err := c.do(pctx, http.MethodHead, u.OriginalURL)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp, err = c.do(pctx, http.MethodGet, u.OriginalURL)
+	}
+
+	health.LatencyMs = time.Since(start).Milliseconds()
+	health.LastCheckedAt = time.Now()
+
+	if err != nil {
+		if pctx.Err() != nil {
+			return nil
+		}
+		health.LastError = err.Error()
+		if errors.Is(err, safehttp.ErrDisallowedAddress) {
+			// The error would name the internal address the destination resolved to
+			health.LastError = safehttp.ErrDisallowedAddress.Error()
+		}
+		return c.finish(health)
+	}
+
+	health.StatusCode = resp.StatusCode
+	health.FinalURL = resp.Request.URL.String()
+	if resp.StatusCode >= http.StatusBadRequest {
+		health.LastError = resp.Status
+	}
+
+	return c.finish(health)
+}
+
+func (c *linkChecker) do(pctx context.Context, method string, target string) (*http.Response, error) {
+
+	req, err := http.NewRequestWithContext(pctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", linkCheckerUserAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	return resp, nil
+}
+
+// finish seeds the failure counters the repository accumulates on upsert
+func (c *linkChecker) finish(health *model.URLHealth) *model.URLHealth {
+
+	if health.LastError == "" {
+		health.ConsecutiveFailures = 0
+		health.IsBroken = false
+		return health
+	}
+
+	health.ConsecutiveFailures = 1
+	health.IsBroken = c.cfg.Checker.BrokenThreshold <= 1
+
+	return health
+}
+
+// waitForHost reserves the next polite slot for a host and sleeps until it arrives
+func (c *linkChecker) waitForHost(pctx context.Context, host string) error {
+
+	c.mu.Lock()
+	now := time.Now()
+	next := c.hostNext[host]
+	if next.Before(now) {
+		next = now
+	}
+	c.hostNext[host] = next.Add(c.cfg.Checker.PerHostDelay)
+	c.mu.Unlock()
+
+	wait := time.Until(next)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-pctx.Done():
+		return pctx.Err()
+	}
+}
+
+func (c *linkChecker) pruneHosts() {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for host, next := range c.hostNext {
+		if next.Before(now) {
+			delete(c.hostNext, host)
+		}
+	}
+}
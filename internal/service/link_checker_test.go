@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"shorten-url/configs"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+	"shorten-url/pkg/safehttp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func checkerCfg() *configs.Config {
+	cfg := testCfg()
+	cfg.Checker = configs.CheckerConfig{
+		Enabled:         true,
+		Interval:        time.Hour,
+		RecheckAfter:    time.Hour,
+		Timeout:         time.Second * 2,
+		Concurrency:     2,
+		BatchSize:       10,
+		BrokenThreshold: 2,
+		MaxRedirects:    3,
+	}
+	return cfg
+}
+
+func newDestinationServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	})
+	mux.HandleFunc("/nohead", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestLinkChecker_RunOnce(t *testing.T) {
+
+	destination := newDestinationServer()
+	defer destination.Close()
+
+	mockRepo := new(repository.MockURLRepository)
+	cfg := checkerCfg()
+	checker := newLinkChecker(mockRepo, cfg, &http.Client{Timeout: cfg.Checker.Timeout})
+	ctx := context.Background()
+
+	mockRepo.On("ListURLsDueForCheck", ctx, mock.AnythingOfType("time.Time"), 10).
+		Return([]*model.URL{
+			{ID: 1, ShortCode: "ok0001", OriginalURL: destination.URL + "/ok"},
+			{ID: 2, ShortCode: "mov001", OriginalURL: destination.URL + "/moved"},
+			{ID: 3, ShortCode: "gone01", OriginalURL: destination.URL + "/gone"},
+			{ID: 4, ShortCode: "nohead", OriginalURL: destination.URL + "/nohead"},
+			{ID: 5, ShortCode: "bad001", OriginalURL: "not a url"},
+		}, nil)
+
+	var mu sync.Mutex
+	saved := make(map[uint]*model.URLHealth)
+	mockRepo.On("SaveURLHealth", ctx, mock.AnythingOfType("*model.URLHealth"), 2).
+		Run(func(args mock.Arguments) {
+			health := args.Get(1).(*model.URLHealth)
+			mu.Lock()
+			saved[health.URLID] = health
+			mu.Unlock()
+		}).
+		Return(&model.URLHealth{}, nil)
+
+	err := checker.RunOnce(ctx)
+
+	assert.NoError(t, err)
+	assert.Len(t, saved, 5)
+
+	assert.Equal(t, http.StatusOK, saved[1].StatusCode)
+	assert.Empty(t, saved[1].LastError)
+	assert.Equal(t, 0, saved[1].ConsecutiveFailures)
+
+	assert.Equal(t, http.StatusOK, saved[2].StatusCode)
+	assert.Equal(t, destination.URL+"/ok", saved[2].FinalURL)
+
+	assert.Equal(t, http.StatusGone, saved[3].StatusCode)
+	assert.NotEmpty(t, saved[3].LastError)
+	assert.Equal(t, 1, saved[3].ConsecutiveFailures)
+	assert.False(t, saved[3].IsBroken)
+
+	assert.Equal(t, http.StatusOK, saved[4].StatusCode)
+
+	assert.Equal(t, "invalid destination url", saved[5].LastError)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLinkChecker_RefusesInternalDestinations(t *testing.T) {
+
+	var probed atomic.Bool
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probed.Store(true)
+	}))
+	defer destination.Close()
+
+	mockRepo := new(repository.MockURLRepository)
+	checker := NewLinkChecker(mockRepo, checkerCfg())
+	ctx := context.Background()
+
+	mockRepo.On("ListURLsDueForCheck", ctx, mock.AnythingOfType("time.Time"), 10).
+		Return([]*model.URL{
+			{ID: 1, ShortCode: "local1", OriginalURL: destination.URL + "/admin"},
+			{ID: 2, ShortCode: "meta01", OriginalURL: "http://169.254.169.254/latest/meta-data/"},
+		}, nil)
+
+	var mu sync.Mutex
+	saved := make(map[uint]*model.URLHealth)
+	mockRepo.On("SaveURLHealth", ctx, mock.AnythingOfType("*model.URLHealth"), 2).
+		Run(func(args mock.Arguments) {
+			health := args.Get(1).(*model.URLHealth)
+			mu.Lock()
+			saved[health.URLID] = health
+			mu.Unlock()
+		}).
+		Return(&model.URLHealth{}, nil)
+
+	assert.NoError(t, checker.RunOnce(ctx))
+
+	assert.False(t, probed.Load())
+	for _, id := range []uint{1, 2} {
+		if assert.Contains(t, saved, id) {
+			assert.Equal(t, 0, saved[id].StatusCode)
+			assert.Empty(t, saved[id].FinalURL)
+			assert.Equal(t, safehttp.ErrDisallowedAddress.Error(), saved[id].LastError)
+		}
+	}
+}
+
+func TestLinkChecker_PerHostDelay(t *testing.T) {
+
+	cfg := checkerCfg()
+	cfg.Checker.PerHostDelay = time.Millisecond * 50
+
+	checker := NewLinkChecker(new(repository.MockURLRepository), cfg).(*linkChecker)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, checker.waitForHost(ctx, "example.com"))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*100)
+
+	start = time.Now()
+	assert.NoError(t, checker.waitForHost(ctx, "other.example.com"))
+	assert.Less(t, time.Since(start), time.Millisecond*50)
+}
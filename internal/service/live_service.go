@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/repository"
+)
+
+type LiveService interface {
+	Subscribe(pctx context.Context, shortCode string) (*ClickSubscription, error)
+	SubscribeAll() *ClickSubscription
+	Unsubscribe(sub *ClickSubscription)
+	Counters(sub *ClickSubscription) *entities.LiveCountersRes
+}
+
+type liveService struct {
+	repo repository.URLRepository
+	hub  ClickHub
+}
+
+func NewLiveService(repo repository.URLRepository, hub ClickHub) LiveService {
+	return &liveService{
+		repo: repo,
+		hub:  hub,
+	}
+}
+
+// Subscribe follows the clicks of one link
+func (s *liveService) Subscribe(pctx context.Context, shortCode string) (*ClickSubscription, error) {
+
+	url, err := s.repo.GetByShortCode(pctx, shortCode)
+	if err != nil {
+		return nil, appErrors.NewNotFoundError("short url was not found")
+	}
+
+	return s.hub.Subscribe(url.ID), nil
+}
+
+// SubscribeAll follows the clicks of every link
+func (s *liveService) SubscribeAll() *ClickSubscription {
+	return s.hub.Subscribe(FirehoseID)
+}
+
+func (s *liveService) Unsubscribe(sub *ClickSubscription) {
+	s.hub.Unsubscribe(sub)
+}
+
+func (s *liveService) Counters(sub *ClickSubscription) *entities.LiveCountersRes {
+	return s.hub.Counters(sub.URLID)
+}
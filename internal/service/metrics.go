@@ -0,0 +1,62 @@
+package service
+
+import (
+	"time"
+
+	"shorten-url/pkg/metrics"
+)
+
+const (
+	RedirectHit     = "hit"
+	RedirectMiss    = "miss"
+	RedirectBlocked = "blocked"
+
+	collisionGenerated = "generated"
+	collisionAlias     = "alias"
+
+	qrCodeCacheHit  = "hit"
+	qrCodeCacheMiss = "miss"
+)
+
+var (
+	redirectsTotal = metrics.Default.NewCounterVec(
+		"shorten_redirects_total",
+		"Short link lookups on the redirect path, by outcome.",
+		"outcome",
+	)
+
+	shortCodeCollisions = metrics.Default.NewCounterVec(
+		"shorten_short_code_collisions_total",
+		"Short codes that were already taken, by whether they were generated or requested as an alias.",
+		"kind",
+	)
+
+	qrCodeDuration = metrics.Default.NewHistogramVec(
+		"shorten_qrcode_generation_duration_seconds",
+		"Time spent encoding QR code images.",
+		[]float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+	)
+
+	qrCodeCache = metrics.Default.NewCounterVec(
+		"shorten_qrcode_cache_total",
+		"QR code image lookups in the in-memory cache, by result.",
+		"result",
+	)
+)
+
+// Every outcome is exported from the first scrape, so rates do not start with a gap
+func init() {
+	for _, outcome := range []string{RedirectHit, RedirectMiss, RedirectBlocked} {
+		redirectsTotal.Init(outcome)
+	}
+	for _, kind := range []string{collisionGenerated, collisionAlias} {
+		shortCodeCollisions.Init(kind)
+	}
+	for _, result := range []string{qrCodeCacheHit, qrCodeCacheMiss} {
+		qrCodeCache.Init(result)
+	}
+}
+
+func observeQrCode(start time.Time) {
+	qrCodeDuration.Observe(time.Since(start).Seconds())
+}
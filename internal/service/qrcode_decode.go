@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"net/url"
+	"strings"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/pkg/qrimage"
+)
+
+const (
+	QrCodeStatusActive   = "active"
+	QrCodeStatusDisabled = "disabled"
+	QrCodeStatusBroken   = "broken"
+	QrCodeStatusNotFound = "not_found"
+)
+
+// DecodeQrCodes reads every QR code in an uploaded PNG or JPEG, such as a print proof, and says for each
+// whether it points at one of our links and where that link leads now
+func (s *urlService) DecodeQrCodes(pctx context.Context, upload []byte) (*entities.QrCodeDecodeRes, error) {
+
+	if len(upload) == 0 {
+		return nil, appErrors.NewInvalidInputError("image is empty")
+	}
+	if len(upload) > s.cfg.QrCode.DecodeMaxBytes {
+		return nil, appErrors.NewInvalidInputError(fmt.Sprintf("image must be at most %d bytes", s.cfg.QrCode.DecodeMaxBytes))
+	}
+
+	decoded, _, err := decodeUploadedImage(upload, "image must be a PNG or JPEG", func(config image.Config) error {
+		if config.Width*config.Height > s.cfg.QrCode.DecodeMaxPixels {
+			return appErrors.NewInvalidInputError(fmt.Sprintf("image must be at most %d pixels", s.cfg.QrCode.DecodeMaxPixels))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	texts, err := qrimage.DecodeAll(decoded)
+	if err != nil {
+		log.Printf("Error: failed to read qr codes %s", err.Error())
+		return nil, appErrors.NewInternalError("failed to read qr codes", err)
+	}
+
+	res := &entities.QrCodeDecodeRes{Codes: make([]entities.DecodedQrCodeRes, 0, len(texts))}
+	for _, text := range texts {
+		code, err := s.describeQrCode(pctx, text)
+		if err != nil {
+			return nil, err
+		}
+		res.Codes = append(res.Codes, *code)
+	}
+
+	return res, nil
+}
+
+// describeQrCode looks up the link behind a decoded text; text that is not one of our URLs is reported as is
+func (s *urlService) describeQrCode(pctx context.Context, text string) (*entities.DecodedQrCodeRes, error) {
+
+	code := &entities.DecodedQrCodeRes{Text: text}
+
+	shortCode, scanCode, ok := s.parseOurURL(text)
+	if !ok {
+		return code, nil
+	}
+	code.Ours = true
+	code.ShortCode = shortCode
+	code.ScanCode = scanCode
+
+	var link *model.URL
+	var err error
+	if scanCode != "" {
+		link, err = s.repo.GetURLByScanCode(pctx, scanCode)
+	} else {
+		link, err = s.repo.GetByShortCode(pctx, shortCode)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		code.Status = QrCodeStatusNotFound
+		return code, nil
+	}
+	if err != nil {
+		log.Printf("Error: failed to find link for qr code %s %s", text, err.Error())
+		return nil, appErrors.NewInternalError("failed to find short url", err)
+	}
+
+	shortURL, err := url.JoinPath(s.cfg.Server.BaseURL, link.ShortCode)
+	if err != nil {
+		log.Printf("Error: failed to build short url %s", err.Error())
+		return nil, appErrors.NewInternalError("failed to build short url", err)
+	}
+
+	code.ShortCode = link.ShortCode
+	code.ShortUrl = shortURL
+	code.OriginalURL = link.OriginalURL
+	code.Status = QrCodeStatusActive
+
+	// Same checks a visitor would run into: the blocklist refuses the redirect, a broken destination fails after it
+	if s.blocklist.Blocked(link.OriginalURL) != nil {
+		code.Status = QrCodeStatusDisabled
+	} else if health, err := s.repo.GetURLHealth(pctx, link.ID); err == nil && health.IsBroken {
+		code.Status = QrCodeStatusBroken
+	}
+
+	return code, nil
+}
+
+// parseOurURL tells whether text is a short URL (BaseURL/<short_code>) or a scan URL (BaseURL/q/<scan_code>)
+// of this service. Only the host and path identify a link, so http and https forms of it both count.
+func (s *urlService) parseOurURL(text string) (shortCode string, scanCode string, ok bool) {
+
+	base, err := url.Parse(s.cfg.Server.BaseURL)
+	if err != nil {
+		return "", "", false
+	}
+
+	link, err := url.Parse(strings.TrimSpace(text))
+	if err != nil || (link.Scheme != "http" && link.Scheme != "https") || !strings.EqualFold(link.Host, base.Host) {
+		return "", "", false
+	}
+
+	path, found := strings.CutPrefix(link.Path, strings.TrimSuffix(base.Path, "/")+"/")
+	if !found {
+		return "", "", false
+	}
+
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	switch {
+	case len(segments) == 1 && segments[0] != "" && segments[0] != "q":
+		return segments[0], "", true
+	case len(segments) == 2 && segments[0] == "q" && segments[1] != "":
+		return "", segments[1], true
+	default:
+		return "", "", false
+	}
+}
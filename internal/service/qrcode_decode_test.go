@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+
+	qrcode "github.com/skip2/go-qrcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// testProof lays the codes of texts out side by side on a white canvas, like a vendor's proof
+func testProof(t *testing.T, texts ...string) image.Image {
+
+	const size = 256
+	proof := image.NewRGBA(image.Rect(0, 0, size*len(texts), size))
+	draw.Draw(proof, proof.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	for i, text := range texts {
+		code, err := qrcode.New(text, qrcode.Medium)
+		assert.NoError(t, err)
+		draw.Draw(proof, image.Rect(i*size, 0, (i+1)*size, size), code.Image(size), image.Point{}, draw.Src)
+	}
+	return proof
+}
+
+func encodeTestProof(t *testing.T, img image.Image) []byte {
+
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestDecodeQrCodes_ReportsEachCode(t *testing.T) {
+
+	blocklist, _ := newLoadedBlocklist(t, []*model.BlocklistRule{
+		{ID: 1, Kind: BlocklistKindDomain, Pattern: "phish.example"},
+	}, "")
+	mockRepo := new(repository.MockURLRepository)
+	cfg := testCfg()
+	service := newTestServiceWith(cfg, mockRepo, blocklist, NewShortenerResolver(cfg), NewReservedWords(cfg))
+	ctx := context.Background()
+
+	mockRepo.On("GetByShortCode", ctx, "abc123").Return(&model.URL{ID: 1, ShortCode: "abc123", OriginalURL: "https://example.com/menu"}, nil)
+	mockRepo.On("GetURLHealth", ctx, uint(1)).Return(nil, sql.ErrNoRows)
+	mockRepo.On("GetURLByScanCode", ctx, "Sc4nC0de01").Return(&model.URL{ID: 2, ShortCode: "def456", OriginalURL: "http://phish.example/login"}, nil)
+	mockRepo.On("GetByShortCode", ctx, "gone01").Return(nil, sql.ErrNoRows)
+
+	upload := encodeTestProof(t, testProof(t,
+		"http://localhost:8080/abc123",
+		"http://localhost:8080/q/Sc4nC0de01",
+		"https://example.org/menu",
+		"https://LOCALHOST:8080/gone01/",
+	))
+
+	res, err := service.DecodeQrCodes(ctx, upload)
+
+	assert.NoError(t, err)
+	if !assert.Len(t, res.Codes, 4) {
+		return
+	}
+
+	byText := make(map[string]entities.DecodedQrCodeRes, len(res.Codes))
+	for _, code := range res.Codes {
+		byText[code.Text] = code
+	}
+
+	assert.Equal(t, entities.DecodedQrCodeRes{
+		Text:        "http://localhost:8080/abc123",
+		Ours:        true,
+		ShortCode:   "abc123",
+		ShortUrl:    "http://localhost:8080/abc123",
+		OriginalURL: "https://example.com/menu",
+		Status:      QrCodeStatusActive,
+	}, byText["http://localhost:8080/abc123"])
+
+	assert.Equal(t, entities.DecodedQrCodeRes{
+		Text:        "http://localhost:8080/q/Sc4nC0de01",
+		Ours:        true,
+		ShortCode:   "def456",
+		ScanCode:    "Sc4nC0de01",
+		ShortUrl:    "http://localhost:8080/def456",
+		OriginalURL: "http://phish.example/login",
+		Status:      QrCodeStatusDisabled,
+	}, byText["http://localhost:8080/q/Sc4nC0de01"])
+
+	assert.Equal(t, entities.DecodedQrCodeRes{Text: "https://example.org/menu"}, byText["https://example.org/menu"])
+
+	assert.Equal(t, entities.DecodedQrCodeRes{
+		Text:      "https://LOCALHOST:8080/gone01/",
+		Ours:      true,
+		ShortCode: "gone01",
+		Status:    QrCodeStatusNotFound,
+	}, byText["https://LOCALHOST:8080/gone01/"])
+}
+
+func TestDecodeQrCodes_BrokenDestinationInJPEG(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	mockRepo.On("GetByShortCode", ctx, "abc123").Return(&model.URL{ID: 1, ShortCode: "abc123", OriginalURL: "https://example.com/gone"}, nil)
+	mockRepo.On("GetURLHealth", ctx, uint(1)).Return(&model.URLHealth{URLID: 1, StatusCode: 404, IsBroken: true}, nil)
+
+	var upload bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&upload, testProof(t, "http://localhost:8080/abc123"), &jpeg.Options{Quality: 80}))
+
+	res, err := service.DecodeQrCodes(ctx, upload.Bytes())
+
+	assert.NoError(t, err)
+	if assert.Len(t, res.Codes, 1) {
+		assert.Equal(t, QrCodeStatusBroken, res.Codes[0].Status)
+		assert.Equal(t, "https://example.com/gone", res.Codes[0].OriginalURL)
+	}
+}
+
+func TestDecodeQrCodes_NotOurLinks(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	texts := []string{
+		"http://localhost:8080/",
+		"http://localhost:8080/shorten/abc123/stats",
+		"http://localhost:8080/q/",
+		"http://localhost:9090/abc123",
+		"ftp://localhost:8080/abc123",
+		"WIFI:S:guest;T:WPA;P:secret;;",
+	}
+	for _, text := range texts {
+		res, err := service.DecodeQrCodes(ctx, encodeTestProof(t, testProof(t, text)))
+
+		assert.NoError(t, err, text)
+		if assert.Len(t, res.Codes, 1, text) {
+			assert.Equal(t, entities.DecodedQrCodeRes{Text: text}, res.Codes[0])
+		}
+	}
+
+	// An image without a code is not an error, it just has nothing to report
+	res, err := service.DecodeQrCodes(ctx, encodeTestPNG(t, 64, 64))
+	assert.NoError(t, err)
+	assert.Empty(t, res.Codes)
+
+	mockRepo.AssertNotCalled(t, "GetByShortCode", mock.Anything, mock.Anything)
+}
+
+func TestDecodeQrCodes_InvalidUploads(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	var animated bytes.Buffer
+	assert.NoError(t, gif.Encode(&animated, image.NewPaletted(image.Rect(0, 0, 10, 10), color.Palette{color.White}), nil))
+
+	tests := []struct {
+		name   string
+		upload []byte
+	}{
+		{"empty", nil},
+		{"too many bytes", make([]byte, 1<<20+1)},
+		{"not an image", []byte("%PDF-1.4")},
+		{"gif", animated.Bytes()},
+		{"too many pixels", encodeTestPNG(t, 1001, 1000)},
+		{"truncated", encodeTestPNG(t, 64, 64)[:60]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.DecodeQrCodes(ctx, tt.upload)
+			if assert.Error(t, err) {
+				assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+			}
+		})
+	}
+}
+
+func TestDecodeQrCodes_LookupFails(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	mockRepo.On("GetURLByScanCode", ctx, "Sc4nC0de01").Return(nil, errors.New("database error"))
+
+	_, err := service.DecodeQrCodes(ctx, encodeTestProof(t, testProof(t, "http://localhost:8080/q/Sc4nC0de01")))
+
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+}
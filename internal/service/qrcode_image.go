@@ -0,0 +1,270 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/pkg/blobstore"
+	pkgUtils "shorten-url/pkg/utils"
+)
+
+// qrCodeScanCodeLength keeps scan codes, and so the encoded URL and its modules, short while far too many
+// to guess
+const qrCodeScanCodeLength = 10
+
+var qrCodeContentTypes = map[string]string{
+	QrCodeFormatPNG: "image/png",
+	QrCodeFormatSVG: "image/svg+xml",
+	QrCodeFormatPDF: "application/pdf",
+}
+
+// qrCodeRequest is everything needed to draw one image of a link's code
+type qrCodeRequest struct {
+	link    *model.URL
+	stored  *model.Qrcode
+	scanURL string
+	opts    qrCodeOptions
+	logo    image.Image
+
+	// etag changes with anything that changes the image: the encoded URL, the options and the logo
+	etag string
+}
+
+// GetQrCodeImage draws a link's code, or reports that the client's copy named by ifNoneMatch is still current
+func (s *urlService) GetQrCodeImage(pctx context.Context, shortCode string, req *entities.QrCodeReq, ifNoneMatch string) (*entities.QrCodeImageRes, error) {
+
+	qr, err := s.prepareQrCode(pctx, shortCode, req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &entities.QrCodeImageRes{
+		ContentType: qrCodeContentTypes[qr.opts.format],
+		FileName:    fmt.Sprintf("qrcode_%s.%s", qr.link.ShortCode, qr.opts.format),
+		ETag:        qr.etag,
+	}
+
+	if etagMatches(ifNoneMatch, qr.etag) {
+		res.NotModified = true
+		return res, nil
+	}
+
+	if res.Data, err = s.qrCodeImage(pctx, qr); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// prepareQrCode validates the options and loads the link, its stored code and the logo the image is drawn from
+func (s *urlService) prepareQrCode(pctx context.Context, shortCode string, req *entities.QrCodeReq) (*qrCodeRequest, error) {
+
+	opts, err := newQrCodeOptions(req, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := s.repo.GetByShortCode(pctx, shortCode)
+	if err != nil {
+		return nil, appErrors.NewNotFoundError("short url was not found")
+	}
+
+	qr := &qrCodeRequest{link: link, opts: opts}
+
+	if opts.workspace != "" {
+		if qr.logo, qr.opts.logoDigest, err = s.workspaceLogo(pctx, opts.workspace); err != nil {
+			return nil, err
+		}
+	}
+
+	if qr.stored, err = s.storedQrCode(pctx, link); err != nil {
+		return nil, err
+	}
+
+	if qr.scanURL, err = s.qrCodeScanURL(qr.stored.ScanCode); err != nil {
+		return nil, err
+	}
+	qr.etag = qrCodeETag(qr.scanURL, qr.opts)
+
+	return qr, nil
+}
+
+// storedQrCode returns the row of a link's canonical code, saving it the first time and again whenever
+// the scan or image URL it recorded is no longer the one served
+func (s *urlService) storedQrCode(pctx context.Context, link *model.URL) (*model.Qrcode, error) {
+
+	imageURL := s.qrCodeImageURL(link.ShortCode, defaultQrCodeOptions)
+	scanCode := pkgUtils.RandString(qrCodeScanCodeLength)
+
+	existing, err := s.repo.GetQrCode(pctx, link.ID)
+	switch {
+	case err == nil:
+		scanCode = existing.ScanCode
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Printf("Error: failed to find qr code for %s %s", link.ShortCode, err.Error())
+		return nil, appErrors.NewInternalError("failed to find qrcode", err)
+	}
+
+	scanURL, err := s.qrCodeScanURL(scanCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil && existing.OriginalURL == scanURL && existing.QrCodeUrl == imageURL {
+		return existing, nil
+	}
+
+	saved, err := s.repo.SaveQrCode(pctx, &model.Qrcode{
+		URLID:       link.ID,
+		ScanCode:    scanCode,
+		OriginalURL: scanURL,
+		QrCodeUrl:   imageURL,
+	})
+	if err != nil {
+		log.Printf("Error: failed to save qrcode url %s", err.Error())
+		return nil, appErrors.NewInternalError("failed to save qrcode url", err)
+	}
+
+	return saved, nil
+}
+
+// qrCodeScanURL is what a code encodes: a path of its own that resolves to whichever link owns the code
+func (s *urlService) qrCodeScanURL(scanCode string) (string, error) {
+
+	scanURL, err := url.JoinPath(s.cfg.Server.BaseURL, "q", scanCode)
+	if err != nil {
+		log.Printf("Error: failed to build qrcode scan url %s", err.Error())
+		return "", appErrors.NewInternalError("failed to build qrcode url", err)
+	}
+	return scanURL, nil
+}
+
+func qrCodeETag(scanURL string, opts qrCodeOptions) string {
+
+	sum := sha256.Sum256([]byte(scanURL + "|" + opts.key()))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// qrCodeBlobKey names a stored canonical image after its scan code and ETag, so an image drawn for an
+// older base URL is never served; the image stays with the code when the code is moved to another link
+func qrCodeBlobKey(scanCode string, etag string) string {
+	return "qrcodes/" + scanCode + "/" + strings.Trim(etag, `"`) + ".png"
+}
+
+// qrCodeImage returns the drawn image, from the cache when it is enabled and already holds it.
+// Drawing is deterministic, so equal ETags always mean equal bytes.
+func (s *urlService) qrCodeImage(pctx context.Context, qr *qrCodeRequest) ([]byte, error) {
+
+	if s.qrImages != nil {
+		if cached, ok := s.qrImages.Get(qr.etag); ok {
+			qrCodeCache.Inc(qrCodeCacheHit)
+			return cached, nil
+		}
+		qrCodeCache.Inc(qrCodeCacheMiss)
+	}
+
+	data, err := s.storedQrCodeImage(pctx, qr)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.qrImages != nil {
+		s.qrImages.Add(qr.etag, data)
+	}
+
+	return data, nil
+}
+
+// storedQrCodeImage keeps the canonical image of each link in the blob store, so other instances and
+// restarts reuse it. Variants are drawn every time, as nothing bounds how many of them there are.
+func (s *urlService) storedQrCodeImage(pctx context.Context, qr *qrCodeRequest) ([]byte, error) {
+
+	if qr.opts != defaultQrCodeOptions {
+		return renderQrCode(qr)
+	}
+
+	key := qrCodeBlobKey(qr.stored.ScanCode, qr.etag)
+	stored, err := s.readBlob(pctx, key)
+	if err == nil {
+		return stored, nil
+	}
+	if !errors.Is(err, blobstore.ErrNotFound) {
+		log.Printf("Error: failed to read stored qr code of %s %s", qr.link.ShortCode, err.Error())
+	}
+
+	rendered, err := renderQrCode(qr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The image is still served when it cannot be stored, it is only drawn again next time
+	if err := s.blobs.Put(pctx, key, bytes.NewReader(rendered), qrCodeContentTypes[QrCodeFormatPNG]); err != nil {
+		log.Printf("Error: failed to store qr code of %s %s", qr.link.ShortCode, err.Error())
+	}
+
+	return rendered, nil
+}
+
+// removeQrCodeImage deletes the stored canonical image of a code removed with its link
+func (s *urlService) removeQrCodeImage(pctx context.Context, qr *model.Qrcode) {
+
+	scanURL, err := s.qrCodeScanURL(qr.ScanCode)
+	if err != nil {
+		return
+	}
+
+	if err := s.blobs.Delete(pctx, qrCodeBlobKey(qr.ScanCode, qrCodeETag(scanURL, defaultQrCodeOptions))); err != nil {
+		log.Printf("Error: failed to delete stored qr code %s %s", qr.ScanCode, err.Error())
+	}
+}
+
+func renderQrCode(qr *qrCodeRequest) ([]byte, error) {
+
+	start := time.Now()
+	rendered, err := qr.opts.render(qr.scanURL, qr.logo)
+	observeQrCode(start)
+	if errors.Is(err, errQrCodeUnreadable) {
+		return nil, appErrors.NewInvalidInputError("the qr code no longer scans with this logo or frame, try a smaller logo_size or a larger size")
+	}
+	if err != nil {
+		log.Printf("Error: failed to encode qr code %s", err.Error())
+		return nil, appErrors.NewInternalError("failed to create qrcode", err)
+	}
+
+	return rendered, nil
+}
+
+// qrCodeImageURL is where the image of these options is served; only options that differ from the defaults are spelled out
+func (s *urlService) qrCodeImageURL(shortCode string, opts qrCodeOptions) string {
+
+	imageURL := strings.TrimSuffix(s.cfg.Server.BaseURL, "/") + "/shorten/" + url.PathEscape(shortCode) + "/qrcode/image"
+	if query := opts.query(); len(query) > 0 {
+		imageURL += "?" + query.Encode()
+	}
+	return imageURL
+}
+
+// etagMatches applies If-None-Match, which compares weakly: a W/ prefix on the client's tags is ignored
+func etagMatches(ifNoneMatch string, etag string) bool {
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/repository"
+	"shorten-url/pkg/blobstore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetQrCodeImage_ETagAndNotModified(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	qrCodeTestCode(mockRepo, qrCodeTestLink(mockRepo, "qr-etag"))
+
+	res, err := service.GetQrCodeImage(ctx, "qr-etag", nil, "")
+
+	assert.NoError(t, err)
+	assert.False(t, res.NotModified)
+	assert.Equal(t, "image/png", res.ContentType)
+	assert.Equal(t, "qrcode_qr-etag.png", res.FileName)
+	assert.True(t, bytes.HasPrefix(res.Data, []byte("\x89PNG")))
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, res.ETag)
+
+	// Equal options, however they are spelled, give the same tag
+	same, err := service.GetQrCodeImage(ctx, "qr-etag", &entities.QrCodeReq{Size: qrCodeDefaultSize, Level: "m"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, res.ETag, same.ETag)
+	assert.Equal(t, res.Data, same.Data)
+
+	for _, ifNoneMatch := range []string{res.ETag, `"stale", ` + res.ETag, "W/" + res.ETag, "*"} {
+		cached, err := service.GetQrCodeImage(ctx, "qr-etag", nil, ifNoneMatch)
+		assert.NoError(t, err)
+		assert.True(t, cached.NotModified, ifNoneMatch)
+		assert.Nil(t, cached.Data)
+		assert.Equal(t, res.ETag, cached.ETag)
+	}
+
+	other, err := service.GetQrCodeImage(ctx, "qr-etag", &entities.QrCodeReq{Size: 512}, res.ETag)
+	assert.NoError(t, err)
+	assert.False(t, other.NotModified)
+	assert.NotEqual(t, res.ETag, other.ETag)
+}
+
+func TestGetQrCodeImage_Formats(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	qrCodeTestCode(mockRepo, qrCodeTestLink(mockRepo, "qr-formats"))
+
+	svg, err := service.GetQrCodeImage(ctx, "qr-formats", &entities.QrCodeReq{Format: "svg"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/svg+xml", svg.ContentType)
+	assert.Equal(t, "qrcode_qr-formats.svg", svg.FileName)
+	assert.True(t, bytes.HasPrefix(svg.Data, []byte("<svg")))
+
+	pdf, err := service.GetQrCodeImage(ctx, "qr-formats", &entities.QrCodeReq{Format: "pdf"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "application/pdf", pdf.ContentType)
+	assert.True(t, bytes.HasPrefix(pdf.Data, []byte("%PDF-1.4")))
+}
+
+func TestGetQrCodeImage_CachesRenderedImages(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo).(*urlService)
+	ctx := context.Background()
+
+	qrCodeTestCode(mockRepo, qrCodeTestLink(mockRepo, "qr-cache"))
+
+	first, err := service.GetQrCodeImage(ctx, "qr-cache", nil, "")
+	assert.NoError(t, err)
+	second, err := service.GetQrCodeImage(ctx, "qr-cache", nil, "")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, service.qrImages.Len())
+	assert.Equal(t, first.Data, second.Data)
+
+	_, err = service.GetQrCodeImage(ctx, "qr-cache", &entities.QrCodeReq{Format: "svg"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, service.qrImages.Len())
+}
+
+func TestGetQrCodeImage_StoresCanonicalImage(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo).(*urlService)
+	ctx := context.Background()
+
+	qr := qrCodeTestCode(mockRepo, qrCodeTestLink(mockRepo, "qr-stored"))
+
+	res, err := service.GetQrCodeImage(ctx, "qr-stored", nil, "")
+	assert.NoError(t, err)
+
+	stored, err := service.readBlob(ctx, qrCodeBlobKey(qr.ScanCode, res.ETag))
+	assert.NoError(t, err)
+	assert.Equal(t, res.Data, stored)
+
+	// Variants are not stored, nothing bounds how many a link has
+	variant, err := service.GetQrCodeImage(ctx, "qr-stored", &entities.QrCodeReq{Size: 512}, "")
+	assert.NoError(t, err)
+	_, err = service.blobs.Get(ctx, qrCodeBlobKey(qr.ScanCode, variant.ETag))
+	assert.ErrorIs(t, err, blobstore.ErrNotFound)
+
+	// Another instance shares the stored image
+	other := NewURLService(mockRepo, nil, nil, nil, nil, nil, service.blobs, testCfg())
+	again, err := other.GetQrCodeImage(ctx, "qr-stored", nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, res.Data, again.Data)
+
+	mockRepo.On("DeleteByShortCode", ctx, "qr-stored").Return(nil)
+	assert.NoError(t, service.DeleteShortUrl(ctx, "qr-stored"))
+
+	_, err = service.blobs.Get(ctx, qrCodeBlobKey(qr.ScanCode, res.ETag))
+	assert.ErrorIs(t, err, blobstore.ErrNotFound)
+}
+
+func TestGetQrCodeImage_WithoutCache(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	cfg := testCfg()
+	cfg.QrCode.CacheEntries = 0
+	service := NewURLService(mockRepo, nil, nil, nil, nil, nil, newTestBlobs(), cfg).(*urlService)
+	ctx := context.Background()
+
+	qrCodeTestCode(mockRepo, qrCodeTestLink(mockRepo, "qr-nocache"))
+
+	res, err := service.GetQrCodeImage(ctx, "qr-nocache", nil, "")
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, res.Data)
+	assert.Nil(t, service.qrImages)
+}
+
+func TestGetQrCodeImage_Errors(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	mockRepo.On("GetByShortCode", ctx, "missing").Return(nil, sql.ErrNoRows)
+
+	_, err := service.GetQrCodeImage(ctx, "missing", nil, "")
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+
+	_, err = service.GetQrCodeImage(ctx, "missing", &entities.QrCodeReq{Format: "gif"}, "")
+	assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"shorten-url/configs"
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/pkg/qrimage"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	QrCodeFormatPNG = "png"
+	QrCodeFormatSVG = "svg"
+	QrCodeFormatPDF = "pdf"
+
+	qrCodeMinSize     = 128
+	qrCodeMaxSize     = 2048
+	qrCodeDefaultSize = 256
+
+	qrCodeMaxMargin     = 16
+	qrCodeDefaultMargin = 4
+
+	qrCodeDefaultLogoSize = 12
+	qrCodeMaxCaption      = 32
+	qrCodeDefaultCaption  = "Scan me"
+)
+
+// errQrCodeUnreadable is returned when a composited code no longer decodes to what it should
+var errQrCodeUnreadable = errors.New("qr code does not scan")
+
+var qrCodeLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// qrCodeOptions are validated rendering options with every default filled in
+type qrCodeOptions struct {
+	size       int
+	level      string
+	margin     int
+	foreground string
+	background string
+	format     string
+
+	workspace  string
+	logoSize   int
+	logoDigest string
+	frame      string
+	caption    string
+}
+
+var defaultQrCodeOptions = qrCodeOptions{
+	size:       qrCodeDefaultSize,
+	level:      "M",
+	margin:     qrCodeDefaultMargin,
+	foreground: "000000",
+	background: "ffffff",
+	format:     QrCodeFormatPNG,
+}
+
+// newQrCodeOptions checks the requested options against their ranges; a nil request means all defaults
+func newQrCodeOptions(req *entities.QrCodeReq, cfg *configs.Config) (qrCodeOptions, error) {
+
+	opts := defaultQrCodeOptions
+	if req == nil {
+		return opts, nil
+	}
+
+	if req.Size != 0 {
+		if req.Size < qrCodeMinSize || req.Size > qrCodeMaxSize {
+			return opts, appErrors.NewInvalidInputError(fmt.Sprintf("size must be between %d and %d", qrCodeMinSize, qrCodeMaxSize))
+		}
+		opts.size = req.Size
+	}
+
+	if req.Level != "" {
+		opts.level = strings.ToUpper(req.Level)
+		if _, ok := qrCodeLevels[opts.level]; !ok {
+			return opts, appErrors.NewInvalidInputError("level must be one of L, M, Q or H")
+		}
+	}
+
+	if req.Margin != nil {
+		if *req.Margin < 0 || *req.Margin > qrCodeMaxMargin {
+			return opts, appErrors.NewInvalidInputError(fmt.Sprintf("margin must be between 0 and %d modules", qrCodeMaxMargin))
+		}
+		opts.margin = *req.Margin
+	}
+
+	var err error
+	if req.Foreground != "" {
+		if opts.foreground, err = normalizeHexColor(req.Foreground); err != nil {
+			return opts, appErrors.NewInvalidInputError("fg " + err.Error())
+		}
+	}
+	if req.Background != "" {
+		if opts.background, err = normalizeHexColor(req.Background); err != nil {
+			return opts, appErrors.NewInvalidInputError("bg " + err.Error())
+		}
+	}
+	if opts.foreground == opts.background {
+		return opts, appErrors.NewInvalidInputError("fg and bg must be different colors")
+	}
+
+	if req.Format != "" {
+		opts.format = strings.ToLower(req.Format)
+		switch opts.format {
+		case QrCodeFormatPNG, QrCodeFormatSVG, QrCodeFormatPDF:
+		default:
+			return opts, appErrors.NewInvalidInputError("format must be png, svg or pdf")
+		}
+	}
+
+	if req.Workspace != "" {
+		if !isValidWorkspace(req.Workspace) {
+			return opts, appErrors.NewInvalidInputError("workspace must be lowercase letters, digits or dashes")
+		}
+		opts.workspace = req.Workspace
+		opts.logoSize = qrCodeDefaultLogoSize
+
+		// The logo hides modules, which only the highest error correction can make up for
+		opts.level = "H"
+	}
+	if req.LogoSize != 0 {
+		if opts.workspace == "" {
+			return opts, appErrors.NewInvalidInputError("logo_size needs a workspace with a logo")
+		}
+		if req.LogoSize < 1 || req.LogoSize > cfg.QrCode.LogoMaxArea {
+			return opts, appErrors.NewInvalidInputError(fmt.Sprintf("logo_size must be between 1 and %d percent of the code", cfg.QrCode.LogoMaxArea))
+		}
+		opts.logoSize = req.LogoSize
+	}
+
+	switch frame := strings.ToLower(req.Frame); frame {
+	case "":
+		if req.Caption != "" {
+			opts.frame = qrimage.FrameCaption
+		}
+	case "none":
+	case qrimage.FrameCaption, qrimage.FrameBox:
+		opts.frame = frame
+	default:
+		return opts, appErrors.NewInvalidInputError("frame must be none, caption or box")
+	}
+	if opts.frame != qrimage.FrameNone {
+		opts.caption = strings.TrimSpace(req.Caption)
+		if opts.caption == "" {
+			opts.caption = qrCodeDefaultCaption
+		}
+		if len(opts.caption) > qrCodeMaxCaption || strings.IndexFunc(opts.caption, func(r rune) bool { return r < ' ' || r > '~' }) >= 0 {
+			return opts, appErrors.NewInvalidInputError(fmt.Sprintf("caption must be at most %d printable ASCII characters", qrCodeMaxCaption))
+		}
+	}
+
+	return opts, nil
+}
+
+// normalizeHexColor accepts RRGGBB or RGB, with or without a leading #, and returns lowercase RRGGBB
+func normalizeHexColor(value string) (string, error) {
+
+	value = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(value), "#"))
+	if len(value) == 3 {
+		value = string([]byte{value[0], value[0], value[1], value[1], value[2], value[2]})
+	}
+	if len(value) != 6 {
+		return "", fmt.Errorf("must be a hex color such as 1a2b3c")
+	}
+	if _, err := hex.DecodeString(value); err != nil {
+		return "", fmt.Errorf("must be a hex color such as 1a2b3c")
+	}
+	return value, nil
+}
+
+func parseHexColor(value string) color.RGBA {
+
+	rgb, _ := hex.DecodeString(value)
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xff}
+}
+
+// key identifies a rendered variant, so the same options always reuse the same image
+func (o qrCodeOptions) key() string {
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%s|%d|%s|%s|%s|%s|%d|%s|%s|%s",
+		o.size, o.level, o.margin, o.foreground, o.background, o.format, o.workspace, o.logoSize, o.logoDigest, o.frame, o.caption)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// query spells out the options that differ from their defaults, in the form newQrCodeOptions reads back
+func (o qrCodeOptions) query() url.Values {
+
+	query := url.Values{}
+	set := func(name string, value string, defaultValue string) {
+		if value != defaultValue {
+			query.Set(name, value)
+		}
+	}
+
+	set("size", strconv.Itoa(o.size), strconv.Itoa(defaultQrCodeOptions.size))
+	set("margin", strconv.Itoa(o.margin), strconv.Itoa(defaultQrCodeOptions.margin))
+	set("fg", o.foreground, defaultQrCodeOptions.foreground)
+	set("bg", o.background, defaultQrCodeOptions.background)
+	set("format", o.format, defaultQrCodeOptions.format)
+
+	// A workspace forces the level, so it is only named without one
+	if o.workspace == "" {
+		set("level", o.level, defaultQrCodeOptions.level)
+	} else {
+		query.Set("workspace", o.workspace)
+		set("logo_size", strconv.Itoa(o.logoSize), strconv.Itoa(qrCodeDefaultLogoSize))
+	}
+
+	if o.frame != qrimage.FrameNone {
+		query.Set("frame", o.frame)
+		set("caption", o.caption, qrCodeDefaultCaption)
+	}
+
+	return query
+}
+
+// composited reports whether a logo or frame is drawn over the plain code, which then has to be verified
+func (o qrCodeOptions) composited() bool {
+	return o.workspace != "" || o.frame != qrimage.FrameNone
+}
+
+// render encodes content and draws it in the requested format. A composited code is decoded again and
+// refused when it no longer reads back; SVG and PDF share the raster's layout, so the raster is what is checked.
+func (o qrCodeOptions) render(content string, logo image.Image) ([]byte, error) {
+
+	code, err := qrcode.New(content, qrCodeLevels[o.level])
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+
+	drawing := qrimage.Options{
+		Size:       o.size,
+		Margin:     o.margin,
+		Foreground: parseHexColor(o.foreground),
+		Background: parseHexColor(o.background),
+		Frame:      o.frame,
+		Caption:    o.caption,
+	}
+	if logo != nil {
+		drawing.Logo = logo
+		drawing.LogoArea = float64(o.logoSize) / 100
+	}
+
+	bitmap := code.Bitmap()
+
+	var raster image.Image
+	if o.composited() || o.format == QrCodeFormatPNG {
+		raster = qrimage.Image(bitmap, drawing)
+	}
+	if o.composited() {
+		if text, err := qrimage.Decode(raster); err != nil || text != content {
+			return nil, errQrCodeUnreadable
+		}
+	}
+
+	var buf bytes.Buffer
+	switch o.format {
+	case QrCodeFormatSVG:
+		err = qrimage.SVG(&buf, bitmap, drawing)
+	case QrCodeFormatPDF:
+		err = qrimage.PDF(&buf, bitmap, drawing)
+	default:
+		err = png.Encode(&buf, raster)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"testing"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+	"shorten-url/pkg/qrimage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewQrCodeOptions_Validation(t *testing.T) {
+
+	zero, tooWide := 0, qrCodeMaxMargin+1
+
+	tests := []struct {
+		name  string
+		req   *entities.QrCodeReq
+		valid bool
+	}{
+		{"defaults", &entities.QrCodeReq{}, true},
+		{"every option", &entities.QrCodeReq{Size: 512, Level: "h", Margin: &zero, Foreground: "#1A2B3C", Background: "fff", Format: "SVG"}, true},
+		{"size too small", &entities.QrCodeReq{Size: qrCodeMinSize - 1}, false},
+		{"size too large", &entities.QrCodeReq{Size: qrCodeMaxSize + 1}, false},
+		{"unknown level", &entities.QrCodeReq{Level: "X"}, false},
+		{"margin too wide", &entities.QrCodeReq{Margin: &tooWide}, false},
+		{"bad color", &entities.QrCodeReq{Foreground: "red"}, false},
+		{"same colors", &entities.QrCodeReq{Foreground: "fff", Background: "#FFFFFF"}, false},
+		{"unknown format", &entities.QrCodeReq{Format: "gif"}, false},
+		{"logo", &entities.QrCodeReq{Workspace: "acme", LogoSize: 15}, true},
+		{"bad workspace", &entities.QrCodeReq{Workspace: "Acme Inc"}, false},
+		{"logo too large", &entities.QrCodeReq{Workspace: "acme", LogoSize: 16}, false},
+		{"logo size without workspace", &entities.QrCodeReq{LogoSize: 10}, false},
+		{"box frame", &entities.QrCodeReq{Frame: "box", Caption: "Scan for the menu"}, true},
+		{"unknown frame", &entities.QrCodeReq{Frame: "circle"}, false},
+		{"caption too long", &entities.QrCodeReq{Caption: "Scan this code to see everything we have on sale"}, false},
+		{"caption not ascii", &entities.QrCodeReq{Caption: "Scannez-moi ✓"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newQrCodeOptions(tt.req, testCfg())
+			if tt.valid {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+		})
+	}
+}
+
+func TestQrCodeOptions_KeyFollowsNormalizedOptions(t *testing.T) {
+
+	a, _ := newQrCodeOptions(&entities.QrCodeReq{Level: "q", Foreground: "#ABC", Format: "SVG"}, testCfg())
+	b, _ := newQrCodeOptions(&entities.QrCodeReq{Level: "Q", Foreground: "aabbcc", Format: "svg"}, testCfg())
+	c, _ := newQrCodeOptions(&entities.QrCodeReq{Level: "Q", Foreground: "aabbcc", Format: "pdf"}, testCfg())
+
+	assert.Equal(t, a.key(), b.key())
+	assert.NotEqual(t, a.key(), c.key())
+	assert.NotEmpty(t, a.query())
+
+	defaults, _ := newQrCodeOptions(&entities.QrCodeReq{Size: qrCodeDefaultSize, Level: "m", Format: "png"}, testCfg())
+	assert.Empty(t, defaults.query())
+}
+
+func TestQrCodeOptions_RenderFormats(t *testing.T) {
+
+	opts, _ := newQrCodeOptions(&entities.QrCodeReq{Size: 300}, testCfg())
+	image, err := opts.render("http://localhost:8080/abc123", nil)
+	assert.NoError(t, err)
+
+	decoded, err := png.Decode(bytes.NewReader(image))
+	assert.NoError(t, err)
+	assert.Equal(t, 300, decoded.Bounds().Dx())
+
+	opts.format = QrCodeFormatSVG
+	image, err = opts.render("http://localhost:8080/abc123", nil)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(image, []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="300" height="300"`)))
+	assert.Contains(t, string(image), `fill="#000000"`)
+
+	opts.format = QrCodeFormatPDF
+	image, err = opts.render("http://localhost:8080/abc123", nil)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(image, []byte("%PDF-1.4")))
+	assert.Contains(t, string(image), "/MediaBox [0 0 300 300]")
+	assert.True(t, bytes.HasSuffix(image, []byte("%%EOF\n")))
+}
+
+func TestQrCodeOptions_LogoAndFrame(t *testing.T) {
+
+	opts, err := newQrCodeOptions(&entities.QrCodeReq{Level: "L", Workspace: "acme"}, testCfg())
+	assert.NoError(t, err)
+	assert.Equal(t, "H", opts.level, "a logo forces the highest error correction")
+	assert.Equal(t, qrCodeDefaultLogoSize, opts.logoSize)
+
+	opts, err = newQrCodeOptions(&entities.QrCodeReq{Frame: "box"}, testCfg())
+	assert.NoError(t, err)
+	assert.Equal(t, qrCodeDefaultCaption, opts.caption)
+
+	opts, err = newQrCodeOptions(&entities.QrCodeReq{Caption: "Menu"}, testCfg())
+	assert.NoError(t, err)
+	assert.Equal(t, qrimage.FrameCaption, opts.frame, "a caption alone gets a plain caption frame")
+
+	opts, err = newQrCodeOptions(&entities.QrCodeReq{Frame: "none", Caption: "Menu"}, testCfg())
+	assert.NoError(t, err)
+	assert.Empty(t, opts.caption)
+}
+
+func testLogo() image.Image {
+
+	logo := image.NewRGBA(image.Rect(0, 0, 80, 60))
+	draw.Draw(logo, logo.Bounds(), image.NewUniform(color.RGBA{R: 0xc8, G: 0x1e, B: 0x1e, A: 0xff}), image.Point{}, draw.Src)
+	return logo
+}
+
+func TestQrCodeOptions_CompositedCodeStillScans(t *testing.T) {
+
+	content := "http://localhost:8080/abc123"
+
+	for _, format := range []string{QrCodeFormatPNG, QrCodeFormatSVG, QrCodeFormatPDF} {
+		opts, _ := newQrCodeOptions(&entities.QrCodeReq{Workspace: "acme", LogoSize: 15, Frame: "box", Format: format}, testCfg())
+
+		image, err := opts.render(content, testLogo())
+		assert.NoError(t, err, format)
+		assert.NotEmpty(t, image, format)
+	}
+
+	opts, _ := newQrCodeOptions(&entities.QrCodeReq{Workspace: "acme", Frame: "caption"}, testCfg())
+	image, err := opts.render(content, testLogo())
+	assert.NoError(t, err)
+
+	decoded, err := png.Decode(bytes.NewReader(image))
+	assert.NoError(t, err)
+	assert.Greater(t, decoded.Bounds().Dy(), decoded.Bounds().Dx(), "the caption goes below the code")
+
+	text, err := qrimage.Decode(decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, content, text)
+}
+
+func TestQrCodeOptions_RefusesCodeThatNoLongerScans(t *testing.T) {
+
+	opts, _ := newQrCodeOptions(&entities.QrCodeReq{Workspace: "acme"}, testCfg())
+	opts.logoSize = 60
+
+	_, err := opts.render("http://localhost:8080/abc123", testLogo())
+
+	assert.ErrorIs(t, err, errQrCodeUnreadable)
+}
+
+func TestGetQrCode_VariantURL(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	qrCodeTestLink(mockRepo, "qr-variant")
+
+	// The stored row keeps the canonical image, whatever options were asked for
+	mockRepo.On("GetQrCode", ctx, uint(1)).Return(nil, sql.ErrNoRows).Once()
+	mockRepo.On("SaveQrCode", ctx, mock.MatchedBy(func(qr *model.Qrcode) bool {
+		return qr.QrCodeUrl == "http://localhost:8080/shorten/qr-variant/qrcode/image"
+	})).Return(&model.Qrcode{
+		ID:          2,
+		URLID:       1,
+		ScanCode:    "v4r14nt000",
+		OriginalURL: "http://localhost:8080/q/v4r14nt000",
+		QrCodeUrl:   "http://localhost:8080/shorten/qr-variant/qrcode/image",
+	}, nil).Once()
+
+	result, err := service.GetQrCode(ctx, "qr-variant", &entities.QrCodeReq{Format: "SVG", Foreground: "#1A2B3C"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, QrCodeFormatSVG, result.Format)
+	assert.Equal(t, "http://localhost:8080/shorten/qr-variant/qrcode/image?fg=1a2b3c&format=svg", result.QrCodeURL)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestQrCodeOptions_QueryReadsBack(t *testing.T) {
+
+	margin := 0
+	reqs := []*entities.QrCodeReq{
+		{Size: 512, Level: "q", Margin: &margin, Background: "eee", Format: "pdf"},
+		{Workspace: "acme", LogoSize: 9, Frame: "box", Caption: "Menu"},
+		{Caption: "Scan me"},
+	}
+
+	for _, req := range reqs {
+		opts, err := newQrCodeOptions(req, testCfg())
+		assert.NoError(t, err)
+
+		query := opts.query()
+		readBack := &entities.QrCodeReq{
+			Level:      query.Get("level"),
+			Foreground: query.Get("fg"),
+			Background: query.Get("bg"),
+			Format:     query.Get("format"),
+			Workspace:  query.Get("workspace"),
+			Frame:      query.Get("frame"),
+			Caption:    query.Get("caption"),
+		}
+		readBack.Size, _ = strconv.Atoi(query.Get("size"))
+		readBack.LogoSize, _ = strconv.Atoi(query.Get("logo_size"))
+		if query.Has("margin") {
+			value, _ := strconv.Atoi(query.Get("margin"))
+			readBack.Margin = &value
+		}
+
+		again, err := newQrCodeOptions(readBack, testCfg())
+		assert.NoError(t, err)
+		assert.Equal(t, opts, again)
+	}
+}
+
+func TestGetQrCode_InvalidOptions(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+
+	result, err := service.GetQrCode(context.Background(), "abc123", &entities.QrCodeReq{Size: 10})
+
+	assert.Nil(t, result)
+	assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+	mockRepo.AssertNotCalled(t, "GetByShortCode", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestResolveQrCode_RecordsScan(t *testing.T) {
+
+	mockRepo := new(repository.MockURLRepository)
+	mockClickRepo := new(repository.MockClickRepository)
+	recorder := newTestClickRecorder(mockClickRepo)
+	service := newTestServiceWithRecorder(mockRepo, recorder)
+	ctx := context.Background()
+
+	mockRepo.On("GetURLByScanCode", ctx, "Sc4nC0de01").
+		Return(&model.URL{ID: 1, ShortCode: "abc123", OriginalURL: "http://example.com"}, nil)
+	mockClickRepo.On("InsertClickEvents", mock.Anything, mock.MatchedBy(func(events []*model.ClickEvent) bool {
+		return len(events) == 1 && events[0].URLID == 1 && events[0].Source == model.ClickSourceQR
+	})).Return(nil)
+	mockClickRepo.On("AddClickCounts", mock.Anything, map[uint]int{1: 1}).Return([]*model.URL{}, nil)
+	mockClickRepo.On("AddQrCodeScans", mock.Anything, map[uint]int{1: 1}).Return(nil)
+	mockClickRepo.On("MergeVisitorSketch", mock.Anything, uint(1), mock.Anything, mock.Anything).Return(nil)
+
+	click := &entities.ClickInfo{UserAgent: testBrowserUserAgent, IP: "203.0.113.7", Method: "GET", Source: model.ClickSourceDirect}
+	result, err := service.ResolveQrCode(ctx, "Sc4nC0de01", click)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", result)
+	assert.NoError(t, recorder.Close(ctx))
+
+	mockRepo.AssertExpectations(t)
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestResolveQrCode_Errors(t *testing.T) {
+
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	mockRepo.On("GetURLByScanCode", ctx, "missing").Return(nil, sql.ErrNoRows)
+
+	_, err := service.ResolveQrCode(ctx, "missing", nil)
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+}
+
+func TestClickRecorder_CountsHumanQrScans(t *testing.T) {
+
+	mockClickRepo := new(repository.MockClickRepository)
+	recorder := newTestClickRecorder(mockClickRepo)
+	ctx := context.Background()
+
+	scan := &entities.ClickInfo{UserAgent: testBrowserUserAgent, IP: "203.0.113.7", Method: "GET", Source: model.ClickSourceQR}
+	direct := &entities.ClickInfo{UserAgent: testBrowserUserAgent, IP: "203.0.113.7", Method: "GET"}
+	botScan := &entities.ClickInfo{UserAgent: "curl/8.0", IP: "203.0.113.8", Method: "GET", Source: model.ClickSourceQR}
+
+	recorder.Record(ctx, &model.URL{ID: 1, ShortCode: "abc123"}, scan)
+	recorder.Record(ctx, &model.URL{ID: 1, ShortCode: "abc123"}, direct)
+	recorder.Record(ctx, &model.URL{ID: 2, ShortCode: "def456"}, scan)
+	recorder.Record(ctx, &model.URL{ID: 2, ShortCode: "def456"}, botScan)
+
+	mockClickRepo.On("InsertClickEvents", mock.Anything, mock.Anything).Return(nil)
+	mockClickRepo.On("AddClickCounts", mock.Anything, map[uint]int{1: 2, 2: 1}).Return([]*model.URL{}, nil)
+	mockClickRepo.On("AddQrCodeScans", mock.Anything, map[uint]int{1: 1, 2: 1}).Return(errors.New("database error"))
+	mockClickRepo.On("MergeVisitorSketch", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	// A failed scan count is only logged, the events are already written
+	assert.NoError(t, recorder.Close(ctx))
+	assert.Equal(t, uint64(4), recorder.Stats().Written)
+
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestRetargetQrCode_MovesCode(t *testing.T) {
+
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	mockRepo.On("GetByShortCode", ctx, "new123").Return(&model.URL{ID: 2, ShortCode: "new123", OriginalURL: "http://new.example.com"}, nil)
+	mockRepo.On("GetQrCode", ctx, uint(2)).Return(nil, sql.ErrNoRows)
+	mockRepo.On("RetargetQrCode", ctx, &model.Qrcode{
+		ScanCode:  "Sc4nC0de01",
+		URLID:     2,
+		QrCodeUrl: "http://localhost:8080/shorten/new123/qrcode/image",
+	}).Return(&model.Qrcode{
+		ID:          1,
+		URLID:       2,
+		ScanCode:    "Sc4nC0de01",
+		OriginalURL: "http://localhost:8080/q/Sc4nC0de01",
+		QrCodeUrl:   "http://localhost:8080/shorten/new123/qrcode/image",
+		ClickCount:  42,
+	}, nil)
+
+	result, err := service.RetargetQrCode(ctx, "Sc4nC0de01", &entities.RetargetQrCodeReq{ShortCode: "new123"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "new123", result.ShortCode)
+	assert.Equal(t, "http://new.example.com", result.OriginalURL)
+	assert.Equal(t, "http://localhost:8080/q/Sc4nC0de01", result.ScanURL)
+	assert.Equal(t, 42, result.Scans)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRetargetQrCode_LinkAlreadyHasCode(t *testing.T) {
+
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	link := qrCodeTestLink(mockRepo, "own123")
+	qrCodeTestCode(mockRepo, link)
+
+	_, err := service.RetargetQrCode(ctx, "0th3rC0de1", &entities.RetargetQrCodeReq{ShortCode: "own123"})
+	assert.Equal(t, appErrors.Conflict, err.(*appErrors.AppError).Type)
+
+	// Moving a code to the link it is already on changes nothing
+	result, err := service.RetargetQrCode(ctx, "Sc4nC0de01", &entities.RetargetQrCodeReq{ShortCode: "own123"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Sc4nC0de01", result.ScanCode)
+
+	mockRepo.AssertNotCalled(t, "RetargetQrCode", mock.Anything, mock.Anything)
+}
+
+func TestRetargetQrCode_Errors(t *testing.T) {
+
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	_, err := service.RetargetQrCode(ctx, "Sc4nC0de01", &entities.RetargetQrCodeReq{})
+	assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+
+	mockRepo.On("GetByShortCode", ctx, "missing").Return(nil, sql.ErrNoRows)
+	_, err = service.RetargetQrCode(ctx, "Sc4nC0de01", &entities.RetargetQrCodeReq{ShortCode: "missing"})
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+
+	mockRepo.On("GetByShortCode", ctx, "new123").Return(&model.URL{ID: 2, ShortCode: "new123"}, nil)
+	mockRepo.On("GetQrCode", ctx, uint(2)).Return(nil, sql.ErrNoRows)
+	mockRepo.On("RetargetQrCode", ctx, mock.MatchedBy(func(qr *model.Qrcode) bool { return qr.ScanCode == "unknown" })).Return(nil, sql.ErrNoRows)
+	mockRepo.On("RetargetQrCode", ctx, mock.MatchedBy(func(qr *model.Qrcode) bool { return qr.ScanCode == "broken" })).Return(nil, errors.New("database error"))
+
+	_, err = service.RetargetQrCode(ctx, "unknown", &entities.RetargetQrCodeReq{ShortCode: "new123"})
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+
+	_, err = service.RetargetQrCode(ctx, "broken", &entities.RetargetQrCodeReq{ShortCode: "new123"})
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/pkg/pdf"
+	"shorten-url/pkg/qrimage"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	QrCodeSheetA4     = "a4"
+	QrCodeSheetLetter = "letter"
+
+	QrCodeCaptionFull     = "full"
+	QrCodeCaptionShortURL = "short_url"
+	QrCodeCaptionNone     = "none"
+
+	qrCodeSheetDefaultColumns = 3
+	qrCodeSheetDefaultRows    = 4
+	qrCodeSheetMaxGrid        = 10
+
+	// Below this phone cameras struggle to read a code from arm's length
+	qrCodeSheetMinLabel = 15.0
+
+	qrCodeSheetPageMargin = 10 * pointsPerMillimetre
+	qrCodeSheetPadding    = 4.0
+
+	pointsPerMillimetre = 72 / 25.4
+)
+
+// qrCodeSheetPages are the page sizes in points, portrait
+var qrCodeSheetPages = map[string][2]float64{
+	QrCodeSheetA4:     {595.28, 841.89},
+	QrCodeSheetLetter: {612, 792},
+}
+
+// qrCodeSheetLayout is a validated sheet request, in points
+type qrCodeSheetLayout struct {
+	pageWidth  float64
+	pageHeight float64
+	columns    int
+	rows       int
+	cellWidth  float64
+	cellHeight float64
+	codeSize   float64
+	level      string
+
+	// lines of caption under each code: the short URL, then the destination
+	lines        int
+	titleSize    float64
+	subtitleSize float64
+}
+
+// qrCodeLabel is one code on the sheet with the text printed under it
+type qrCodeLabel struct {
+	scanURL     string
+	shortURL    string
+	destination string
+}
+
+// WriteQrCodeSheet streams a PDF with the codes of the given links, in the order given, or of every link
+// in a campaign, laid out as a grid of labels. Everything is checked before the first byte is written; after that a failure can only
+// cut the document short.
+func (s *urlService) WriteQrCodeSheet(pctx context.Context, req *entities.QrCodeSheetReq, w io.Writer) error {
+
+	if req == nil {
+		req = new(entities.QrCodeSheetReq)
+	}
+
+	layout, err := newQrCodeSheetLayout(req)
+	if err != nil {
+		return err
+	}
+
+	links, err := s.qrCodeSheetLinks(pctx, req)
+	if err != nil {
+		return err
+	}
+
+	labels, err := s.qrCodeLabels(pctx, links)
+	if err != nil {
+		return err
+	}
+
+	doc := pdf.NewDocument()
+	if err := doc.Stream(w); err != nil {
+		return appErrors.NewInternalError("failed to write qrcode sheet", err)
+	}
+
+	var page *pdf.Page
+	perPage := layout.columns * layout.rows
+	for i, label := range labels {
+		if i%perPage == 0 {
+			// A client that went away stops the rendering of the pages it would never get
+			if err := pctx.Err(); err != nil {
+				return appErrors.NewInternalError("failed to write qrcode sheet", err)
+			}
+			page = doc.AddPage(layout.pageWidth, layout.pageHeight)
+		}
+		if err := layout.draw(doc, page, i%perPage, label); err != nil {
+			log.Printf("Error: failed to draw qr code %s %s", label.shortURL, err.Error())
+			return appErrors.NewInternalError("failed to write qrcode sheet", err)
+		}
+	}
+
+	if err := doc.Close(); err != nil {
+		return appErrors.NewInternalError("failed to write qrcode sheet", err)
+	}
+
+	return nil
+}
+
+// qrCodeSheetLinks finds the links a sheet asks for, either by short code in the order given or by campaign
+func (s *urlService) qrCodeSheetLinks(pctx context.Context, req *entities.QrCodeSheetReq) ([]*model.URL, error) {
+
+	campaign := strings.TrimSpace(req.Campaign)
+	if campaign == "" {
+		return s.qrCodeSheetLinksByShortCode(pctx, req.ShortCodes)
+	}
+	if len(req.ShortCodes) > 0 {
+		return nil, appErrors.NewInvalidInputError("give either short_codes or campaign, not both")
+	}
+
+	// One link past the limit tells a campaign that is too large apart from one that just fits
+	links, err := s.repo.ListByCampaign(pctx, campaign, s.cfg.QrCode.SheetMaxCodes+1)
+	if err != nil {
+		log.Printf("Error: failed to list campaign %s for qrcode sheet %s", campaign, err.Error())
+		return nil, appErrors.NewInternalError("failed to find short urls", err)
+	}
+	if len(links) == 0 {
+		return nil, appErrors.NewNotFoundError(fmt.Sprintf("campaign %q has no short urls", campaign))
+	}
+	if len(links) > s.cfg.QrCode.SheetMaxCodes {
+		return nil, appErrors.NewInvalidInputError(fmt.Sprintf("a sheet holds at most %d codes", s.cfg.QrCode.SheetMaxCodes))
+	}
+
+	return links, nil
+}
+
+func (s *urlService) qrCodeSheetLinksByShortCode(pctx context.Context, requested []string) ([]*model.URL, error) {
+
+	shortCodes := make([]string, 0, len(requested))
+	seen := make(map[string]bool, len(requested))
+	for _, shortCode := range requested {
+		shortCode = strings.TrimSpace(shortCode)
+		if shortCode == "" || seen[shortCode] {
+			continue
+		}
+		seen[shortCode] = true
+		shortCodes = append(shortCodes, shortCode)
+	}
+
+	if len(shortCodes) == 0 {
+		return nil, appErrors.NewInvalidInputError("short_codes or campaign must name at least one short url")
+	}
+	if len(shortCodes) > s.cfg.QrCode.SheetMaxCodes {
+		return nil, appErrors.NewInvalidInputError(fmt.Sprintf("a sheet holds at most %d codes", s.cfg.QrCode.SheetMaxCodes))
+	}
+
+	links, err := s.repo.ListByShortCodes(pctx, shortCodes)
+	if err != nil {
+		log.Printf("Error: failed to list short urls for qrcode sheet %s", err.Error())
+		return nil, appErrors.NewInternalError("failed to find short urls", err)
+	}
+
+	byCode := make(map[string]*model.URL, len(links))
+	for _, link := range links {
+		byCode[link.ShortCode] = link
+	}
+
+	ordered := make([]*model.URL, 0, len(shortCodes))
+	var missing []string
+	for _, shortCode := range shortCodes {
+		if byCode[shortCode] == nil {
+			missing = append(missing, shortCode)
+			continue
+		}
+		ordered = append(ordered, byCode[shortCode])
+	}
+	if len(missing) > 0 {
+		return nil, appErrors.NewNotFoundError("short urls were not found: " + strings.Join(missing, ", "))
+	}
+
+	return ordered, nil
+}
+
+// qrCodeLabels loads the codes of the links, creating the codes that do not exist yet
+func (s *urlService) qrCodeLabels(pctx context.Context, links []*model.URL) ([]qrCodeLabel, error) {
+
+	labels := make([]qrCodeLabel, 0, len(links))
+	for _, link := range links {
+		stored, err := s.storedQrCode(pctx, link)
+		if err != nil {
+			return nil, err
+		}
+
+		scanURL, err := s.qrCodeScanURL(stored.ScanCode)
+		if err != nil {
+			return nil, err
+		}
+
+		shortURL, err := url.JoinPath(s.cfg.Server.BaseURL, link.ShortCode)
+		if err != nil {
+			log.Printf("Error: failed to build short url %s", err.Error())
+			return nil, appErrors.NewInternalError("failed to build short url", err)
+		}
+
+		labels = append(labels, qrCodeLabel{
+			scanURL:     scanURL,
+			shortURL:    withoutScheme(shortURL),
+			destination: withoutScheme(link.OriginalURL),
+		})
+	}
+
+	return labels, nil
+}
+
+// newQrCodeSheetLayout checks the request and sizes the codes: as large as the labels allow, or as asked
+func newQrCodeSheetLayout(req *entities.QrCodeSheetReq) (qrCodeSheetLayout, error) {
+
+	layout := qrCodeSheetLayout{
+		columns: qrCodeSheetDefaultColumns,
+		rows:    qrCodeSheetDefaultRows,
+		level:   defaultQrCodeOptions.level,
+	}
+
+	pageSize := strings.ToLower(req.PageSize)
+	if pageSize == "" {
+		pageSize = QrCodeSheetA4
+	}
+	page, ok := qrCodeSheetPages[pageSize]
+	if !ok {
+		return layout, appErrors.NewInvalidInputError("page_size must be a4 or letter")
+	}
+	layout.pageWidth, layout.pageHeight = page[0], page[1]
+
+	if req.Columns != 0 {
+		layout.columns = req.Columns
+	}
+	if req.Rows != 0 {
+		layout.rows = req.Rows
+	}
+	if layout.columns < 1 || layout.columns > qrCodeSheetMaxGrid || layout.rows < 1 || layout.rows > qrCodeSheetMaxGrid {
+		return layout, appErrors.NewInvalidInputError(fmt.Sprintf("columns and rows must be between 1 and %d", qrCodeSheetMaxGrid))
+	}
+
+	switch strings.ToLower(req.Caption) {
+	case QrCodeCaptionFull, "":
+		layout.lines = 2
+	case QrCodeCaptionShortURL:
+		layout.lines = 1
+	case QrCodeCaptionNone:
+	default:
+		return layout, appErrors.NewInvalidInputError("caption must be full, short_url or none")
+	}
+
+	if req.Level != "" {
+		layout.level = strings.ToUpper(req.Level)
+		if _, ok := qrCodeLevels[layout.level]; !ok {
+			return layout, appErrors.NewInvalidInputError("level must be one of L, M, Q or H")
+		}
+	}
+
+	layout.cellWidth = (layout.pageWidth - 2*qrCodeSheetPageMargin) / float64(layout.columns)
+	layout.cellHeight = (layout.pageHeight - 2*qrCodeSheetPageMargin) / float64(layout.rows)
+
+	layout.titleSize = min(max(layout.cellWidth*0.06, 6), 11)
+	layout.subtitleSize = layout.titleSize * 0.8
+
+	largest := min(layout.cellWidth, layout.cellHeight-layout.captionHeight()) - 2*qrCodeSheetPadding
+	if largest < qrCodeSheetMinLabel*pointsPerMillimetre {
+		return layout, appErrors.NewInvalidInputError(fmt.Sprintf("%d x %d labels leave less than %gmm per code, use fewer columns or rows", layout.columns, layout.rows, qrCodeSheetMinLabel))
+	}
+
+	layout.codeSize = largest
+	if req.LabelSize != 0 {
+		layout.codeSize = req.LabelSize * pointsPerMillimetre
+		if req.LabelSize < qrCodeSheetMinLabel || layout.codeSize > largest {
+			return layout, appErrors.NewInvalidInputError(fmt.Sprintf("label_size must be between %gmm and %.0fmm for %d x %d labels", qrCodeSheetMinLabel, largest/pointsPerMillimetre, layout.columns, layout.rows))
+		}
+	}
+
+	return layout, nil
+}
+
+func (l qrCodeSheetLayout) captionHeight() float64 {
+
+	switch l.lines {
+	case 0:
+		return 0
+	case 1:
+		return qrCodeSheetPadding + l.titleSize*1.2
+	default:
+		return qrCodeSheetPadding + l.titleSize*1.2 + l.subtitleSize*1.2
+	}
+}
+
+// draw places a label in slot, counted left to right and top to bottom; the code and its caption are
+// centered in the slot together
+func (l qrCodeSheetLayout) draw(doc *pdf.Document, page *pdf.Page, slot int, label qrCodeLabel) error {
+
+	code, err := qrcode.New(label.scanURL, qrCodeLevels[l.level])
+	if err != nil {
+		return err
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	drawing := qrimage.Options{
+		Margin:     qrCodeDefaultMargin,
+		Foreground: color.Black,
+		Background: color.White,
+	}
+
+	cellX := qrCodeSheetPageMargin + float64(slot%l.columns)*l.cellWidth
+	cellTop := l.pageHeight - qrCodeSheetPageMargin - float64(slot/l.columns)*l.cellHeight
+
+	codeHeight := qrimage.Height(bitmap, drawing, l.codeSize)
+	blockTop := cellTop - (l.cellHeight-codeHeight-l.captionHeight())/2
+	codeBottom := blockTop - codeHeight
+
+	qrimage.Draw(doc, page, bitmap, drawing, cellX+(l.cellWidth-l.codeSize)/2, codeBottom, l.codeSize)
+
+	page.SetFillColor(color.Black)
+	textWidth := l.cellWidth - 2*qrCodeSheetPadding
+	baseline := codeBottom - qrCodeSheetPadding - l.titleSize
+	if l.lines >= 1 {
+		l.centeredText(page, pdf.HelveticaBold, l.titleSize, cellX, baseline, textWidth, label.shortURL)
+	}
+	if l.lines >= 2 {
+		l.centeredText(page, pdf.Helvetica, l.subtitleSize, cellX, baseline-l.subtitleSize*1.2, textWidth, label.destination)
+	}
+
+	return nil
+}
+
+func (l qrCodeSheetLayout) centeredText(page *pdf.Page, font pdf.Font, size float64, cellX float64, baseline float64, width float64, text string) {
+
+	text = fitText(font, size, text, width)
+	page.Text(font, size, cellX+(l.cellWidth-pdf.TextWidth(font, size, text))/2, baseline, text)
+}
+
+// fitText shortens text with a trailing ellipsis until it is at most width points wide
+func fitText(font pdf.Font, size float64, text string, width float64) string {
+
+	if pdf.TextWidth(font, size, text) <= width {
+		return text
+	}
+	for len(text) > 0 {
+		text = text[:len(text)-1]
+		if pdf.TextWidth(font, size, text+"...") <= width {
+			return text + "..."
+		}
+	}
+	return ""
+}
+
+func withoutScheme(value string) string {
+
+	if i := strings.Index(value, "://"); i >= 0 {
+		return value[i+3:]
+	}
+	return value
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// sheetTestLinks registers n links whose codes already exist, and returns their short codes
+func sheetTestLinks(mockRepo *repository.MockURLRepository, n int) []string {
+
+	shortCodes := make([]string, 0, n)
+	links := make([]*model.URL, 0, n)
+	for i := 1; i <= n; i++ {
+		link := &model.URL{ID: uint(i), ShortCode: fmt.Sprintf("sheet%02d", i), OriginalURL: fmt.Sprintf("https://example.com/event/%d", i)}
+		shortCodes = append(shortCodes, link.ShortCode)
+		links = append(links, link)
+		qrCodeTestCode(mockRepo, link)
+	}
+
+	// The repository returns them in no particular order
+	reversed := make([]*model.URL, 0, n)
+	for i := len(links) - 1; i >= 0; i-- {
+		reversed = append(reversed, links[i])
+	}
+	mockRepo.On("ListByShortCodes", mock.Anything, shortCodes).Return(reversed, nil)
+
+	return shortCodes
+}
+
+// assertValidPDF checks that every entry of the cross-reference table points at the object it names
+func assertValidPDF(t *testing.T, data []byte) {
+
+	t.Helper()
+
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if !assert.NotNil(t, startxref, "trailer") {
+		return
+	}
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xref:], -1)
+	assert.NotEmpty(t, entries)
+
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		assert.True(t, bytes.HasPrefix(data[offset:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))), "object %d", i+1)
+	}
+}
+
+func TestWriteQrCodeSheet_LaysOutPages(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	shortCodes := sheetTestLinks(mockRepo, 14)
+
+	var out bytes.Buffer
+	err := service.WriteQrCodeSheet(ctx, &entities.QrCodeSheetReq{ShortCodes: shortCodes}, &out)
+
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(out.Bytes(), []byte("%PDF-1.4")))
+	assertValidPDF(t, out.Bytes())
+
+	// 3 x 4 labels a page by default
+	assert.Contains(t, out.String(), "/Count 2 >>")
+	assert.Contains(t, out.String(), "(localhost:8080/sheet01) Tj")
+	assert.Contains(t, out.String(), "(example.com/event/14) Tj")
+	mockRepo.AssertNotCalled(t, "SaveQrCode", mock.Anything, mock.Anything)
+}
+
+func TestWriteQrCodeSheet_Layouts(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	shortCodes := sheetTestLinks(mockRepo, 5)
+
+	var out bytes.Buffer
+	err := service.WriteQrCodeSheet(ctx, &entities.QrCodeSheetReq{
+		ShortCodes: shortCodes,
+		PageSize:   "Letter",
+		Columns:    2,
+		Rows:       2,
+		LabelSize:  40,
+		Caption:    "short_url",
+		Level:      "h",
+	}, &out)
+
+	assert.NoError(t, err)
+	assertValidPDF(t, out.Bytes())
+	assert.Contains(t, out.String(), "/Count 2 >>")
+	assert.Contains(t, out.String(), "/MediaBox [0 0 612 792]")
+	assert.Contains(t, out.String(), "(localhost:8080/sheet05) Tj")
+	assert.NotContains(t, out.String(), "example.com")
+
+	mockRepo.On("ListByShortCodes", mock.Anything, shortCodes[:1]).
+		Return([]*model.URL{{ID: 1, ShortCode: shortCodes[0], OriginalURL: "https://example.com/event/1"}}, nil)
+
+	out.Reset()
+	err = service.WriteQrCodeSheet(ctx, &entities.QrCodeSheetReq{ShortCodes: shortCodes[:1], Caption: "none"}, &out)
+
+	assert.NoError(t, err)
+	assertValidPDF(t, out.Bytes())
+	assert.NotContains(t, out.String(), " Tj")
+}
+
+func TestWriteQrCodeSheet_Campaign(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	links := []*model.URL{
+		{ID: 1, ShortCode: "expo01", OriginalURL: "https://example.com/expo/1", Campaign: "expo"},
+		{ID: 2, ShortCode: "expo02", OriginalURL: "https://example.com/expo/2", Campaign: "expo"},
+	}
+	for _, link := range links {
+		qrCodeTestCode(mockRepo, link)
+	}
+	mockRepo.On("ListByCampaign", ctx, "expo", 41).Return(links, nil)
+	mockRepo.On("ListByCampaign", ctx, "empty", 41).Return([]*model.URL{}, nil)
+	mockRepo.On("ListByCampaign", ctx, "huge", 41).Return(make([]*model.URL, 41), nil)
+
+	var out bytes.Buffer
+	err := service.WriteQrCodeSheet(ctx, &entities.QrCodeSheetReq{Campaign: " expo "}, &out)
+
+	assert.NoError(t, err)
+	assertValidPDF(t, out.Bytes())
+	assert.Contains(t, out.String(), "(localhost:8080/expo01) Tj")
+	assert.Contains(t, out.String(), "(localhost:8080/expo02) Tj")
+
+	err = service.WriteQrCodeSheet(ctx, &entities.QrCodeSheetReq{Campaign: "empty"}, new(bytes.Buffer))
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+
+	err = service.WriteQrCodeSheet(ctx, &entities.QrCodeSheetReq{Campaign: "huge"}, new(bytes.Buffer))
+	assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+
+	mockRepo.AssertNotCalled(t, "ListByShortCodes", mock.Anything, mock.Anything)
+}
+
+func TestWriteQrCodeSheet_InvalidRequests(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	tooMany := make([]string, 41)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("code%02d", i)
+	}
+
+	reqs := []*entities.QrCodeSheetReq{
+		nil,
+		{ShortCodes: []string{" ", ""}},
+		{ShortCodes: tooMany},
+		{ShortCodes: []string{"abc123"}, PageSize: "a3"},
+		{ShortCodes: []string{"abc123"}, Columns: 11},
+		{ShortCodes: []string{"abc123"}, Rows: -1},
+		{ShortCodes: []string{"abc123"}, Caption: "title"},
+		{ShortCodes: []string{"abc123"}, Level: "x"},
+		{ShortCodes: []string{"abc123"}, LabelSize: 10},
+		{ShortCodes: []string{"abc123"}, LabelSize: 200},
+		{ShortCodes: []string{"abc123"}, Campaign: "expo"},
+	}
+
+	for _, req := range reqs {
+		var out bytes.Buffer
+		err := service.WriteQrCodeSheet(ctx, req, &out)
+		if assert.Error(t, err, "%+v", req) {
+			assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type, "%+v", req)
+		}
+		assert.Zero(t, out.Len())
+	}
+	mockRepo.AssertNotCalled(t, "ListByShortCodes", mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "ListByCampaign", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWriteQrCodeSheet_UnknownShortCodes(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	mockRepo.On("ListByShortCodes", ctx, []string{"abc123", "gone01", "gone02"}).
+		Return([]*model.URL{{ID: 1, ShortCode: "abc123"}}, nil)
+
+	var out bytes.Buffer
+	err := service.WriteQrCodeSheet(ctx, &entities.QrCodeSheetReq{ShortCodes: []string{"abc123", "gone01", "abc123", "gone02"}}, &out)
+
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+	assert.Contains(t, err.Error(), "gone01, gone02")
+	assert.Zero(t, out.Len())
+}
+
+func TestWriteQrCodeSheet_Errors(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+
+	mockRepo.On("ListByShortCodes", mock.Anything, []string{"broken"}).Return(nil, errors.New("database error"))
+
+	err := service.WriteQrCodeSheet(context.Background(), &entities.QrCodeSheetReq{ShortCodes: []string{"broken"}}, new(bytes.Buffer))
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+
+	// A client that went away gets no pages
+	shortCodes := sheetTestLinks(mockRepo, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = service.WriteQrCodeSheet(ctx, &entities.QrCodeSheetReq{ShortCodes: shortCodes}, new(bytes.Buffer))
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+	assert.Contains(t, err.Error(), context.Canceled.Error())
+}
+
+func TestFitText(t *testing.T) {
+
+	assert.Equal(t, "short", fitText("Helvetica", 10, "short", 100))
+
+	fitted := fitText("Helvetica", 10, "example.com/a/very/long/path/that/does/not/fit", 100)
+	assert.Regexp(t, `^example\.com/.*\.\.\.$`, fitted)
+
+	assert.Empty(t, fitText("Helvetica", 10, "wide", 1))
+}
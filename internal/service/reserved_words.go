@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"shorten-url/configs"
+)
+
+type ReservedWords interface {
+	AddPaths(paths []string)
+	Match(code string) (string, bool)
+	Exact() []string
+	Terms() []string
+}
+
+// reservedWords holds exact route segments plus terms that may not appear anywhere in a code
+type reservedWords struct {
+	mu    sync.RWMutex
+	exact map[string]struct{}
+	terms map[string]struct{}
+}
+
+func NewReservedWords(cfg *configs.Config) ReservedWords {
+
+	r := &reservedWords{
+		exact: make(map[string]struct{}),
+		terms: make(map[string]struct{}),
+	}
+
+	for _, word := range cfg.Reserved.Words {
+		r.addTerm(word)
+	}
+
+	if cfg.Reserved.FilePath != "" {
+		if err := r.loadFile(cfg.Reserved.FilePath); err != nil {
+			log.Printf("Error: failed to load reserved words from %s %s", cfg.Reserved.FilePath, err.Error())
+		}
+	}
+
+	return r
+}
+
+// AddPaths reserves every static segment of the given route paths, e.g. /shorten/broken
+func (r *reservedWords) AddPaths(paths []string) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, path := range paths {
+		for _, segment := range strings.Split(path, "/") {
+			segment = strings.ToLower(strings.TrimSuffix(segment, "*"))
+			if segment == "" || strings.HasPrefix(segment, ":") {
+				continue
+			}
+			r.exact[segment] = struct{}{}
+		}
+	}
+}
+
+// Match returns the reserved word that the code collides with
+func (r *reservedWords) Match(code string) (string, bool) {
+
+	code = strings.ToLower(code)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.exact[code]; ok {
+		return code, true
+	}
+
+	for term := range r.terms {
+		if strings.Contains(code, term) {
+			return term, true
+		}
+	}
+
+	return "", false
+}
+
+func (r *reservedWords) Exact() []string {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return sortedKeys(r.exact)
+}
+
+func (r *reservedWords) Terms() []string {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return sortedKeys(r.terms)
+}
+
+func (r *reservedWords) addTerm(word string) {
+	if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+		r.terms[word] = struct{}{}
+	}
+}
+
+func (r *reservedWords) loadFile(path string) error {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r.addTerm(line)
+	}
+
+	return scanner.Err()
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
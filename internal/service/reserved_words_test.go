@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestReservedWords(t *testing.T) ReservedWords {
+
+	cfg := testCfg()
+	cfg.Reserved.Words = []string{"Acme"}
+	cfg.Reserved.FilePath = filepath.Join(t.TempDir(), "reserved.txt")
+	assert.NoError(t, os.WriteFile(cfg.Reserved.FilePath, []byte("# comment\nbadword\n\n"), 0o644))
+
+	reserved := NewReservedWords(cfg)
+	reserved.AddPaths([]string{"/health", "/temp*", "/:short_code", "/shorten/:short_code/stat", "/shorten/broken"})
+
+	return reserved
+}
+
+func TestReservedWords_Match(t *testing.T) {
+
+	reserved := newTestReservedWords(t)
+
+	tests := []struct {
+		code     string
+		word     string
+		reserved bool
+	}{
+		{code: "health", word: "health", reserved: true},
+		{code: "HEALTH", word: "health", reserved: true},
+		{code: "temp", word: "temp", reserved: true},
+		{code: "broken", word: "broken", reserved: true},
+		{code: "stat", word: "stat", reserved: true},
+		{code: "healthy"},
+		{code: "xAcMe1", word: "acme", reserved: true},
+		{code: "a-BadWord", word: "badword", reserved: true},
+		{code: "abc123"},
+	}
+
+	for _, tt := range tests {
+		word, ok := reserved.Match(tt.code)
+		assert.Equal(t, tt.reserved, ok, tt.code)
+		assert.Equal(t, tt.word, word, tt.code)
+	}
+
+	assert.Equal(t, []string{"broken", "health", "shorten", "stat", "temp"}, reserved.Exact())
+	assert.Equal(t, []string{"acme", "badword"}, reserved.Terms())
+}
+
+func TestShortenURL_CustomAlias(t *testing.T) {
+
+	cfg := testCfg()
+	mockRepo := new(repository.MockURLRepository)
+	blocklist := NewBlocklistService(new(repository.MockBlocklistRepository), cfg)
+	service := newTestServiceWith(cfg, mockRepo, blocklist, NewShortenerResolver(cfg), newTestReservedWords(t))
+	ctx := context.Background()
+
+	for alias, wantType := range map[string]appErrors.ErrorType{
+		"health":      appErrors.InvalidInput,
+		"my-acme":     appErrors.InvalidInput,
+		"a":           appErrors.InvalidInput,
+		"has space":   appErrors.InvalidInput,
+		"taken-alias": appErrors.Conflict,
+	} {
+		mockRepo.On("IsShortCodeExists", ctx, "taken-alias").Return(true).Maybe()
+
+		_, err := service.ShortenURL(ctx, "http://example.com", alias, "")
+
+		var appErr *appErrors.AppError
+		assert.True(t, errors.As(err, &appErr), alias)
+		assert.Equal(t, wantType, appErr.Type, alias)
+	}
+
+	mockRepo.On("IsShortCodeExists", ctx, "launch-2026").Return(false)
+	mockRepo.On("Create", ctx, mock.MatchedBy(func(url *model.URL) bool {
+		return url.ShortCode == "launch-2026"
+	})).Return(&model.URLInterpeter{ID: 3}, nil)
+
+	result, err := service.ShortenURL(ctx, "http://example.com", "launch-2026", "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "launch-2026", result.ShortUrl)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetReservedConflicts(t *testing.T) {
+
+	cfg := testCfg()
+	mockRepo := new(repository.MockURLRepository)
+	blocklist := NewBlocklistService(new(repository.MockBlocklistRepository), cfg)
+	service := newTestServiceWith(cfg, mockRepo, blocklist, NewShortenerResolver(cfg), newTestReservedWords(t))
+	ctx := context.Background()
+
+	mockRepo.On("FindShortCodeConflicts", ctx,
+		[]string{"broken", "health", "shorten", "stat", "temp"},
+		[]string{"acme", "badword"},
+	).Return([]*model.URL{
+		{ID: 4, ShortCode: "Health", OriginalURL: "http://example.com"},
+		{ID: 9, ShortCode: "acme01", OriginalURL: "http://example.org"},
+	}, nil).Once()
+
+	result, err := service.GetReservedConflicts(ctx)
+
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "health", result[0].Reserved)
+	assert.Equal(t, "acme", result[1].Reserved)
+
+	mockRepo.On("FindShortCodeConflicts", ctx, mock.Anything, mock.Anything).
+		Return(nil, errors.New("database error"))
+
+	_, err = service.GetReservedConflicts(ctx)
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+
+	mockRepo.AssertExpectations(t)
+}
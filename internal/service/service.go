@@ -2,11 +2,12 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"shorten-url/configs"
@@ -14,59 +15,142 @@ import (
 	appErrors "shorten-url/internal/errors"
 	"shorten-url/internal/model"
 	"shorten-url/internal/repository"
+	"shorten-url/pkg/blobstore"
+	"shorten-url/pkg/lru"
+	pkgUtils "shorten-url/pkg/utils"
 	"shorten-url/utils"
 	"strconv"
+)
 
-	qrcode "github.com/skip2/go-qrcode"
+const (
+	shortCodeLength      = 6
+	maxShortCodeAttempts = 10
+	maxCampaignLength    = 64
 )
 
 type URLService interface {
-	ShortenURL(pctx context.Context, originalURL string) (*entities.CreateShortenUrlRes, error)
-	CreateQrCode(pctx context.Context, shortCode string) (*entities.CreateQrCodeRes, error)
-	GetOriginalURL(pctx context.Context, shortCode string) (string, error)
+	ShortenURL(pctx context.Context, originalURL string, customAlias string, campaign string) (*entities.CreateShortenUrlRes, error)
+	GetQrCode(pctx context.Context, shortCode string, req *entities.QrCodeReq) (*entities.QrCodeRes, error)
+	GetQrCodeImage(pctx context.Context, shortCode string, req *entities.QrCodeReq, ifNoneMatch string) (*entities.QrCodeImageRes, error)
+	GetOriginalURL(pctx context.Context, shortCode string, click *entities.ClickInfo) (string, error)
+	ResolveQrCode(pctx context.Context, scanCode string, click *entities.ClickInfo) (string, error)
+	RetargetQrCode(pctx context.Context, scanCode string, req *entities.RetargetQrCodeReq) (*entities.QrCodeRes, error)
+	WriteQrCodeSheet(pctx context.Context, req *entities.QrCodeSheetReq, w io.Writer) error
+	DecodeQrCodes(pctx context.Context, upload []byte) (*entities.QrCodeDecodeRes, error)
 	RetrieveOriginalURL(pctx context.Context, shortCode string) (*entities.RetriveOriginalUrlRes, error)
 	UpdateShortUrl(pctx context.Context, shortCode string, updatedUrl string) (*model.URL, error)
 	DeleteShortUrl(pctx context.Context, shortCode string) error
-	GetUrlStatic(pctx context.Context, shortCode string) (*entities.UrlStaticRes, error)
+	GetBrokenLinks(pctx context.Context) ([]*entities.BrokenLinkRes, error)
+	GetReservedConflicts(pctx context.Context) ([]*entities.ReservedConflictRes, error)
+	SaveWorkspaceLogo(pctx context.Context, workspace string, upload []byte) (*entities.WorkspaceLogoRes, error)
+	DeleteWorkspaceLogo(pctx context.Context, workspace string) error
 }
 
 type urlService struct {
-	repo repository.URLRepository
-	cfg  *configs.Config
+	repo      repository.URLRepository
+	blocklist BlocklistService
+	resolver  ShortenerResolver
+	reserved  ReservedWords
+	clicks    ClickRecorder
+	webhooks  WebhookService
+	blobs     blobstore.BlobStore
+	cfg       *configs.Config
+	ownHosts  map[string]struct{}
+	qrImages  *lru.Cache[string, []byte]
 }
 
-func NewURLService(repo repository.URLRepository, cfg *configs.Config) URLService {
+func NewURLService(
+	repo repository.URLRepository,
+	blocklist BlocklistService,
+	resolver ShortenerResolver,
+	reserved ReservedWords,
+	clicks ClickRecorder,
+	webhooks WebhookService,
+	blobs blobstore.BlobStore,
+	cfg *configs.Config,
+) URLService {
+
+	ownHosts := make(map[string]struct{})
+	if baseURL, err := url.Parse(cfg.Server.BaseURL); err == nil && baseURL.Hostname() != "" {
+		ownHosts[strings.ToLower(baseURL.Hostname())] = struct{}{}
+	}
+	for _, alias := range cfg.Server.AliasDomains {
+		ownHosts[strings.ToLower(strings.TrimSpace(alias))] = struct{}{}
+	}
+
+	// Without a cache every image request draws the code again
+	var qrImages *lru.Cache[string, []byte]
+	if cfg.QrCode.CacheEntries > 0 {
+		qrImages = lru.New[string, []byte](cfg.QrCode.CacheEntries, int64(cfg.QrCode.CacheMaxBytes), func(image []byte) int64 {
+			return int64(len(image))
+		})
+	}
 
 	return &urlService{
-		repo: repo,
-		cfg:  cfg,
+		repo:      repo,
+		blocklist: blocklist,
+		resolver:  resolver,
+		reserved:  reserved,
+		clicks:    clicks,
+		webhooks:  webhooks,
+		blobs:     blobs,
+		cfg:       cfg,
+		ownHosts:  ownHosts,
+		qrImages:  qrImages,
 	}
 }
 
-func (s *urlService) GetOriginalURL(pctx context.Context, shortCode string) (string, error) {
+func (s *urlService) GetOriginalURL(pctx context.Context, shortCode string, click *entities.ClickInfo) (string, error) {
 
 	url, err := s.repo.GetByShortCode(pctx, shortCode)
 	if err != nil {
+		redirectsTotal.Inc(RedirectMiss)
 		return "", appErrors.NewNotFoundError("short url was not found")
 	}
 
-	if err := s.repo.UpdateShortUrlCount(pctx, shortCode); err != nil {
-		return "", appErrors.NewInternalError("failed to update click count", err)
+	return s.follow(pctx, url, click)
+}
+
+// follow checks a link's destination against the blocklist and records the click
+func (s *urlService) follow(pctx context.Context, url *model.URL, click *entities.ClickInfo) (string, error) {
+
+	if rule := s.blocklist.Blocked(url.OriginalURL); rule != nil {
+		redirectsTotal.Inc(RedirectBlocked)
+		log.Printf("Refusing redirect for %s, destination matches %s rule %q", url.ShortCode, rule.Kind, rule.Pattern)
+		return "", appErrors.NewForbiddenError("short url has been disabled")
 	}
 
+	redirectsTotal.Inc(RedirectHit)
+
+	// Counting happens off the redirect path; a full click queue never fails the redirect
+	s.clicks.Record(pctx, url, click)
+
 	return url.OriginalURL, nil
 }
 
 func (s *urlService) DeleteShortUrl(pctx context.Context, shortCode string) error {
 
-	if !s.repo.IsShortCodeExists(pctx, shortCode) {
+	url, err := s.repo.GetByShortCode(pctx, shortCode)
+	if err != nil {
 		return appErrors.NewNotFoundError("short url was not found")
 	}
 
+	// The code is removed with the link, so its stored image is looked up first
+	qr, err := s.repo.GetQrCode(pctx, url.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error: failed to find qr code for %s %s", shortCode, err.Error())
+	}
+
 	if err := s.repo.DeleteByShortCode(pctx, shortCode); err != nil {
 		return appErrors.NewInternalError("failed to delete short url", err)
 	}
 
+	if qr != nil {
+		s.removeQrCodeImage(pctx, qr)
+	}
+
+	s.webhooks.Emit(pctx, model.WebhookEventLinkDeleted, url, nil)
+
 	return nil
 }
 
@@ -89,115 +173,301 @@ func (s *urlService) RetrieveOriginalURL(pctx context.Context, shortCode string)
 
 func (s *urlService) UpdateShortUrl(pctx context.Context, shortCode string, updatedUrl string) (*model.URL, error) {
 
-	url, err := s.repo.UpdateShortUrl(pctx, shortCode, updatedUrl)
+	destination, err := s.validateDestination(pctx, updatedUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := s.repo.UpdateShortUrl(pctx, shortCode, destination)
 	if err != nil {
 		log.Printf("Error: failed to update short url %s", err.Error())
 		return nil, appErrors.NewInternalError("failed to update short url", err)
 	}
 
+	s.webhooks.Emit(pctx, model.WebhookEventLinkUpdated, url, nil)
+
 	return url, nil
 
 }
 
-func (s *urlService) ShortenURL(pctx context.Context, originalURL string) (*entities.CreateShortenUrlRes, error) {
+func (s *urlService) ShortenURL(pctx context.Context, originalURL string, customAlias string, campaign string) (*entities.CreateShortenUrlRes, error) {
 
-	newUrl := utils.RandString(6)
+	campaign = strings.TrimSpace(campaign)
+	if len(campaign) > maxCampaignLength {
+		return nil, appErrors.NewInvalidInputError(fmt.Sprintf("campaign must be at most %d characters", maxCampaignLength))
+	}
+
+	destination, err := s.validateDestination(pctx, originalURL)
+	if err != nil {
+		return nil, err
+	}
+
+	newUrl, err := s.newShortCode(pctx, strings.TrimSpace(customAlias))
+	if err != nil {
+		return nil, err
+	}
 
 	shortenInterpreter, err := s.repo.Create(pctx, &model.URL{
 		ShortCode:   newUrl,
-		OriginalURL: originalURL,
+		OriginalURL: destination,
+		Campaign:    campaign,
 	})
 	if err != nil {
 		log.Printf("Error: failed to creat shorten url %s", err.Error())
 		return nil, appErrors.NewInternalError("failed to created shorten url", err)
 	}
 
+	s.webhooks.Emit(pctx, model.WebhookEventLinkCreated, &model.URL{
+		ID:          shortenInterpreter.ID,
+		ShortCode:   newUrl,
+		OriginalURL: destination,
+		Campaign:    campaign,
+		CreatedAt:   shortenInterpreter.CreatedAt,
+		UpdatedAt:   shortenInterpreter.UpdatedAt,
+	}, nil)
+
 	return &entities.CreateShortenUrlRes{
 		Id:          strconv.Itoa(int(shortenInterpreter.ID)),
 		ShortUrl:    newUrl,
-		OriginalURL: originalURL,
+		OriginalURL: destination,
+		Campaign:    campaign,
 		CreatedAt:   shortenInterpreter.CreatedAt,
 		UpdatedAt:   shortenInterpreter.UpdatedAt,
 	}, nil
 }
 
-func (s *urlService) CreateQrCode(pctx context.Context, originalURL string) (*entities.CreateQrCodeRes, error) {
+// newShortCode validates a custom alias, or generates a random code that is neither reserved nor taken
+func (s *urlService) newShortCode(pctx context.Context, customAlias string) (string, error) {
+
+	if customAlias != "" {
+		if !pkgUtils.IsValidShortCode(customAlias) {
+			return "", appErrors.NewInvalidInputError("custom alias must be 3-20 letters, digits or dashes")
+		}
+		if _, reserved := s.reserved.Match(customAlias); reserved {
+			return "", appErrors.NewInvalidInputError("custom alias is reserved")
+		}
+		if s.repo.IsShortCodeExists(pctx, customAlias) {
+			shortCodeCollisions.Inc(collisionAlias)
+			return "", appErrors.NewConflictError("custom alias is already taken")
+		}
+		return customAlias, nil
+	}
 
-	if strings.TrimSpace(originalURL) == "" {
-		return nil, appErrors.NewInvalidInputError("original url is required")
+	for attempt := 0; attempt < maxShortCodeAttempts; attempt++ {
+		code := utils.RandString(shortCodeLength)
+		if _, reserved := s.reserved.Match(code); reserved {
+			continue
+		}
+		if s.repo.IsShortCodeExists(pctx, code) {
+			shortCodeCollisions.Inc(collisionGenerated)
+			continue
+		}
+		return code, nil
 	}
 
-	// existingURL, err := s.repo.GetByShortCode(pctx, originalURL)
-	// if err != nil {
-	// 	log.Printf("Error: failed to find short url for qr code %s", err.Error())
-	// 	return nil, appErrors.NewNotFoundError("short url was not found")
-	// }
+	return "", appErrors.NewInternalError("failed to generate short code", nil)
+}
+
+// validateDestination runs the create and update checks and returns the url that should be stored
+func (s *urlService) validateDestination(pctx context.Context, rawURL string) (string, error) {
+
+	rawURL = strings.TrimSpace(rawURL)
 
-	if err := os.MkdirAll("temp", 0o755); err != nil {
-		log.Printf("Error: failed to create temp directory %s", err.Error())
-		return nil, appErrors.NewInternalError("failed to prepare qrcode directory", err)
+	if err := s.checkDestination(rawURL); err != nil {
+		return "", err
 	}
 
-	targetURL, err := url.JoinPath(s.cfg.Server.BaseURL, originalURL)
+	destination, err := s.resolver.Resolve(pctx, rawURL)
 	if err != nil {
-		log.Printf("Error: failed to build qrcode target url %s", err.Error())
-		return nil, appErrors.NewInternalError("failed to build qrcode url", err)
+		log.Printf("Error: failed to resolve destination %s %s", rawURL, err.Error())
+		return "", appErrors.NewInvalidInputError(err.Error())
 	}
 
-	png, err := qrcode.Encode(targetURL, qrcode.Medium, 256)
-	if err != nil {
-		log.Printf("Error: failed to encode qr code %s", err.Error())
-		return nil, appErrors.NewInternalError("failed to create qrcode", err)
+	if destination != rawURL {
+		if err := s.checkDestination(destination); err != nil {
+			return "", err
+		}
 	}
 
-	fileName := fmt.Sprintf("qrcode_%s.png", utils.RandString(6))
-	filePath := filepath.Join("temp", fileName)
+	return destination, nil
+}
+
+// checkDestination rejects blocked urls and urls that point back at one of our own hosts
+func (s *urlService) checkDestination(rawURL string) error {
 
-	if err := os.WriteFile(filePath, png, 0o644); err != nil {
-		log.Printf("Error: failed to save qr code file %s", err.Error())
-		return nil, appErrors.NewInternalError("failed to save qrcode image", err)
+	if err := s.blocklist.Check(rawURL); err != nil {
+		return err
 	}
 
-	publicImageURL, err := url.JoinPath(s.cfg.Server.BaseURL, "temp", fileName)
+	target, _ := url.Parse(rawURL)
+	host := strings.TrimSuffix(strings.ToLower(target.Hostname()), ".")
+	if _, ok := s.ownHosts[host]; ok {
+		return appErrors.NewInvalidInputError("destination cannot point at this url shortener")
+	}
+
+	return nil
+}
+
+// GetQrCode describes a link's QR code and where its image is served. The image is drawn here as well, which
+// refuses options that no longer scan before their URL is handed out and warms the cache for the download.
+func (s *urlService) GetQrCode(pctx context.Context, shortCode string, req *entities.QrCodeReq) (*entities.QrCodeRes, error) {
+
+	qr, err := s.prepareQrCode(pctx, shortCode, req)
 	if err != nil {
-		log.Printf("Error: failed to build public qrcode url %s", err.Error())
-		return nil, appErrors.NewInternalError("failed to build public qrcode url", err)
+		return nil, err
 	}
 
-	// existingURL.QrCodeUrl = publicImageURL
-	req := &model.Qrcode{
-		OriginalURL: originalURL,
-		QrCodeUrl:   publicImageURL,
+	if _, err := s.qrCodeImage(pctx, qr); err != nil {
+		return nil, err
 	}
 
-	qrcodeRes, err := s.repo.CreateQrCode(pctx, req)
+	return s.toQrCodeRes(qr.link, qr.stored, qr.opts)
+}
+
+// ResolveQrCode follows a scanned code to the link that currently owns it; the scan counts as a click with source qr
+func (s *urlService) ResolveQrCode(pctx context.Context, scanCode string, click *entities.ClickInfo) (string, error) {
+
+	url, err := s.repo.GetURLByScanCode(pctx, scanCode)
 	if err != nil {
-		log.Printf("Error: failed to save qrcode url %s", err.Error())
-		return nil, appErrors.NewInternalError("failed to save qrcode url", err)
+		redirectsTotal.Inc(RedirectMiss)
+		return "", appErrors.NewNotFoundError("qr code was not found")
 	}
 
-	return &entities.CreateQrCodeRes{
-		Id:          strconv.Itoa(int(qrcodeRes.ID)),
-		OriginalURL: req.OriginalURL,
-		QrCodeURL:   req.QrCodeUrl,
-		CreatedAt:   qrcodeRes.CreatedAt,
-		UpdatedAt:   qrcodeRes.UpdatedAt,
-	}, nil
+	if click == nil {
+		click = new(entities.ClickInfo)
+	}
+	click.Source = model.ClickSourceQR
+
+	return s.follow(pctx, url, click)
 }
 
-func (s *urlService) GetUrlStatic(pctx context.Context, shortCode string) (*entities.UrlStaticRes, error) {
+// RetargetQrCode moves a printed code to another link, which must not have a code of its own yet.
+// The code keeps its scan URL, so its image and printed copies are unchanged.
+func (s *urlService) RetargetQrCode(pctx context.Context, scanCode string, req *entities.RetargetQrCodeReq) (*entities.QrCodeRes, error) {
 
-	url, err := s.repo.GetByShortCode(pctx, shortCode)
+	if req == nil || req.ShortCode == "" {
+		return nil, appErrors.NewInvalidInputError("short_code is required")
+	}
+
+	link, err := s.repo.GetByShortCode(pctx, req.ShortCode)
 	if err != nil {
 		return nil, appErrors.NewNotFoundError("short url was not found")
 	}
 
-	return &entities.UrlStaticRes{
-		Id:          strconv.Itoa(int(url.ID)),
-		Url:         url.OriginalURL,
-		ShortCode:   url.ShortCode,
-		CreatedAt:   url.CreatedAt,
-		UpdatedAt:   url.UpdatedAt,
-		AccessCount: url.ClickCount,
+	existing, err := s.repo.GetQrCode(pctx, link.ID)
+	switch {
+	case err == nil:
+		if existing.ScanCode == scanCode {
+			return s.toQrCodeRes(link, existing, defaultQrCodeOptions)
+		}
+		return nil, appErrors.NewConflictError("short url already has a qr code")
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Printf("Error: failed to find qr code for %s %s", link.ShortCode, err.Error())
+		return nil, appErrors.NewInternalError("failed to find qrcode", err)
+	}
+
+	moved, err := s.repo.RetargetQrCode(pctx, &model.Qrcode{
+		ScanCode:  scanCode,
+		URLID:     link.ID,
+		QrCodeUrl: s.qrCodeImageURL(link.ShortCode, defaultQrCodeOptions),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, appErrors.NewNotFoundError("qr code was not found")
+	}
+	if err != nil {
+		log.Printf("Error: failed to retarget qr code %s %s", scanCode, err.Error())
+		return nil, appErrors.NewInternalError("failed to retarget qrcode", err)
+	}
+
+	return s.toQrCodeRes(link, moved, defaultQrCodeOptions)
+}
+
+// readBlob reads a whole blob; only small ones such as logos and QR images are read this way
+func (s *urlService) readBlob(pctx context.Context, key string) ([]byte, error) {
+
+	object, err := s.blobs.Get(pctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return io.ReadAll(object)
+}
+
+func (s *urlService) toQrCodeRes(link *model.URL, qr *model.Qrcode, opts qrCodeOptions) (*entities.QrCodeRes, error) {
+
+	shortURL, err := url.JoinPath(s.cfg.Server.BaseURL, link.ShortCode)
+	if err != nil {
+		log.Printf("Error: failed to build short url %s", err.Error())
+		return nil, appErrors.NewInternalError("failed to build short url", err)
+	}
+
+	return &entities.QrCodeRes{
+		Id:          strconv.Itoa(int(qr.ID)),
+		ShortCode:   link.ShortCode,
+		ShortUrl:    shortURL,
+		OriginalURL: link.OriginalURL,
+		QrCodeURL:   s.qrCodeImageURL(link.ShortCode, opts),
+		ScanCode:    qr.ScanCode,
+		ScanURL:     qr.OriginalURL,
+		Scans:       qr.ClickCount,
+		Format:      opts.format,
+		CreatedAt:   qr.CreatedAt,
+		UpdatedAt:   qr.UpdatedAt,
 	}, nil
 }
+
+func (s *urlService) GetBrokenLinks(pctx context.Context) ([]*entities.BrokenLinkRes, error) {
+
+	brokenUrls, err := s.repo.ListBrokenURLs(pctx)
+	if err != nil {
+		log.Printf("Error: failed to list broken links %s", err.Error())
+		return nil, appErrors.NewInternalError("failed to list broken links", err)
+	}
+
+	res := make([]*entities.BrokenLinkRes, 0, len(brokenUrls))
+	for _, brokenUrl := range brokenUrls {
+		res = append(res, &entities.BrokenLinkRes{
+			Id:          strconv.Itoa(int(brokenUrl.ID)),
+			ShortCode:   brokenUrl.ShortCode,
+			OriginalURL: brokenUrl.OriginalURL,
+			Health:      toLinkHealthRes(&brokenUrl.Health),
+		})
+	}
+
+	return res, nil
+}
+
+func toLinkHealthRes(health *model.URLHealth) *entities.LinkHealthRes {
+	return &entities.LinkHealthRes{
+		StatusCode:          health.StatusCode,
+		LatencyMs:           health.LatencyMs,
+		FinalURL:            health.FinalURL,
+		LastError:           health.LastError,
+		ConsecutiveFailures: health.ConsecutiveFailures,
+		IsBroken:            health.IsBroken,
+		LastCheckedAt:       health.LastCheckedAt,
+	}
+}
+
+func (s *urlService) GetReservedConflicts(pctx context.Context) ([]*entities.ReservedConflictRes, error) {
+
+	urls, err := s.repo.FindShortCodeConflicts(pctx, s.reserved.Exact(), s.reserved.Terms())
+	if err != nil {
+		log.Printf("Error: failed to find reserved short code conflicts %s", err.Error())
+		return nil, appErrors.NewInternalError("failed to find reserved short code conflicts", err)
+	}
+
+	res := make([]*entities.ReservedConflictRes, 0, len(urls))
+	for _, url := range urls {
+		word, _ := s.reserved.Match(url.ShortCode)
+		res = append(res, &entities.ReservedConflictRes{
+			Id:          strconv.Itoa(int(url.ID)),
+			ShortCode:   url.ShortCode,
+			OriginalURL: url.OriginalURL,
+			Reserved:    word,
+		})
+	}
+
+	return res, nil
+}
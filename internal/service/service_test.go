@@ -2,7 +2,9 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,6 +13,8 @@ import (
 	appErrors "shorten-url/internal/errors"
 	"shorten-url/internal/model"
 	"shorten-url/internal/repository"
+	"shorten-url/pkg/blobstore"
+	"shorten-url/pkg/hll"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -21,18 +25,59 @@ func testCfg() *configs.Config {
 		Server: configs.ServerConfig{
 			BaseURL: "http://localhost:8080",
 		},
+		QrCode: configs.QrCodeConfig{
+			LogoMaxBytes:     1 << 20,
+			LogoMaxDimension: 1024,
+			LogoMaxArea:      15,
+			CacheEntries:     16,
+			CacheMaxBytes:    1 << 20,
+			SheetMaxCodes:    40,
+			DecodeMaxBytes:   1 << 20,
+			DecodeMaxPixels:  1_000_000,
+		},
+		BlobStore: configs.BlobStoreConfig{
+			URLExpiry: time.Minute * 15,
+		},
 	}
 }
 
+func newTestService(repo *repository.MockURLRepository) URLService {
+	return newTestServiceWithRecorder(repo, NewClickRecorder(new(repository.MockClickRepository), NewBotClassifier(testCfg()), NewClickHub(testCfg()), newTestWebhooks(testCfg()), newTestSalts(testCfg()), testCfg()))
+}
+
+func newTestServiceWithRecorder(repo *repository.MockURLRepository, recorder ClickRecorder) URLService {
+	cfg := testCfg()
+	return NewURLService(
+		repo,
+		NewBlocklistService(new(repository.MockBlocklistRepository), cfg),
+		NewShortenerResolver(cfg),
+		NewReservedWords(cfg),
+		recorder,
+		newTestWebhooks(cfg),
+		newTestBlobs(),
+		cfg,
+	)
+}
+
+func newTestBlobs() blobstore.BlobStore {
+	return blobstore.NewMemoryStore(blobstore.NewURLSigner("http://localhost:8080/blobs", []byte("test")))
+}
+
+// newTestServiceWith builds a service around custom validation components
+func newTestServiceWith(cfg *configs.Config, repo *repository.MockURLRepository, blocklist BlocklistService, resolver ShortenerResolver, reserved ReservedWords) URLService {
+	return NewURLService(repo, blocklist, resolver, reserved, NewClickRecorder(new(repository.MockClickRepository), NewBotClassifier(cfg), NewClickHub(cfg), newTestWebhooks(cfg), newTestSalts(cfg), cfg), newTestWebhooks(cfg), newTestBlobs(), cfg)
+}
+
 func TestShortenURL_Success(t *testing.T) {
 
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
 	originalUrl := "http://example.com"
 	now := time.Now()
 
+	mockRepo.On("IsShortCodeExists", ctx, mock.AnythingOfType("string")).Return(false)
 	mockRepo.On("Create", ctx, mock.MatchedBy(func(url *model.URL) bool {
 		return url.OriginalURL == originalUrl && len(url.ShortCode) == 6
 	})).Return(&model.URLInterpeter{
@@ -41,7 +86,7 @@ func TestShortenURL_Success(t *testing.T) {
 		UpdatedAt: now,
 	}, nil)
 
-	result, err := service.ShortenURL(ctx, originalUrl)
+	result, err := service.ShortenURL(ctx, originalUrl, "", "")
 
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
@@ -54,18 +99,59 @@ func TestShortenURL_Success(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestShortenURL_RetriesTakenGeneratedCode(t *testing.T) {
+
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	mockRepo.On("IsShortCodeExists", ctx, mock.AnythingOfType("string")).Return(true).Once()
+	mockRepo.On("IsShortCodeExists", ctx, mock.AnythingOfType("string")).Return(false).Once()
+	mockRepo.On("Create", ctx, mock.AnythingOfType("*model.URL")).Return(&model.URLInterpeter{ID: 1}, nil)
+
+	result, err := service.ShortenURL(ctx, "http://example.com", "", "")
+
+	assert.NoError(t, err)
+	assert.Len(t, result.ShortUrl, shortCodeLength)
+	mockRepo.AssertNumberOfCalls(t, "IsShortCodeExists", 2)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestShortenURL_Campaign(t *testing.T) {
+
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	mockRepo.On("IsShortCodeExists", ctx, mock.AnythingOfType("string")).Return(false)
+	mockRepo.On("Create", ctx, mock.MatchedBy(func(url *model.URL) bool {
+		return url.Campaign == "expo-2026"
+	})).Return(&model.URLInterpeter{ID: 1}, nil)
+
+	result, err := service.ShortenURL(ctx, "http://example.com", "", " expo-2026 ")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "expo-2026", result.Campaign)
+
+	_, err = service.ShortenURL(ctx, "http://example.com", "", strings.Repeat("x", maxCampaignLength+1))
+	assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+
+	mockRepo.AssertNumberOfCalls(t, "Create", 1)
+}
+
 func TestShortenURL_Error(t *testing.T) {
 
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
 	originalUrl := "http://example.com"
 
+	mockRepo.On("IsShortCodeExists", ctx, mock.AnythingOfType("string")).Return(false)
 	mockRepo.On("Create", ctx, mock.AnythingOfType("*model.URL")).
 		Return(nil, errors.New("database error"))
 
-	result, err := service.ShortenURL(ctx, originalUrl)
+	result, err := service.ShortenURL(ctx, originalUrl, "", "")
 
 	assert.Error(t, err)
 	assert.Nil(t, result)
@@ -77,7 +163,9 @@ func TestShortenURL_Error(t *testing.T) {
 func TestGetOriginalURL_Success(t *testing.T) {
 
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	mockClickRepo := new(repository.MockClickRepository)
+	recorder := newTestClickRecorder(mockClickRepo)
+	service := newTestServiceWithRecorder(mockRepo, recorder)
 	ctx := context.Background()
 
 	shortCode := "abc123"
@@ -87,74 +175,125 @@ func TestGetOriginalURL_Success(t *testing.T) {
 		OriginalURL: "http://example.com",
 		ClickCount:  5,
 	}
+	click := &entities.ClickInfo{
+		Referrer:  "https://news.example/post",
+		UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148",
+		IP:        "203.0.113.7",
+		Country:   "th",
+	}
 
 	mockRepo.On("GetByShortCode", ctx, shortCode).
 		Return(expectedURL, nil)
-	mockRepo.On("UpdateShortUrlCount", ctx, shortCode).
-		Return(nil)
-
-	result, err := service.GetOriginalURL(ctx, shortCode)
+	mockClickRepo.On("InsertClickEvents", mock.Anything, mock.MatchedBy(func(events []*model.ClickEvent) bool {
+		event := events[0]
+		return len(events) == 1 &&
+			event.URLID == 1 &&
+			event.Referrer == click.Referrer &&
+			event.ReferrerHost == "news.example" &&
+			event.Country == "TH" &&
+			event.Device == "mobile" &&
+			event.OS == "iOS" &&
+			!event.IsBot &&
+			event.Source == model.ClickSourceDirect &&
+			len(event.IPHash) == 64 &&
+			!event.ClickedAt.IsZero()
+	})).Return(nil)
+	mockClickRepo.On("AddClickCounts", mock.Anything, map[uint]int{1: 1}).
+		Return([]*model.URL{}, nil)
+	mockClickRepo.On("MergeVisitorSketch", mock.Anything, uint(1), mock.AnythingOfType("time.Time"), mock.MatchedBy(func(sketch *hll.Sketch) bool {
+		return sketch.Count() == 1
+	})).Return(errors.New("sketch error"))
+
+	result, err := service.GetOriginalURL(ctx, shortCode, click)
 
 	assert.NoError(t, err)
 	assert.Equal(t, expectedURL.OriginalURL, result)
+	assert.NoError(t, recorder.Close(ctx))
 
 	mockRepo.AssertExpectations(t)
+	mockClickRepo.AssertExpectations(t)
 }
 
-func TestGetOriginalURL_NotFound(t *testing.T) {
+func TestGetOriginalURL_BotClickSkipsCounter(t *testing.T) {
 
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	mockClickRepo := new(repository.MockClickRepository)
+	recorder := newTestClickRecorder(mockClickRepo)
+	service := newTestServiceWithRecorder(mockRepo, recorder)
 	ctx := context.Background()
 
-	shortCode := "notfound"
+	shortCode := "abc123"
+	click := &entities.ClickInfo{
+		UserAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		IP:        "203.0.113.7",
+		Method:    "GET",
+	}
 
 	mockRepo.On("GetByShortCode", ctx, shortCode).
-		Return(nil, errors.New("not found"))
+		Return(&model.URL{ID: 1, ShortCode: shortCode, OriginalURL: "http://example.com"}, nil)
+	mockClickRepo.On("InsertClickEvents", mock.Anything, mock.MatchedBy(func(events []*model.ClickEvent) bool {
+		return len(events) == 1 && events[0].IsBot && events[0].Device == "bot"
+	})).Return(nil)
 
-	result, err := service.GetOriginalURL(ctx, shortCode)
+	result, err := service.GetOriginalURL(ctx, shortCode, click)
 
-	assert.Error(t, err)
-	assert.Empty(t, result)
-	assert.IsType(t, &appErrors.AppError{}, err)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", result)
+	assert.NoError(t, recorder.Close(ctx))
 
-	appErr := err.(*appErrors.AppError)
-	assert.Equal(t, appErrors.NotFound, appErr.Type)
+	mockClickRepo.AssertNotCalled(t, "AddClickCounts", mock.Anything, mock.Anything)
+	mockClickRepo.AssertNotCalled(t, "MergeVisitorSketch", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockClickRepo.AssertExpectations(t)
+}
+
+func TestGetOriginalURL_FullQueueStillRedirects(t *testing.T) {
+
+	mockRepo := new(repository.MockURLRepository)
+	recorder := NewClickRecorder(new(repository.MockClickRepository), NewBotClassifier(testCfg()), NewClickHub(testCfg()), newTestWebhooks(testCfg()), newTestSalts(testCfg()), testCfg())
+	service := newTestServiceWithRecorder(mockRepo, recorder)
+	ctx := context.Background()
+
+	shortCode := "abc123"
+
+	mockRepo.On("GetByShortCode", ctx, shortCode).
+		Return(&model.URL{ID: 1, ShortCode: shortCode, OriginalURL: "http://example.com"}, nil)
+
+	result, err := service.GetOriginalURL(ctx, shortCode, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", result)
+	assert.Equal(t, uint64(1), recorder.Stats().Dropped)
 
 	mockRepo.AssertExpectations(t)
 }
 
-func TestGetOriginalURL_UpdateCountError(t *testing.T) {
+func TestGetOriginalURL_NotFound(t *testing.T) {
 
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
-	shortCode := "abc123"
-	expectedURL := &model.URL{
-		ID:          1,
-		ShortCode:   shortCode,
-		OriginalURL: "http://example.com",
-	}
+	shortCode := "notfound"
 
 	mockRepo.On("GetByShortCode", ctx, shortCode).
-		Return(expectedURL, nil)
-	mockRepo.On("UpdateShortUrlCount", ctx, shortCode).
-		Return(errors.New("update error"))
+		Return(nil, errors.New("not found"))
 
-	result, err := service.GetOriginalURL(ctx, shortCode)
+	result, err := service.GetOriginalURL(ctx, shortCode, nil)
 
 	assert.Error(t, err)
 	assert.Empty(t, result)
 	assert.IsType(t, &appErrors.AppError{}, err)
 
+	appErr := err.(*appErrors.AppError)
+	assert.Equal(t, appErrors.NotFound, appErr.Type)
+
 	mockRepo.AssertExpectations(t)
 }
 
 func TestRetrieveOriginalURL_Success(t *testing.T) {
 
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
 	shortCode := "abc123"
@@ -187,7 +326,7 @@ func TestRetrieveOriginalURL_Success(t *testing.T) {
 func TestRetrieveOriginalURL_NotFound(t *testing.T) {
 
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
 	shortCode := "notfound"
@@ -207,7 +346,7 @@ func TestRetrieveOriginalURL_NotFound(t *testing.T) {
 func TestUpdateShortUrl_Success(t *testing.T) {
 
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
 	shortCode := "abc123"
@@ -236,7 +375,7 @@ func TestUpdateShortUrl_Success(t *testing.T) {
 func TestUpdateShortUrl_NotFound(t *testing.T) {
 
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
 	shortCode := "notfound"
@@ -257,13 +396,15 @@ func TestUpdateShortUrl_NotFound(t *testing.T) {
 func TestDeleteShortUrl_Success(t *testing.T) {
 
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
 	shortCode := "abc123"
 
-	mockRepo.On("IsShortCodeExists", ctx, shortCode).
-		Return(true)
+	mockRepo.On("GetByShortCode", ctx, shortCode).
+		Return(&model.URL{ID: 1, ShortCode: shortCode}, nil)
+	mockRepo.On("GetQrCode", ctx, uint(1)).
+		Return(nil, sql.ErrNoRows)
 	mockRepo.On("DeleteByShortCode", ctx, shortCode).
 		Return(nil)
 
@@ -277,13 +418,13 @@ func TestDeleteShortUrl_Success(t *testing.T) {
 func TestDeleteShortUrl_NotFound(t *testing.T) {
 
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
 	shortCode := "notfound"
 
-	mockRepo.On("IsShortCodeExists", ctx, shortCode).
-		Return(false)
+	mockRepo.On("GetByShortCode", ctx, shortCode).
+		Return(nil, errors.New("not found"))
 
 	err := service.DeleteShortUrl(ctx, shortCode)
 
@@ -298,13 +439,15 @@ func TestDeleteShortUrl_NotFound(t *testing.T) {
 
 func TestDeleteShortUrl_DeleteError(t *testing.T) {
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
 	shortCode := "abc123"
 
-	mockRepo.On("IsShortCodeExists", ctx, shortCode).
-		Return(true)
+	mockRepo.On("GetByShortCode", ctx, shortCode).
+		Return(&model.URL{ID: 1, ShortCode: shortCode}, nil)
+	mockRepo.On("GetQrCode", ctx, uint(1)).
+		Return(nil, sql.ErrNoRows)
 	mockRepo.On("DeleteByShortCode", ctx, shortCode).
 		Return(errors.New("delete failed"))
 
@@ -316,114 +459,170 @@ func TestDeleteShortUrl_DeleteError(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
-func TestGetUrlStatic_Success(t *testing.T) {
+func TestGetBrokenLinks_Success(t *testing.T) {
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
-	shortCode := "abc123"
-	now := time.Now()
-	expectedURL := &model.URL{
-		ID:          1,
-		ShortCode:   shortCode,
-		OriginalURL: "http://example.com",
-		ClickCount:  15,
-		CreatedAt:   now,
-		UpdatedAt:   now,
-	}
-
-	mockRepo.On("GetByShortCode", ctx, shortCode).
-		Return(expectedURL, nil)
+	mockRepo.On("ListBrokenURLs", ctx).
+		Return([]*model.BrokenURL{
+			{
+				URL:    model.URL{ID: 7, ShortCode: "gone12", OriginalURL: "http://gone.example.com"},
+				Health: model.URLHealth{URLID: 7, StatusCode: 410, IsBroken: true, ConsecutiveFailures: 4},
+			},
+		}, nil)
 
-	result, err := service.GetUrlStatic(ctx, shortCode)
+	result, err := service.GetBrokenLinks(ctx)
 
 	assert.NoError(t, err)
-	assert.NotNil(t, result)
-	assert.Equal(t, "1", result.Id)
-	assert.Equal(t, expectedURL.OriginalURL, result.Url)
-	assert.Equal(t, expectedURL.ShortCode, result.ShortCode)
-	assert.Equal(t, expectedURL.ClickCount, result.AccessCount)
-	assert.Equal(t, expectedURL.CreatedAt, result.CreatedAt)
-	assert.Equal(t, expectedURL.UpdatedAt, result.UpdatedAt)
+	assert.Len(t, result, 1)
+	assert.Equal(t, "7", result[0].Id)
+	assert.Equal(t, "gone12", result[0].ShortCode)
+	assert.Equal(t, 410, result[0].Health.StatusCode)
+	assert.Equal(t, 4, result[0].Health.ConsecutiveFailures)
 
 	mockRepo.AssertExpectations(t)
 }
 
-func TestGetUrlStatic_NotFound(t *testing.T) {
-
+func TestGetBrokenLinks_RepoError(t *testing.T) {
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
-	shortCode := "notfound"
-
-	mockRepo.On("GetByShortCode", ctx, shortCode).
-		Return(nil, errors.New("not found"))
+	mockRepo.On("ListBrokenURLs", ctx).
+		Return(nil, errors.New("database error"))
 
-	result, err := service.GetUrlStatic(ctx, shortCode)
+	result, err := service.GetBrokenLinks(ctx)
 
 	assert.Error(t, err)
 	assert.Nil(t, result)
 	assert.IsType(t, &appErrors.AppError{}, err)
 
-	appErr := err.(*appErrors.AppError)
-	assert.Equal(t, appErrors.NotFound, appErr.Type)
-
 	mockRepo.AssertExpectations(t)
 }
 
-func TestCreateQrCode_EmptyURL(t *testing.T) {
+func TestGetQrCode_UnknownShortCode(t *testing.T) {
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
-	result, err := service.CreateQrCode(ctx, "")
+	mockRepo.On("GetByShortCode", ctx, "missing").Return(nil, sql.ErrNoRows)
+
+	result, err := service.GetQrCode(ctx, "missing", nil)
 
-	assert.Error(t, err)
 	assert.Nil(t, result)
-	assert.IsType(t, &appErrors.AppError{}, err)
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+	mockRepo.AssertNotCalled(t, "SaveQrCode", mock.Anything, mock.Anything)
+}
 
-	mockRepo.AssertExpectations(t)
+// qrCodeTestLink registers a link to draw QR codes for
+func qrCodeTestLink(mockRepo *repository.MockURLRepository, shortCode string) *model.URL {
+
+	link := &model.URL{ID: 1, ShortCode: shortCode, OriginalURL: "http://example.com"}
+	mockRepo.On("GetByShortCode", mock.Anything, shortCode).Return(link, nil)
+
+	return link
 }
 
-func TestCreateQrCode_Success(t *testing.T) {
+// qrCodeTestCode registers the stored code of a link, up to date with the URLs the service serves
+func qrCodeTestCode(mockRepo *repository.MockURLRepository, link *model.URL) *model.Qrcode {
+
+	qr := &model.Qrcode{
+		ID:          1,
+		URLID:       link.ID,
+		ScanCode:    "Sc4nC0de01",
+		OriginalURL: "http://localhost:8080/q/Sc4nC0de01",
+		QrCodeUrl:   "http://localhost:8080/shorten/" + link.ShortCode + "/qrcode/image",
+	}
+	mockRepo.On("GetQrCode", mock.Anything, link.ID).Return(qr, nil)
+
+	return qr
+}
+
+func TestGetQrCode_GeneratesOncePerLink(t *testing.T) {
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
+	qrCodeTestLink(mockRepo, "qr-once")
 	now := time.Now()
 
-	mockRepo.On("CreateQrCode", ctx, mock.Anything).
-		Return(&model.QrcodeInterpeter{
-			ID:        1,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}, nil)
+	// The scan code is drawn by the service, the saved row takes it over
+	saved := &model.Qrcode{ID: 7, URLID: 1, CreatedAt: now, UpdatedAt: now}
+	mockRepo.On("GetQrCode", ctx, uint(1)).Return(nil, sql.ErrNoRows).Once()
+	mockRepo.On("SaveQrCode", ctx, mock.MatchedBy(func(qr *model.Qrcode) bool {
+		return qr.URLID == 1 &&
+			len(qr.ScanCode) == qrCodeScanCodeLength &&
+			qr.OriginalURL == "http://localhost:8080/q/"+qr.ScanCode &&
+			qr.QrCodeUrl == "http://localhost:8080/shorten/qr-once/qrcode/image"
+	})).Run(func(args mock.Arguments) {
+		qr := args.Get(1).(*model.Qrcode)
+		saved.ScanCode, saved.OriginalURL, saved.QrCodeUrl = qr.ScanCode, qr.OriginalURL, qr.QrCodeUrl
+	}).Return(saved, nil).Once()
+
+	result, err := service.GetQrCode(ctx, "qr-once", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "7", result.Id)
+	assert.Equal(t, "qr-once", result.ShortCode)
+	assert.Equal(t, "http://localhost:8080/qr-once", result.ShortUrl)
+	assert.Equal(t, "http://example.com", result.OriginalURL)
+	assert.Equal(t, "http://localhost:8080/shorten/qr-once/qrcode/image", result.QrCodeURL)
+	assert.Equal(t, saved.ScanCode, result.ScanCode)
+	assert.Equal(t, "http://localhost:8080/q/"+saved.ScanCode, result.ScanURL)
+
+	// The stored code is reused while it records the URLs still served
+	mockRepo.On("GetQrCode", ctx, uint(1)).Return(&model.Qrcode{
+		ID: 7, URLID: 1, ScanCode: saved.ScanCode, OriginalURL: result.ScanURL, QrCodeUrl: result.QrCodeURL, CreatedAt: now, UpdatedAt: now,
+	}, nil).Once()
 
-	result, err := service.CreateQrCode(ctx, "abc123")
+	again, err := service.GetQrCode(ctx, "qr-once", nil)
 
 	assert.NoError(t, err)
-	assert.NotNil(t, result)
-	assert.Equal(t, "1", result.Id)
-	assert.NotEmpty(t, result.QrCodeURL)
+	assert.Equal(t, result, again)
+	mockRepo.AssertExpectations(t)
+}
 
+func TestGetQrCode_UpdatesStaleImageURL(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	qrCodeTestLink(mockRepo, "qr-stale")
+
+	// Codes stored before images were served on request still point at a written file, and those stored
+	// before scans were tracked encode the short link; they keep their scan code once given one
+	mockRepo.On("GetQrCode", ctx, uint(1)).Return(&model.Qrcode{
+		ID: 3, URLID: 1, ScanCode: "0a1b2c3d4e", OriginalURL: "http://localhost:8080/qr-stale", QrCodeUrl: "http://localhost:8080/temp/qrcode_x1y2z3.png",
+	}, nil)
+	mockRepo.On("SaveQrCode", ctx, mock.MatchedBy(func(qr *model.Qrcode) bool {
+		return qr.ScanCode == "0a1b2c3d4e" &&
+			qr.OriginalURL == "http://localhost:8080/q/0a1b2c3d4e" &&
+			qr.QrCodeUrl == "http://localhost:8080/shorten/qr-stale/qrcode/image"
+	})).Return(&model.Qrcode{ID: 3, URLID: 1, ScanCode: "0a1b2c3d4e", OriginalURL: "http://localhost:8080/q/0a1b2c3d4e", QrCodeUrl: "http://localhost:8080/shorten/qr-stale/qrcode/image"}, nil)
+
+	result, err := service.GetQrCode(ctx, "qr-stale", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/shorten/qr-stale/qrcode/image", result.QrCodeURL)
+	assert.Equal(t, "http://localhost:8080/q/0a1b2c3d4e", result.ScanURL)
 	mockRepo.AssertExpectations(t)
 }
 
-func TestCreateQrCode_RepoError(t *testing.T) {
+func TestGetQrCode_RepoError(t *testing.T) {
 	mockRepo := new(repository.MockURLRepository)
-	service := NewURLService(mockRepo, testCfg())
+	service := newTestService(mockRepo)
 	ctx := context.Background()
 
-	mockRepo.On("CreateQrCode", ctx, mock.Anything).
-		Return(nil, errors.New("database error"))
+	qrCodeTestLink(mockRepo, "qr-error")
 
-	result, err := service.CreateQrCode(ctx, "abc123")
+	mockRepo.On("GetQrCode", ctx, uint(1)).Return(nil, sql.ErrNoRows)
+	mockRepo.On("SaveQrCode", ctx, mock.Anything).Return(nil, errors.New("database error"))
 
-	assert.Error(t, err)
-	assert.Nil(t, result)
-	assert.IsType(t, &appErrors.AppError{}, err)
+	result, err := service.GetQrCode(ctx, "qr-error", nil)
 
+	assert.Nil(t, result)
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
 	mockRepo.AssertExpectations(t)
 }
 
@@ -440,6 +639,7 @@ func TestShortenURL_TableDriven(t *testing.T) {
 			originalURL: "http://example.com",
 			setupMock: func(m *repository.MockURLRepository) {
 				now := time.Now()
+				m.On("IsShortCodeExists", mock.Anything, mock.AnythingOfType("string")).Return(false)
 				m.On("Create", mock.Anything, mock.MatchedBy(func(url *model.URL) bool {
 					return url.OriginalURL == "http://example.com" && len(url.ShortCode) == 6
 				})).Return(&model.URLInterpeter{
@@ -460,6 +660,7 @@ func TestShortenURL_TableDriven(t *testing.T) {
 			name:        "Error - Repository failure",
 			originalURL: "http://example.com",
 			setupMock: func(m *repository.MockURLRepository) {
+				m.On("IsShortCodeExists", mock.Anything, mock.AnythingOfType("string")).Return(false)
 				m.On("Create", mock.Anything, mock.AnythingOfType("*model.URL")).
 					Return(nil, errors.New("database error"))
 			},
@@ -475,10 +676,10 @@ func TestShortenURL_TableDriven(t *testing.T) {
 
 			mockRepo := new(repository.MockURLRepository)
 			tt.setupMock(mockRepo)
-			service := NewURLService(mockRepo, testCfg())
+			service := newTestService(mockRepo)
 			ctx := context.Background()
 
-			result, err := service.ShortenURL(ctx, tt.originalURL)
+			result, err := service.ShortenURL(ctx, tt.originalURL, "", "")
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -507,7 +708,8 @@ func TestDeleteShortUrl_TableDriven(t *testing.T) {
 			name:      "Success - Delete existing URL",
 			shortCode: "abc123",
 			setupMock: func(m *repository.MockURLRepository) {
-				m.On("IsShortCodeExists", mock.Anything, "abc123").Return(true)
+				m.On("GetByShortCode", mock.Anything, "abc123").Return(&model.URL{ID: 1, ShortCode: "abc123"}, nil)
+				m.On("GetQrCode", mock.Anything, uint(1)).Return(nil, sql.ErrNoRows)
 				m.On("DeleteByShortCode", mock.Anything, "abc123").Return(nil)
 			},
 			wantErr: false,
@@ -516,7 +718,7 @@ func TestDeleteShortUrl_TableDriven(t *testing.T) {
 			name:      "Error - URL not found",
 			shortCode: "notfound",
 			setupMock: func(m *repository.MockURLRepository) {
-				m.On("IsShortCodeExists", mock.Anything, "notfound").Return(false)
+				m.On("GetByShortCode", mock.Anything, "notfound").Return(nil, errors.New("not found"))
 			},
 			wantErr:      true,
 			expectedType: appErrors.NotFound,
@@ -525,7 +727,8 @@ func TestDeleteShortUrl_TableDriven(t *testing.T) {
 			name:      "Error - Delete failed",
 			shortCode: "abc123",
 			setupMock: func(m *repository.MockURLRepository) {
-				m.On("IsShortCodeExists", mock.Anything, "abc123").Return(true)
+				m.On("GetByShortCode", mock.Anything, "abc123").Return(&model.URL{ID: 1, ShortCode: "abc123"}, nil)
+				m.On("GetQrCode", mock.Anything, uint(1)).Return(nil, sql.ErrNoRows)
 				m.On("DeleteByShortCode", mock.Anything, "abc123").
 					Return(errors.New("delete failed"))
 			},
@@ -539,7 +742,7 @@ func TestDeleteShortUrl_TableDriven(t *testing.T) {
 
 			mockRepo := new(repository.MockURLRepository)
 			tt.setupMock(mockRepo)
-			service := NewURLService(mockRepo, testCfg())
+			service := newTestService(mockRepo)
 			ctx := context.Background()
 
 			err := service.DeleteShortUrl(ctx, tt.shortCode)
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"shorten-url/configs"
+	"shorten-url/pkg/safehttp"
+)
+
+var (
+	errShortenerNotAllowed = errors.New("links through other url shorteners are not allowed")
+	errShortenerLoop       = errors.New("url shortener redirects form a loop")
+	errShortenerTooDeep    = errors.New("url shortener chain is too long")
+	errShortenerNoRedirect = errors.New("url shortener did not redirect")
+)
+
+type ShortenerResolver interface {
+	IsShortener(host string) bool
+	Resolve(pctx context.Context, rawURL string) (string, error)
+}
+
+type shortenerResolver struct {
+	cfg     *configs.Config
+	client  *http.Client
+	domains map[string]struct{}
+}
+
+func NewShortenerResolver(cfg *configs.Config) ShortenerResolver {
+	return newShortenerResolver(cfg, safehttp.NewClient(cfg.Resolver.Timeout))
+}
+
+func newShortenerResolver(cfg *configs.Config, client *http.Client) *shortenerResolver {
+
+	domains := make(map[string]struct{}, len(cfg.Resolver.ShortenerDomains))
+	for _, domain := range cfg.Resolver.ShortenerDomains {
+		domains[strings.ToLower(strings.TrimSpace(domain))] = struct{}{}
+	}
+
+	return &shortenerResolver{
+		cfg:     cfg,
+		client:  client,
+		domains: domains,
+	}
+}
+
+// IsShortener reports whether host is a known shortener domain or one of its subdomains
+func (r *shortenerResolver) IsShortener(host string) bool {
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for {
+		if _, ok := r.domains[host]; ok {
+			return true
+		}
+		dot := strings.IndexByte(host, '.')
+		if dot < 0 {
+			return false
+		}
+		host = host[dot+1:]
+	}
+}
+
+// Resolve follows known shortener hops until the url leaves them, returning the final destination.
+// Urls that do not start at a shortener are returned unchanged without any network access.
+func (r *shortenerResolver) Resolve(pctx context.Context, rawURL string) (string, error) {
+
+	current, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	if !r.IsShortener(current.Hostname()) {
+		return rawURL, nil
+	}
+
+	if !r.cfg.Resolver.Enabled {
+		return "", errShortenerNotAllowed
+	}
+
+	visited := make(map[string]struct{})
+	for hop := 0; r.IsShortener(current.Hostname()); hop++ {
+		if hop >= r.cfg.Resolver.MaxHops {
+			return "", errShortenerTooDeep
+		}
+		if _, ok := visited[current.String()]; ok {
+			return "", errShortenerLoop
+		}
+		visited[current.String()] = struct{}{}
+
+		if current, err = r.follow(pctx, current); err != nil {
+			return "", err
+		}
+	}
+
+	return current.String(), nil
+}
+
+func (r *shortenerResolver) follow(pctx context.Context, current *url.URL) (*url.URL, error) {
+
+	resp, err := r.do(pctx, http.MethodHead, current)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp, err = r.do(pctx, http.MethodGet, current)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", current.Hostname(), err)
+	}
+
+	location := resp.Header.Get("Location")
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 || location == "" {
+		return nil, errShortenerNoRedirect
+	}
+
+	next, err := current.Parse(location)
+	if err != nil || (next.Scheme != "http" && next.Scheme != "https") || next.Hostname() == "" {
+		return nil, fmt.Errorf("url shortener redirected to an invalid url %q", location)
+	}
+
+	return next, nil
+}
+
+func (r *shortenerResolver) do(pctx context.Context, method string, target *url.URL) (*http.Response, error) {
+
+	req, err := http.NewRequestWithContext(pctx, method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", linkCheckerUserAgent)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return resp, nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"shorten-url/configs"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+	"shorten-url/pkg/safehttp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newFakeShortener(t *testing.T) (*httptest.Server, *configs.Config) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://final.example/landing?utm=1", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/hop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/final", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/self", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost:8080/abc123", http.StatusFound)
+	})
+	mux.HandleFunc("/nohead", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		http.Redirect(w, r, "https://final.example/get", http.StatusFound)
+	})
+	mux.HandleFunc("/dead", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	serverURL, _ := url.Parse(server.URL)
+
+	cfg := testCfg()
+	cfg.Resolver = configs.ResolverConfig{
+		Enabled:          true,
+		ShortenerDomains: []string{serverURL.Hostname(), "bit.ly"},
+		MaxHops:          3,
+		Timeout:          time.Second * 2,
+	}
+
+	return server, cfg
+}
+
+func newTestResolver(cfg *configs.Config) *shortenerResolver {
+	return newShortenerResolver(cfg, &http.Client{
+		Timeout: cfg.Resolver.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	})
+}
+
+func TestShortenerResolver_IsShortener(t *testing.T) {
+
+	resolver := newTestResolver(checkerCfg())
+	resolver.domains = map[string]struct{}{"bit.ly": {}}
+
+	assert.True(t, resolver.IsShortener("bit.ly"))
+	assert.True(t, resolver.IsShortener("J.MP.Bit.LY."))
+	assert.False(t, resolver.IsShortener("notbit.ly"))
+	assert.False(t, resolver.IsShortener("example.com"))
+}
+
+func TestShortenerResolver_Resolve(t *testing.T) {
+
+	server, cfg := newFakeShortener(t)
+	resolver := newTestResolver(cfg)
+	ctx := context.Background()
+
+	final, err := resolver.Resolve(ctx, server.URL+"/hop")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://final.example/landing?utm=1", final)
+
+	final, err = resolver.Resolve(ctx, server.URL+"/nohead")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://final.example/get", final)
+
+	final, err = resolver.Resolve(ctx, "https://example.com/untouched")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/untouched", final)
+
+	_, err = resolver.Resolve(ctx, server.URL+"/loop")
+	assert.ErrorIs(t, err, errShortenerLoop)
+
+	_, err = resolver.Resolve(ctx, server.URL+"/dead")
+	assert.ErrorIs(t, err, errShortenerNoRedirect)
+
+	cfg.Resolver.MaxHops = 1
+	_, err = resolver.Resolve(ctx, server.URL+"/hop")
+	assert.ErrorIs(t, err, errShortenerTooDeep)
+
+	cfg.Resolver.Enabled = false
+	_, err = resolver.Resolve(ctx, server.URL+"/final")
+	assert.ErrorIs(t, err, errShortenerNotAllowed)
+}
+
+func TestShortenerResolver_RefusesPrivateAddresses(t *testing.T) {
+
+	server, cfg := newFakeShortener(t)
+
+	_, err := NewShortenerResolver(cfg).Resolve(context.Background(), server.URL+"/final")
+
+	assert.True(t, errors.Is(err, safehttp.ErrDisallowedAddress))
+}
+
+func TestShortenURL_DestinationValidation(t *testing.T) {
+
+	server, cfg := newFakeShortener(t)
+	cfg.Server.AliasDomains = []string{"sho.rt"}
+
+	mockRepo := new(repository.MockURLRepository)
+	blocklist := NewBlocklistService(new(repository.MockBlocklistRepository), cfg)
+	service := newTestServiceWith(cfg, mockRepo, blocklist, newTestResolver(cfg), NewReservedWords(cfg))
+	ctx := context.Background()
+
+	for _, destination := range []string{
+		"http://localhost:8080/abc123",
+		"https://SHO.RT/abc123",
+		server.URL + "/self",
+		server.URL + "/loop",
+	} {
+		_, err := service.ShortenURL(ctx, destination, "", "")
+		assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type, destination)
+	}
+
+	mockRepo.On("IsShortCodeExists", ctx, mock.AnythingOfType("string")).Return(false)
+	mockRepo.On("Create", ctx, mock.MatchedBy(func(url *model.URL) bool {
+		return url.OriginalURL == "https://final.example/landing?utm=1"
+	})).Return(&model.URLInterpeter{ID: 1}, nil)
+
+	result, err := service.ShortenURL(ctx, server.URL+"/hop", "", "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://final.example/landing?utm=1", result.OriginalURL)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("shorten-url/internal/service")
+
+func startSpan(pctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(pctx, name, trace.WithAttributes(attrs...))
+}
+
+// finishSpan ends a span, marking it failed only for internal errors; a missing link or bad input is the caller's doing
+func finishSpan(span trace.Span, err error) {
+
+	if err != nil {
+		span.RecordError(err)
+
+		var appErr *appErrors.AppError
+		if errors.As(err, &appErr) && appErr.Type != appErrors.Internal {
+			span.SetAttributes(attribute.String("error.type", string(appErr.Type)))
+		} else {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+
+	span.End()
+}
+
+// tracedURLService records a span around every call of the service it wraps
+type tracedURLService struct {
+	inner URLService
+}
+
+// NewTracedURLService traces each URLService method of inner as a child of the request span
+func NewTracedURLService(inner URLService) URLService {
+	return &tracedURLService{
+		inner: inner,
+	}
+}
+
+func (s *tracedURLService) ShortenURL(pctx context.Context, originalURL string, customAlias string, campaign string) (*entities.CreateShortenUrlRes, error) {
+	ctx, span := startSpan(pctx, "URLService.ShortenURL")
+	result, err := s.inner.ShortenURL(ctx, originalURL, customAlias, campaign)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedURLService) GetQrCode(pctx context.Context, shortCode string, req *entities.QrCodeReq) (*entities.QrCodeRes, error) {
+	ctx, span := startSpan(pctx, "URLService.GetQrCode", attribute.String("short_code", shortCode))
+	result, err := s.inner.GetQrCode(ctx, shortCode, req)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedURLService) GetQrCodeImage(pctx context.Context, shortCode string, req *entities.QrCodeReq, ifNoneMatch string) (*entities.QrCodeImageRes, error) {
+	ctx, span := startSpan(pctx, "URLService.GetQrCodeImage", attribute.String("short_code", shortCode))
+	result, err := s.inner.GetQrCodeImage(ctx, shortCode, req, ifNoneMatch)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedURLService) GetOriginalURL(pctx context.Context, shortCode string, click *entities.ClickInfo) (string, error) {
+	ctx, span := startSpan(pctx, "URLService.GetOriginalURL", attribute.String("short_code", shortCode))
+	result, err := s.inner.GetOriginalURL(ctx, shortCode, click)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedURLService) ResolveQrCode(pctx context.Context, scanCode string, click *entities.ClickInfo) (string, error) {
+	ctx, span := startSpan(pctx, "URLService.ResolveQrCode", attribute.String("scan_code", scanCode))
+	result, err := s.inner.ResolveQrCode(ctx, scanCode, click)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedURLService) RetargetQrCode(pctx context.Context, scanCode string, req *entities.RetargetQrCodeReq) (*entities.QrCodeRes, error) {
+	ctx, span := startSpan(pctx, "URLService.RetargetQrCode", attribute.String("scan_code", scanCode))
+	result, err := s.inner.RetargetQrCode(ctx, scanCode, req)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedURLService) WriteQrCodeSheet(pctx context.Context, req *entities.QrCodeSheetReq, w io.Writer) error {
+	var count int
+	if req != nil {
+		count = len(req.ShortCodes)
+	}
+	ctx, span := startSpan(pctx, "URLService.WriteQrCodeSheet", attribute.Int("short_codes", count))
+	err := s.inner.WriteQrCodeSheet(ctx, req, w)
+	finishSpan(span, err)
+	return err
+}
+
+func (s *tracedURLService) DecodeQrCodes(pctx context.Context, upload []byte) (*entities.QrCodeDecodeRes, error) {
+	ctx, span := startSpan(pctx, "URLService.DecodeQrCodes", attribute.Int("bytes", len(upload)))
+	result, err := s.inner.DecodeQrCodes(ctx, upload)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedURLService) RetrieveOriginalURL(pctx context.Context, shortCode string) (*entities.RetriveOriginalUrlRes, error) {
+	ctx, span := startSpan(pctx, "URLService.RetrieveOriginalURL", attribute.String("short_code", shortCode))
+	result, err := s.inner.RetrieveOriginalURL(ctx, shortCode)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedURLService) UpdateShortUrl(pctx context.Context, shortCode string, updatedUrl string) (*model.URL, error) {
+	ctx, span := startSpan(pctx, "URLService.UpdateShortUrl", attribute.String("short_code", shortCode))
+	result, err := s.inner.UpdateShortUrl(ctx, shortCode, updatedUrl)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedURLService) DeleteShortUrl(pctx context.Context, shortCode string) error {
+	ctx, span := startSpan(pctx, "URLService.DeleteShortUrl", attribute.String("short_code", shortCode))
+	err := s.inner.DeleteShortUrl(ctx, shortCode)
+	finishSpan(span, err)
+	return err
+}
+
+func (s *tracedURLService) GetBrokenLinks(pctx context.Context) ([]*entities.BrokenLinkRes, error) {
+	ctx, span := startSpan(pctx, "URLService.GetBrokenLinks")
+	result, err := s.inner.GetBrokenLinks(ctx)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedURLService) GetReservedConflicts(pctx context.Context) ([]*entities.ReservedConflictRes, error) {
+	ctx, span := startSpan(pctx, "URLService.GetReservedConflicts")
+	result, err := s.inner.GetReservedConflicts(ctx)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedURLService) SaveWorkspaceLogo(pctx context.Context, workspace string, upload []byte) (*entities.WorkspaceLogoRes, error) {
+	ctx, span := startSpan(pctx, "URLService.SaveWorkspaceLogo", attribute.String("workspace", workspace))
+	result, err := s.inner.SaveWorkspaceLogo(ctx, workspace, upload)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedURLService) DeleteWorkspaceLogo(pctx context.Context, workspace string) error {
+	ctx, span := startSpan(pctx, "URLService.DeleteWorkspaceLogo", attribute.String("workspace", workspace))
+	err := s.inner.DeleteWorkspaceLogo(ctx, workspace)
+	finishSpan(span, err)
+	return err
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracedURLService_SpanStatus(t *testing.T) {
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	mockRepo := new(repository.MockURLRepository)
+	service := NewTracedURLService(newTestService(mockRepo))
+	ctx := context.Background()
+
+	mockRepo.On("GetByShortCode", mock.Anything, "missing").Return(nil, errors.New("sql: no rows in result set"))
+	mockRepo.On("DeleteByShortCode", mock.Anything, "abc123").Return(errors.New("database error"))
+	mockRepo.On("GetByShortCode", mock.Anything, "abc123").Return(&model.URL{ID: 1, ShortCode: "abc123"}, nil)
+	mockRepo.On("GetQrCode", mock.Anything, uint(1)).Return(nil, errors.New("sql: no rows in result set"))
+
+	_, err := service.GetOriginalURL(ctx, "missing", nil)
+	assert.Error(t, err)
+	assert.Error(t, service.DeleteShortUrl(ctx, "abc123"))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+
+	assert.Equal(t, "URLService.GetOriginalURL", spans[0].Name())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code, "a missing link is not a server error")
+	assert.Contains(t, spans[0].Attributes(), attribute.String("short_code", "missing"))
+	assert.Contains(t, spans[0].Attributes(), attribute.String("error.type", "NOT_FOUND"))
+
+	assert.Equal(t, "URLService.DeleteShortUrl", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
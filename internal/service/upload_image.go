@@ -0,0 +1,28 @@
+package service
+
+import (
+	"bytes"
+	"image"
+
+	appErrors "shorten-url/internal/errors"
+)
+
+// decodeUploadedImage decodes an uploaded PNG or JPEG once fits accepts its size. The header is checked
+// before decoding so a small file cannot claim a huge canvas
+func decodeUploadedImage(upload []byte, notImage string, fits func(image.Config) error) (image.Image, image.Config, error) {
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(upload))
+	if err != nil || (format != "png" && format != "jpeg") {
+		return nil, config, appErrors.NewInvalidInputError(notImage)
+	}
+	if err := fits(config); err != nil {
+		return nil, config, err
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(upload))
+	if err != nil {
+		return nil, config, appErrors.NewInvalidInputError(notImage)
+	}
+
+	return decoded, config, nil
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"shorten-url/internal/model"
+)
+
+const webhookUserAgent = "shorten-url-webhooks/1.0"
+
+// Start sends due deliveries on every poll interval until the context is cancelled
+func (s *webhookService) Start(pctx context.Context) {
+
+	ticker := time.NewTicker(s.cfg.Webhook.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Reload(pctx); err != nil {
+			log.Printf("Error: failed to reload webhook endpoints %s", err.Error())
+		}
+		if err := s.RunOnce(pctx); err != nil {
+			log.Printf("Error: webhook delivery run failed %s", err.Error())
+		}
+
+		select {
+		case <-pctx.Done():
+			log.Println("Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce claims one batch of due deliveries and sends them
+func (s *webhookService) RunOnce(pctx context.Context) error {
+
+	batchSize := s.cfg.Webhook.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	concurrency := s.cfg.Webhook.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	// The lease covers the whole batch waiting for slots, so only a crashed instance's deliveries are picked up again
+	now := s.now().UTC()
+	rounds := (batchSize + concurrency - 1) / concurrency
+	leaseUntil := now.Add(s.cfg.Webhook.Timeout * time.Duration(rounds+1))
+
+	deliveries, err := s.repo.ClaimDueDeliveries(pctx, now, leaseUntil, batchSize)
+	if err != nil {
+		return err
+	}
+
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for _, target := range deliveries {
+		wg.Add(1)
+		go func(target *model.WebhookDeliveryTarget) {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-pctx.Done():
+				return
+			}
+
+			s.deliver(pctx, target)
+		}(target)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// deliver makes one attempt and schedules the next one with exponential backoff until attempts run out
+func (s *webhookService) deliver(pctx context.Context, target *model.WebhookDeliveryTarget) {
+
+	delivery := &target.WebhookDelivery
+	attemptAt := s.now().UTC()
+
+	statusCode, err := s.send(pctx, target, attemptAt)
+	if err != nil && pctx.Err() != nil {
+		// Shutting down; the lease runs out and the attempt is made again
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastAttemptAt = &attemptAt
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+
+	switch {
+	case err == nil:
+		delivery.Status = model.WebhookDeliverySucceeded
+	case delivery.Attempts >= s.cfg.Webhook.MaxAttempts:
+		delivery.Status = model.WebhookDeliveryFailed
+		delivery.LastError = err.Error()
+		log.Printf("Error: giving up on webhook delivery %d to %s after %d attempts %s", delivery.ID, target.URL, delivery.Attempts, err.Error())
+	default:
+		delivery.Status = model.WebhookDeliveryPending
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = attemptAt.Add(webhookBackoff(s.cfg.Webhook.RetryBaseDelay, s.cfg.Webhook.RetryMaxDelay, delivery.Attempts))
+	}
+
+	// A finished attempt is recorded even during shutdown, otherwise it would be sent twice
+	if err := s.repo.SaveDeliveryAttempt(context.WithoutCancel(pctx), delivery); err != nil {
+		log.Printf("Error: failed to save webhook delivery %d %s", delivery.ID, err.Error())
+	}
+}
+
+// send posts the payload; anything but a 2xx response, redirects included, is a failed attempt
+func (s *webhookService) send(pctx context.Context, target *model.WebhookDeliveryTarget, at time.Time) (int, error) {
+
+	req, err := http.NewRequestWithContext(pctx, http.MethodPost, target.URL, bytes.NewReader(target.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", webhookUserAgent)
+	req.Header.Set("X-Webhook-Id", target.EventID)
+	req.Header.Set("X-Webhook-Event", target.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(target.ID, 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", webhookSignature(target.Secret, timestamp, target.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// webhookSignature signs "timestamp.body" with the endpoint secret; receivers recompute it and reject stale timestamps
+func webhookSignature(secret string, timestamp string, body []byte) string {
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff doubles the base delay after every failed attempt, up to the maximum
+func webhookBackoff(base time.Duration, maxDelay time.Duration, attempts int) time.Duration {
+
+	if base <= 0 {
+		base = time.Second
+	}
+
+	delay := base
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+
+	return delay
+}
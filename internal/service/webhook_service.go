@@ -0,0 +1,387 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	mathrand "math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"shorten-url/configs"
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+	"shorten-url/pkg/safehttp"
+)
+
+const (
+	defaultWebhookDeliveriesLimit = 50
+	maxWebhookDeliveriesLimit     = 200
+)
+
+// webhookEvents are the event types an endpoint may subscribe to; links cannot expire yet, so there is no link.expired
+var webhookEvents = map[string]struct{}{
+	model.WebhookEventLinkCreated:          {},
+	model.WebhookEventLinkUpdated:          {},
+	model.WebhookEventLinkDeleted:          {},
+	model.WebhookEventLinkClicked:          {},
+	model.WebhookEventLinkThresholdReached: {},
+}
+
+// WebhookService logs link events for subscribed endpoints and delivers them in the background
+type WebhookService interface {
+	Start(pctx context.Context)
+	RunOnce(pctx context.Context) error
+	Reload(pctx context.Context) error
+	Emit(pctx context.Context, eventType string, url *model.URL, data *entities.WebhookEventDataRes)
+	LinkClicked(pctx context.Context, url *model.URL, event *model.ClickEvent)
+	CreateEndpoint(pctx context.Context, req *entities.CreateWebhookEndpointReq) (*entities.WebhookEndpointRes, error)
+	ListEndpoints(pctx context.Context) ([]*entities.WebhookEndpointRes, error)
+	DeleteEndpoint(pctx context.Context, id uint) error
+	ListDeliveries(pctx context.Context, endpointID uint, req *entities.WebhookDeliveriesReq) ([]*entities.WebhookDeliveryRes, error)
+	ReplayDelivery(pctx context.Context, id int64) (*entities.WebhookDeliveryRes, error)
+}
+
+type webhookService struct {
+	repo   repository.WebhookRepository
+	cfg    *configs.Config
+	client *http.Client
+	now    func() time.Time
+	sample func() float64
+
+	mu         sync.RWMutex
+	endpoints  []*model.WebhookEndpoint
+	subscribed map[string]struct{}
+}
+
+func NewWebhookService(repo repository.WebhookRepository, cfg *configs.Config) WebhookService {
+	return &webhookService{
+		repo:       repo,
+		cfg:        cfg,
+		client:     safehttp.NewClient(cfg.Webhook.Timeout),
+		now:        time.Now,
+		sample:     mathrand.Float64,
+		subscribed: make(map[string]struct{}),
+	}
+}
+
+// Reload refreshes the endpoints events are logged for; endpoints created on other instances show up on the next poll
+func (s *webhookService) Reload(pctx context.Context) error {
+
+	endpoints, err := s.repo.ListEndpoints(pctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.endpoints = endpoints
+	s.rebuildLocked()
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Emit logs an event for every subscribed endpoint; a webhook never fails the change that triggered it
+func (s *webhookService) Emit(pctx context.Context, eventType string, url *model.URL, data *entities.WebhookEventDataRes) {
+
+	if !s.isSubscribed(eventType) {
+		return
+	}
+
+	if data == nil {
+		data = new(entities.WebhookEventDataRes)
+	}
+	data.Link = s.toWebhookLinkRes(url)
+
+	event := &entities.WebhookEventRes{
+		Id:        "evt_" + randomHex(16),
+		Type:      eventType,
+		CreatedAt: s.now().UTC(),
+		Data:      data,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error: failed to encode %s webhook event %s", eventType, err.Error())
+		return
+	}
+
+	// The request that caused the event may be gone already, the log entry should still be written
+	if _, err := s.repo.EnqueueDeliveries(context.WithoutCancel(pctx), event.Id, eventType, payload, event.CreatedAt); err != nil {
+		log.Printf("Error: failed to log %s webhook event for %s %s", eventType, url.ShortCode, err.Error())
+	}
+}
+
+// LinkClicked emits a sample of human clicks so busy links do not flood receivers; the click recorder calls it
+// while flushing a batch, so logging the event never holds up a redirect
+func (s *webhookService) LinkClicked(pctx context.Context, url *model.URL, event *model.ClickEvent) {
+
+	if s.cfg.Webhook.ClickSampleRate <= 0 || !s.isSubscribed(model.WebhookEventLinkClicked) {
+		return
+	}
+	if event.IsBot || s.sample() >= s.cfg.Webhook.ClickSampleRate {
+		return
+	}
+
+	s.Emit(pctx, model.WebhookEventLinkClicked, url, &entities.WebhookEventDataRes{
+		Click: &entities.WebhookClickRes{
+			ClickedAt: event.ClickedAt,
+			Referrer:  event.ReferrerHost,
+			Country:   event.Country,
+			Device:    event.Device,
+			Source:    event.Source,
+		},
+	})
+}
+
+func (s *webhookService) CreateEndpoint(pctx context.Context, req *entities.CreateWebhookEndpointReq) (*entities.WebhookEndpointRes, error) {
+
+	target, err := validateWebhookURL(req.URL)
+	if err != nil {
+		return nil, appErrors.NewInvalidInputError(err.Error())
+	}
+
+	events, err := normalizeWebhookEvents(req.Events)
+	if err != nil {
+		return nil, appErrors.NewInvalidInputError(err.Error())
+	}
+
+	endpoint, err := s.repo.CreateEndpoint(pctx, &model.WebhookEndpoint{
+		URL:    target,
+		Secret: "whsec_" + randomHex(32),
+		Events: events,
+	})
+	if err != nil {
+		log.Printf("Error: failed to create webhook endpoint %s", err.Error())
+		return nil, appErrors.NewInternalError("failed to create webhook endpoint", err)
+	}
+
+	s.mu.Lock()
+	s.endpoints = append(s.endpoints, endpoint)
+	s.rebuildLocked()
+	s.mu.Unlock()
+
+	res := toWebhookEndpointRes(endpoint)
+	res.Secret = endpoint.Secret
+
+	return res, nil
+}
+
+func (s *webhookService) ListEndpoints(pctx context.Context) ([]*entities.WebhookEndpointRes, error) {
+
+	endpoints, err := s.repo.ListEndpoints(pctx)
+	if err != nil {
+		log.Printf("Error: failed to list webhook endpoints %s", err.Error())
+		return nil, appErrors.NewInternalError("failed to list webhook endpoints", err)
+	}
+
+	res := make([]*entities.WebhookEndpointRes, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		res = append(res, toWebhookEndpointRes(endpoint))
+	}
+
+	return res, nil
+}
+
+func (s *webhookService) DeleteEndpoint(pctx context.Context, id uint) error {
+
+	if err := s.repo.DeleteEndpoint(pctx, id); err != nil {
+		log.Printf("Error: failed to delete webhook endpoint %s", err.Error())
+		return appErrors.NewNotFoundError("webhook endpoint was not found")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	endpoints := make([]*model.WebhookEndpoint, 0, len(s.endpoints))
+	for _, endpoint := range s.endpoints {
+		if endpoint.ID != id {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	s.endpoints = endpoints
+	s.rebuildLocked()
+
+	return nil
+}
+
+func (s *webhookService) ListDeliveries(pctx context.Context, endpointID uint, req *entities.WebhookDeliveriesReq) ([]*entities.WebhookDeliveryRes, error) {
+
+	if req == nil {
+		req = new(entities.WebhookDeliveriesReq)
+	}
+
+	switch req.Status {
+	case "", model.WebhookDeliveryPending, model.WebhookDeliverySucceeded, model.WebhookDeliveryFailed:
+	default:
+		return nil, appErrors.NewInvalidInputError("status must be pending, succeeded or failed")
+	}
+
+	limit := req.Limit
+	switch {
+	case limit == 0:
+		limit = defaultWebhookDeliveriesLimit
+	case limit < 0 || limit > maxWebhookDeliveriesLimit:
+		return nil, appErrors.NewInvalidInputError(fmt.Sprintf("limit must be between 1 and %d", maxWebhookDeliveriesLimit))
+	}
+
+	deliveries, err := s.repo.ListDeliveries(pctx, endpointID, req.Status, limit)
+	if err != nil {
+		log.Printf("Error: failed to list webhook deliveries %s", err.Error())
+		return nil, appErrors.NewInternalError("failed to list webhook deliveries", err)
+	}
+
+	res := make([]*entities.WebhookDeliveryRes, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		res = append(res, toWebhookDeliveryRes(delivery))
+	}
+
+	return res, nil
+}
+
+// ReplayDelivery sends a logged event again as a new delivery, whatever became of the original
+func (s *webhookService) ReplayDelivery(pctx context.Context, id int64) (*entities.WebhookDeliveryRes, error) {
+
+	delivery, err := s.repo.ReplayDelivery(pctx, id, s.now().UTC())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, appErrors.NewNotFoundError("webhook delivery was not found")
+		}
+		log.Printf("Error: failed to replay webhook delivery %d %s", id, err.Error())
+		return nil, appErrors.NewInternalError("failed to replay webhook delivery", err)
+	}
+
+	return toWebhookDeliveryRes(delivery), nil
+}
+
+func (s *webhookService) isSubscribed(eventType string) bool {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.subscribed[eventType]
+	return ok
+}
+
+func (s *webhookService) rebuildLocked() {
+
+	subscribed := make(map[string]struct{})
+	for _, endpoint := range s.endpoints {
+		for _, event := range endpoint.Events {
+			subscribed[event] = struct{}{}
+		}
+	}
+	s.subscribed = subscribed
+}
+
+func (s *webhookService) toWebhookLinkRes(u *model.URL) *entities.WebhookLinkRes {
+
+	shortURL, err := url.JoinPath(s.cfg.Server.BaseURL, u.ShortCode)
+	if err != nil {
+		shortURL = u.ShortCode
+	}
+
+	return &entities.WebhookLinkRes{
+		Id:          strconv.Itoa(int(u.ID)),
+		ShortCode:   u.ShortCode,
+		ShortUrl:    shortURL,
+		OriginalURL: u.OriginalURL,
+		ClickCount:  u.ClickCount,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+	}
+}
+
+// validateWebhookURL accepts public http(s) urls; hostnames are checked again when the delivery connects
+func validateWebhookURL(rawURL string) (string, error) {
+
+	rawURL = strings.TrimSpace(rawURL)
+
+	target, err := url.Parse(rawURL)
+	if err != nil || target.Hostname() == "" {
+		return "", errors.New("invalid webhook url")
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return "", errors.New("webhook url must use http or https")
+	}
+	if ip := net.ParseIP(target.Hostname()); ip != nil && !safehttp.IsPublicIP(ip) {
+		return "", errors.New("webhook url must point at a public address")
+	}
+
+	return rawURL, nil
+}
+
+func normalizeWebhookEvents(events []string) ([]string, error) {
+
+	seen := make(map[string]struct{})
+	normalized := make([]string, 0, len(events))
+	for _, event := range events {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if _, ok := webhookEvents[event]; !ok {
+			return nil, fmt.Errorf("unknown webhook event %q", event)
+		}
+		if _, ok := seen[event]; ok {
+			continue
+		}
+		seen[event] = struct{}{}
+		normalized = append(normalized, event)
+	}
+
+	if len(normalized) == 0 {
+		return nil, errors.New("at least one webhook event is required")
+	}
+
+	return normalized, nil
+}
+
+func toWebhookEndpointRes(endpoint *model.WebhookEndpoint) *entities.WebhookEndpointRes {
+	return &entities.WebhookEndpointRes{
+		Id:        endpoint.ID,
+		URL:       endpoint.URL,
+		Events:    endpoint.Events,
+		CreatedAt: endpoint.CreatedAt,
+	}
+}
+
+func toWebhookDeliveryRes(delivery *model.WebhookDelivery) *entities.WebhookDeliveryRes {
+
+	res := &entities.WebhookDeliveryRes{
+		Id:             delivery.ID,
+		EndpointId:     delivery.EndpointID,
+		EventId:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		LastAttemptAt:  delivery.LastAttemptAt,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		ReplayOf:       delivery.ReplayOf,
+		CreatedAt:      delivery.CreatedAt,
+		Payload:        json.RawMessage(delivery.Payload),
+	}
+	if delivery.Status == model.WebhookDeliveryPending {
+		next := delivery.NextAttemptAt
+		res.NextAttemptAt = &next
+	}
+
+	return res
+}
+
+func randomHex(size int) string {
+
+	buf := make([]byte, size)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,357 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shorten-url/configs"
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newTestWebhooks has no endpoints, so nothing it is handed ever reaches the repository
+func newTestWebhooks(cfg *configs.Config) WebhookService {
+	return NewWebhookService(new(repository.MockWebhookRepository), cfg)
+}
+
+func newTestWebhookService(now time.Time, endpoints ...*model.WebhookEndpoint) (*webhookService, *repository.MockWebhookRepository) {
+
+	cfg := testCfg()
+	cfg.Webhook.Timeout = time.Second
+	cfg.Webhook.Concurrency = 2
+	cfg.Webhook.BatchSize = 10
+	cfg.Webhook.MaxAttempts = 3
+	cfg.Webhook.RetryBaseDelay = time.Minute
+	cfg.Webhook.RetryMaxDelay = time.Hour
+	cfg.Webhook.ClickSampleRate = 0.1
+
+	mockRepo := new(repository.MockWebhookRepository)
+	webhooks := NewWebhookService(mockRepo, cfg).(*webhookService)
+	webhooks.now = func() time.Time { return now }
+	webhooks.sample = func() float64 { return 0 }
+	webhooks.endpoints = endpoints
+	webhooks.rebuildLocked()
+
+	return webhooks, mockRepo
+}
+
+func decodeWebhookEvent(t *testing.T, payload []byte) *entities.WebhookEventRes {
+
+	event := new(entities.WebhookEventRes)
+	if err := json.Unmarshal(payload, event); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestWebhookService_CreateEndpointValidates(t *testing.T) {
+
+	webhooks, _ := newTestWebhookService(time.Now())
+	ctx := context.Background()
+
+	cases := []struct {
+		name string
+		req  *entities.CreateWebhookEndpointReq
+	}{
+		{name: "invalid url", req: &entities.CreateWebhookEndpointReq{URL: "not a url", Events: []string{"link.created"}}},
+		{name: "unsupported scheme", req: &entities.CreateWebhookEndpointReq{URL: "ftp://hooks.example.com", Events: []string{"link.created"}}},
+		{name: "private address", req: &entities.CreateWebhookEndpointReq{URL: "http://10.0.0.5/hook", Events: []string{"link.created"}}},
+		{name: "unknown event", req: &entities.CreateWebhookEndpointReq{URL: "https://hooks.example.com", Events: []string{"link.exploded"}}},
+		{name: "event that is never emitted", req: &entities.CreateWebhookEndpointReq{URL: "https://hooks.example.com", Events: []string{"link.created", "link.expired"}}},
+		{name: "no events", req: &entities.CreateWebhookEndpointReq{URL: "https://hooks.example.com"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := webhooks.CreateEndpoint(ctx, tc.req)
+			assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+		})
+	}
+}
+
+func TestWebhookService_CreateEndpointSubscribes(t *testing.T) {
+
+	now := utcTime("2026-10-18T10:00:00Z")
+	webhooks, mockRepo := newTestWebhookService(now)
+	ctx := context.Background()
+
+	mockRepo.On("CreateEndpoint", ctx, mock.MatchedBy(func(endpoint *model.WebhookEndpoint) bool {
+		return len(endpoint.Secret) == len("whsec_")+64 &&
+			assert.ObjectsAreEqual([]string{"link.created", "link.deleted"}, []string(endpoint.Events))
+	})).Return(&model.WebhookEndpoint{ID: 3, URL: "https://hooks.example.com/in", Secret: "whsec_test", Events: []string{"link.created", "link.deleted"}}, nil)
+
+	res, err := webhooks.CreateEndpoint(ctx, &entities.CreateWebhookEndpointReq{
+		URL:    " https://hooks.example.com/in ",
+		Events: []string{"link.created", " LINK.DELETED", "link.created"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), res.Id)
+	assert.Equal(t, "whsec_test", res.Secret)
+	assert.True(t, webhooks.isSubscribed(model.WebhookEventLinkDeleted))
+	assert.False(t, webhooks.isSubscribed(model.WebhookEventLinkClicked))
+
+	mockRepo.On("DeleteEndpoint", ctx, uint(3)).Return(nil)
+	mockRepo.On("DeleteEndpoint", ctx, uint(4)).Return(errors.New("no webhook endpoint found with the given id"))
+
+	assert.NoError(t, webhooks.DeleteEndpoint(ctx, 3))
+	assert.False(t, webhooks.isSubscribed(model.WebhookEventLinkDeleted))
+
+	err = webhooks.DeleteEndpoint(ctx, 4)
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWebhookService_EmitLogsSubscribedEvents(t *testing.T) {
+
+	now := utcTime("2026-10-18T10:00:00Z")
+	webhooks, mockRepo := newTestWebhookService(now, &model.WebhookEndpoint{ID: 1, Events: []string{model.WebhookEventLinkThresholdReached}})
+	ctx := context.Background()
+
+	var payload []byte
+	mockRepo.On("EnqueueDeliveries", mock.Anything, mock.AnythingOfType("string"), model.WebhookEventLinkThresholdReached, mock.Anything, now).
+		Run(func(args mock.Arguments) { payload = args.Get(3).([]byte) }).
+		Return(int64(1), nil).Once()
+
+	url := &model.URL{ID: 7, ShortCode: "abc123", OriginalURL: "https://example.com", ClickCount: 100}
+	webhooks.Emit(ctx, model.WebhookEventLinkThresholdReached, url, &entities.WebhookEventDataRes{Threshold: 100})
+	webhooks.Emit(ctx, model.WebhookEventLinkCreated, url, nil)
+
+	event := decodeWebhookEvent(t, payload)
+	assert.Regexp(t, "^evt_[0-9a-f]{32}$", event.Id)
+	assert.Equal(t, model.WebhookEventLinkThresholdReached, event.Type)
+	assert.Equal(t, 100, event.Data.Threshold)
+	assert.Equal(t, "7", event.Data.Link.Id)
+	assert.Equal(t, "http://localhost:8080/abc123", event.Data.Link.ShortUrl)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWebhookService_LinkClickedIsSampled(t *testing.T) {
+
+	now := utcTime("2026-10-18T10:00:00Z")
+	webhooks, mockRepo := newTestWebhookService(now, &model.WebhookEndpoint{ID: 1, Events: []string{model.WebhookEventLinkClicked}})
+	ctx := context.Background()
+	url := &model.URL{ID: 7, ShortCode: "abc123"}
+
+	var payload []byte
+	mockRepo.On("EnqueueDeliveries", mock.Anything, mock.Anything, model.WebhookEventLinkClicked, mock.Anything, now).
+		Run(func(args mock.Arguments) { payload = args.Get(3).([]byte) }).
+		Return(int64(1), nil).Once()
+
+	human := &model.ClickEvent{URLID: 7, ClickedAt: now, ReferrerHost: "t.co", Country: "TH", Source: model.ClickSourceDirect}
+
+	webhooks.LinkClicked(ctx, url, human)
+	webhooks.LinkClicked(ctx, url, &model.ClickEvent{URLID: 7, ClickedAt: now, IsBot: true})
+
+	webhooks.sample = func() float64 { return 0.5 }
+	webhooks.LinkClicked(ctx, url, human)
+
+	event := decodeWebhookEvent(t, payload)
+	assert.Equal(t, "t.co", event.Data.Click.Referrer)
+	assert.Equal(t, "TH", event.Data.Click.Country)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWebhookService_RunOnceSignsAndDelivers(t *testing.T) {
+
+	now := utcTime("2026-10-18T10:00:00Z")
+	webhooks, mockRepo := newTestWebhookService(now)
+	ctx := context.Background()
+	payload := []byte(`{"id":"evt_1","type":"link.created"}`)
+
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, payload, body)
+		received <- r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	webhooks.client = server.Client()
+
+	mockRepo.On("ClaimDueDeliveries", ctx, now, now.Add(time.Second*6), 10).
+		Return([]*model.WebhookDeliveryTarget{{
+			WebhookDelivery: model.WebhookDelivery{ID: 9, EventID: "evt_1", EventType: "link.created", Payload: payload, Status: model.WebhookDeliveryPending},
+			URL:             server.URL,
+			Secret:          "whsec_test",
+		}}, nil)
+	mockRepo.On("SaveDeliveryAttempt", mock.Anything, mock.MatchedBy(func(delivery *model.WebhookDelivery) bool {
+		return delivery.Status == model.WebhookDeliverySucceeded && delivery.Attempts == 1 &&
+			delivery.LastStatusCode == http.StatusNoContent && delivery.LastError == ""
+	})).Return(nil)
+
+	assert.NoError(t, webhooks.RunOnce(ctx))
+
+	req := <-received
+	timestamp := req.Header.Get("X-Webhook-Timestamp")
+	assert.Equal(t, "1792317600", timestamp)
+	assert.Equal(t, "evt_1", req.Header.Get("X-Webhook-Id"))
+	assert.Equal(t, "9", req.Header.Get("X-Webhook-Delivery"))
+	assert.Equal(t, webhookSignature("whsec_test", timestamp, payload), req.Header.Get("X-Webhook-Signature"))
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWebhookService_FailedAttemptsBackOffThenGiveUp(t *testing.T) {
+
+	now := utcTime("2026-10-18T10:00:00Z")
+	webhooks, mockRepo := newTestWebhookService(now)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	webhooks.client = server.Client()
+
+	retrying := &model.WebhookDeliveryTarget{WebhookDelivery: model.WebhookDelivery{ID: 1, Attempts: 1}, URL: server.URL}
+	exhausted := &model.WebhookDeliveryTarget{WebhookDelivery: model.WebhookDelivery{ID: 2, Attempts: 2}, URL: server.URL}
+
+	mockRepo.On("SaveDeliveryAttempt", mock.Anything, mock.MatchedBy(func(delivery *model.WebhookDelivery) bool {
+		return delivery.ID == 1 && delivery.Status == model.WebhookDeliveryPending && delivery.Attempts == 2 &&
+			delivery.NextAttemptAt.Equal(now.Add(time.Minute*2)) && delivery.LastError == "endpoint responded 503 Service Unavailable"
+	})).Return(nil).Once()
+	mockRepo.On("SaveDeliveryAttempt", mock.Anything, mock.MatchedBy(func(delivery *model.WebhookDelivery) bool {
+		return delivery.ID == 2 && delivery.Status == model.WebhookDeliveryFailed && delivery.Attempts == 3
+	})).Return(nil).Once()
+
+	webhooks.deliver(ctx, retrying)
+	webhooks.deliver(ctx, exhausted)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWebhookBackoff(t *testing.T) {
+
+	assert.Equal(t, time.Second*30, webhookBackoff(time.Second*30, time.Hour, 1))
+	assert.Equal(t, time.Minute*4, webhookBackoff(time.Second*30, time.Hour, 4))
+	assert.Equal(t, time.Hour, webhookBackoff(time.Second*30, time.Hour, 40))
+}
+
+func TestWebhookService_ListAndReplayDeliveries(t *testing.T) {
+
+	now := utcTime("2026-10-18T10:00:00Z")
+	webhooks, mockRepo := newTestWebhookService(now)
+	ctx := context.Background()
+
+	_, err := webhooks.ListDeliveries(ctx, 1, &entities.WebhookDeliveriesReq{Status: "lost"})
+	assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+
+	_, err = webhooks.ListDeliveries(ctx, 1, &entities.WebhookDeliveriesReq{Limit: 500})
+	assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type)
+
+	mockRepo.On("ListDeliveries", ctx, uint(1), model.WebhookDeliveryFailed, defaultWebhookDeliveriesLimit).
+		Return([]*model.WebhookDelivery{{ID: 4, Status: model.WebhookDeliveryFailed, Payload: []byte(`{}`)}}, nil)
+
+	deliveries, err := webhooks.ListDeliveries(ctx, 1, &entities.WebhookDeliveriesReq{Status: model.WebhookDeliveryFailed})
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Nil(t, deliveries[0].NextAttemptAt)
+
+	original := int64(4)
+	mockRepo.On("ReplayDelivery", ctx, int64(4), now).
+		Return(&model.WebhookDelivery{ID: 5, Status: model.WebhookDeliveryPending, NextAttemptAt: now, ReplayOf: &original}, nil)
+	mockRepo.On("ReplayDelivery", ctx, int64(99), now).
+		Return(nil, sql.ErrNoRows)
+
+	replay, err := webhooks.ReplayDelivery(ctx, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), *replay.ReplayOf)
+	assert.Equal(t, now, *replay.NextAttemptAt)
+
+	_, err = webhooks.ReplayDelivery(ctx, 99)
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestClickRecorder_EmitsCrossedThresholds(t *testing.T) {
+
+	cfg := testCfg()
+	cfg.Analytics.QueueSize = 10
+	cfg.Analytics.Workers = 1
+	cfg.Analytics.BatchSize = 10
+	cfg.Analytics.FlushInterval = time.Hour
+	cfg.Webhook.ClickThresholds = []int{100, 1000}
+
+	mockClickRepo := new(repository.MockClickRepository)
+	webhooks, mockWebhookRepo := newTestWebhookService(time.Now(), &model.WebhookEndpoint{ID: 1, Events: []string{model.WebhookEventLinkThresholdReached}})
+	recorder := NewClickRecorder(mockClickRepo, NewBotClassifier(cfg), NewClickHub(cfg), webhooks, newTestSalts(cfg), cfg)
+	ctx := context.Background()
+
+	recorder.Record(ctx, &model.URL{ID: 1}, nil)
+	recorder.Record(ctx, &model.URL{ID: 1}, nil)
+	recorder.Record(ctx, &model.URL{ID: 2}, nil)
+
+	mockClickRepo.On("InsertClickEvents", mock.Anything, mock.Anything).Return(nil)
+	mockClickRepo.On("AddClickCounts", mock.Anything, map[uint]int{1: 2, 2: 1}).
+		Return([]*model.URL{{ID: 1, ShortCode: "crossed", ClickCount: 101}, {ID: 2, ShortCode: "below", ClickCount: 99}}, nil)
+
+	var payload []byte
+	mockWebhookRepo.On("EnqueueDeliveries", mock.Anything, mock.Anything, model.WebhookEventLinkThresholdReached, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { payload = args.Get(3).([]byte) }).
+		Return(int64(1), nil).Once()
+
+	assert.NoError(t, recorder.Close(ctx))
+
+	event := decodeWebhookEvent(t, payload)
+	assert.Equal(t, "crossed", event.Data.Link.ShortCode)
+	assert.Equal(t, 100, event.Data.Threshold)
+
+	mockWebhookRepo.AssertExpectations(t)
+}
+
+func TestClickRecorder_EmitsClickWebhooksOnFlush(t *testing.T) {
+
+	cfg := testCfg()
+	cfg.Analytics.QueueSize = 10
+	cfg.Analytics.Workers = 1
+	cfg.Analytics.BatchSize = 10
+	cfg.Analytics.FlushInterval = time.Hour
+
+	mockClickRepo := new(repository.MockClickRepository)
+	webhooks, mockWebhookRepo := newTestWebhookService(time.Now(), &model.WebhookEndpoint{ID: 1, Events: []string{model.WebhookEventLinkClicked}})
+	recorder := NewClickRecorder(mockClickRepo, NewBotClassifier(cfg), NewClickHub(cfg), webhooks, newTestSalts(cfg), cfg)
+	ctx := context.Background()
+
+	human := &entities.ClickInfo{UserAgent: testBrowserUserAgent, IP: "203.0.113.7", Referrer: "https://t.co/x", Method: "GET"}
+	recorder.Record(ctx, &model.URL{ID: 1, ShortCode: "abc123"}, human)
+	recorder.Record(ctx, &model.URL{ID: 1, ShortCode: "abc123"}, &entities.ClickInfo{UserAgent: "curl/8.0", Method: "GET"})
+
+	// Recording a click is the redirect path, nothing may be written for it yet
+	mockWebhookRepo.AssertNotCalled(t, "EnqueueDeliveries", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	mockClickRepo.On("InsertClickEvents", mock.Anything, mock.Anything).Return(nil)
+	mockClickRepo.On("AddClickCounts", mock.Anything, map[uint]int{1: 1}).Return([]*model.URL{}, nil)
+	mockClickRepo.On("MergeVisitorSketch", mock.Anything, uint(1), mock.Anything, mock.Anything).Return(nil)
+
+	var payload []byte
+	mockWebhookRepo.On("EnqueueDeliveries", mock.Anything, mock.Anything, model.WebhookEventLinkClicked, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { payload = args.Get(3).([]byte) }).
+		Return(int64(1), nil).Once()
+
+	assert.NoError(t, recorder.Close(ctx))
+
+	event := decodeWebhookEvent(t, payload)
+	assert.Equal(t, "abc123", event.Data.Link.ShortCode)
+	assert.Equal(t, "t.co", event.Data.Click.Referrer)
+	assert.NotContains(t, string(payload), "203.0.113.7")
+
+	mockClickRepo.AssertExpectations(t)
+	mockWebhookRepo.AssertExpectations(t)
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"log"
+	"regexp"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+)
+
+var workspacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+func isValidWorkspace(workspace string) bool {
+	return workspacePattern.MatchString(workspace)
+}
+
+// workspaceLogoKey is where a workspace's logo is kept in the blob store; an upload overwrites the last one
+func workspaceLogoKey(workspace string) string {
+	return "logos/" + workspace + ".png"
+}
+
+// SaveWorkspaceLogo checks an uploaded PNG or JPEG and stores it re-encoded as PNG, which also drops any metadata it carried
+func (s *urlService) SaveWorkspaceLogo(pctx context.Context, workspace string, upload []byte) (*entities.WorkspaceLogoRes, error) {
+
+	if !isValidWorkspace(workspace) {
+		return nil, appErrors.NewInvalidInputError("workspace must be lowercase letters, digits or dashes")
+	}
+	if len(upload) == 0 {
+		return nil, appErrors.NewInvalidInputError("logo is empty")
+	}
+	if len(upload) > s.cfg.QrCode.LogoMaxBytes {
+		return nil, appErrors.NewInvalidInputError(fmt.Sprintf("logo must be at most %d bytes", s.cfg.QrCode.LogoMaxBytes))
+	}
+
+	decoded, config, err := decodeUploadedImage(upload, "logo must be a PNG or JPEG image", func(config image.Config) error {
+		if config.Width > s.cfg.QrCode.LogoMaxDimension || config.Height > s.cfg.QrCode.LogoMaxDimension {
+			return appErrors.NewInvalidInputError(fmt.Sprintf("logo must be at most %d pixels per side", s.cfg.QrCode.LogoMaxDimension))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, decoded); err != nil {
+		log.Printf("Error: failed to encode logo of workspace %s %s", workspace, err.Error())
+		return nil, appErrors.NewInternalError("failed to store logo", err)
+	}
+
+	key := workspaceLogoKey(workspace)
+	if err := s.blobs.Put(pctx, key, &encoded, "image/png"); err != nil {
+		log.Printf("Error: failed to store logo of workspace %s %s", workspace, err.Error())
+		return nil, appErrors.NewInternalError("failed to store logo", err)
+	}
+
+	saved, err := s.repo.SaveWorkspaceLogo(pctx, &model.WorkspaceLogo{
+		Workspace: workspace,
+		ImageKey:  key,
+		Width:     config.Width,
+		Height:    config.Height,
+	})
+	if err != nil {
+		log.Printf("Error: failed to save logo of workspace %s %s", workspace, err.Error())
+		return nil, appErrors.NewInternalError("failed to store logo", err)
+	}
+
+	return &entities.WorkspaceLogoRes{
+		Workspace: saved.Workspace,
+		Width:     saved.Width,
+		Height:    saved.Height,
+		UpdatedAt: saved.UpdatedAt,
+	}, nil
+}
+
+func (s *urlService) DeleteWorkspaceLogo(pctx context.Context, workspace string) error {
+
+	deleted, err := s.repo.DeleteWorkspaceLogo(pctx, workspace)
+	if err != nil {
+		log.Printf("Error: failed to delete logo of workspace %s %s", workspace, err.Error())
+		return appErrors.NewInternalError("failed to delete logo", err)
+	}
+	if !deleted {
+		return appErrors.NewNotFoundError("workspace has no logo")
+	}
+
+	// The row is what makes a logo exist, so a blob left behind is only logged
+	if err := s.blobs.Delete(pctx, workspaceLogoKey(workspace)); err != nil {
+		log.Printf("Error: failed to delete stored logo of workspace %s %s", workspace, err.Error())
+	}
+
+	return nil
+}
+
+// workspaceLogo loads the logo a QR code asks for and returns it with a digest, so variants drawn with
+// an older logo are not reused once it is replaced
+func (s *urlService) workspaceLogo(pctx context.Context, workspace string) (image.Image, string, error) {
+
+	logo, err := s.repo.GetWorkspaceLogo(pctx, workspace)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", appErrors.NewNotFoundError("workspace has no logo")
+	}
+	if err != nil {
+		log.Printf("Error: failed to load logo of workspace %s %s", workspace, err.Error())
+		return nil, "", appErrors.NewInternalError("failed to load logo", err)
+	}
+
+	data := logo.Image
+	if logo.ImageKey != "" {
+		if data, err = s.readBlob(pctx, logo.ImageKey); err != nil {
+			log.Printf("Error: failed to read logo of workspace %s %s", workspace, err.Error())
+			return nil, "", appErrors.NewInternalError("failed to load logo", err)
+		}
+	}
+
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Error: failed to decode logo of workspace %s %s", workspace, err.Error())
+		return nil, "", appErrors.NewInternalError("failed to load logo", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return decoded, hex.EncodeToString(sum[:8]), nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+
+	"shorten-url/internal/entities"
+	appErrors "shorten-url/internal/errors"
+	"shorten-url/internal/model"
+	"shorten-url/internal/repository"
+	"shorten-url/pkg/blobstore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func encodeTestPNG(t *testing.T, width int, height int) []byte {
+
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))))
+	return buf.Bytes()
+}
+
+func TestSaveWorkspaceLogo_Validation(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		workspace string
+		upload    []byte
+	}{
+		{"bad workspace", "Acme Inc", encodeTestPNG(t, 10, 10)},
+		{"empty", "acme", nil},
+		{"not an image", "acme", []byte("GIF89a not really")},
+		{"too many pixels", "acme", encodeTestPNG(t, 1025, 10)},
+		{"too many bytes", "acme", make([]byte, (1<<20)+1)},
+	}
+
+	for _, tt := range tests {
+		_, err := service.SaveWorkspaceLogo(ctx, tt.workspace, tt.upload)
+		assert.Equal(t, appErrors.InvalidInput, err.(*appErrors.AppError).Type, tt.name)
+	}
+
+	mockRepo.AssertNotCalled(t, "SaveWorkspaceLogo", mock.Anything, mock.Anything)
+}
+
+func TestSaveWorkspaceLogo_StoresPNG(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo).(*urlService)
+	ctx := context.Background()
+
+	mockRepo.On("SaveWorkspaceLogo", ctx, mock.MatchedBy(func(logo *model.WorkspaceLogo) bool {
+		return logo.Workspace == "acme" && logo.ImageKey == "logos/acme.png" && logo.Image == nil && logo.Width == 40 && logo.Height == 20
+	})).Return(&model.WorkspaceLogo{Workspace: "acme", ImageKey: "logos/acme.png", Width: 40, Height: 20}, nil)
+
+	res, err := service.SaveWorkspaceLogo(ctx, "acme", encodeTestPNG(t, 40, 20))
+
+	assert.NoError(t, err)
+	assert.Equal(t, &entities.WorkspaceLogoRes{Workspace: "acme", Width: 40, Height: 20}, res)
+	mockRepo.AssertExpectations(t)
+
+	stored, err := service.readBlob(ctx, "logos/acme.png")
+	assert.NoError(t, err)
+	_, err = png.Decode(bytes.NewReader(stored))
+	assert.NoError(t, err)
+}
+
+func TestDeleteWorkspaceLogo(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo).(*urlService)
+	ctx := context.Background()
+
+	assert.NoError(t, service.blobs.Put(ctx, "logos/acme.png", bytes.NewReader(encodeTestPNG(t, 10, 10)), "image/png"))
+
+	mockRepo.On("DeleteWorkspaceLogo", ctx, "acme").Return(true, nil).Once()
+	assert.NoError(t, service.DeleteWorkspaceLogo(ctx, "acme"))
+
+	_, err := service.blobs.Get(ctx, "logos/acme.png")
+	assert.ErrorIs(t, err, blobstore.ErrNotFound)
+
+	mockRepo.On("DeleteWorkspaceLogo", ctx, "acme").Return(false, nil).Once()
+	err = service.DeleteWorkspaceLogo(ctx, "acme")
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+
+	mockRepo.On("DeleteWorkspaceLogo", ctx, "acme").Return(false, errors.New("database error")).Once()
+	err = service.DeleteWorkspaceLogo(ctx, "acme")
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+}
+
+func TestGetQrCode_WorkspaceLogo(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo)
+	ctx := context.Background()
+
+	qrCodeTestLink(mockRepo, "qr-logo")
+
+	mockRepo.On("GetWorkspaceLogo", ctx, "nologo").Return(nil, sql.ErrNoRows)
+
+	_, err := service.GetQrCode(ctx, "qr-logo", &entities.QrCodeReq{Workspace: "nologo"})
+	assert.Equal(t, appErrors.NotFound, err.(*appErrors.AppError).Type)
+
+	mockRepo.On("GetWorkspaceLogo", ctx, "acme").Return(&model.WorkspaceLogo{Workspace: "acme", Image: encodeTestPNG(t, 40, 40)}, nil)
+	mockRepo.On("GetQrCode", ctx, uint(1)).Return(nil, sql.ErrNoRows).Once()
+	mockRepo.On("SaveQrCode", ctx, mock.AnythingOfType("*model.Qrcode")).Return(&model.Qrcode{ID: 5, URLID: 1}, nil).Once()
+
+	res, err := service.GetQrCode(ctx, "qr-logo", &entities.QrCodeReq{Workspace: "acme", Frame: "box"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/shorten/qr-logo/qrcode/image?frame=box&workspace=acme", res.QrCodeURL)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetQrCodeImage_StoredWorkspaceLogo(t *testing.T) {
+	mockRepo := new(repository.MockURLRepository)
+	service := newTestService(mockRepo).(*urlService)
+	ctx := context.Background()
+
+	qrCodeTestCode(mockRepo, qrCodeTestLink(mockRepo, "qr-brand"))
+
+	mockRepo.On("GetWorkspaceLogo", ctx, "brand").Return(&model.WorkspaceLogo{Workspace: "brand", ImageKey: "logos/brand.png"}, nil)
+
+	// A row whose blob has gone missing cannot be drawn
+	_, err := service.GetQrCodeImage(ctx, "qr-brand", &entities.QrCodeReq{Workspace: "brand"}, "")
+	assert.Equal(t, appErrors.Internal, err.(*appErrors.AppError).Type)
+
+	assert.NoError(t, service.blobs.Put(ctx, "logos/brand.png", bytes.NewReader(encodeTestPNG(t, 40, 40)), "image/png"))
+
+	res, err := service.GetQrCodeImage(ctx, "qr-brand", &entities.QrCodeReq{Workspace: "brand"}, "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, res.Data)
+}
@@ -0,0 +1,53 @@
+// Package blobstore keeps generated and uploaded files behind one interface, so they can live on the
+// local filesystem, in memory or in S3-compatible object storage such as MinIO.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Get when nothing is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys that are not slash separated names of letters, digits, dots, dashes and underscores
+var ErrInvalidKey = errors.New("invalid blob key")
+
+type BlobStore interface {
+	// Put stores everything read from r under key, replacing what was there
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens the blob under key; the caller closes it
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes the blob under key and succeeds when there is none
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that downloads the blob without any other credentials until expiry has passed
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// Object is an open blob
+type Object struct {
+	io.ReadCloser
+	ContentType string
+	Size        int64
+}
+
+var keySegment = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// ValidKey reports whether key can be stored by every backend; segments made only of dots are refused
+// so a key can never climb out of the filesystem store's directory
+func ValidKey(key string) bool {
+
+	if key == "" {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if !keySegment.MatchString(segment) || strings.Trim(segment, ".") == "" {
+			return false
+		}
+	}
+	return true
+}
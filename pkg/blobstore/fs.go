@@ -0,0 +1,108 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// fileStore keeps each blob as a file under dir. Files carry no metadata, so the content type is
+// worked out again from the key's extension when a blob is read.
+type fileStore struct {
+	dir    string
+	signer *URLSigner
+}
+
+func NewFileStore(dir string, signer *URLSigner) BlobStore {
+	return &fileStore{
+		dir:    dir,
+		signer: signer,
+	}
+}
+
+// Put writes to a temporary file next to the target and renames it, so readers never see half a blob
+func (s *fileStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+
+	target := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+func (s *fileStore) Get(ctx context.Context, key string) (*Object, error) {
+
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	file, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return &Object{ReadCloser: file, ContentType: contentType, Size: info.Size()}, nil
+}
+
+func (s *fileStore) Delete(ctx context.Context, key string) error {
+
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *fileStore) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	return s.signer.Sign(key, expiry), nil
+}
+
+func (s *fileStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
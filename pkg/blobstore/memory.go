@@ -0,0 +1,90 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps blobs in a map; it is meant for tests and single instance development setups
+type memoryStore struct {
+	signer *URLSigner
+
+	mu    sync.RWMutex
+	blobs map[string]memoryBlob
+}
+
+type memoryBlob struct {
+	data        []byte
+	contentType string
+}
+
+func NewMemoryStore(signer *URLSigner) BlobStore {
+	return &memoryStore{
+		signer: signer,
+		blobs:  make(map[string]memoryBlob),
+	}
+}
+
+func (s *memoryStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blobs[key] = memoryBlob{data: data, contentType: contentType}
+	return nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) (*Object, error) {
+
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	blob, ok := s.blobs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	// Stored slices are never written to again, so readers can share them
+	return &Object{
+		ReadCloser:  io.NopCloser(bytes.NewReader(blob.data)),
+		ContentType: blob.contentType,
+		Size:        int64(len(blob.data)),
+	}, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.blobs, key)
+	return nil
+}
+
+func (s *memoryStore) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	return s.signer.Sign(key, expiry), nil
+}
@@ -0,0 +1,117 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3PartSize bounds the memory a Put of unknown length takes; the client would otherwise size parts
+// for the largest object S3 accepts
+const s3PartSize = 16 << 20
+
+// S3Options reach a bucket on AWS S3 or any compatible server, e.g. localhost:9000 for a local MinIO
+type S3Options struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// s3Store keeps blobs as objects and hands out presigned GET URLs, so downloads bypass the application
+type s3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Store connects to the bucket, creating it when it does not exist yet
+func NewS3Store(pctx context.Context, opts S3Options) (BlobStore, error) {
+
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(pctx, opts.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach bucket %s: %w", opts.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(pctx, opts.Bucket, minio.MakeBucketOptions{Region: opts.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", opts.Bucket, err)
+		}
+	}
+
+	return &s3Store{
+		client: client,
+		bucket: opts.Bucket,
+	}, nil
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, -1, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s3PartSize,
+	})
+	return err
+}
+
+// Get stats the object first, since GetObject itself only fails on the first read
+func (s *s3Store) Get(ctx context.Context, key string) (*Object, error) {
+
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &Object{ReadCloser: object, ContentType: info.ContentType, Size: info.Size}, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *s3Store) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+
+	signed, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return signed.String(), nil
+}
@@ -0,0 +1,58 @@
+package blobstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URLSigner makes and checks the download URLs of the filesystem and memory stores, which the
+// application serves itself; a URL is an HMAC of its key and expiry
+type URLSigner struct {
+	baseURL string
+	secret  []byte
+	now     func() time.Time
+}
+
+// NewURLSigner signs URLs under baseURL, e.g. https://sho.rt/blobs
+func NewURLSigner(baseURL string, secret []byte) *URLSigner {
+	return &URLSigner{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+		now:     time.Now,
+	}
+}
+
+// Sign returns the URL of key, valid until expiry has passed
+func (s *URLSigner) Sign(key string, expiry time.Duration) string {
+
+	expires := strconv.FormatInt(s.now().Add(expiry).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.signature(key, expires))
+
+	return s.baseURL + "/" + key + "?" + query.Encode()
+}
+
+// Verify reports whether signature was made for key and expires, and whether that time is still ahead
+func (s *URLSigner) Verify(key string, expires string, signature string) bool {
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || s.now().Unix() > unix {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(s.signature(key, expires)))
+}
+
+func (s *URLSigner) signature(key string, expires string) string {
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,92 @@
+package hll
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// Precision 12 keeps a sketch at 4 KiB with a standard error of about 1.6%
+const (
+	Precision = 12
+
+	registerCount = 1 << Precision
+	version       = 1
+)
+
+var ErrInvalidSketch = errors.New("invalid hyperloglog sketch")
+
+// Sketch is a HyperLogLog cardinality estimator; it only ever stores register maxima, never the items
+type Sketch struct {
+	registers []uint8
+}
+
+func New() *Sketch {
+	return &Sketch{registers: make([]uint8, registerCount)}
+}
+
+// FromBytes decodes a sketch written by Bytes
+func FromBytes(data []byte) (*Sketch, error) {
+
+	if len(data) != registerCount+2 || data[0] != version || data[1] != Precision {
+		return nil, ErrInvalidSketch
+	}
+
+	sketch := New()
+	copy(sketch.registers, data[2:])
+	return sketch, nil
+}
+
+// Bytes encodes the sketch as a version byte, the precision and the registers
+func (s *Sketch) Bytes() []byte {
+
+	data := make([]byte, 0, registerCount+2)
+	data = append(data, version, Precision)
+	return append(data, s.registers...)
+}
+
+// AddHash records an item by its 64-bit hash, which must be uniformly distributed
+func (s *Sketch) AddHash(hash uint64) {
+
+	index := hash >> (64 - Precision)
+	rank := uint8(bits.LeadingZeros64(hash<<Precision|1<<(Precision-1))) + 1
+
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+	}
+}
+
+// Merge folds another sketch into this one, giving the estimate of the union
+func (s *Sketch) Merge(other *Sketch) {
+
+	for i, rank := range other.registers {
+		if rank > s.registers[i] {
+			s.registers[i] = rank
+		}
+	}
+}
+
+// Count estimates the number of distinct items added
+func (s *Sketch) Count() uint64 {
+
+	m := float64(registerCount)
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	sum := 0.0
+	zeros := 0
+	for _, rank := range s.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha * m * m / sum
+
+	// Linear counting is far more accurate while many registers are still empty
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(math.Round(estimate))
+}
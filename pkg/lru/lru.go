@@ -0,0 +1,93 @@
+// Package lru is a size-bounded least-recently-used cache that is safe for concurrent use.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache evicts the least recently used entries once it holds more than maxEntries entries
+// or more than maxBytes bytes, as reported by the size function; a zero bound is not enforced
+type Cache[K comparable, V any] struct {
+	maxEntries int
+	maxBytes   int64
+	size       func(V) int64
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[K]*list.Element
+	bytes   int64
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+	size  int64
+}
+
+func New[K comparable, V any](maxEntries int, maxBytes int64, size func(V) int64) *Cache[K, V] {
+	return &Cache[K, V]{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		size:       size,
+		order:      list.New(),
+		entries:    make(map[K]*list.Element),
+	}
+}
+
+// Get returns the cached value and marks it as recently used
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*entry[K, V]).value, true
+	}
+
+	var zero V
+	return zero, false
+}
+
+// Add stores a value, evicting older ones as needed; a value larger than maxBytes on its own is not kept
+func (c *Cache[K, V]) Add(key K, value V) {
+
+	var size int64
+	if c.size != nil {
+		size = c.size(value)
+	}
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.removeElement(element)
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, size: size})
+	c.bytes += size
+
+	for (c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// Len returns the number of cached entries
+func (c *Cache[K, V]) Len() int {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *Cache[K, V]) removeElement(element *list.Element) {
+
+	e := c.order.Remove(element).(*entry[K, V])
+	delete(c.entries, e.key)
+	c.bytes -= e.size
+}
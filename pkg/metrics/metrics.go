@@ -0,0 +1,337 @@
+// Package metrics keeps counters, histograms and gauges in memory and writes them
+// in the Prometheus text exposition format (version 0.0.4).
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets suits request latencies, in seconds
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Default is the registry the application's metrics are declared on
+var Default = NewRegistry()
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds every metric in registration order; names must be unique
+type Registry struct {
+	mu         sync.RWMutex
+	names      map[string]struct{}
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		names: make(map[string]struct{}),
+	}
+}
+
+func (r *Registry) register(name string, c collector) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.names[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = struct{}{}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes every metric in the text exposition format
+func (r *Registry) WriteTo(w io.Writer) error {
+
+	r.mu.RLock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	buf := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	return buf.Flush()
+}
+
+// Handler serves the registry to scrapers
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteTo(w)
+	})
+}
+
+// vec keeps one child per distinct label value combination
+type vec[T any] struct {
+	name     string
+	help     string
+	kind     string
+	labels   []string
+	mu       sync.RWMutex
+	children map[string]*child[T]
+	create   func() *T
+}
+
+type child[T any] struct {
+	values []string
+	metric *T
+}
+
+func (v *vec[T]) with(values []string) *T {
+
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	c, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return c.metric
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if c, ok := v.children[key]; ok {
+		return c.metric
+	}
+	c = &child[T]{values: append([]string(nil), values...), metric: v.create()}
+	v.children[key] = c
+	return c.metric
+}
+
+// sorted returns the children ordered by label values so scrapes are stable
+func (v *vec[T]) sorted() []*child[T] {
+
+	v.mu.RLock()
+	children := make([]*child[T], 0, len(v.children))
+	for _, c := range v.children {
+		children = append(children, c)
+	}
+	v.mu.RUnlock()
+
+	sort.Slice(children, func(i, j int) bool {
+		return strings.Join(children[i].values, "\xff") < strings.Join(children[j].values, "\xff")
+	})
+	return children
+}
+
+func (v *vec[T]) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+}
+
+// floatValue is a float64 updated atomically
+type floatValue struct {
+	bits atomic.Uint64
+}
+
+func (f *floatValue) add(delta float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (f *floatValue) load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// CounterVec is a monotonically increasing value per label combination
+type CounterVec struct {
+	vec vec[floatValue]
+}
+
+func (r *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+
+	c := &CounterVec{vec: vec[floatValue]{
+		name:     name,
+		help:     help,
+		kind:     "counter",
+		labels:   labels,
+		children: make(map[string]*child[floatValue]),
+		create:   func() *floatValue { return new(floatValue) },
+	}}
+	r.register(name, c)
+	return c
+}
+
+func (c *CounterVec) Inc(values ...string) {
+	c.vec.with(values).add(1)
+}
+
+// Add increases the counter; negative deltas are ignored
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta > 0 {
+		c.vec.with(values).add(delta)
+	}
+}
+
+// Init creates a series at zero so it is exported before the first increment
+func (c *CounterVec) Init(values ...string) {
+	c.vec.with(values)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+
+	c.vec.header(w)
+	for _, child := range c.vec.sorted() {
+		writeSample(w, c.vec.name, c.vec.labels, child.values, "", "", child.metric.load())
+	}
+}
+
+// HistogramVec counts observations into cumulative buckets per label combination
+type HistogramVec struct {
+	vec     vec[histogram]
+	buckets []float64
+}
+
+type histogram struct {
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    floatValue
+}
+
+func (r *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{buckets: buckets}
+	h.vec = vec[histogram]{
+		name:     name,
+		help:     help,
+		kind:     "histogram",
+		labels:   labels,
+		children: make(map[string]*child[histogram]),
+		create:   func() *histogram { return &histogram{counts: make([]atomic.Uint64, len(buckets))} },
+	}
+	r.register(name, h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, values ...string) {
+
+	child := h.vec.with(values)
+
+	// Only the first bucket that fits is counted; buckets are made cumulative when written
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		child.counts[i].Add(1)
+	}
+	child.count.Add(1)
+	child.sum.add(value)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+
+	h.vec.header(w)
+	for _, child := range h.vec.sorted() {
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += child.metric.counts[i].Load()
+			writeSample(w, h.vec.name+"_bucket", h.vec.labels, child.values, "le", formatFloat(upper), float64(cumulative))
+		}
+		count := child.metric.count.Load()
+		writeSample(w, h.vec.name+"_bucket", h.vec.labels, child.values, "le", "+Inf", float64(count))
+		writeSample(w, h.vec.name+"_sum", h.vec.labels, child.values, "", "", child.metric.sum.load())
+		writeSample(w, h.vec.name+"_count", h.vec.labels, child.values, "", "", float64(count))
+	}
+}
+
+// funcMetric reads its value when scraped, for state that is already tracked elsewhere
+type funcMetric struct {
+	name string
+	help string
+	kind string
+	fn   func() float64
+}
+
+// NewGaugeFunc exports a value that can go up and down, read from fn on every scrape
+func (r *Registry) NewGaugeFunc(name string, help string, fn func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, kind: "gauge", fn: fn})
+}
+
+// NewCounterFunc exports a cumulative value kept elsewhere, read from fn on every scrape
+func (r *Registry) NewCounterFunc(name string, help string, fn func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, kind: "counter", fn: fn})
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	writeSample(w, f.name, nil, nil, "", "", f.fn())
+}
+
+func writeSample(w *bufio.Writer, name string, labels []string, values []string, extraLabel string, extraValue string, value float64) {
+
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label)
+			w.WriteString(`="`)
+			w.WriteString(escapeLabel(values[i]))
+			w.WriteByte('"')
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraLabel)
+			w.WriteString(`="`)
+			w.WriteString(extraValue)
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(value float64) string {
+
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
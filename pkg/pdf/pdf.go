@@ -0,0 +1,394 @@
+// Package pdf writes small PDF 1.4 documents made of filled shapes, text in the
+// standard Helvetica fonts and raster images, without any dependency outside the
+// standard library.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Document is a list of pages written out in order; units are points (1/72 inch).
+// WriteTo writes a document built in memory; Stream instead writes each page out as soon as the next one
+// is added, so long documents never have to be held whole.
+type Document struct {
+	pages  []*Page
+	images []*Image
+
+	// out is set once writing has started; objects are numbered as they are written, except the catalog
+	// and the page tree, which come first and last
+	out         *countingWriter
+	offsets     []int64
+	fontObjects map[Font]int
+	pageObjects []int
+	imageCount  int
+	streaming   bool
+}
+
+// Page records drawing operators; the origin is the bottom left corner
+type Page struct {
+	doc     *Document
+	width   float64
+	height  float64
+	content bytes.Buffer
+	fonts   map[Font]struct{}
+	images  map[*Image]struct{}
+}
+
+// Image is a raster added once to a document and drawn on any of its pages
+type Image struct {
+	name   string
+	object int
+	width  int
+	height int
+	rgb    []byte
+	alpha  []byte
+}
+
+var errStreaming = errors.New("pdf: document is being streamed")
+
+func NewDocument() *Document {
+	return &Document{}
+}
+
+// AddPage appends an empty page of the given size. A streamed document writes out the page before it.
+func (d *Document) AddPage(width float64, height float64) *Page {
+
+	if d.streaming && len(d.pages) > 0 {
+		d.writePage(d.pages[0])
+		d.pages = d.pages[:0]
+	}
+
+	page := &Page{
+		doc:    d,
+		width:  width,
+		height: height,
+		fonts:  make(map[Font]struct{}),
+		images: make(map[*Image]struct{}),
+	}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// AddImage stores img compressed; an alpha channel is kept only when some pixel is not opaque.
+// A streamed document writes it out at once.
+func (d *Document) AddImage(img image.Image) *Image {
+
+	bounds := img.Bounds()
+	rgb := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	alpha := make([]byte, 0, bounds.Dx()*bounds.Dy())
+	opaque := true
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			opaque = opaque && c.A == 0xff
+		}
+	}
+
+	d.imageCount++
+	added := &Image{
+		name:   "Im" + strconv.Itoa(d.imageCount),
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		rgb:    deflate(rgb),
+	}
+	if !opaque {
+		added.alpha = deflate(alpha)
+	}
+
+	if d.streaming {
+		d.writeImage(added)
+		return added
+	}
+	d.images = append(d.images, added)
+	return added
+}
+
+// SetFillColor sets the color later shapes and text are filled with
+func (p *Page) SetFillColor(c color.Color) {
+
+	r, g, b, _ := c.RGBA()
+	fmt.Fprintf(&p.content, "%s %s %s rg\n", channel(r), channel(g), channel(b))
+}
+
+// Rect adds a rectangle to the current path
+func (p *Page) Rect(x float64, y float64, width float64, height float64) {
+	fmt.Fprintf(&p.content, "%s %s %s %s re\n", number(x), number(y), number(width), number(height))
+}
+
+// Fill paints the current path with the fill color and starts a new one
+func (p *Page) Fill() {
+	p.content.WriteString("f\n")
+}
+
+// Text writes one line with its baseline starting at x, y; characters outside printable ASCII are shown as '?'
+func (p *Page) Text(font Font, size float64, x float64, y float64, text string) {
+
+	p.fonts[font] = struct{}{}
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n", font.resourceName(), number(size), number(x), number(y), escapeText(text))
+}
+
+// DrawImage scales img into the rectangle whose bottom left corner is at x, y
+func (p *Page) DrawImage(img *Image, x float64, y float64, width float64, height float64) {
+
+	p.images[img] = struct{}{}
+	fmt.Fprintf(&p.content, "q %s 0 0 %s %s %s cm /%s Do Q\n", number(width), number(height), number(x), number(y), img.name)
+}
+
+// WriteTo writes the document with its cross-reference table
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+
+	if d.out != nil {
+		return 0, errStreaming
+	}
+
+	d.begin(w)
+	for _, img := range d.images {
+		d.writeImage(img)
+	}
+	for _, page := range d.pages {
+		d.writePage(page)
+	}
+	err := d.finish()
+	return d.out.n, err
+}
+
+// Stream starts writing the document to w; pages are written as they are completed and Close ends the
+// document. Pages already added are written with the next one.
+func (d *Document) Stream(w io.Writer) error {
+
+	if d.out != nil {
+		return errStreaming
+	}
+
+	d.begin(w)
+	for _, img := range d.images {
+		d.writeImage(img)
+	}
+	d.images = nil
+	for len(d.pages) > 1 {
+		d.writePage(d.pages[0])
+		d.pages = d.pages[1:]
+	}
+	d.streaming = true
+	return d.out.err
+}
+
+// Close writes the last page of a streamed document and ends it
+func (d *Document) Close() error {
+
+	if !d.streaming {
+		return errors.New("pdf: document is not being streamed")
+	}
+
+	for _, page := range d.pages {
+		d.writePage(page)
+	}
+	d.pages = nil
+	d.streaming = false
+	return d.finish()
+}
+
+// begin writes the header and reserves the catalog and the page tree, which are written by finish
+func (d *Document) begin(w io.Writer) {
+
+	d.out = &countingWriter{w: bufio.NewWriter(w)}
+	d.offsets = make([]int64, 2)
+	d.fontObjects = make(map[Font]int)
+
+	d.out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+}
+
+// reserve hands out the next object number; the object may be written later
+func (d *Document) reserve() int {
+
+	d.offsets = append(d.offsets, 0)
+	return len(d.offsets)
+}
+
+func (d *Document) object(number int, body func()) {
+
+	d.offsets[number-1] = d.out.n
+	fmt.Fprintf(d.out, "%d 0 obj\n", number)
+	body()
+	d.out.WriteString("\nendobj\n")
+}
+
+func (d *Document) stream(number int, dict string, data []byte) {
+
+	d.object(number, func() {
+		fmt.Fprintf(d.out, "<< %s /Length %d >>\nstream\n", dict, len(data))
+		d.out.Write(data)
+		d.out.WriteString("\nendstream")
+	})
+}
+
+func (d *Document) writeImage(img *Image) {
+
+	img.object = d.reserve()
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode", img.width, img.height)
+	if img.alpha == nil {
+		d.stream(img.object, dict, img.rgb)
+		return
+	}
+
+	mask := d.reserve()
+	d.stream(img.object, dict+fmt.Sprintf(" /SMask %d 0 R", mask), img.rgb)
+	d.stream(mask, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode", img.width, img.height), img.alpha)
+
+	// The compressed pixels are in the file now; only the name and object number are still needed
+	img.rgb, img.alpha = nil, nil
+}
+
+func (d *Document) writePage(page *Page) {
+
+	for _, font := range sortedFonts(page.fonts) {
+		if _, ok := d.fontObjects[font]; !ok {
+			d.fontObjects[font] = d.reserve()
+		}
+	}
+
+	images := make([]*Image, 0, len(page.images))
+	for img := range page.images {
+		images = append(images, img)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].object < images[j].object })
+
+	object := d.reserve()
+	content := d.reserve()
+	d.pageObjects = append(d.pageObjects, object)
+
+	d.object(object, func() {
+		fmt.Fprintf(d.out, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << ", number(page.width), number(page.height))
+		if len(page.fonts) > 0 {
+			d.out.WriteString("/Font <<")
+			for _, font := range sortedFonts(page.fonts) {
+				fmt.Fprintf(d.out, " /%s %d 0 R", font.resourceName(), d.fontObjects[font])
+			}
+			d.out.WriteString(" >> ")
+		}
+		if len(images) > 0 {
+			d.out.WriteString("/XObject <<")
+			for _, img := range images {
+				fmt.Fprintf(d.out, " /%s %d 0 R", img.name, img.object)
+			}
+			d.out.WriteString(" >> ")
+		}
+		fmt.Fprintf(d.out, ">> /Contents %d 0 R >>", content)
+	})
+	d.stream(content, "", page.content.Bytes())
+}
+
+// finish writes the fonts, the page tree, the catalog and the cross-reference table
+func (d *Document) finish() error {
+
+	fonts := make([]Font, 0, len(d.fontObjects))
+	for font := range d.fontObjects {
+		fonts = append(fonts, font)
+	}
+	sort.Slice(fonts, func(i, j int) bool { return fonts[i] < fonts[j] })
+	for _, font := range fonts {
+		d.object(d.fontObjects[font], func() {
+			fmt.Fprintf(d.out, "<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font)
+		})
+	}
+
+	d.object(2, func() {
+		d.out.WriteString("<< /Type /Pages /Kids [")
+		for _, page := range d.pageObjects {
+			fmt.Fprintf(d.out, " %d 0 R", page)
+		}
+		fmt.Fprintf(d.out, " ] /Count %d >>", len(d.pageObjects))
+	})
+	d.object(1, func() { d.out.WriteString("<< /Type /Catalog /Pages 2 0 R >>") })
+
+	xref := d.out.n
+	fmt.Fprintf(d.out, "xref\n0 %d\n0000000000 65535 f \n", len(d.offsets)+1)
+	for _, offset := range d.offsets {
+		fmt.Fprintf(d.out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(d.out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.offsets)+1, xref)
+
+	if d.out.err != nil {
+		return d.out.err
+	}
+	return d.out.w.Flush()
+}
+
+// countingWriter tracks byte offsets for the cross-reference table and keeps the first write error
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func (c *countingWriter) WriteString(s string) (int, error) {
+	return c.Write([]byte(s))
+}
+
+func sortedFonts(set map[Font]struct{}) []Font {
+
+	fonts := make([]Font, 0, len(set))
+	for font := range set {
+		fonts = append(fonts, font)
+	}
+	sort.Slice(fonts, func(i, j int) bool { return fonts[i] < fonts[j] })
+	return fonts
+}
+
+func deflate(data []byte) []byte {
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+
+func escapeText(text string) string {
+	return textEscaper.Replace(printable(text))
+}
+
+// printable replaces what the standard fonts cannot be relied on to show
+func printable(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return '?'
+		}
+		return r
+	}, text)
+}
+
+func number(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1000)/1000, 'f', -1, 64)
+}
+
+func channel(value uint32) string {
+	return strconv.FormatFloat(float64(value)/0xffff, 'f', 3, 64)
+}
@@ -0,0 +1,48 @@
+package qrimage
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	captionFontOnce sync.Once
+	captionFont     *opentype.Font
+)
+
+// drawCaption centers text in box with the bundled Go Bold font, size in pixels
+func drawCaption(img draw.Image, box image.Rectangle, text string, size float64, c color.Color) {
+
+	captionFontOnce.Do(func() {
+		captionFont, _ = opentype.Parse(gobold.TTF)
+	})
+	if captionFont == nil || size < 1 {
+		return
+	}
+
+	face, err := opentype.NewFace(captionFont, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return
+	}
+	defer face.Close()
+
+	drawer := &font.Drawer{Dst: img, Src: image.NewUniform(c), Face: face}
+
+	// The width is measured with another font than SVG and PDF use, so it is checked again here
+	width := drawer.MeasureString(text).Ceil()
+	if width > box.Dx() {
+		return
+	}
+
+	metrics := face.Metrics()
+	baseline := box.Min.Y + (box.Dy()+metrics.CapHeight.Ceil())/2
+	drawer.Dot = fixed.P(box.Min.X+(box.Dx()-width)/2, baseline)
+	drawer.DrawString(text)
+}
@@ -0,0 +1,60 @@
+package qrimage
+
+import (
+	"image"
+
+	"github.com/makiuchi-d/gozxing"
+	multiqrcode "github.com/makiuchi-d/gozxing/multi/qrcode"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+var tryHarder = map[gozxing.DecodeHintType]interface{}{
+	gozxing.DecodeHintType_TRY_HARDER: true,
+}
+
+// Decode reads the QR code in img and returns the text it encodes
+func Decode(img image.Image) (string, error) {
+
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := qrcode.NewQRCodeReader().Decode(bitmap, tryHarder)
+	if err != nil {
+		return "", err
+	}
+	return result.GetText(), nil
+}
+
+// DecodeAll reads every QR code in img and returns the texts they encode, or none when there is no
+// readable code. A code that appears twice, as on a proof of a sheet, is returned twice.
+func DecodeAll(img image.Image) ([]string, error) {
+
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := multiqrcode.NewQRCodeMultiReader().DecodeMultiple(bitmap, tryHarder)
+	if _, ok := err.(gozxing.ReaderException); ok {
+		// The multi reader skips finder patterns it cannot group; a lone code may still be read whole
+		text, err := Decode(img)
+		if _, ok := err.(gozxing.ReaderException); ok {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []string{text}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make([]string, 0, len(results))
+	for _, result := range results {
+		texts = append(texts, result.GetText())
+	}
+	return texts, nil
+}
@@ -0,0 +1,319 @@
+// Package qrimage draws a QR code module matrix as PNG, SVG or PDF, optionally with
+// a centered logo and a frame carrying a caption.
+package qrimage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+
+	"shorten-url/pkg/pdf"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	FrameNone    = ""
+	FrameCaption = "caption"
+	FrameBox     = "box"
+)
+
+// Options describe the drawing. Size is the width in pixels for PNG and SVG and in points for PDF;
+// frames make the drawing taller than it is wide.
+type Options struct {
+	Size       int
+	Margin     int
+	Foreground color.Color
+	Background color.Color
+
+	// Logo covers LogoArea, a fraction of the symbol, in the middle of the code; the modules under it are left out
+	Logo     image.Image
+	LogoArea float64
+
+	Frame   string
+	Caption string
+}
+
+// rect is an area in module units, y growing downwards
+type rect struct {
+	x, y, w, h float64
+}
+
+// layout places every part of the drawing in module units
+type layout struct {
+	width   int
+	height  int
+	code    rect
+	margin  int
+	modules int
+
+	// cleared is the square of symbol modules under the logo, from its first row and column
+	clearedFrom int
+	clearedTo   int
+	logo        rect
+
+	band       rect
+	captionFg  color.Color
+	fontModule float64
+}
+
+func newLayout(bitmap [][]bool, opts Options) layout {
+
+	l := layout{modules: len(bitmap), margin: opts.Margin}
+
+	// A frame drawn right against the symbol would stop readers from finding its edge
+	if opts.Frame == FrameBox && l.margin < 2 {
+		l.margin = 2
+	}
+	side := l.modules + l.margin*2
+
+	l.code = rect{0, 0, float64(side), float64(side)}
+	l.width, l.height = side, side
+
+	if opts.Logo != nil && opts.LogoArea > 0 {
+		cleared := int(math.Round(float64(l.modules) * math.Sqrt(opts.LogoArea)))
+		if (l.modules-cleared)%2 != 0 {
+			cleared--
+		}
+		if cleared > 2 {
+			l.clearedFrom = (l.modules - cleared) / 2
+			l.clearedTo = l.clearedFrom + cleared
+
+			// Half a module of background is kept around the logo
+			start := float64(l.margin+l.clearedFrom) + 0.5
+			l.logo = fitRect(opts.Logo.Bounds(), rect{start, start, float64(cleared) - 1, float64(cleared) - 1})
+		}
+	}
+
+	if opts.Frame == FrameNone {
+		return l
+	}
+
+	band := max(4, int(math.Round(float64(side)*0.18)))
+	l.captionFg = opts.Foreground
+
+	if opts.Frame == FrameBox {
+		border := max(1, int(math.Round(float64(side)/30)))
+		l.code.x, l.code.y = float64(border), float64(border)
+		l.width = side + border*2
+		l.height = side + border + band
+		l.captionFg = opts.Background
+	} else {
+		l.height = side + band
+	}
+	l.band = rect{0, float64(l.height - band), float64(l.width), float64(band)}
+
+	// The caption takes a little over half the band, less when that would not fit across
+	l.fontModule = float64(band) * 0.55
+	if width := pdf.TextWidth(pdf.HelveticaBold, l.fontModule, opts.Caption); width > float64(l.width)*0.9 {
+		l.fontModule *= float64(l.width) * 0.9 / width
+	}
+
+	return l
+}
+
+// dark reports whether the module at x, y is drawn, which it is not under the logo
+func (l layout) dark(bitmap [][]bool, x int, y int) bool {
+
+	if l.clearedTo > 0 && x >= l.clearedFrom && x < l.clearedTo && y >= l.clearedFrom && y < l.clearedTo {
+		return false
+	}
+	return bitmap[y][x]
+}
+
+// runs calls fn for every horizontal run of dark modules, in module units from the drawing's top left corner
+func (l layout) runs(bitmap [][]bool, fn func(x int, y int, length int)) {
+
+	offsetX, offsetY := int(l.code.x)+l.margin, int(l.code.y)+l.margin
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !l.dark(bitmap, x, y) {
+				continue
+			}
+			start := x
+			for x < len(row) && l.dark(bitmap, x, y) {
+				x++
+			}
+			fn(offsetX+start, offsetY+y, x-start)
+		}
+	}
+}
+
+// fitRect centers an image of the given bounds in box, keeping its aspect ratio
+func fitRect(bounds image.Rectangle, box rect) rect {
+
+	scale := math.Min(box.w/float64(bounds.Dx()), box.h/float64(bounds.Dy()))
+	w, h := float64(bounds.Dx())*scale, float64(bounds.Dy())*scale
+	return rect{box.x + (box.w-w)/2, box.y + (box.h-h)/2, w, h}
+}
+
+// Image rasterizes the drawing; every module takes a whole number of pixels and the drawing is
+// centered, growing the image when Size cannot fit one pixel per module
+func Image(bitmap [][]bool, opts Options) image.Image {
+
+	l := newLayout(bitmap, opts)
+
+	scale := max(1, opts.Size/l.width)
+	width := max(opts.Size, l.width*scale)
+	pad := (width - l.width*scale) / 2
+	height := l.height*scale + pad*2
+
+	px := func(r rect) image.Rectangle {
+		return image.Rect(
+			pad+int(math.Round(r.x*float64(scale))),
+			pad+int(math.Round(r.y*float64(scale))),
+			pad+int(math.Round((r.x+r.w)*float64(scale))),
+			pad+int(math.Round((r.y+r.h)*float64(scale))),
+		)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	fg, bg := image.NewUniform(opts.Foreground), image.NewUniform(opts.Background)
+
+	if opts.Frame == FrameBox {
+		draw.Draw(img, img.Bounds(), fg, image.Point{}, draw.Src)
+		draw.Draw(img, px(l.code), bg, image.Point{}, draw.Src)
+	} else {
+		draw.Draw(img, img.Bounds(), bg, image.Point{}, draw.Src)
+	}
+
+	l.runs(bitmap, func(x int, y int, length int) {
+		draw.Draw(img, px(rect{float64(x), float64(y), float64(length), 1}), fg, image.Point{}, draw.Src)
+	})
+
+	if l.logo.w > 0 {
+		xdraw.CatmullRom.Scale(img, px(l.logo), opts.Logo, opts.Logo.Bounds(), xdraw.Over, nil)
+	}
+
+	if l.band.h > 0 && opts.Caption != "" {
+		drawCaption(img, px(l.band), opts.Caption, l.fontModule*float64(scale), l.captionFg)
+	}
+
+	return img
+}
+
+// PNG encodes the rasterized drawing
+func PNG(w io.Writer, bitmap [][]bool, opts Options) error {
+	return png.Encode(w, Image(bitmap, opts))
+}
+
+// SVG draws in module units, so the code stays sharp at any print size
+func SVG(w io.Writer, bitmap [][]bool, opts Options) error {
+
+	l := newLayout(bitmap, opts)
+	height := int(math.Round(float64(opts.Size) * float64(l.height) / float64(l.width)))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, height, l.width, l.height)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`, l.width, l.height, hexColor(opts.Background))
+
+	if opts.Frame == FrameBox {
+		fmt.Fprintf(&buf, `<path fill="%s" fill-rule="evenodd" d="M0 0h%dv%dh-%dzM%g %gh%gv%gh-%gz"/>`, hexColor(opts.Foreground),
+			l.width, l.height, l.width, l.code.x, l.code.y, l.code.w, l.code.h, l.code.w)
+	}
+
+	// Runs of dark modules in a row become one rectangle
+	fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(opts.Foreground))
+	l.runs(bitmap, func(x int, y int, length int) {
+		fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x, y, length, length)
+	})
+	buf.WriteString(`"/>`)
+
+	if l.logo.w > 0 {
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, opts.Logo); err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, `<image x="%s" y="%s" width="%s" height="%s" preserveAspectRatio="xMidYMid meet" href="data:image/png;base64,%s"/>`,
+			svgNumber(l.logo.x), svgNumber(l.logo.y), svgNumber(l.logo.w), svgNumber(l.logo.h), base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+
+	if l.band.h > 0 && opts.Caption != "" {
+		fmt.Fprintf(&buf, `<text x="%s" y="%s" fill="%s" font-family="Helvetica, Arial, sans-serif" font-weight="bold" font-size="%s" text-anchor="middle" shape-rendering="auto">%s</text>`,
+			svgNumber(l.band.x+l.band.w/2), svgNumber(l.band.y+l.band.h/2+l.fontModule*0.35), hexColor(l.captionFg), svgNumber(l.fontModule), html.EscapeString(opts.Caption))
+	}
+
+	buf.WriteString(`</svg>`)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// PDF draws a single page Size points wide with the code as vector rectangles
+func PDF(w io.Writer, bitmap [][]bool, opts Options) error {
+
+	doc := pdf.NewDocument()
+	page := doc.AddPage(float64(opts.Size), Height(bitmap, opts, float64(opts.Size)))
+	Draw(doc, page, bitmap, opts, 0, 0, float64(opts.Size))
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// Height returns how tall a drawing of the given width is, frame included
+func Height(bitmap [][]bool, opts Options, width float64) float64 {
+
+	l := newLayout(bitmap, opts)
+	return width * float64(l.height) / float64(l.width)
+}
+
+// Draw paints the drawing, background included, width points wide with its bottom left corner at x, y
+func Draw(doc *pdf.Document, page *pdf.Page, bitmap [][]bool, opts Options, x float64, y float64, width float64) {
+
+	l := newLayout(bitmap, opts)
+	unit := width / float64(l.width)
+	height := float64(l.height) * unit
+
+	// PDF grows upwards, the layout downwards
+	fill := func(r rect) {
+		page.Rect(x+r.x*unit, y+height-(r.y+r.h)*unit, r.w*unit, r.h*unit)
+	}
+
+	page.SetFillColor(opts.Background)
+	fill(rect{0, 0, float64(l.width), float64(l.height)})
+	page.Fill()
+
+	page.SetFillColor(opts.Foreground)
+	if opts.Frame == FrameBox {
+		fill(rect{0, 0, float64(l.width), l.code.y})
+		fill(rect{0, l.code.y, l.code.x, l.code.h})
+		fill(rect{l.code.x + l.code.w, l.code.y, float64(l.width) - l.code.x - l.code.w, l.code.h})
+		fill(rect{0, l.code.y + l.code.h, float64(l.width), float64(l.height) - l.code.y - l.code.h})
+	}
+	l.runs(bitmap, func(mx int, my int, length int) {
+		fill(rect{float64(mx), float64(my), float64(length), 1})
+	})
+	page.Fill()
+
+	if l.logo.w > 0 {
+		page.DrawImage(doc.AddImage(opts.Logo), x+l.logo.x*unit, y+height-(l.logo.y+l.logo.h)*unit, l.logo.w*unit, l.logo.h*unit)
+	}
+
+	if l.band.h > 0 && opts.Caption != "" {
+		size := l.fontModule * unit
+		textWidth := pdf.TextWidth(pdf.HelveticaBold, size, opts.Caption)
+		baseline := y + height - (l.band.y+l.band.h/2)*unit - size*0.35
+
+		page.SetFillColor(l.captionFg)
+		page.Text(pdf.HelveticaBold, size, x+(l.band.x+l.band.w/2)*unit-textWidth/2, baseline, opts.Caption)
+	}
+}
+
+func hexColor(c color.Color) string {
+
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+func svgNumber(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1000)/1000, 'f', -1, 64)
+}
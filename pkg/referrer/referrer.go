@@ -0,0 +1,91 @@
+package referrer
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	ChannelDirect = "Direct"
+)
+
+// channels maps registrable domains to the friendly name reported in stats
+var channels = map[string]string{
+	"google":         "Google",
+	"bing.com":       "Bing",
+	"duckduckgo.com": "DuckDuckGo",
+	"yahoo.com":      "Yahoo",
+	"yandex":         "Yandex",
+	"baidu.com":      "Baidu",
+	"naver.com":      "Naver",
+	"facebook.com":   "Facebook",
+	"fb.me":          "Facebook",
+	"messenger.com":  "Facebook",
+	"instagram.com":  "Instagram",
+	"t.co":           "Twitter",
+	"twitter.com":    "Twitter",
+	"x.com":          "Twitter",
+	"linkedin.com":   "LinkedIn",
+	"lnkd.in":        "LinkedIn",
+	"reddit.com":     "Reddit",
+	"youtube.com":    "YouTube",
+	"youtu.be":       "YouTube",
+	"tiktok.com":     "TikTok",
+	"pinterest.com":  "Pinterest",
+	"line.me":        "LINE",
+	"whatsapp.com":   "WhatsApp",
+	"telegram.org":   "Telegram",
+	"t.me":           "Telegram",
+	"slack.com":      "Slack",
+	"discord.com":    "Discord",
+}
+
+// Host returns the lower-cased referrer host without common mobile and www prefixes
+func Host(rawReferrer string) string {
+
+	rawReferrer = strings.TrimSpace(rawReferrer)
+	if rawReferrer == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(rawReferrer)
+	if err != nil || parsed.Hostname() == "" {
+		return ""
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	for _, prefix := range []string{"www.", "m.", "l.", "lm.", "mobile."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+
+	return host
+}
+
+// Channel maps a referrer host to a friendly channel name, falling back to the host itself
+func Channel(host string) string {
+
+	if host == "" {
+		return ChannelDirect
+	}
+
+	labels := strings.Split(host, ".")
+	for i := 0; i < len(labels)-1; i++ {
+		if channel, ok := channels[strings.Join(labels[i:], ".")]; ok {
+			return channel
+		}
+	}
+
+	// Search engines run on many country domains such as google.co.th. Only the label registered under a public
+	// suffix counts, so google.evil.com and google.github.io, under a private suffix, are reported as they are
+	suffix, icann := publicsuffix.PublicSuffix(host)
+	if icann && strings.HasSuffix(host, "."+suffix) {
+		registrable := strings.TrimSuffix(host, "."+suffix)
+		if channel, ok := channels[registrable[strings.LastIndex(registrable, ".")+1:]]; ok {
+			return channel
+		}
+	}
+
+	return host
+}
@@ -0,0 +1,110 @@
+package useragent
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+
+	Unknown = "Unknown"
+)
+
+// Agent is the parsed form of a User-Agent header
+type Agent struct {
+	Browser        string
+	BrowserVersion string
+	OS             string
+	Device         string
+	IsBot          bool
+}
+
+type browserRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// Order matters: many browsers embed the tokens of the ones they are based on
+var browserRules = []browserRule{
+	{name: "Edge", pattern: regexp.MustCompile(`(?:Edg|Edge|EdgA|EdgiOS)/([\d.]+)`)},
+	{name: "Opera", pattern: regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`)},
+	{name: "Samsung Internet", pattern: regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+	{name: "Yandex", pattern: regexp.MustCompile(`YaBrowser/([\d.]+)`)},
+	{name: "UC Browser", pattern: regexp.MustCompile(`UCBrowser/([\d.]+)`)},
+	{name: "Facebook", pattern: regexp.MustCompile(`(?:FBAV|FB_IAB)/([\d.]+)`)},
+	{name: "Instagram", pattern: regexp.MustCompile(`Instagram ([\d.]+)`)},
+	{name: "LINE", pattern: regexp.MustCompile(`Line/([\d.]+)`)},
+	{name: "Firefox", pattern: regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+	{name: "Chrome", pattern: regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+	{name: "Safari", pattern: regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+	{name: "Internet Explorer", pattern: regexp.MustCompile(`(?:MSIE |Trident/.*rv:)([\d.]+)`)},
+	{name: "curl", pattern: regexp.MustCompile(`curl/([\d.]+)`)},
+}
+
+type osRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+var osRules = []osRule{
+	{name: "iOS", pattern: regexp.MustCompile(`iPhone|iPad|iPod`)},
+	{name: "Android", pattern: regexp.MustCompile(`Android`)},
+	{name: "Windows", pattern: regexp.MustCompile(`Windows`)},
+	{name: "ChromeOS", pattern: regexp.MustCompile(`CrOS`)},
+	{name: "macOS", pattern: regexp.MustCompile(`Macintosh|Mac OS X`)},
+	{name: "Linux", pattern: regexp.MustCompile(`Linux|X11`)},
+}
+
+var botPattern = regexp.MustCompile(`(?i)bot\b|bot/|crawler|spider|slurp|facebookexternalhit|embedly|preview|headless|python-requests|go-http-client|wget|curl/|httpclient|monitor|pingdom|uptime`)
+
+var tabletPattern = regexp.MustCompile(`(?i)iPad|Tablet|Kindle|Silk/|PlayBook`)
+
+var mobilePattern = regexp.MustCompile(`(?i)Mobi|iPhone|iPod|Android.*Mobile|Windows Phone|BlackBerry|Opera Mini`)
+
+// Parse extracts browser, operating system and device class from a User-Agent header
+func Parse(userAgent string) Agent {
+
+	userAgent = strings.TrimSpace(userAgent)
+	if userAgent == "" {
+		return Agent{Browser: Unknown, OS: Unknown, Device: DeviceUnknown}
+	}
+
+	agent := Agent{Browser: Unknown, OS: Unknown}
+
+	for _, rule := range browserRules {
+		if match := rule.pattern.FindStringSubmatch(userAgent); match != nil {
+			agent.Browser = rule.name
+			agent.BrowserVersion = match[1]
+			break
+		}
+	}
+
+	for _, rule := range osRules {
+		if rule.pattern.MatchString(userAgent) {
+			agent.OS = rule.name
+			break
+		}
+	}
+
+	switch {
+	case botPattern.MatchString(userAgent):
+		agent.IsBot = true
+		agent.Device = DeviceBot
+	case tabletPattern.MatchString(userAgent):
+		agent.Device = DeviceTablet
+	case strings.Contains(userAgent, "Android") && !strings.Contains(userAgent, "Mobile"):
+		// Android tablets drop the Mobile token that phones send
+		agent.Device = DeviceTablet
+	case mobilePattern.MatchString(userAgent):
+		agent.Device = DeviceMobile
+	default:
+		agent.Device = DeviceDesktop
+	}
+
+	return agent
+}